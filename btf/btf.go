@@ -10,6 +10,7 @@ import (
 	"io"
 	"math"
 	"os"
+	"path/filepath"
 	"reflect"
 
 	"github.com/cilium/ebpf/internal"
@@ -94,7 +95,7 @@ func LoadSpecFromReader(rd io.ReaderAt) (*Spec, error) {
 		if bo := guessRawBTFByteOrder(rd); bo != nil {
 			// Try to parse a naked BTF blob. This will return an error if
 			// we encounter a Datasec, since we can't fix it up.
-			spec, err := loadRawSpec(io.NewSectionReader(rd, 0, math.MaxInt64), bo, nil, nil)
+			spec, err := loadRawSpec(io.NewSectionReader(rd, 0, math.MaxInt64), bo, nil, nil, nil)
 			return spec, err
 		}
 
@@ -199,11 +200,52 @@ func loadSpecFromELF(file *internal.SafeELFFile) (*Spec, error) {
 		return nil, fmt.Errorf("compressed BTF is not supported")
 	}
 
-	return loadRawSpec(btfSection.ReaderAt, file.ByteOrder, sectionSizes, vars)
+	return loadRawSpec(btfSection.ReaderAt, file.ByteOrder, nil, sectionSizes, vars)
 }
 
-func loadRawSpec(btf io.ReaderAt, bo binary.ByteOrder, sectionSizes map[string]uint32, variableOffsets map[variable]uint32) (*Spec, error) {
-	rawTypes, rawStrings, err := parseBTF(btf, bo)
+// LoadSplitSpecFromReader reads split BTF from a raw blob. Split BTF, such as
+// the BTF of kernel modules, only contains the types which aren't already part
+// of base.
+//
+// The returned Spec contains the types of base followed by the types of the
+// split BTF, with type IDs continuing after the last type of base.
+func LoadSplitSpecFromReader(r io.ReaderAt, base *Spec) (*Spec, error) {
+	return loadRawSpec(r, base.byteOrder, base, nil, nil)
+}
+
+// LoadKernelModuleSpec returns the BTF of a kernel module, which is split BTF
+// on top of the kernel's BTF in base.
+//
+// Reads from /sys/kernel/btf/<module>. Returns an error wrapping
+// os.ErrNotExist if the kernel doesn't provide BTF for the module.
+func LoadKernelModuleSpec(module string, base *Spec) (*Spec, error) {
+	fh, err := os.Open(filepath.Join("/sys/kernel/btf", module))
+	if err != nil {
+		return nil, err
+	}
+	defer fh.Close()
+
+	spec, err := LoadSplitSpecFromReader(fh, base)
+	if err != nil {
+		return nil, fmt.Errorf("module %s: %w", module, err)
+	}
+
+	return spec, nil
+}
+
+// loadRawSpec parses a raw BTF blob. base is the Spec the blob is split from,
+// or nil.
+func loadRawSpec(btf io.ReaderAt, bo binary.ByteOrder, base *Spec, sectionSizes map[string]uint32, variableOffsets map[variable]uint32) (*Spec, error) {
+	var (
+		baseStrings *stringTable
+		baseTypes   []Type
+	)
+	if base != nil {
+		baseStrings = base.strings
+		baseTypes = base.types
+	}
+
+	rawTypes, rawStrings, err := parseBTF(btf, bo, baseStrings)
 	if err != nil {
 		return nil, err
 	}
@@ -213,7 +255,7 @@ func loadRawSpec(btf io.ReaderAt, bo binary.ByteOrder, sectionSizes map[string]u
 		return nil, err
 	}
 
-	types, err := inflateRawTypes(rawTypes, rawStrings)
+	types, err := inflateRawTypes(rawTypes, rawStrings, baseTypes)
 	if err != nil {
 		return nil, err
 	}
@@ -263,7 +305,7 @@ func LoadKernelSpec() (*Spec, error) {
 	if err == nil {
 		defer fh.Close()
 
-		return loadRawSpec(fh, internal.NativeEndian, nil, nil)
+		return loadRawSpec(fh, internal.NativeEndian, nil, nil, nil)
 	}
 
 	file, err := findVMLinux()
@@ -353,14 +395,14 @@ func guessRawBTFByteOrder(r io.ReaderAt) binary.ByteOrder {
 
 // parseBTF reads a .BTF section into memory and parses it into a list of
 // raw types and a string table.
-func parseBTF(btf io.ReaderAt, bo binary.ByteOrder) ([]rawType, *stringTable, error) {
+func parseBTF(btf io.ReaderAt, bo binary.ByteOrder, baseStrings *stringTable) ([]rawType, *stringTable, error) {
 	buf := internal.NewBufferedSectionReader(btf, 0, math.MaxInt64)
 	header, err := parseBTFHeader(buf, bo)
 	if err != nil {
 		return nil, nil, fmt.Errorf("parsing .BTF header: %v", err)
 	}
 
-	rawStrings, err := readStringTable(io.NewSectionReader(btf, header.stringStart(), int64(header.StringLen)))
+	rawStrings, err := readStringTable(io.NewSectionReader(btf, header.stringStart(), int64(header.StringLen)), baseStrings)
 	if err != nil {
 		return nil, nil, fmt.Errorf("can't read type names: %w", err)
 	}
@@ -633,6 +675,41 @@ func (s *Spec) TypeByName(name string, typ interface{}) error {
 	return nil
 }
 
+// EnumValue returns the value of an element of the enum with the given name.
+//
+// Returns an error wrapping ErrNotFound if the enum or the element don't exist.
+func (s *Spec) EnumValue(enum, name string) (int32, error) {
+	values, err := s.EnumValues(enum)
+	if err != nil {
+		return 0, err
+	}
+
+	value, ok := values[name]
+	if !ok {
+		return 0, fmt.Errorf("enum %s: value %s: %w", enum, name, ErrNotFound)
+	}
+
+	return value, nil
+}
+
+// EnumValues returns the elements of the enum with the given name, keyed
+// by their name.
+//
+// Returns an error wrapping ErrNotFound if the enum doesn't exist.
+func (s *Spec) EnumValues(enum string) (map[string]int32, error) {
+	var typ *Enum
+	if err := s.TypeByName(enum, &typ); err != nil {
+		return nil, err
+	}
+
+	values := make(map[string]int32, len(typ.Values))
+	for _, v := range typ.Values {
+		values[v.Name] = v.Value
+	}
+
+	return values, nil
+}
+
 // TypesIterator iterates over types of a given spec.
 type TypesIterator struct {
 	spec  *Spec
@@ -663,10 +740,26 @@ type Handle struct {
 	fd   *sys.FD
 }
 
+// HandleOptions control loading BTF into the kernel.
+type HandleOptions struct {
+	// TokenFD is a BPF token delegated by a privileged process, which
+	// allows loading BTF without privileges. Zero doesn't use a token.
+	//
+	// Needs kernel 6.9+.
+	TokenFD int
+}
+
 // NewHandle loads BTF into the kernel.
 //
 // Returns ErrNotSupported if BTF is not supported.
 func NewHandle(spec *Spec) (*Handle, error) {
+	return NewHandleWithOptions(spec, HandleOptions{})
+}
+
+// NewHandleWithOptions loads BTF into the kernel.
+//
+// Returns ErrNotSupported if BTF is not supported.
+func NewHandleWithOptions(spec *Spec, opts HandleOptions) (*Handle, error) {
 	if err := haveBTF(); err != nil {
 		return nil, err
 	}
@@ -675,6 +768,10 @@ func NewHandle(spec *Spec) (*Handle, error) {
 		return nil, fmt.Errorf("can't load %s BTF on %s", spec.byteOrder, internal.NativeEndian)
 	}
 
+	if spec.strings.base != nil {
+		return nil, errors.New("can't load split BTF")
+	}
+
 	btf, err := spec.marshal(marshalOpts{
 		ByteOrder:        internal.NativeEndian,
 		StripFuncLinkage: haveFuncLinkage() != nil,
@@ -687,18 +784,29 @@ func NewHandle(spec *Spec) (*Handle, error) {
 		return nil, errors.New("BTF exceeds the maximum size")
 	}
 
-	attr := &sys.BtfLoadAttr{
-		Btf:     sys.NewSlicePointer(btf),
-		BtfSize: uint32(len(btf)),
+	attr := &sys.BtfLoadTokenAttr{
+		BtfLoadAttr: sys.BtfLoadAttr{
+			Btf:     sys.NewSlicePointer(btf),
+			BtfSize: uint32(len(btf)),
+		},
+	}
+
+	load := func() (*sys.FD, error) {
+		if opts.TokenFD == 0 {
+			return sys.BtfLoad(&attr.BtfLoadAttr)
+		}
+		attr.BtfFlags = sys.BPF_F_TOKEN_FD
+		attr.BtfTokenFd = int32(opts.TokenFD)
+		return sys.BtfLoadToken(attr)
 	}
 
-	fd, err := sys.BtfLoad(attr)
+	fd, err := load()
 	if err != nil {
 		logBuf := make([]byte, 64*1024)
 		attr.BtfLogBuf = sys.NewSlicePointer(logBuf)
 		attr.BtfLogSize = uint32(len(logBuf))
 		attr.BtfLogLevel = 1
-		_, logErr := sys.BtfLoad(attr)
+		_, logErr := load()
 		// NB: The syscall will never return ENOSPC as of 5.18-rc4.
 		return nil, internal.ErrorWithLog(err, logBuf, logErr)
 	}
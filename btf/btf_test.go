@@ -92,6 +92,37 @@ func TestTypeByNameAmbiguous(t *testing.T) {
 	})
 }
 
+func TestEnumValue(t *testing.T) {
+	spec, err := LoadSpecFromReader(readVMLinux(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	value, err := spec.EnumValue("bpf_map_type", "BPF_MAP_TYPE_HASH")
+	if err != nil {
+		t.Fatal("Can't get enum value:", err)
+	}
+	if value != 1 {
+		t.Error("Expected BPF_MAP_TYPE_HASH to be 1, got", value)
+	}
+
+	values, err := spec.EnumValues("bpf_map_type")
+	if err != nil {
+		t.Fatal("Can't get enum values:", err)
+	}
+	if values["BPF_MAP_TYPE_ARRAY"] != 2 {
+		t.Error("Expected BPF_MAP_TYPE_ARRAY to be 2, got", values["BPF_MAP_TYPE_ARRAY"])
+	}
+
+	if _, err := spec.EnumValue("bpf_map_type", "bogus"); !errors.Is(err, ErrNotFound) {
+		t.Error("Expected ErrNotFound for a missing value, got", err)
+	}
+
+	if _, err := spec.EnumValue("bogus", "BPF_MAP_TYPE_HASH"); !errors.Is(err, ErrNotFound) {
+		t.Error("Expected ErrNotFound for a missing enum, got", err)
+	}
+}
+
 func TestTypeByName(t *testing.T) {
 	spec, err := LoadSpecFromReader(readVMLinux(t))
 	if err != nil {
@@ -175,7 +206,7 @@ func BenchmarkParseVmlinux(b *testing.B) {
 			b.Fatal(err)
 		}
 
-		if _, err := loadRawSpec(rd, binary.LittleEndian, nil, nil); err != nil {
+		if _, err := loadRawSpec(rd, binary.LittleEndian, nil, nil, nil); err != nil {
 			b.Fatal("Can't load BTF:", err)
 		}
 	}
@@ -377,3 +408,112 @@ func TestTypesIterator(t *testing.T) {
 		t.Fatal("Cannot find 'iphdr' type")
 	}
 }
+
+func TestLoadSplitSpec(t *testing.T) {
+	var baseTypes struct {
+		Int     btfType
+		IntData uint32
+	}
+	baseTypes.Int.NameOff = 1
+	baseTypes.Int.SetKind(kindInt)
+	baseTypes.Int.SizeType = 4
+	baseTypes.IntData = 32
+
+	base, err := LoadSpecFromReader(bytes.NewReader(marshalBTF(&baseTypes, []byte("\x00int\x00"), internal.NativeEndian)))
+	if err != nil {
+		t.Fatal("Can't load base:", err)
+	}
+
+	// The string table of split BTF continues after the one of the base,
+	// so "foo" has offset 5.
+	var splitTypes struct {
+		Typedef btfType
+		Pointer btfType
+	}
+	splitTypes.Typedef.NameOff = 5
+	splitTypes.Typedef.SetKind(kindTypedef)
+	splitTypes.Typedef.SizeType = 1
+	splitTypes.Pointer.SetKind(kindPointer)
+	splitTypes.Pointer.SizeType = 2
+
+	split, err := LoadSplitSpecFromReader(bytes.NewReader(marshalBTF(&splitTypes, []byte("foo\x00"), internal.NativeEndian)), base)
+	if err != nil {
+		t.Fatal("Can't load split BTF:", err)
+	}
+
+	var typedef *Typedef
+	if err := split.TypeByName("foo", &typedef); err != nil {
+		t.Fatal(err)
+	}
+
+	if id, err := split.TypeID(typedef); err != nil || id != 2 {
+		t.Fatalf("Typedef has ID %d instead of 2 (error: %v)", id, err)
+	}
+
+	if typ, ok := typedef.Type.(*Int); !ok || typ.Name != "int" {
+		t.Fatalf("Typedef doesn't point at int from base: %v", typedef.Type)
+	}
+
+	ptr, err := split.TypeByID(3)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ptr.(*Pointer).Target != typedef {
+		t.Fatal("Pointer doesn't point at typedef")
+	}
+
+	if _, err := split.AnyTypeByName("int"); err != nil {
+		t.Fatal("Can't find type from base:", err)
+	}
+
+	if _, err := NewHandle(split); err == nil {
+		t.Fatal("NewHandle accepts split BTF")
+	}
+}
+
+func TestTypeNameByID(t *testing.T) {
+	var types struct {
+		Int     btfType
+		IntData uint32
+		Pointer btfType
+	}
+	types.Int.NameOff = 1
+	types.Int.SetKind(kindInt)
+	types.Int.SizeType = 4
+	types.IntData = 32
+	types.Pointer.SetKind(kindPointer)
+	types.Pointer.SizeType = 1
+
+	spec, err := LoadSpecFromReader(bytes.NewReader(marshalBTF(&types, []byte("\x00int\x00"), internal.NativeEndian)))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	handle, err := NewHandle(spec)
+	testutils.SkipIfNotSupported(t, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer handle.Close()
+
+	info, err := newInfoFromFd(handle.fd)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	name, err := TypeNameByID(info.ID, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if name != "int" {
+		t.Errorf("Expected int, got %q", name)
+	}
+
+	if name, err := TypeNameByID(info.ID, 2); err != nil || name != "" {
+		t.Errorf("Expected no name for pointer, got %q (error: %v)", name, err)
+	}
+
+	if _, err := TypeNameByID(info.ID, 3); !errors.Is(err, ErrNotFound) {
+		t.Error("Expected ErrNotFound for invalid type ID, got", err)
+	}
+}
@@ -2,6 +2,8 @@ package btf
 
 import (
 	"bytes"
+	"fmt"
+	"os"
 
 	"github.com/cilium/ebpf/internal"
 	"github.com/cilium/ebpf/internal/sys"
@@ -21,12 +23,32 @@ type info struct {
 }
 
 func newInfoFromFd(fd *sys.FD) (*info, error) {
+	btfBuffer, btfInfo, name, err := readInfo(fd)
+	if err != nil {
+		return nil, err
+	}
+
+	spec, err := loadRawSpec(bytes.NewReader(btfBuffer), internal.NativeEndian, nil, nil, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	return &info{
+		BTF:       spec,
+		ID:        ID(btfInfo.Id),
+		Name:      name,
+		KernelBTF: btfInfo.KernelBtf != 0,
+	}, nil
+}
+
+// readInfo returns the raw BTF and the name of a BTF object.
+func readInfo(fd *sys.FD) ([]byte, *sys.BtfInfo, string, error) {
 	// We invoke the syscall once with a empty BTF and name buffers to get size
 	// information to allocate buffers. Then we invoke it a second time with
 	// buffers to receive the data.
 	var btfInfo sys.BtfInfo
 	if err := sys.ObjInfo(fd, &btfInfo); err != nil {
-		return nil, err
+		return nil, nil, "", err
 	}
 
 	btfBuffer := make([]byte, btfInfo.BtfSize)
@@ -34,18 +56,58 @@ func newInfoFromFd(fd *sys.FD) (*info, error) {
 	btfInfo.Btf, btfInfo.BtfSize = sys.NewSlicePointerLen(btfBuffer)
 	btfInfo.Name, btfInfo.NameLen = sys.NewSlicePointerLen(nameBuffer)
 	if err := sys.ObjInfo(fd, &btfInfo); err != nil {
-		return nil, err
+		return nil, nil, "", err
+	}
+
+	return btfBuffer, &btfInfo, unix.ByteSliceToString(nameBuffer), nil
+}
+
+// TypeNameByID returns the name of the type typeID in the BTF object id, which
+// has been loaded into the kernel.
+//
+// Unlike NewHandleFromID, the types of the BTF aren't decoded into a Spec.
+// The BTF of kernel modules is supported, whose type IDs continue after the
+// ones of vmlinux. Requires CAP_SYS_ADMIN.
+func TypeNameByID(id ID, typeID TypeID) (string, error) {
+	fd, err := sys.BtfGetFdById(&sys.BtfGetFdByIdAttr{Id: uint32(id)})
+	if err != nil {
+		return "", fmt.Errorf("get BTF by id: %w", err)
 	}
+	defer fd.Close()
 
-	spec, err := loadRawSpec(bytes.NewReader(btfBuffer), internal.NativeEndian, nil, nil)
+	raw, btfInfo, name, err := readInfo(fd)
 	if err != nil {
-		return nil, err
+		return "", fmt.Errorf("get BTF info: %w", err)
 	}
 
-	return &info{
-		BTF:       spec,
-		ID:        ID(btfInfo.Id),
-		Name:      unix.ByteSliceToString(nameBuffer),
-		KernelBTF: btfInfo.KernelBtf != 0,
-	}, nil
+	var (
+		firstID     = TypeID(1)
+		baseStrings *stringTable
+	)
+	if btfInfo.KernelBtf != 0 && name != "vmlinux" {
+		// Module BTF is split from vmlinux.
+		fh, err := os.Open("/sys/kernel/btf/vmlinux")
+		if err != nil {
+			return "", fmt.Errorf("base of module %s: %w", name, err)
+		}
+		defer fh.Close()
+
+		baseTypes, strings, err := parseBTF(fh, internal.NativeEndian, nil)
+		if err != nil {
+			return "", fmt.Errorf("base of module %s: %w", name, err)
+		}
+		firstID += TypeID(len(baseTypes))
+		baseStrings = strings
+	}
+
+	rawTypes, rawStrings, err := parseBTF(bytes.NewReader(raw), internal.NativeEndian, baseStrings)
+	if err != nil {
+		return "", err
+	}
+
+	if typeID < firstID || int(typeID-firstID) >= len(rawTypes) {
+		return "", fmt.Errorf("type ID %d: %w", typeID, ErrNotFound)
+	}
+
+	return rawStrings.Lookup(rawTypes[typeID-firstID].NameOff)
 }
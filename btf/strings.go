@@ -9,6 +9,9 @@ import (
 )
 
 type stringTable struct {
+	// The strings of the base BTF if this is split BTF, otherwise nil.
+	// Offsets into the table start after the end of base.
+	base    *stringTable
 	offsets []uint32
 	strings []string
 }
@@ -19,7 +22,9 @@ type sizedReader interface {
 	Size() int64
 }
 
-func readStringTable(r sizedReader) (*stringTable, error) {
+// readStringTable reads a string table. base is the string table of the base
+// BTF when reading split BTF, and nil otherwise.
+func readStringTable(r sizedReader, base *stringTable) (*stringTable, error) {
 	// Derived from vmlinux BTF.
 	const averageStringLength = 16
 
@@ -40,6 +45,12 @@ func readStringTable(r sizedReader) (*stringTable, error) {
 		return nil, err
 	}
 
+	if base != nil {
+		// Split BTF doesn't have to start with the empty string, since that
+		// is part of the base.
+		return &stringTable{base, offsets, strings}, nil
+	}
+
 	if len(strings) == 0 {
 		return nil, errors.New("string table is empty")
 	}
@@ -48,7 +59,7 @@ func readStringTable(r sizedReader) (*stringTable, error) {
 		return nil, errors.New("first item in string table is non-empty")
 	}
 
-	return &stringTable{offsets, strings}, nil
+	return &stringTable{nil, offsets, strings}, nil
 }
 
 func splitNull(data []byte, atEOF bool) (advance int, token []byte, err error) {
@@ -64,6 +75,14 @@ func splitNull(data []byte, atEOF bool) (advance int, token []byte, err error) {
 }
 
 func (st *stringTable) Lookup(offset uint32) (string, error) {
+	if st.base != nil {
+		baseLength := uint32(st.base.Length())
+		if offset < baseLength {
+			return st.base.Lookup(offset)
+		}
+		offset -= baseLength
+	}
+
 	i := search(st.offsets, offset)
 	if i == len(st.offsets) || st.offsets[i] != offset {
 		return "", fmt.Errorf("offset %d isn't start of a string", offset)
@@ -72,7 +91,12 @@ func (st *stringTable) Lookup(offset uint32) (string, error) {
 	return st.strings[i], nil
 }
 
+// Length returns the size of the encoded table, excluding any base.
 func (st *stringTable) Length() int {
+	if len(st.offsets) == 0 {
+		return 0
+	}
+
 	last := len(st.offsets) - 1
 	return int(st.offsets[last]) + len(st.strings[last]) + 1
 }
@@ -779,9 +779,19 @@ func (dq *typeDeque) all() []*Type {
 // Returns a map of named types (so, where NameOff is non-zero) and a slice of types
 // indexed by TypeID. Since BTF ignores compilation units, multiple types may share
 // the same name. A Type may form a cyclic graph by pointing at itself.
-func inflateRawTypes(rawTypes []rawType, rawStrings *stringTable) ([]Type, error) {
-	types := make([]Type, 0, len(rawTypes)+1)
-	types = append(types, (*Void)(nil))
+//
+// baseTypes are the types of the base BTF when inflating split BTF. They are
+// included in the result, and the IDs of rawTypes continue after them.
+func inflateRawTypes(rawTypes []rawType, rawStrings *stringTable, baseTypes []Type) ([]Type, error) {
+	types := make([]Type, 0, len(baseTypes)+len(rawTypes)+1)
+	if baseTypes == nil {
+		// Void is defined to always be type ID 0, and is thus
+		// omitted from BTF.
+		types = append(types, (*Void)(nil))
+	} else {
+		types = append(types, baseTypes...)
+	}
+	firstID := TypeID(len(types))
 
 	type fixupDef struct {
 		id  TypeID
@@ -882,9 +892,7 @@ func inflateRawTypes(rawTypes []rawType, rawStrings *stringTable) ([]Type, error
 
 	for i, raw := range rawTypes {
 		var (
-			// Void is defined to always be type ID 0, and is thus
-			// omitted from BTF.
-			id  = TypeID(i + 1)
+			id  = firstID + TypeID(i)
 			typ Type
 		)
 
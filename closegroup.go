@@ -0,0 +1,83 @@
+package ebpf
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"sync"
+)
+
+// CloseGroup closes a set of resources in the reverse order they were added
+// to it.
+//
+// Add consumers of a resource after the resource itself, so that consumers
+// are closed first. For example, add maps before the ringbuf.Reader or
+// perf.Reader reading from them, and programs before the links attaching
+// them.
+//
+// The zero value is ready to use. It is safe for concurrent use.
+type CloseGroup struct {
+	mu      sync.Mutex
+	closers []io.Closer
+}
+
+// Add a resource to the group.
+func (cg *CloseGroup) Add(c io.Closer) {
+	cg.mu.Lock()
+	defer cg.mu.Unlock()
+
+	cg.closers = append(cg.closers, c)
+}
+
+// Close all resources in the group, starting with the one added last.
+//
+// All resources are closed even if some of them return an error. The
+// returned error contains the errors of all failed resources, and supports
+// errors.Is and errors.As for each of them. The group is empty afterwards.
+func (cg *CloseGroup) Close() error {
+	cg.mu.Lock()
+	closers := cg.closers
+	cg.closers = nil
+	cg.mu.Unlock()
+
+	var errs closeErrors
+	for i := len(closers) - 1; i >= 0; i-- {
+		if err := closers[i].Close(); err != nil {
+			errs = append(errs, err)
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs
+}
+
+// closeErrors are the errors encountered by CloseGroup.Close.
+type closeErrors []error
+
+func (ce closeErrors) Error() string {
+	msgs := make([]string, 0, len(ce))
+	for _, err := range ce {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func (ce closeErrors) Is(target error) bool {
+	for _, err := range ce {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+func (ce closeErrors) As(target interface{}) bool {
+	for _, err := range ce {
+		if errors.As(err, target) {
+			return true
+		}
+	}
+	return false
+}
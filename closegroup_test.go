@@ -0,0 +1,46 @@
+package ebpf
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+type closeFunc func() error
+
+func (fn closeFunc) Close() error { return fn() }
+
+func TestCloseGroup(t *testing.T) {
+	c := qt.New(t)
+
+	var (
+		cg    CloseGroup
+		order []int
+	)
+
+	for i := 0; i < 3; i++ {
+		i := i
+		cg.Add(closeFunc(func() error {
+			order = append(order, i)
+			if i == 1 {
+				return os.ErrClosed
+			}
+			return nil
+		}))
+	}
+
+	err := cg.Close()
+	c.Assert(order, qt.DeepEquals, []int{2, 1, 0})
+	c.Assert(errors.Is(err, os.ErrClosed), qt.IsTrue, qt.Commentf("got error: %v", err))
+
+	// The group is empty after Close.
+	c.Assert(cg.Close(), qt.IsNil)
+	c.Assert(order, qt.HasLen, 3)
+
+	m := createArray(t)
+	cg.Add(m)
+	c.Assert(cg.Close(), qt.IsNil)
+	c.Assert(m.FD(), qt.Equals, -1)
+}
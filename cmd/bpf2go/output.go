@@ -2,6 +2,7 @@ package main
 
 import (
 	"bytes"
+	"encoding/binary"
 	"fmt"
 	"go/token"
 	"io"
@@ -28,6 +29,9 @@ package {{ .Package }}
 import (
 	"bytes"
 	_ "embed"
+{{- if .Variables }}
+	"encoding/binary"
+{{- end }}
 	"fmt"
 	"io"
 
@@ -37,6 +41,11 @@ import (
 {{- if .Types }}
 {{- range $type := .Types }}
 {{ $.TypeDeclaration (index $.TypeNames $type) $type }}
+{{- with index $.TypeSizes $type }}
+
+// {{ index $.TypeNames $type }}Size is the size of {{ index $.TypeNames $type }} in bytes, according to BTF.
+const {{ index $.TypeNames $type }}Size = {{ . }}
+{{- end }}
 
 {{ end }}
 {{- end }}
@@ -59,6 +68,9 @@ func {{ .Name.Load }}() (*ebpf.CollectionSpec, error) {
 //     *{{ .Name.Objects }}
 //     *{{ .Name.Programs }}
 //     *{{ .Name.Maps }}
+{{- if .Variables }}
+//     *{{ .Name.Variables }}
+{{- end }}
 //
 // See ebpf.CollectionSpec.LoadAndAssign documentation for details.
 func {{ .Name.LoadObjects }}(obj interface{}, opts *ebpf.CollectionOptions) (error) {
@@ -102,12 +114,18 @@ type {{ .Name.MapSpecs }} struct {
 type {{ .Name.Objects }} struct {
 	{{ .Name.Programs }}
 	{{ .Name.Maps }}
+{{- if .Variables }}
+	{{ .Name.Variables }}
+{{- end }}
 }
 
 func (o *{{ .Name.Objects }}) Close() error {
 	return {{ .Name.CloseHelper }}(
 		&o.{{ .Name.Programs }},
 		&o.{{ .Name.Maps }},
+{{- if .Variables }}
+		&o.{{ .Name.Variables }},
+{{- end }}
 	)
 }
 
@@ -145,6 +163,81 @@ func (p *{{ .Name.Programs }}) Close() error {
 	)
 }
 
+{{- if .Variables }}
+
+// {{ .Name.Variables }} contains the data sections holding global variables
+// after they have been loaded into the kernel.
+//
+// It can be passed to {{ .Name.LoadObjects }} or ebpf.CollectionSpec.LoadAndAssign.
+type {{ .Name.Variables }} struct {
+{{- range $name, $id := .DataSections }}
+	{{ $id }} *ebpf.Map {{ tag $name }}
+{{- end }}
+{{- range .OmittedVariables }}
+	// {{ . }}
+{{- end }}
+}
+
+func (v *{{ .Name.Variables }}) Close() error {
+	return {{ .Name.CloseHelper }}(
+{{- range $id := .DataSections }}
+		v.{{ $id }},
+{{- end }}
+	)
+}
+{{- range .Variables }}
+
+// {{ .Ident }} returns the current value of the global variable {{ .Name }}.
+func (v *{{ $.Name.Variables }}) {{ .Ident }}() ({{ .Type }}, error) {
+	var value {{ .Type }}
+	err := {{ $.Name.ReadVariableHelper }}(v.{{ .Section }}, {{ .Offset }}, {{ .Size }}, &value)
+	return value, err
+}
+{{- if not .ReadOnly }}
+
+// Set{{ .Ident }} changes the value of the global variable {{ .Name }}.
+func (v *{{ $.Name.Variables }}) Set{{ .Ident }}(value {{ .Type }}) error {
+	return {{ $.Name.WriteVariableHelper }}(v.{{ .Section }}, {{ .Offset }}, {{ .Size }}, value)
+}
+{{- end }}
+{{- end }}
+
+func {{ .Name.ReadVariableHelper }}(m *ebpf.Map, offset, size int, out interface{}) error {
+	b, err := m.LookupBytes(uint32(0))
+	if err != nil {
+		return err
+	}
+	if offset+size > len(b) {
+		return fmt.Errorf("offset %d(+%d) is out of bounds", offset, size)
+	}
+
+	return binary.Read(bytes.NewReader(b[offset:offset+size]), binary.{{ .ByteOrder }}, out)
+}
+{{- if .WritableVariables }}
+
+func {{ .Name.WriteVariableHelper }}(m *ebpf.Map, offset, size int, value interface{}) error {
+	var buf bytes.Buffer
+	if err := binary.Write(&buf, binary.{{ .ByteOrder }}, value); err != nil {
+		return err
+	}
+	if buf.Len() != size {
+		return fmt.Errorf("value has %d bytes instead of %d", buf.Len(), size)
+	}
+
+	b, err := m.LookupBytes(uint32(0))
+	if err != nil {
+		return err
+	}
+	if offset+size > len(b) {
+		return fmt.Errorf("offset %d(+%d) is out of bounds", offset, size)
+	}
+
+	copy(b[offset:], buf.Bytes())
+	return m.Put(uint32(0), b)
+}
+{{- end }}
+{{- end }}
+
 func {{ .Name.CloseHelper }}(closers ...io.Closer) error {
 	for _, closer := range closers {
 		if err := closer.Close(); err != nil {
@@ -213,10 +306,22 @@ func (n templateName) Programs() string {
 	return string(n) + "Programs"
 }
 
+func (n templateName) Variables() string {
+	return string(n) + "Variables"
+}
+
 func (n templateName) CloseHelper() string {
 	return "_" + toUpperFirst(string(n)) + "Close"
 }
 
+func (n templateName) ReadVariableHelper() string {
+	return "_" + toUpperFirst(string(n)) + "ReadVariable"
+}
+
+func (n templateName) WriteVariableHelper() string {
+	return "_" + toUpperFirst(string(n)) + "WriteVariable"
+}
+
 type outputArgs struct {
 	pkg             string
 	ident           string
@@ -290,22 +395,45 @@ func output(args outputArgs) error {
 		return err
 	}
 
+	typeSizes, err := collectTypeSizes(types)
+	if err != nil {
+		return err
+	}
+
 	gf := &btf.GoFormatter{
 		Names:      typeNames,
 		Identifier: internal.Identifier,
 	}
 
+	dataSections, variables, omitted := collectVariables(spec.Maps, gf, maps, programs)
+
+	var writable bool
+	for _, v := range variables {
+		writable = writable || !v.ReadOnly
+	}
+
+	byteOrder := "LittleEndian"
+	if spec.ByteOrder == binary.BigEndian {
+		byteOrder = "BigEndian"
+	}
+
 	ctx := struct {
 		*btf.GoFormatter
-		Module    string
-		Package   string
-		Tags      []string
-		Name      templateName
-		Maps      map[string]string
-		Programs  map[string]string
-		Types     []btf.Type
-		TypeNames map[btf.Type]string
-		File      string
+		Module            string
+		Package           string
+		Tags              []string
+		Name              templateName
+		Maps              map[string]string
+		Programs          map[string]string
+		Types             []btf.Type
+		TypeNames         map[btf.Type]string
+		TypeSizes         map[btf.Type]int
+		DataSections      map[string]string
+		Variables         []variable
+		OmittedVariables  []string
+		WritableVariables bool
+		ByteOrder         string
+		File              string
 	}{
 		gf,
 		ebpfModule,
@@ -316,6 +444,12 @@ func output(args outputArgs) error {
 		programs,
 		types,
 		typeNames,
+		typeSizes,
+		dataSections,
+		variables,
+		omitted,
+		writable,
+		byteOrder,
 		filepath.Base(args.obj),
 	}
 
@@ -339,6 +473,29 @@ func collectCTypes(types *btf.Spec, names []string) ([]btf.Type, error) {
 	return result, nil
 }
 
+// collectTypeSizes returns the size of all structs and unions in types, which
+// usually describe events read from a ring buffer or perf event array.
+//
+// The size is computed from BTF and includes any padding, so that it
+// matches the size of samples submitted by the eBPF program.
+func collectTypeSizes(types []btf.Type) (map[btf.Type]int, error) {
+	sizes := make(map[btf.Type]int)
+	for _, typ := range types {
+		switch btf.UnderlyingType(typ).(type) {
+		case *btf.Struct, *btf.Union:
+		default:
+			continue
+		}
+
+		size, err := btf.Sizeof(typ)
+		if err != nil {
+			return nil, fmt.Errorf("size of %s: %w", typ, err)
+		}
+		sizes[typ] = size
+	}
+	return sizes, nil
+}
+
 // collectMapTypes returns a list of all types used as map keys or values.
 func collectMapTypes(maps map[string]*ebpf.MapSpec) []btf.Type {
 	var result []btf.Type
@@ -354,6 +511,124 @@ func collectMapTypes(maps map[string]*ebpf.MapSpec) []btf.Type {
 	return result
 }
 
+// variable is a global variable in a data section.
+type variable struct {
+	// Name of the variable in C.
+	Name string
+	// Go identifier of the accessor.
+	Ident string
+	// Go identifier of the field holding the data section.
+	Section string
+	// Go type of the variable.
+	Type         string
+	Offset, Size uint32
+	// Variables in .rodata can't be modified once loaded.
+	ReadOnly bool
+}
+
+// collectVariables returns the data sections containing global variables
+// keyed by their name, and the variables which can be represented in Go.
+// fields are the identifiers of the other structs embedded in Objects,
+// which accessors must not clash with.
+//
+// A description is returned for each variable that was omitted.
+func collectVariables(maps map[string]*ebpf.MapSpec, gf *btf.GoFormatter, fields ...map[string]string) (map[string]string, []variable, []string) {
+	var names []string
+	for name, m := range maps {
+		if _, ok := m.Value.(*btf.Datasec); !ok {
+			continue
+		}
+		if !isDataSection(name) {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	sections := make(map[string]string)
+	for _, name := range names {
+		sections[name] = internal.Identifier(name)
+	}
+
+	// Accessors must not clash with the fields or methods of the struct.
+	idents := map[string]bool{"Close": true}
+	for _, id := range sections {
+		idents[id] = true
+	}
+	for _, f := range fields {
+		for _, id := range f {
+			idents[id] = true
+		}
+	}
+
+	var (
+		vars    []variable
+		omitted []string
+	)
+	for _, name := range names {
+		ds := maps[name].Value.(*btf.Datasec)
+		for _, vsi := range ds.Vars {
+			v, ok := vsi.Type.(*btf.Var)
+			if !ok {
+				continue
+			}
+
+			typ, err := typeLiteral(gf, v.Type)
+			if err != nil {
+				omitted = append(omitted, fmt.Sprintf("Variable %s in %s is omitted: %s", v.Name, name, err))
+				continue
+			}
+
+			id := internal.Identifier(v.Name)
+			if idents[id] || idents["Set"+id] {
+				omitted = append(omitted, fmt.Sprintf("Variable %s in %s is omitted: identifier %s is already used", v.Name, name, id))
+				continue
+			}
+			idents[id] = true
+			idents["Set"+id] = true
+
+			vars = append(vars, variable{
+				Name:     v.Name,
+				Ident:    id,
+				Section:  sections[name],
+				Type:     typ,
+				Offset:   vsi.Offset,
+				Size:     vsi.Size,
+				ReadOnly: strings.HasPrefix(name, ".rodata"),
+			})
+		}
+	}
+
+	if len(vars) == 0 {
+		return nil, nil, nil
+	}
+
+	return sections, vars, omitted
+}
+
+func isDataSection(name string) bool {
+	for _, prefix := range []string{".bss", ".data", ".rodata"} {
+		if name == prefix || strings.HasPrefix(name, prefix+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// typeLiteral returns the Go type of typ, using the named types known to gf.
+func typeLiteral(gf *btf.GoFormatter, typ btf.Type) (string, error) {
+	const name = "T"
+
+	// Wrapping typ in a typedef yields "type T <literal>" for all kinds of
+	// types, including enums.
+	decl, err := gf.TypeDeclaration(name, &btf.Typedef{Name: name, Type: typ})
+	if err != nil {
+		return "", err
+	}
+
+	return strings.TrimPrefix(decl, "type "+name+" "), nil
+}
+
 // sortTypes returns a list of types sorted by their (generated) Go type name.
 //
 // Duplicate Go type names are rejected.
@@ -3,6 +3,7 @@ package main
 import (
 	"testing"
 
+	"github.com/cilium/ebpf"
 	"github.com/cilium/ebpf/btf"
 	qt "github.com/frankban/quicktest"
 )
@@ -58,3 +59,75 @@ func TestOrderTypes(t *testing.T) {
 		})
 	}
 }
+
+func TestCollectTypeSizes(t *testing.T) {
+	u8 := &btf.Int{Name: "u8", Size: 1}
+	u32 := &btf.Int{Name: "u32", Size: 4}
+	event := &btf.Struct{
+		Name: "event",
+		Size: 8,
+		Members: []btf.Member{
+			{Name: "pid", Type: u32},
+			{Name: "cpu", Type: u8, Offset: 32},
+		},
+	}
+	typedef := &btf.Typedef{Name: "event_t", Type: event}
+	enum := &btf.Enum{Name: "e"}
+
+	sizes, err := collectTypeSizes([]btf.Type{event, typedef, enum})
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, sizes, qt.DeepEquals, map[btf.Type]int{
+		event:   8,
+		typedef: 8,
+	})
+}
+
+func TestCollectVariables(t *testing.T) {
+	u32 := &btf.Int{Name: "u32", Size: 4}
+	fn := &btf.Func{Name: "fn", Type: &btf.FuncProto{}}
+
+	maps := map[string]*ebpf.MapSpec{
+		".bss": {
+			Value: &btf.Datasec{
+				Name: ".bss",
+				Vars: []btf.VarSecinfo{
+					{Type: &btf.Var{Name: "counter", Type: u32}, Offset: 0, Size: 4},
+					{Type: &btf.Var{Name: "bogus", Type: fn}, Offset: 4, Size: 8},
+				},
+			},
+		},
+		".rodata.config": {
+			Value: &btf.Datasec{
+				Name: ".rodata.config",
+				Vars: []btf.VarSecinfo{
+					{Type: &btf.Var{Name: "target_comm", Type: &btf.Array{Type: u32, Nelems: 4}}, Offset: 0, Size: 16},
+					{Type: &btf.Var{Name: "bss", Type: u32}, Offset: 16, Size: 4},
+				},
+			},
+		},
+		"hash": {
+			Value: u32,
+		},
+	}
+
+	sections, vars, omitted := collectVariables(maps, &btf.GoFormatter{})
+	qt.Assert(t, sections, qt.DeepEquals, map[string]string{
+		".bss":           "Bss",
+		".rodata.config": "Rodataconfig",
+	})
+	qt.Assert(t, vars, qt.DeepEquals, []variable{
+		{"counter", "Counter", "Bss", "uint32", 0, 4, false},
+		{"target_comm", "TargetComm", "Rodataconfig", "[4]uint32", 0, 16, true},
+	})
+	qt.Assert(t, len(omitted), qt.Equals, 2)
+
+	// Accessors must not clash with the fields of Programs and Maps either.
+	_, vars, omitted = collectVariables(maps, &btf.GoFormatter{},
+		map[string]string{"hash": "Hash"},
+		map[string]string{"counter": "Counter"},
+	)
+	qt.Assert(t, vars, qt.DeepEquals, []variable{
+		{"target_comm", "TargetComm", "Rodataconfig", "[4]uint32", 0, 16, true},
+	})
+	qt.Assert(t, len(omitted), qt.Equals, 3)
+}
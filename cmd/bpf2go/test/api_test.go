@@ -36,6 +36,14 @@ func TestLoadingObjects(t *testing.T) {
 	if objs.Map1 == nil {
 		t.Error("Loading returns an object with nil maps")
 	}
+
+	myConstant, err := objs.MyConstant()
+	if err != nil {
+		t.Fatal("Can't read variable:", err)
+	}
+	if myConstant != testEFROOD {
+		t.Error("Expected my_constant to be testEFROOD, got", myConstant)
+	}
 }
 
 func TestTypes(t *testing.T) {
@@ -7,6 +7,7 @@ package test
 import (
 	"bytes"
 	_ "embed"
+	"encoding/binary"
 	"fmt"
 	"io"
 
@@ -20,6 +21,9 @@ type testBarfoo struct {
 	Boo testE
 }
 
+// testBarfooSize is the size of testBarfoo in bytes, according to BTF.
+const testBarfooSize = 16
+
 type testE int32
 
 const (
@@ -45,6 +49,7 @@ func loadTest() (*ebpf.CollectionSpec, error) {
 //     *testObjects
 //     *testPrograms
 //     *testMaps
+//     *testVariables
 //
 // See ebpf.CollectionSpec.LoadAndAssign documentation for details.
 func loadTestObjects(obj interface{}, opts *ebpf.CollectionOptions) error {
@@ -84,12 +89,14 @@ type testMapSpecs struct {
 type testObjects struct {
 	testPrograms
 	testMaps
+	testVariables
 }
 
 func (o *testObjects) Close() error {
 	return _TestClose(
 		&o.testPrograms,
 		&o.testMaps,
+		&o.testVariables,
 	)
 }
 
@@ -119,6 +126,46 @@ func (p *testPrograms) Close() error {
 	)
 }
 
+// testVariables contains the data sections holding global variables
+// after they have been loaded into the kernel.
+//
+// It can be passed to loadTestObjects or ebpf.CollectionSpec.LoadAndAssign.
+type testVariables struct {
+	Rodata *ebpf.Map `ebpf:".rodata"`
+}
+
+func (v *testVariables) Close() error {
+	return _TestClose(
+		v.Rodata,
+	)
+}
+
+// MyConstant returns the current value of the global variable my_constant.
+func (v *testVariables) MyConstant() (testE, error) {
+	var value testE
+	err := _TestReadVariable(v.Rodata, 0, 4, &value)
+	return value, err
+}
+
+// StructConst returns the current value of the global variable struct_const.
+func (v *testVariables) StructConst() (testBarfoo, error) {
+	var value testBarfoo
+	err := _TestReadVariable(v.Rodata, 8, 16, &value)
+	return value, err
+}
+
+func _TestReadVariable(m *ebpf.Map, offset, size int, out interface{}) error {
+	b, err := m.LookupBytes(uint32(0))
+	if err != nil {
+		return err
+	}
+	if offset+size > len(b) {
+		return fmt.Errorf("offset %d(+%d) is out of bounds", offset, size)
+	}
+
+	return binary.Read(bytes.NewReader(b[offset:offset+size]), binary.LittleEndian, out)
+}
+
 func _TestClose(closers ...io.Closer) error {
 	for _, closer := range closers {
 		if err := closer.Close(); err != nil {
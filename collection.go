@@ -1,14 +1,19 @@
 package ebpf
 
 import (
+	"bytes"
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"os"
 	"reflect"
 	"strings"
+	"time"
 
 	"github.com/cilium/ebpf/asm"
 	"github.com/cilium/ebpf/btf"
+	"github.com/cilium/ebpf/internal"
+	"github.com/cilium/ebpf/internal/unix"
 )
 
 // CollectionOptions control loading a collection into the kernel.
@@ -18,6 +23,14 @@ type CollectionOptions struct {
 	Maps     MapOptions
 	Programs ProgramOptions
 
+	// TokenFD is a BPF token delegated by a privileged process, used to
+	// create all maps, programs and BTF of the collection without
+	// privileges. It takes precedence over Maps.TokenFD and
+	// Programs.TokenFD. Zero doesn't use a token.
+	//
+	// Needs kernel 6.9+.
+	TokenFD int
+
 	// MapReplacements takes a set of Maps that will be used instead of
 	// creating new ones when loading the CollectionSpec.
 	//
@@ -28,6 +41,26 @@ type CollectionOptions struct {
 	// The given Maps are Clone()d before being used in the Collection, so the
 	// caller can Close() them freely when they are no longer needed.
 	MapReplacements map[string]*Map
+
+	// LoadProgramFilter is called with the name of each program in the
+	// CollectionSpec. Programs for which it returns false are not loaded
+	// by NewCollectionWithOptions, and are omitted from ProgramArray
+	// contents. Maps which are only referenced by skipped programs are
+	// not created either.
+	//
+	// All programs are loaded if LoadProgramFilter is nil.
+	LoadProgramFilter func(name string) bool
+
+	// DisableBTF creates maps and loads programs without passing their BTF
+	// to the kernel, for kernels built without or with limited BTF support.
+	// Maps and programs still fall back to loading without BTF if the kernel
+	// doesn't support it at all, so this is only needed if the kernel rejects
+	// the BTF of the CollectionSpec.
+	//
+	// Programs which need CO-RE relocations can't be loaded this way and
+	// return an error instead. Map features which depend on BTF, like spin
+	// locks and timers, are unavailable.
+	DisableBTF bool
 }
 
 // CollectionSpec describes a collection.
@@ -107,6 +140,124 @@ func (cs *CollectionSpec) RewriteMaps(maps map[string]*Map) error {
 	return nil
 }
 
+// SetProgramName overrides the name a program is loaded with, which is what
+// shows up in ProgramInfo.Name and tools like bpftool.
+//
+// program is the key of the program in CollectionSpec.Programs. The kernel
+// only retains the first 15 bytes of a name, so SetProgramName returns an
+// error instead of letting longer names be truncated. It also returns an
+// error if name contains characters the kernel doesn't accept; use
+// SanitizeName to remove them.
+func (cs *CollectionSpec) SetProgramName(program, name string) error {
+	spec := cs.Programs[program]
+	if spec == nil {
+		return fmt.Errorf("program %s not found in CollectionSpec", program)
+	}
+
+	if max := unix.BPF_OBJ_NAME_LEN - 1; len(name) > max {
+		return fmt.Errorf("name %q exceeds %d bytes", name, max)
+	}
+
+	if strings.IndexFunc(name, invalidBPFObjNameChar) != -1 {
+		return fmt.Errorf("name %q contains invalid characters", name)
+	}
+
+	spec.Name = name
+	return nil
+}
+
+// Prune removes all programs from the spec except the ones named in
+// keepPrograms, and drops maps which are only referenced by removed programs.
+// Removed programs are also omitted from ProgramArray contents. Maps which
+// aren't referenced by any program are retained, since user space may use
+// them.
+//
+// Returns an error if a program in keepPrograms doesn't exist, or if a kept
+// program references a map which isn't in the spec. The spec is not modified
+// in that case.
+func (cs *CollectionSpec) Prune(keepPrograms []string) error {
+	keep := make(map[string]bool, len(keepPrograms))
+	for _, name := range keepPrograms {
+		if cs.Programs[name] == nil {
+			return fmt.Errorf("program %s not found in CollectionSpec", name)
+		}
+		keep[name] = true
+	}
+
+	// used tracks whether a map is referenced by a kept program. Maps which
+	// are only referenced by removed programs are present but false.
+	used := make(map[string]bool)
+	for progName, progSpec := range cs.Programs {
+		for _, ins := range progSpec.Instructions {
+			if !ins.IsLoadFromMap() || ins.Reference() == "" {
+				continue
+			}
+
+			ref := ins.Reference()
+			used[ref] = used[ref] || keep[progName]
+
+			// Maps associated by the caller don't need a spec.
+			if !keep[progName] || ins.Map() != nil || int32(ins.Constant) > 0 {
+				continue
+			}
+
+			if cs.Maps[ref] == nil {
+				return fmt.Errorf("program %s: map %s: %w", progName, ref, asm.ErrUnsatisfiedMapReference)
+			}
+		}
+	}
+
+	// Inner maps referenced from the contents of a used map are used as well.
+	var markInner func(mapName string)
+	markInner = func(mapName string) {
+		ms := cs.Maps[mapName]
+		if ms == nil || (ms.Type != ArrayOfMaps && ms.Type != HashOfMaps) {
+			return
+		}
+
+		for _, kv := range ms.Contents {
+			if inner, ok := kv.Value.(string); ok && !used[inner] {
+				used[inner] = true
+				markInner(inner)
+			}
+		}
+	}
+	for mapName, isUsed := range used {
+		if isUsed {
+			markInner(mapName)
+		}
+	}
+
+	for progName := range cs.Programs {
+		if !keep[progName] {
+			delete(cs.Programs, progName)
+		}
+	}
+
+	for mapName, isUsed := range used {
+		if !isUsed {
+			delete(cs.Maps, mapName)
+		}
+	}
+
+	for _, ms := range cs.Maps {
+		if ms.Type != ProgramArray {
+			continue
+		}
+
+		contents := ms.Contents[:0]
+		for _, kv := range ms.Contents {
+			if progName, ok := kv.Value.(string); ok && !keep[progName] {
+				continue
+			}
+			contents = append(contents, kv)
+		}
+		ms.Contents = contents
+	}
+
+	return nil
+}
+
 // RewriteConstants replaces the value of multiple constants.
 //
 // The constant must be defined like so in the C program:
@@ -259,7 +410,9 @@ func (cs *CollectionSpec) Assign(to interface{}) error {
 //
 // Returns an error if any of the fields can't be found, or
 // if the same Map or Program is assigned multiple times.
-func (cs *CollectionSpec) LoadAndAssign(to interface{}, opts *CollectionOptions) error {
+func (cs *CollectionSpec) LoadAndAssign(to interface{}, opts *CollectionOptions) (err error) {
+	defer internal.AddStackTrace(&err)
+
 	loader, err := newCollectionLoader(cs, opts)
 	if err != nil {
 		return err
@@ -321,6 +474,9 @@ func (cs *CollectionSpec) LoadAndAssign(to interface{}, opts *CollectionOptions)
 type Collection struct {
 	Programs map[string]*Program
 	Maps     map[string]*Map
+
+	// Global variables in data sections, keyed by their C name.
+	variables map[string]*variable
 }
 
 // NewCollection creates a Collection from the given spec, creating and
@@ -337,22 +493,30 @@ func NewCollection(spec *CollectionSpec) (*Collection, error) {
 //
 // Omitting Collection.Close() during application shutdown is an error.
 // See the package documentation for details around Map and Program lifecycle.
-func NewCollectionWithOptions(spec *CollectionSpec, opts CollectionOptions) (*Collection, error) {
+func NewCollectionWithOptions(spec *CollectionSpec, opts CollectionOptions) (_ *Collection, err error) {
+	defer internal.AddStackTrace(&err)
+
 	loader, err := newCollectionLoader(spec, &opts)
 	if err != nil {
 		return nil, err
 	}
 	defer loader.cleanup()
 
+	skipMaps := loader.unusedMaps()
+
 	// Create maps first, as their fds need to be linked into programs.
 	for mapName := range spec.Maps {
+		if skipMaps[mapName] {
+			continue
+		}
+
 		if _, err := loader.loadMap(mapName); err != nil {
 			return nil, err
 		}
 	}
 
 	for progName, prog := range spec.Programs {
-		if prog.Type == UnspecifiedProgram {
+		if prog.Type == UnspecifiedProgram || !loader.wantProgram(progName) {
 			continue
 		}
 
@@ -374,9 +538,55 @@ func NewCollectionWithOptions(spec *CollectionSpec, opts CollectionOptions) (*Co
 	return &Collection{
 		progs,
 		maps,
+		dataSectionVariables(spec, maps),
 	}, nil
 }
 
+// variable describes the location of a global variable in a data section.
+type variable struct {
+	mapName      string
+	offset, size uint32
+}
+
+// dataSectionVariables collects the variables declared in the BTF Datasecs of
+// all loaded .bss, .data and .rodata maps.
+//
+// Variables which are declared in more than one section map to nil.
+func dataSectionVariables(spec *CollectionSpec, maps map[string]*Map) map[string]*variable {
+	vars := make(map[string]*variable)
+	for name, ms := range spec.Maps {
+		if maps[name] == nil || !isDataSection(name) {
+			continue
+		}
+
+		ds, ok := ms.Value.(*btf.Datasec)
+		if !ok {
+			continue
+		}
+
+		for _, v := range ds.Vars {
+			vname := v.Type.TypeName()
+			if _, ok := vars[vname]; ok {
+				vars[vname] = nil
+				continue
+			}
+
+			vars[vname] = &variable{name, v.Offset, v.Size}
+		}
+	}
+
+	return vars
+}
+
+func isDataSection(name string) bool {
+	for _, prefix := range []string{".bss", ".data", ".rodata"} {
+		if name == prefix || strings.HasPrefix(name, prefix+".") {
+			return true
+		}
+	}
+	return false
+}
+
 type handleCache struct {
 	btfHandles map[*btf.Spec]*btf.Handle
 }
@@ -387,12 +597,14 @@ func newHandleCache() *handleCache {
 	}
 }
 
-func (hc handleCache) btfHandle(spec *btf.Spec) (*btf.Handle, error) {
+// btfHandle loads spec into the kernel, using the BPF token tokenFD if it's
+// not zero.
+func (hc handleCache) btfHandle(spec *btf.Spec, tokenFD int) (*btf.Handle, error) {
 	if hc.btfHandles[spec] != nil {
 		return hc.btfHandles[spec], nil
 	}
 
-	handle, err := btf.NewHandle(spec)
+	handle, err := btf.NewHandleWithOptions(spec, btf.HandleOptions{TokenFD: tokenFD})
 	if err != nil {
 		return nil, err
 	}
@@ -420,6 +632,13 @@ func newCollectionLoader(coll *CollectionSpec, opts *CollectionOptions) (*collec
 		opts = &CollectionOptions{}
 	}
 
+	if opts.TokenFD != 0 {
+		withToken := *opts
+		withToken.Maps.TokenFD = opts.TokenFD
+		withToken.Programs.TokenFD = opts.TokenFD
+		opts = &withToken
+	}
+
 	// Check for existing MapSpecs in the CollectionSpec for all provided replacement maps.
 	for name, m := range opts.MapReplacements {
 		spec, ok := coll.Maps[name]
@@ -460,7 +679,46 @@ func (cl *collectionLoader) cleanup() {
 	}
 }
 
-func (cl *collectionLoader) loadMap(mapName string) (*Map, error) {
+// wantProgram returns false if the named program is rejected by
+// CollectionOptions.LoadProgramFilter.
+func (cl *collectionLoader) wantProgram(progName string) bool {
+	return cl.opts.LoadProgramFilter == nil || cl.opts.LoadProgramFilter(progName)
+}
+
+// unusedMaps returns the set of maps which are referenced by programs skipped
+// due to CollectionOptions.LoadProgramFilter, but not by any other program.
+func (cl *collectionLoader) unusedMaps() map[string]bool {
+	if cl.opts.LoadProgramFilter == nil {
+		return nil
+	}
+
+	used := make(map[string]bool)
+	for progName, progSpec := range cl.coll.Programs {
+		want := progSpec.Type != UnspecifiedProgram && cl.wantProgram(progName)
+		for _, ins := range progSpec.Instructions {
+			if !ins.IsLoadFromMap() || ins.Reference() == "" {
+				continue
+			}
+
+			used[ins.Reference()] = used[ins.Reference()] || want
+		}
+	}
+
+	unused := make(map[string]bool)
+	for mapName, isUsed := range used {
+		if !isUsed {
+			unused[mapName] = true
+		}
+	}
+
+	return unused
+}
+
+func (cl *collectionLoader) loadMap(mapName string) (_ *Map, err error) {
+	// Annotate errors here as well as in the exported functions, so that
+	// the stack shows which map or program failed to load.
+	defer internal.AddStackTrace(&err)
+
 	if m := cl.maps[mapName]; m != nil {
 		return m, nil
 	}
@@ -485,6 +743,11 @@ func (cl *collectionLoader) loadMap(mapName string) (*Map, error) {
 		return m, nil
 	}
 
+	if cl.opts.DisableBTF && mapSpec.BTF != nil {
+		mapSpec = mapSpec.Copy()
+		mapSpec.BTF = nil
+	}
+
 	m, err := newMapWithOptions(mapSpec, cl.opts.Maps, cl.handles)
 	if err != nil {
 		return nil, fmt.Errorf("map %s: %w", mapName, err)
@@ -494,7 +757,9 @@ func (cl *collectionLoader) loadMap(mapName string) (*Map, error) {
 	return m, nil
 }
 
-func (cl *collectionLoader) loadProgram(progName string) (*Program, error) {
+func (cl *collectionLoader) loadProgram(progName string) (_ *Program, err error) {
+	defer internal.AddStackTrace(&err)
+
 	if prog := cl.programs[progName]; prog != nil {
 		return prog, nil
 	}
@@ -516,6 +781,13 @@ func (cl *collectionLoader) loadProgram(progName string) (*Program, error) {
 
 	progSpec = progSpec.Copy()
 
+	if cl.opts.DisableBTF && progSpec.BTF != nil {
+		if hasCORERelocations(progSpec.Instructions) {
+			return nil, fmt.Errorf("program %s: CO-RE relocations require BTF, which is disabled", progName)
+		}
+		progSpec.BTF = nil
+	}
+
 	// Rewrite any reference to a valid map in the program's instructions,
 	// which includes all of its dependencies.
 	for i := range progSpec.Instructions {
@@ -560,6 +832,19 @@ func (cl *collectionLoader) populateMaps() error {
 
 		mapSpec = mapSpec.Copy()
 
+		if mapSpec.Type == ProgramArray && cl.opts.LoadProgramFilter != nil {
+			// Don't load programs rejected by the filter just because
+			// they're referenced from a ProgramArray.
+			contents := mapSpec.Contents[:0]
+			for _, kv := range mapSpec.Contents {
+				if objName, ok := kv.Value.(string); ok && !cl.wantProgram(objName) {
+					continue
+				}
+				contents = append(contents, kv)
+			}
+			mapSpec.Contents = contents
+		}
+
 		// MapSpecs that refer to inner maps or programs within the same
 		// CollectionSpec do so using strings. These strings are used as the key
 		// to look up the respective object in the Maps or Programs fields.
@@ -643,6 +928,141 @@ func (coll *Collection) DetachProgram(name string) *Program {
 	return p
 }
 
+// ReadVariable reads the current value of a global variable from the .bss,
+// .data or .rodata section it is declared in.
+//
+// out is unmarshaled according to the same rules as Map.Lookup and must match
+// the size of the variable.
+//
+// Requires BTF for the data section.
+func (coll *Collection) ReadVariable(name string, out interface{}) error {
+	b, err := coll.variableBytes(name)
+	if err != nil {
+		return err
+	}
+
+	if err := unmarshalBytes(out, b); err != nil {
+		return fmt.Errorf("variable %s: %w", name, err)
+	}
+
+	return nil
+}
+
+// variablePollInterval is replaced in tests.
+var variablePollInterval = 10 * time.Millisecond
+
+// WaitForVariable polls a global variable in coll until it is equal to want,
+// for example to wait for an eBPF program to set a flag once it has
+// initialized.
+//
+// want is marshaled according to the same rules as Map.Put and must match the
+// size of the variable. Returns an error wrapping os.ErrDeadlineExceeded if
+// the variable doesn't reach the value within timeout.
+//
+// Requires BTF for the data section, see Collection.ReadVariable.
+func WaitForVariable(coll *Collection, name string, want interface{}, timeout time.Duration) error {
+	_, v, err := coll.variable(name)
+	if err != nil {
+		return err
+	}
+
+	wantBytes, err := marshalBytes(want, int(v.size))
+	if err != nil {
+		return fmt.Errorf("variable %s: %w", name, err)
+	}
+
+	deadline := internal.Now().Add(timeout)
+	for {
+		b, err := coll.variableBytes(name)
+		if err != nil {
+			return err
+		}
+
+		if bytes.Equal(b, wantBytes) {
+			return nil
+		}
+
+		if !internal.Now().Before(deadline) {
+			return fmt.Errorf("variable %s didn't reach the wanted value within %s: %w", name, timeout, os.ErrDeadlineExceeded)
+		}
+
+		time.Sleep(variablePollInterval)
+	}
+}
+
+// variableBytes returns the current contents of a global variable.
+func (coll *Collection) variableBytes(name string) ([]byte, error) {
+	m, v, err := coll.variable(name)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := m.LookupBytes(uint32(0))
+	if err != nil {
+		return nil, fmt.Errorf("variable %s: %w", name, err)
+	}
+
+	if int(v.offset+v.size) > len(b) {
+		return nil, fmt.Errorf("variable %s: offset %d(+%d) is out of bounds", name, v.offset, v.size)
+	}
+
+	return b[v.offset : v.offset+v.size], nil
+}
+
+// WriteVariable replaces the value of a global variable in the .bss or .data
+// section it is declared in.
+//
+// The update isn't atomic with respect to other variables in the same data
+// section: concurrent writes from eBPF programs may be lost. Writing to
+// .rodata fails since the map is frozen after loading.
+//
+// Requires BTF for the data section.
+func (coll *Collection) WriteVariable(name string, value interface{}) error {
+	m, v, err := coll.variable(name)
+	if err != nil {
+		return err
+	}
+
+	buf, err := marshalBytes(value, int(v.size))
+	if err != nil {
+		return fmt.Errorf("variable %s: %w", name, err)
+	}
+
+	b, err := m.LookupBytes(uint32(0))
+	if err != nil {
+		return fmt.Errorf("variable %s: %w", name, err)
+	}
+
+	if int(v.offset+v.size) > len(b) {
+		return fmt.Errorf("variable %s: offset %d(+%d) is out of bounds", name, v.offset, v.size)
+	}
+
+	copy(b[v.offset:], buf)
+
+	if err := m.Put(uint32(0), b); err != nil {
+		return fmt.Errorf("variable %s: %w", name, err)
+	}
+
+	return nil
+}
+
+func (coll *Collection) variable(name string) (*Map, *variable, error) {
+	v, ok := coll.variables[name]
+	if !ok {
+		return nil, nil, fmt.Errorf("no variable named %s in a data section", name)
+	}
+	if v == nil {
+		return nil, nil, fmt.Errorf("variable %s is declared in multiple data sections", name)
+	}
+
+	m := coll.Maps[v.mapName]
+	if m == nil {
+		return nil, nil, fmt.Errorf("variable %s: map %s is not part of the collection", name, v.mapName)
+	}
+
+	return m, v, nil
+}
+
 // structField represents a struct field containing the ebpf struct tag.
 type structField struct {
 	reflect.StructField
@@ -3,8 +3,10 @@ package ebpf
 import (
 	"errors"
 	"fmt"
+	"os"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/cilium/ebpf/asm"
 	"github.com/cilium/ebpf/btf"
@@ -323,6 +325,272 @@ func TestCollectionSpecMapReplacements_SpecMismatch(t *testing.T) {
 	}
 }
 
+func TestCollectionSpecLoadProgramFilter(t *testing.T) {
+	mapSpec := func() *MapSpec {
+		return &MapSpec{
+			Type:       Array,
+			KeySize:    4,
+			ValueSize:  4,
+			MaxEntries: 1,
+		}
+	}
+
+	progSpec := func(maps ...string) *ProgramSpec {
+		var insns asm.Instructions
+		for _, m := range maps {
+			insns = append(insns, asm.LoadMapPtr(asm.R1, 0).WithReference(m))
+		}
+		insns = append(insns,
+			asm.LoadImm(asm.R0, 0, asm.DWord),
+			asm.Return(),
+		)
+
+		return &ProgramSpec{
+			Type:         SocketFilter,
+			Instructions: insns,
+			License:      "MIT",
+		}
+	}
+
+	spec := &CollectionSpec{
+		Maps: map[string]*MapSpec{
+			"shared":   mapSpec(),
+			"kept":     mapSpec(),
+			"skipped":  mapSpec(),
+			"orphaned": mapSpec(),
+		},
+		Programs: map[string]*ProgramSpec{
+			"keep": progSpec("shared", "kept"),
+			"skip": progSpec("shared", "skipped"),
+		},
+	}
+
+	coll, err := NewCollectionWithOptions(spec, CollectionOptions{
+		LoadProgramFilter: func(name string) bool {
+			return name != "skip"
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer coll.Close()
+
+	if coll.Programs["keep"] == nil {
+		t.Error("Program keep wasn't loaded")
+	}
+	if coll.Programs["skip"] != nil {
+		t.Error("Program skip was loaded")
+	}
+
+	for _, name := range []string{"shared", "kept", "orphaned"} {
+		if coll.Maps[name] == nil {
+			t.Errorf("Map %s wasn't created", name)
+		}
+	}
+	if coll.Maps["skipped"] != nil {
+		t.Error("Map only used by a skipped program was created")
+	}
+}
+
+func TestCollectionSpecPrune(t *testing.T) {
+	mapSpec := func() *MapSpec {
+		return &MapSpec{
+			Type:       Array,
+			KeySize:    4,
+			ValueSize:  4,
+			MaxEntries: 1,
+		}
+	}
+
+	progSpec := func(maps ...string) *ProgramSpec {
+		var insns asm.Instructions
+		for _, m := range maps {
+			insns = append(insns, asm.LoadMapPtr(asm.R1, 0).WithReference(m))
+		}
+		insns = append(insns,
+			asm.LoadImm(asm.R0, 0, asm.DWord),
+			asm.Return(),
+		)
+
+		return &ProgramSpec{
+			Type:         SocketFilter,
+			Instructions: insns,
+			License:      "MIT",
+		}
+	}
+
+	newSpec := func() *CollectionSpec {
+		return &CollectionSpec{
+			Maps: map[string]*MapSpec{
+				"shared":   mapSpec(),
+				"kept":     mapSpec(),
+				"removed":  mapSpec(),
+				"orphaned": mapSpec(),
+				"jumps": {
+					Type:       ProgramArray,
+					KeySize:    4,
+					ValueSize:  4,
+					MaxEntries: 2,
+					Contents: []MapKV{
+						{Key: uint32(0), Value: "keep"},
+						{Key: uint32(1), Value: "remove"},
+					},
+				},
+			},
+			Programs: map[string]*ProgramSpec{
+				"keep":   progSpec("shared", "kept", "jumps"),
+				"remove": progSpec("shared", "removed"),
+			},
+		}
+	}
+
+	spec := newSpec()
+	if err := spec.Prune([]string{"keep"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if spec.Programs["keep"] == nil || spec.Programs["remove"] != nil {
+		t.Error("Expected only program keep to remain")
+	}
+	for _, name := range []string{"shared", "kept", "orphaned", "jumps"} {
+		if spec.Maps[name] == nil {
+			t.Errorf("Map %s was removed", name)
+		}
+	}
+	if spec.Maps["removed"] != nil {
+		t.Error("Map only used by a removed program wasn't removed")
+	}
+	if contents := spec.Maps["jumps"].Contents; len(contents) != 1 || contents[0].Value != "keep" {
+		t.Error("Removed program wasn't dropped from ProgramArray:", contents)
+	}
+
+	coll, err := NewCollection(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	coll.Close()
+
+	spec = newSpec()
+	if err := spec.Prune([]string{"bogus"}); err == nil {
+		t.Error("Prune doesn't return an error for a missing program")
+	}
+
+	spec = newSpec()
+	delete(spec.Maps, "kept")
+	if err := spec.Prune([]string{"keep"}); !errors.Is(err, asm.ErrUnsatisfiedMapReference) {
+		t.Error("Expected ErrUnsatisfiedMapReference, got", err)
+	}
+	if len(spec.Programs) != 2 {
+		t.Error("Failed Prune modified the spec")
+	}
+}
+
+func TestCollectionSpecDisableBTF(t *testing.T) {
+	// The BTF of the map doesn't contain its key and value types, so creating
+	// the map fails unless BTF is disabled.
+	bogus := &btf.Spec{}
+	spec := &CollectionSpec{
+		Maps: map[string]*MapSpec{
+			"hash": {
+				Type:       Hash,
+				KeySize:    4,
+				ValueSize:  4,
+				MaxEntries: 1,
+				Key:        &btf.Int{Size: 4},
+				Value:      &btf.Int{Size: 4},
+				BTF:        bogus,
+			},
+		},
+		Programs: map[string]*ProgramSpec{
+			"prog": {
+				Type: SocketFilter,
+				Instructions: asm.Instructions{
+					asm.LoadMapPtr(asm.R1, 0).WithReference("hash"),
+					asm.LoadImm(asm.R0, 0, asm.DWord),
+					asm.Return(),
+				},
+				License: "MIT",
+				BTF:     bogus,
+			},
+		},
+		Types: bogus,
+	}
+
+	if coll, err := NewCollection(spec); err == nil {
+		coll.Close()
+		t.Fatal("Loading a map with bogus BTF doesn't fail")
+	}
+
+	coll, err := NewCollectionWithOptions(spec, CollectionOptions{DisableBTF: true})
+	if err != nil {
+		t.Fatal("Can't load collection without BTF:", err)
+	}
+	coll.Close()
+
+	if spec.Maps["hash"].BTF == nil || spec.Programs["prog"].BTF == nil {
+		t.Error("DisableBTF modifies the CollectionSpec")
+	}
+
+	relocs, err := LoadCollectionSpec("btf/testdata/relocs-el.elf")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = NewCollectionWithOptions(relocs, CollectionOptions{DisableBTF: true})
+	if err == nil {
+		t.Fatal("Loading programs with CO-RE relocations doesn't fail without BTF")
+	}
+}
+
+func TestCollectionSpecSetProgramName(t *testing.T) {
+	spec := &CollectionSpec{
+		Programs: map[string]*ProgramSpec{
+			"prog": {
+				Type: SocketFilter,
+				Instructions: asm.Instructions{
+					asm.LoadImm(asm.R0, 0, asm.DWord),
+					asm.Return(),
+				},
+				License: "MIT",
+			},
+		},
+	}
+
+	if err := spec.SetProgramName("missing", "foo"); err == nil {
+		t.Error("SetProgramName accepts missing program")
+	}
+
+	if err := spec.SetProgramName("prog", "a_very_long_program_name"); err == nil {
+		t.Error("SetProgramName accepts name longer than 15 bytes")
+	}
+
+	if err := spec.SetProgramName("prog", "foo-bar"); err == nil {
+		t.Error("SetProgramName accepts name with invalid characters")
+	}
+
+	if err := spec.SetProgramName("prog", "TcpClose"); err != nil {
+		t.Fatal(err)
+	}
+
+	coll, err := NewCollection(spec)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer coll.Close()
+
+	testutils.SkipOnOldKernel(t, "4.15", "program names")
+
+	info, err := coll.Programs["prog"].Info()
+	testutils.SkipIfNotSupported(t, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if info.Name != "TcpClose" {
+		t.Errorf("Expected program name TcpClose, got %s", info.Name)
+	}
+}
+
 func TestCollectionSpec_LoadAndAssign_LazyLoading(t *testing.T) {
 	spec := &CollectionSpec{
 		Maps: map[string]*MapSpec{
@@ -579,3 +847,122 @@ func ExampleCollectionSpec_LoadAndAssign() {
 	// Output: SocketFilter
 	// Array
 }
+
+func TestWaitForVariable(t *testing.T) {
+	cs := &CollectionSpec{
+		Maps: map[string]*MapSpec{
+			".bss": {
+				Name:       ".bss",
+				Type:       Array,
+				KeySize:    4,
+				ValueSize:  4,
+				MaxEntries: 1,
+				Value: &btf.Datasec{
+					Name: ".bss",
+					Size: 4,
+					Vars: []btf.VarSecinfo{
+						{Type: &btf.Var{Name: "ready", Type: &btf.Int{Name: "u32", Size: 4}, Linkage: btf.GlobalVar}, Offset: 0, Size: 4},
+					},
+				},
+			},
+		},
+	}
+
+	coll, err := NewCollection(cs)
+	testutils.SkipIfNotSupported(t, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer coll.Close()
+
+	oldInterval := variablePollInterval
+	variablePollInterval = time.Millisecond
+	defer func() { variablePollInterval = oldInterval }()
+
+	err = WaitForVariable(coll, "ready", uint32(1), 20*time.Millisecond)
+	if !errors.Is(err, os.ErrDeadlineExceeded) {
+		t.Fatal("Expected os.ErrDeadlineExceeded, got", err)
+	}
+
+	written := make(chan error, 1)
+	go func() {
+		time.Sleep(20 * time.Millisecond)
+		written <- coll.WriteVariable("ready", uint32(1))
+	}()
+
+	if err := WaitForVariable(coll, "ready", uint32(1), 10*time.Second); err != nil {
+		t.Fatal("Can't wait for variable:", err)
+	}
+	if err := <-written; err != nil {
+		t.Fatal("Can't write variable:", err)
+	}
+
+	if err := WaitForVariable(coll, "ready", uint64(1), time.Second); err == nil {
+		t.Error("WaitForVariable accepts a value of the wrong size")
+	}
+
+	if err := WaitForVariable(coll, "bogus", uint32(1), time.Second); err == nil {
+		t.Error("WaitForVariable accepts a missing variable")
+	}
+}
+
+func TestCollectionVariables(t *testing.T) {
+	u32 := &btf.Int{Name: "u32", Size: 4}
+	newVar := func(name string) *btf.Var {
+		return &btf.Var{Name: name, Type: u32, Linkage: btf.GlobalVar}
+	}
+
+	cs := &CollectionSpec{
+		Maps: map[string]*MapSpec{
+			".bss": {
+				Name:       ".bss",
+				Type:       Array,
+				KeySize:    4,
+				ValueSize:  8,
+				MaxEntries: 1,
+				Value: &btf.Datasec{
+					Name: ".bss",
+					Size: 8,
+					Vars: []btf.VarSecinfo{
+						{Type: newVar("counter"), Offset: 0, Size: 4},
+						{Type: newVar("config"), Offset: 4, Size: 4},
+					},
+				},
+			},
+		},
+	}
+
+	coll, err := NewCollection(cs)
+	testutils.SkipIfNotSupported(t, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer coll.Close()
+
+	if err := coll.WriteVariable("config", uint32(42)); err != nil {
+		t.Fatal("Can't write variable:", err)
+	}
+
+	var counter, config uint32
+	if err := coll.ReadVariable("config", &config); err != nil {
+		t.Fatal("Can't read variable:", err)
+	}
+	if config != 42 {
+		t.Error("Expected config to be 42, got", config)
+	}
+
+	if err := coll.ReadVariable("counter", &counter); err != nil {
+		t.Fatal("Can't read variable:", err)
+	}
+	if counter != 0 {
+		t.Error("Writing config modified counter:", counter)
+	}
+
+	if err := coll.WriteVariable("config", uint64(1)); err == nil {
+		t.Error("Writing a value of the wrong size doesn't fail")
+	}
+
+	if err := coll.ReadVariable("bogus", &config); err == nil {
+		t.Error("Reading a missing variable doesn't fail")
+	}
+}
@@ -0,0 +1,29 @@
+package ebpf
+
+import (
+	"bytes"
+)
+
+// CStringEquals returns true if the NUL-terminated byte array b, as commonly
+// found in structs shared with BPF (e.g. a task's comm), is equal to s.
+//
+// It is equivalent to unix.ByteSliceToString(b) == s, but doesn't allocate.
+// If b contains no NUL the whole slice is compared.
+func CStringEquals(b []byte, s string) bool {
+	n := cStringLen(b)
+	if n != len(s) {
+		return false
+	}
+
+	// The compiler elides the allocation for the conversion.
+	return string(b[:n]) == s
+}
+
+// cStringLen returns the number of bytes before the first NUL in b, or
+// len(b) if there is no NUL.
+func cStringLen(b []byte) int {
+	if n := bytes.IndexByte(b, 0); n >= 0 {
+		return n
+	}
+	return len(b)
+}
@@ -0,0 +1,39 @@
+package ebpf
+
+import (
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/cilium/ebpf/internal/unix"
+)
+
+func TestCStringEquals(t *testing.T) {
+	for _, tc := range []struct {
+		in   []byte
+		want string
+	}{
+		{nil, ""},
+		{[]byte{0, 'a'}, ""},
+		{[]byte("sipp\x00\x00\x00\x00"), "sipp"},
+		{[]byte("sipp\x00garbage"), "sipp"},
+		{[]byte("no terminator"), "no terminator"},
+	} {
+		qt.Assert(t, unix.ByteSliceToString(tc.in), qt.Equals, tc.want)
+		qt.Assert(t, CStringEquals(tc.in, tc.want), qt.IsTrue)
+	}
+
+	comm := [16]byte{'s', 'i', 'p', 'p'}
+	qt.Assert(t, CStringEquals(comm[:], "sipp"), qt.IsTrue)
+	qt.Assert(t, CStringEquals(comm[:], "sip"), qt.IsFalse)
+	qt.Assert(t, CStringEquals(comm[:], "sippy"), qt.IsFalse)
+	qt.Assert(t, CStringEquals(comm[:], "sipp\x00"), qt.IsFalse)
+}
+
+func TestCStringEqualsAllocs(t *testing.T) {
+	comm := [16]byte{'s', 'i', 'p', 'p'}
+	allocs := testing.AllocsPerRun(10, func() {
+		CStringEquals(comm[:], "sipp")
+	})
+	qt.Assert(t, allocs, qt.Equals, float64(0))
+}
@@ -0,0 +1,150 @@
+package ebpf
+
+import (
+	"fmt"
+	"sort"
+)
+
+// SpecDiffKind describes how an object differs between two CollectionSpecs.
+type SpecDiffKind int
+
+const (
+	// The object only exists in the second spec.
+	SpecAdded SpecDiffKind = iota
+	// The object only exists in the first spec.
+	SpecRemoved
+	// The object exists in both specs, but a field differs.
+	SpecChanged
+)
+
+func (k SpecDiffKind) String() string {
+	switch k {
+	case SpecAdded:
+		return "added"
+	case SpecRemoved:
+		return "removed"
+	case SpecChanged:
+		return "changed"
+	default:
+		return fmt.Sprintf("SpecDiffKind(%d)", int(k))
+	}
+}
+
+// SpecDiff is a difference between the maps or programs of two
+// CollectionSpecs, as returned by DiffSpecs.
+type SpecDiff struct {
+	Kind SpecDiffKind
+
+	// Name of the map or program which differs. Exactly one of the two
+	// is set.
+	Map, Program string
+
+	// Name of the MapSpec or ProgramSpec field which differs, for example
+	// "ValueSize". Only set if Kind is SpecChanged.
+	Field string
+
+	// The value of Field in the first and the second spec.
+	Old, New interface{}
+}
+
+func (sd SpecDiff) String() string {
+	obj := "map " + sd.Map
+	if sd.Program != "" {
+		obj = "program " + sd.Program
+	}
+
+	if sd.Kind != SpecChanged {
+		return fmt.Sprintf("%s %s", obj, sd.Kind)
+	}
+
+	return fmt.Sprintf("%s: %s changed from %v to %v", obj, sd.Field, sd.Old, sd.New)
+}
+
+// DiffSpecs compares the maps and programs of two CollectionSpecs.
+//
+// Maps are compared by type, key and value size, maximum number of entries,
+// flags and pinning. Any of these differences makes a map incompatible with
+// a map pinned by the other spec. Programs are compared by type, attach type
+// and attach target. Instructions and type information are not compared.
+//
+// Returns differences to maps before programs, each ordered by name.
+func DiffSpecs(a, b *CollectionSpec) []SpecDiff {
+	var diffs []SpecDiff
+
+	for _, name := range sortedNames(a.Maps, b.Maps) {
+		am, bm := a.Maps[name], b.Maps[name]
+		switch {
+		case bm == nil:
+			diffs = append(diffs, SpecDiff{Kind: SpecRemoved, Map: name})
+		case am == nil:
+			diffs = append(diffs, SpecDiff{Kind: SpecAdded, Map: name})
+		default:
+			for _, field := range []struct {
+				name     string
+				old, new interface{}
+			}{
+				{"Type", am.Type, bm.Type},
+				{"KeySize", am.KeySize, bm.KeySize},
+				{"ValueSize", am.ValueSize, bm.ValueSize},
+				{"MaxEntries", am.MaxEntries, bm.MaxEntries},
+				{"Flags", am.Flags, bm.Flags},
+				{"Pinning", am.Pinning, bm.Pinning},
+			} {
+				if field.old != field.new {
+					diffs = append(diffs, SpecDiff{SpecChanged, name, "", field.name, field.old, field.new})
+				}
+			}
+		}
+	}
+
+	for _, name := range sortedNames(a.Programs, b.Programs) {
+		ap, bp := a.Programs[name], b.Programs[name]
+		switch {
+		case bp == nil:
+			diffs = append(diffs, SpecDiff{Kind: SpecRemoved, Program: name})
+		case ap == nil:
+			diffs = append(diffs, SpecDiff{Kind: SpecAdded, Program: name})
+		default:
+			for _, field := range []struct {
+				name     string
+				old, new interface{}
+			}{
+				{"Type", ap.Type, bp.Type},
+				{"AttachType", ap.AttachType, bp.AttachType},
+				{"AttachTo", ap.AttachTo, bp.AttachTo},
+			} {
+				if field.old != field.new {
+					diffs = append(diffs, SpecDiff{SpecChanged, "", name, field.name, field.old, field.new})
+				}
+			}
+		}
+	}
+
+	return diffs
+}
+
+// sortedNames returns the union of the keys of a and b in ascending order.
+//
+// a and b must be of type map[string]*MapSpec or map[string]*ProgramSpec.
+func sortedNames(a, b interface{}) []string {
+	set := make(map[string]struct{})
+	for _, m := range []interface{}{a, b} {
+		switch m := m.(type) {
+		case map[string]*MapSpec:
+			for name := range m {
+				set[name] = struct{}{}
+			}
+		case map[string]*ProgramSpec:
+			for name := range m {
+				set[name] = struct{}{}
+			}
+		}
+	}
+
+	names := make([]string, 0, len(set))
+	for name := range set {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,48 @@
+package ebpf
+
+import (
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestDiffSpecs(t *testing.T) {
+	a := &CollectionSpec{
+		Maps: map[string]*MapSpec{
+			"events":  {Type: RingBuf, MaxEntries: 4096},
+			"counts":  {Type: Hash, KeySize: 4, ValueSize: 8, MaxEntries: 10, Pinning: PinByName},
+			"removed": {Type: Array},
+		},
+		Programs: map[string]*ProgramSpec{
+			"probe": {Type: Kprobe, AttachTo: "vprintk"},
+			"old":   {Type: SocketFilter},
+		},
+	}
+
+	b := &CollectionSpec{
+		Maps: map[string]*MapSpec{
+			"events": {Type: RingBuf, MaxEntries: 4096},
+			"counts": {Type: Hash, KeySize: 4, ValueSize: 16, MaxEntries: 20, Pinning: PinByName},
+			"added":  {Type: Array},
+		},
+		Programs: map[string]*ProgramSpec{
+			"probe": {Type: Kprobe, AttachTo: "printk"},
+			"new":   {Type: SocketFilter},
+		},
+	}
+
+	qt.Assert(t, DiffSpecs(a, b), qt.DeepEquals, []SpecDiff{
+		{Kind: SpecAdded, Map: "added"},
+		{SpecChanged, "counts", "", "ValueSize", uint32(8), uint32(16)},
+		{SpecChanged, "counts", "", "MaxEntries", uint32(10), uint32(20)},
+		{Kind: SpecRemoved, Map: "removed"},
+		{Kind: SpecAdded, Program: "new"},
+		{Kind: SpecRemoved, Program: "old"},
+		{SpecChanged, "", "probe", "AttachTo", "vprintk", "printk"},
+	})
+
+	qt.Assert(t, DiffSpecs(a, a), qt.HasLen, 0)
+
+	diff := SpecDiff{SpecChanged, "counts", "", "ValueSize", uint32(8), uint32(16)}
+	qt.Assert(t, diff.String(), qt.Equals, "map counts: ValueSize changed from 8 to 16")
+}
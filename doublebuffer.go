@@ -0,0 +1,99 @@
+package ebpf
+
+import (
+	"fmt"
+	"sync"
+)
+
+// DoubleBuffer flips an eBPF program between writing to one of two identical
+// maps, so that user space can drain the other one without racing the
+// program.
+//
+// The active map is selected either by storing it in an ArrayOfMaps or
+// HashOfMaps, or by storing its index (0 or 1) as a uint32 in any other map
+// with a four byte value. The program looks up the selector on every
+// invocation. Constants in .rodata can't be used as a selector since they are
+// frozen once the program is loaded; use a global variable in .data or a
+// dedicated map instead.
+//
+// It is safe for concurrent use.
+type DoubleBuffer struct {
+	mu       sync.Mutex
+	selector *Map
+	key      interface{}
+	buffers  [2]*Map
+	active   int
+}
+
+// NewDoubleBuffer creates a DoubleBuffer which writes the active map to key
+// in selector. a becomes the active map.
+//
+// Returns an error if a and b don't have the same type, key and value size,
+// maximum number of entries and flags. The DoubleBuffer doesn't take
+// ownership of any of the maps.
+func NewDoubleBuffer(selector *Map, key interface{}, a, b *Map) (*DoubleBuffer, error) {
+	if a.Type() != b.Type() || a.KeySize() != b.KeySize() || a.ValueSize() != b.ValueSize() ||
+		a.MaxEntries() != b.MaxEntries() || a.Flags() != b.Flags() {
+		return nil, fmt.Errorf("maps %s and %s: %w", a, b, ErrMapIncompatible)
+	}
+
+	switch selector.Type() {
+	case ArrayOfMaps, HashOfMaps:
+	default:
+		if selector.ValueSize() != 4 {
+			return nil, fmt.Errorf("selector %s: value size %d is not a uint32 index", selector, selector.ValueSize())
+		}
+	}
+
+	db := &DoubleBuffer{
+		selector: selector,
+		key:      key,
+		buffers:  [2]*Map{a, b},
+	}
+
+	if err := db.activate(0); err != nil {
+		return nil, err
+	}
+
+	return db, nil
+}
+
+// Active returns the map the program currently writes to.
+func (db *DoubleBuffer) Active() *Map {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	return db.buffers[db.active]
+}
+
+// Swap makes the inactive map the active one, and returns the map which was
+// active until now so that it can be drained.
+//
+// The program may still be writing to the returned map for the duration of
+// an invocation that started before the swap.
+func (db *DoubleBuffer) Swap() (*Map, error) {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+
+	prev := db.active
+	if err := db.activate(1 - prev); err != nil {
+		return nil, err
+	}
+
+	return db.buffers[prev], nil
+}
+
+func (db *DoubleBuffer) activate(index int) error {
+	var value interface{} = uint32(index)
+	switch db.selector.Type() {
+	case ArrayOfMaps, HashOfMaps:
+		value = db.buffers[index]
+	}
+
+	if err := db.selector.Put(db.key, value); err != nil {
+		return fmt.Errorf("activate map %s: %w", db.buffers[index], err)
+	}
+
+	db.active = index
+	return nil
+}
@@ -0,0 +1,93 @@
+package ebpf
+
+import (
+	"errors"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/cilium/ebpf/internal/testutils"
+)
+
+func TestDoubleBuffer(t *testing.T) {
+	newArray := func(t *testing.T, maxEntries uint32) *Map {
+		t.Helper()
+
+		m, err := NewMap(&MapSpec{
+			Type:       Array,
+			KeySize:    4,
+			ValueSize:  4,
+			MaxEntries: maxEntries,
+		})
+		qt.Assert(t, err, qt.IsNil)
+		t.Cleanup(func() { m.Close() })
+		return m
+	}
+
+	a, b := newArray(t, 2), newArray(t, 2)
+
+	_, err := NewDoubleBuffer(newArray(t, 1), uint32(0), a, newArray(t, 3))
+	qt.Assert(t, errors.Is(err, ErrMapIncompatible), qt.IsTrue)
+
+	t.Run("index", func(t *testing.T) {
+		selector := newArray(t, 1)
+		db, err := NewDoubleBuffer(selector, uint32(0), a, b)
+		qt.Assert(t, err, qt.IsNil)
+		qt.Assert(t, db.Active(), qt.Equals, a)
+
+		var index uint32
+		inactive, err := db.Swap()
+		qt.Assert(t, err, qt.IsNil)
+		qt.Assert(t, inactive, qt.Equals, a)
+		qt.Assert(t, db.Active(), qt.Equals, b)
+		qt.Assert(t, selector.Lookup(uint32(0), &index), qt.IsNil)
+		qt.Assert(t, index, qt.Equals, uint32(1))
+
+		inactive, err = db.Swap()
+		qt.Assert(t, err, qt.IsNil)
+		qt.Assert(t, inactive, qt.Equals, b)
+		qt.Assert(t, selector.Lookup(uint32(0), &index), qt.IsNil)
+		qt.Assert(t, index, qt.Equals, uint32(0))
+	})
+
+	t.Run("map of maps", func(t *testing.T) {
+		testutils.SkipOnOldKernel(t, "4.12", "maps of maps")
+
+		selector, err := NewMap(&MapSpec{
+			Type:       ArrayOfMaps,
+			KeySize:    4,
+			ValueSize:  4,
+			MaxEntries: 1,
+			InnerMap: &MapSpec{
+				Type:       Array,
+				KeySize:    4,
+				ValueSize:  4,
+				MaxEntries: 2,
+			},
+		})
+		qt.Assert(t, err, qt.IsNil)
+		defer selector.Close()
+
+		db, err := NewDoubleBuffer(selector, uint32(0), a, b)
+		qt.Assert(t, err, qt.IsNil)
+
+		activeID := func() MapID {
+			var id uint32
+			qt.Assert(t, selector.Lookup(uint32(0), &id), qt.IsNil)
+			return MapID(id)
+		}
+
+		aInfo, err := a.Info()
+		qt.Assert(t, err, qt.IsNil)
+		aID, _ := aInfo.ID()
+		bInfo, err := b.Info()
+		qt.Assert(t, err, qt.IsNil)
+		bID, _ := bInfo.ID()
+
+		qt.Assert(t, activeID(), qt.Equals, aID)
+		inactive, err := db.Swap()
+		qt.Assert(t, err, qt.IsNil)
+		qt.Assert(t, inactive, qt.Equals, a)
+		qt.Assert(t, activeID(), qt.Equals, bID)
+	})
+}
@@ -736,6 +736,7 @@ func mapSpecFromBTF(es *elfSection, vs *btf.VarSecinfo, def *btf.Struct, spec *b
 		keySize, valueSize uint32
 		mapType            MapType
 		flags, maxEntries  uint32
+		mapExtra           uint32
 		pinType            PinType
 		innerMapSpec       *MapSpec
 		contents           []MapKV
@@ -763,6 +764,12 @@ func mapSpecFromBTF(es *elfSection, vs *btf.VarSecinfo, def *btf.Struct, spec *b
 				return nil, fmt.Errorf("can't get BTF map max entries: %w", err)
 			}
 
+		case "map_extra":
+			mapExtra, err = uintFromBTF(member.Type)
+			if err != nil {
+				return nil, fmt.Errorf("can't get BTF map extra: %w", err)
+			}
+
 		case "key":
 			if keySize != 0 {
 				return nil, errors.New("both key and key_size given")
@@ -913,6 +920,7 @@ func mapSpecFromBTF(es *elfSection, vs *btf.VarSecinfo, def *btf.Struct, spec *b
 		ValueSize:  valueSize,
 		MaxEntries: maxEntries,
 		Flags:      flags,
+		MapExtra:   uint64(mapExtra),
 		Key:        key,
 		Value:      value,
 		BTF:        spec,
@@ -0,0 +1,41 @@
+package events
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+
+	"github.com/cilium/ebpf/internal"
+)
+
+// Decode unmarshals a sample into out, which must be a pointer to a fixed
+// size value such as a struct generated by bpf2go.
+//
+// order is usually the ByteOrder of the CollectionSpec the eBPF program was
+// loaded from, which makes the choice explicit instead of hard coding it in
+// each read loop. A nil order uses the host's native byte order, which is
+// what a CollectionSpec built for the host declares.
+//
+// Trailing bytes in raw are ignored, since samples from perf event arrays
+// contain padding. Returns an error wrapping ErrUnexpectedSize if raw is too
+// short.
+func Decode(raw []byte, order binary.ByteOrder, out interface{}) error {
+	if order == nil {
+		order = internal.NativeEndian
+	}
+
+	size := binary.Size(out)
+	if size < 0 {
+		return fmt.Errorf("can't decode into %T: not a fixed size value", out)
+	}
+
+	if len(raw) < size {
+		return fmt.Errorf("decode into %T: sample has %d bytes instead of at least %d: %w", out, len(raw), size, ErrUnexpectedSize)
+	}
+
+	if err := binary.Read(bytes.NewReader(raw), order, out); err != nil {
+		return fmt.Errorf("decode into %T: %w", out, err)
+	}
+
+	return nil
+}
@@ -0,0 +1,38 @@
+package events
+
+import (
+	"encoding/binary"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/cilium/ebpf/internal"
+)
+
+func TestDecode(t *testing.T) {
+	type event struct {
+		Pid  uint32
+		Port uint16
+		_    [2]byte
+	}
+
+	raw := []byte{1, 0, 0, 0, 2, 0, 0, 0, 0xff}
+
+	var ev event
+	qt.Assert(t, Decode(raw, binary.LittleEndian, &ev), qt.IsNil)
+	qt.Assert(t, ev.Pid, qt.Equals, uint32(1))
+	qt.Assert(t, ev.Port, qt.Equals, uint16(2))
+
+	qt.Assert(t, Decode(raw, binary.BigEndian, &ev), qt.IsNil)
+	qt.Assert(t, ev.Pid, qt.Equals, uint32(1<<24))
+	qt.Assert(t, ev.Port, qt.Equals, uint16(2<<8))
+
+	var native event
+	qt.Assert(t, Decode(raw, nil, &native), qt.IsNil)
+	var want event
+	qt.Assert(t, Decode(raw, internal.NativeEndian, &want), qt.IsNil)
+	qt.Assert(t, native, qt.Equals, want)
+
+	qt.Assert(t, Decode(raw[:7], nil, &ev), qt.ErrorIs, ErrUnexpectedSize)
+	qt.Assert(t, Decode(raw, nil, new(int)), qt.IsNotNil)
+}
@@ -0,0 +1,13 @@
+// Package events allows reading from BPF ring buffers, and falling back to
+// perf event arrays on kernels which don't support them (before Linux 5.8).
+//
+// The eBPF program must be able to submit events to either kind of map, since
+// a perf event array requires bpf_perf_event_output instead of
+// bpf_ringbuf_output or bpf_ringbuf_reserve. This is usually done with a
+// constant which is set via CollectionSpec.RewriteConstants depending on the
+// result of FallbackToPerf, and which guards the calls to the helpers. The
+// verifier removes the branch which isn't taken.
+//
+// Runner reads from several Readers concurrently, and takes care of closing
+// them and any links in the right order on shutdown.
+package events
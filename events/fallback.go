@@ -0,0 +1,62 @@
+package events
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/features"
+)
+
+// haveRingBuf is replaced in tests.
+var haveRingBuf = func() error {
+	return features.HaveMapType(ebpf.RingBuf)
+}
+
+// FallbackToPerf replaces the given ring buffer maps in spec with perf event
+// arrays if the kernel doesn't support ring buffers.
+//
+// Returns true if the maps were replaced, in which case programs must submit
+// events using bpf_perf_event_output. See the package documentation.
+func FallbackToPerf(spec *ebpf.CollectionSpec, maps ...string) (bool, error) {
+	err := haveRingBuf()
+	if err == nil {
+		return false, nil
+	}
+	if !errors.Is(err, ebpf.ErrNotSupported) {
+		return false, fmt.Errorf("detect ring buffer support: %w", err)
+	}
+
+	if err := UsePerfEventArray(spec, maps...); err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// UsePerfEventArray replaces the given ring buffer maps in spec with perf
+// event arrays, regardless of whether the kernel supports ring buffers.
+//
+// The perf event arrays have one entry for each possible CPU. Returns an error
+// if a map doesn't exist or isn't a ring buffer.
+func UsePerfEventArray(spec *ebpf.CollectionSpec, maps ...string) error {
+	for _, name := range maps {
+		ms := spec.Maps[name]
+		if ms == nil {
+			return fmt.Errorf("missing map spec %s", name)
+		}
+
+		if ms.Type != ebpf.RingBuf {
+			return fmt.Errorf("map %s: expected %s, got %s", name, ebpf.RingBuf, ms.Type)
+		}
+
+		ms.Type = ebpf.PerfEventArray
+		ms.KeySize = 0
+		ms.ValueSize = 0
+		ms.MaxEntries = 0
+		ms.Key = nil
+		ms.Value = nil
+	}
+
+	return nil
+}
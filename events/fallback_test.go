@@ -0,0 +1,59 @@
+package events
+
+import (
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/internal"
+)
+
+func TestUsePerfEventArray(t *testing.T) {
+	spec := &ebpf.CollectionSpec{
+		Maps: map[string]*ebpf.MapSpec{
+			"events": {Type: ebpf.RingBuf, MaxEntries: 4096},
+			"counts": {Type: ebpf.Hash, KeySize: 4, ValueSize: 4, MaxEntries: 1},
+		},
+	}
+
+	qt.Assert(t, UsePerfEventArray(spec, "events"), qt.IsNil)
+	qt.Assert(t, spec.Maps["events"], qt.DeepEquals, &ebpf.MapSpec{Type: ebpf.PerfEventArray})
+
+	qt.Assert(t, UsePerfEventArray(spec, "counts"), qt.IsNotNil)
+	qt.Assert(t, UsePerfEventArray(spec, "missing"), qt.IsNotNil)
+
+	m, err := ebpf.NewMap(spec.Maps["events"])
+	qt.Assert(t, err, qt.IsNil)
+	m.Close()
+}
+
+func TestFallbackToPerf(t *testing.T) {
+	defer func(orig func() error) { haveRingBuf = orig }(haveRingBuf)
+
+	for _, tt := range []struct {
+		err      error
+		fallback bool
+	}{
+		{nil, false},
+		{internal.ErrNotSupported, true},
+	} {
+		haveRingBuf = func() error { return tt.err }
+
+		spec := &ebpf.CollectionSpec{
+			Maps: map[string]*ebpf.MapSpec{
+				"events": {Type: ebpf.RingBuf, MaxEntries: 4096},
+			},
+		}
+
+		fallback, err := FallbackToPerf(spec, "events")
+		qt.Assert(t, err, qt.IsNil)
+		qt.Assert(t, fallback, qt.Equals, tt.fallback)
+
+		want := ebpf.RingBuf
+		if tt.fallback {
+			want = ebpf.PerfEventArray
+		}
+		qt.Assert(t, spec.Maps["events"].Type, qt.Equals, want)
+	}
+}
@@ -0,0 +1,222 @@
+package events
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"reflect"
+	"strings"
+
+	"github.com/cilium/ebpf/internal"
+)
+
+// JSONOptions control how a JSONReader renders events.
+type JSONOptions struct {
+	// The byte order events are decoded with, see Decode. Defaults to the
+	// host's native byte order.
+	ByteOrder binary.ByteOrder
+
+	// Names of struct fields which contain an IPv4 or IPv6 address, such as
+	// "Saddr". They are rendered as strings in the usual notation instead of
+	// numbers. The field must be four or 16 bytes long and contain the
+	// address in network byte order, like __be32 or struct in6_addr.
+	IPFields []string
+}
+
+// JSONReader reads events from a Reader, decodes them and writes them to an
+// io.Writer as newline delimited JSON, which can be piped to tools like jq.
+//
+// Struct fields become object keys in declaration order, using the name
+// from a json tag if there is one. Byte arrays such as Comm are rendered as
+// strings with trailing NUL bytes removed, and blank padding fields are
+// omitted. Lost samples are written as {"lost_samples":N}.
+type JSONReader struct {
+	rd        *Reader
+	w         io.Writer
+	typ       reflect.Type
+	order     binary.ByteOrder
+	ipFields  map[string]bool
+	lineBuf   bytes.Buffer
+	sampleBuf reflect.Value
+}
+
+// NewJSONReader creates a JSONReader which decodes events into values of the
+// same type as prototype, usually a struct generated by bpf2go.
+//
+// Closing the JSONReader closes rd.
+func NewJSONReader(rd *Reader, prototype interface{}, w io.Writer, opts *JSONOptions) (*JSONReader, error) {
+	if opts == nil {
+		opts = &JSONOptions{}
+	}
+
+	typ := reflect.TypeOf(prototype)
+	if typ == nil {
+		return nil, errors.New("prototype is nil")
+	}
+	for typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+
+	sample := reflect.New(typ)
+	if typ.Kind() == reflect.Slice || binary.Size(sample.Interface()) < 0 {
+		return nil, fmt.Errorf("can't decode into %s: not a fixed size value", typ)
+	}
+
+	order := opts.ByteOrder
+	if order == nil {
+		order = internal.NativeEndian
+	}
+
+	ipFields := make(map[string]bool, len(opts.IPFields))
+	for _, name := range opts.IPFields {
+		ipFields[name] = true
+	}
+
+	return &JSONReader{
+		rd:        rd,
+		w:         w,
+		typ:       typ,
+		order:     order,
+		ipFields:  ipFields,
+		sampleBuf: sample,
+	}, nil
+}
+
+// Next reads a single event and writes it as a line of JSON.
+//
+// Blocks until an event is available. Returns an error wrapping ErrClosed if
+// the JSONReader is closed.
+func (jr *JSONReader) Next() error {
+	rec, err := jr.rd.Read()
+	if err != nil {
+		return err
+	}
+
+	jr.lineBuf.Reset()
+	if rec.LostSamples > 0 {
+		fmt.Fprintf(&jr.lineBuf, "{\"lost_samples\":%d}\n", rec.LostSamples)
+	} else {
+		if err := Decode(rec.RawSample, jr.order, jr.sampleBuf.Interface()); err != nil {
+			return err
+		}
+
+		if err := jr.encode(&jr.lineBuf, jr.sampleBuf.Elem(), ""); err != nil {
+			return fmt.Errorf("encode %s: %w", jr.typ, err)
+		}
+		jr.lineBuf.WriteByte('\n')
+	}
+
+	_, err = jr.w.Write(jr.lineBuf.Bytes())
+	return err
+}
+
+// Copy writes events until the JSONReader is closed, in which case it
+// returns nil, or an error occurs.
+func (jr *JSONReader) Copy() error {
+	for {
+		err := jr.Next()
+		if errors.Is(err, ErrClosed) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// Close the underlying Reader.
+//
+// It interrupts calls to Next and Copy.
+func (jr *JSONReader) Close() error {
+	return jr.rd.Close()
+}
+
+// encode writes v to buf. field is the name of the struct field v was taken
+// from, if any.
+func (jr *JSONReader) encode(buf *bytes.Buffer, v reflect.Value, field string) error {
+	if jr.ipFields[field] {
+		var raw bytes.Buffer
+		if err := binary.Write(&raw, jr.order, v.Interface()); err != nil {
+			return fmt.Errorf("field %s: %w", field, err)
+		}
+		if raw.Len() != net.IPv4len && raw.Len() != net.IPv6len {
+			return fmt.Errorf("field %s: %d bytes can't be an IP address", field, raw.Len())
+		}
+		return jr.encodeJSON(buf, net.IP(raw.Bytes()).String())
+	}
+
+	switch v.Kind() {
+	case reflect.Struct:
+		buf.WriteByte('{')
+		first := true
+		for i := 0; i < v.NumField(); i++ {
+			sf := v.Type().Field(i)
+			if sf.Name == "_" || sf.PkgPath != "" {
+				continue
+			}
+
+			name := sf.Name
+			if tag := strings.Split(sf.Tag.Get("json"), ",")[0]; tag == "-" {
+				continue
+			} else if tag != "" {
+				name = tag
+			}
+
+			if !first {
+				buf.WriteByte(',')
+			}
+			first = false
+
+			if err := jr.encodeJSON(buf, name); err != nil {
+				return err
+			}
+			buf.WriteByte(':')
+			if err := jr.encode(buf, v.Field(i), sf.Name); err != nil {
+				return err
+			}
+		}
+		buf.WriteByte('}')
+		return nil
+
+	case reflect.Array:
+		switch v.Type().Elem().Kind() {
+		case reflect.Uint8, reflect.Int8:
+			str := make([]byte, v.Len())
+			for i := range str {
+				str[i] = byte(v.Index(i).Convert(reflect.TypeOf(byte(0))).Uint())
+			}
+			if i := bytes.IndexByte(str, 0); i != -1 {
+				str = str[:i]
+			}
+			return jr.encodeJSON(buf, string(str))
+
+		case reflect.Struct, reflect.Array:
+			buf.WriteByte('[')
+			for i := 0; i < v.Len(); i++ {
+				if i > 0 {
+					buf.WriteByte(',')
+				}
+				if err := jr.encode(buf, v.Index(i), ""); err != nil {
+					return err
+				}
+			}
+			buf.WriteByte(']')
+			return nil
+		}
+	}
+
+	return jr.encodeJSON(buf, v.Interface())
+}
+
+func (jr *JSONReader) encodeJSON(buf *bytes.Buffer, v interface{}) error {
+	out, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	buf.Write(out)
+	return nil
+}
@@ -0,0 +1,60 @@
+package events
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/internal/testutils"
+	"github.com/cilium/ebpf/ringbuf/ringbuftest"
+)
+
+func TestJSONReader(t *testing.T) {
+	testutils.SkipOnOldKernel(t, "5.8", "BPF ring buffer")
+
+	type event struct {
+		Pid   uint32
+		Saddr [4]byte
+		Comm  [8]int8
+		Port  uint16 `json:"port"`
+		_     [2]byte
+		Args  [2]uint32
+	}
+
+	events, err := ebpf.NewMap(&ebpf.MapSpec{
+		Type:       ebpf.RingBuf,
+		MaxEntries: uint32(os.Getpagesize()),
+	})
+	qt.Assert(t, err, qt.IsNil)
+	defer events.Close()
+
+	sub, err := ringbuftest.NewSubmitter(events, binary.Size(event{}))
+	qt.Assert(t, err, qt.IsNil)
+	defer sub.Close()
+
+	rd, err := NewReader(events, 0)
+	qt.Assert(t, err, qt.IsNil)
+
+	var out bytes.Buffer
+	jr, err := NewJSONReader(rd, &event{}, &out, &JSONOptions{IPFields: []string{"Saddr"}})
+	qt.Assert(t, err, qt.IsNil)
+	defer jr.Close()
+
+	ev := event{Pid: 42, Saddr: [4]byte{192, 0, 2, 1}, Port: 80, Args: [2]uint32{1, 2}}
+	copy(ev.Comm[:], []int8{'c', 'u', 'r', 'l'})
+	qt.Assert(t, sub.Submit(&ev), qt.IsNil)
+	qt.Assert(t, jr.Next(), qt.IsNil)
+
+	qt.Assert(t, out.String(), qt.Equals,
+		`{"Pid":42,"Saddr":"192.0.2.1","Comm":"curl","port":80,"Args":[1,2]}`+"\n")
+
+	qt.Assert(t, jr.Close(), qt.IsNil)
+	qt.Assert(t, jr.Copy(), qt.IsNil)
+
+	_, err = NewJSONReader(rd, []byte{}, &out, nil)
+	qt.Assert(t, err, qt.IsNotNil)
+}
@@ -0,0 +1,100 @@
+package events
+
+import (
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/perf"
+	"github.com/cilium/ebpf/ringbuf"
+)
+
+var (
+	// ErrClosed is returned by Read when the Reader is closed.
+	ErrClosed = os.ErrClosed
+	// ErrUnexpectedSize is returned by AssertSize.
+	ErrUnexpectedSize = errors.New("unexpected sample size")
+)
+
+// AssertSize returns an error wrapping ErrUnexpectedSize if raw is shorter
+// than size bytes. Use it to check a sample before decoding it, with a size
+// obtained from BTF such as the <type>Size constants generated by bpf2go.
+//
+// Longer samples are accepted since samples read from a perf event array
+// contain up to 7 bytes of trailing padding.
+func AssertSize(raw []byte, size int) error {
+	if len(raw) < size {
+		return fmt.Errorf("sample has %d bytes instead of at least %d: %w", len(raw), size, ErrUnexpectedSize)
+	}
+	return nil
+}
+
+// Record contains an event read from a ring buffer or perf event array.
+type Record struct {
+	// The event as submitted by the eBPF program. Events from perf event
+	// arrays may contain up to 7 bytes of trailing garbage.
+	RawSample []byte
+
+	// The number of events which were lost since the previous Record,
+	// because the perf event array was full. In this case RawSample is nil.
+	// Always zero for ring buffers, which make the eBPF program handle a
+	// full buffer instead.
+	LostSamples uint64
+}
+
+// Reader reads events from either a ring buffer or a perf event array.
+type Reader struct {
+	ring *ringbuf.Reader
+	perf *perf.Reader
+}
+
+// NewReader creates a Reader for a ring buffer or perf event array.
+//
+// perCPUBuffer is the size in bytes of the buffer allocated for each CPU if
+// events is a perf event array, see perf.NewReader. It is ignored for ring
+// buffers, whose size is fixed when creating the map.
+func NewReader(events *ebpf.Map, perCPUBuffer int) (*Reader, error) {
+	switch events.Type() {
+	case ebpf.RingBuf:
+		rd, err := ringbuf.NewReader(events)
+		if err != nil {
+			return nil, err
+		}
+		return &Reader{ring: rd}, nil
+
+	case ebpf.PerfEventArray:
+		rd, err := perf.NewReader(events, perCPUBuffer)
+		if err != nil {
+			return nil, err
+		}
+		return &Reader{perf: rd}, nil
+
+	default:
+		return nil, fmt.Errorf("can't read events from map type %s", events.Type())
+	}
+}
+
+// Read the next event.
+//
+// Blocks until an event is available. Calling Close interrupts the function,
+// which then returns an error wrapping ErrClosed.
+func (r *Reader) Read() (Record, error) {
+	if r.ring != nil {
+		rec, err := r.ring.Read()
+		return Record{RawSample: rec.RawSample}, err
+	}
+
+	rec, err := r.perf.Read()
+	return Record{RawSample: rec.RawSample, LostSamples: rec.LostSamples}, err
+}
+
+// Close frees resources used by the reader.
+//
+// It interrupts calls to Read.
+func (r *Reader) Close() error {
+	if r.ring != nil {
+		return r.ring.Close()
+	}
+	return r.perf.Close()
+}
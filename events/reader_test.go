@@ -0,0 +1,97 @@
+package events
+
+import (
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/asm"
+	"github.com/cilium/ebpf/internal/testutils"
+)
+
+func TestReader(t *testing.T) {
+	for _, spec := range []*ebpf.MapSpec{
+		{Type: ebpf.RingBuf, MaxEntries: 4096},
+		{Type: ebpf.PerfEventArray},
+	} {
+		t.Run(spec.Type.String(), func(t *testing.T) {
+			if spec.Type == ebpf.RingBuf {
+				testutils.SkipOnOldKernel(t, "5.8", "BPF ring buffer")
+			}
+
+			m, err := ebpf.NewMap(spec)
+			qt.Assert(t, err, qt.IsNil)
+			defer m.Close()
+
+			rd, err := NewReader(m, 4096)
+			qt.Assert(t, err, qt.IsNil)
+
+			errs := make(chan error, 1)
+			go func() {
+				_, err := rd.Read()
+				errs <- err
+			}()
+
+			qt.Assert(t, rd.Close(), qt.IsNil)
+			qt.Assert(t, <-errs, qt.ErrorIs, ErrClosed)
+		})
+	}
+
+	m, err := ebpf.NewMap(&ebpf.MapSpec{Type: ebpf.Array, KeySize: 4, ValueSize: 4, MaxEntries: 1})
+	qt.Assert(t, err, qt.IsNil)
+	defer m.Close()
+
+	_, err = NewReader(m, 4096)
+	qt.Assert(t, err, qt.IsNotNil)
+}
+
+func TestAssertSize(t *testing.T) {
+	qt.Assert(t, AssertSize(make([]byte, 4), 4), qt.IsNil)
+	qt.Assert(t, AssertSize(make([]byte, 3), 4), qt.ErrorIs, ErrUnexpectedSize)
+	qt.Assert(t, AssertSize(make([]byte, 5), 4), qt.IsNil)
+	qt.Assert(t, AssertSize(nil, 0), qt.IsNil)
+}
+
+func TestAssertSizePerfSample(t *testing.T) {
+	const (
+		bpfFCurrentCPU = 0xffffffff
+		sampleSize     = 5
+	)
+
+	m, err := ebpf.NewMap(&ebpf.MapSpec{Type: ebpf.PerfEventArray})
+	qt.Assert(t, err, qt.IsNil)
+	defer m.Close()
+
+	prog, err := ebpf.NewProgram(&ebpf.ProgramSpec{
+		Type:    ebpf.XDP,
+		License: "GPL",
+		Instructions: asm.Instructions{
+			asm.Mov.Imm(asm.R2, 0),
+			asm.StoreMem(asm.RFP, -8, asm.R2, asm.DWord),
+			asm.LoadMapPtr(asm.R2, m.FD()),
+			asm.LoadImm(asm.R3, bpfFCurrentCPU, asm.DWord),
+			asm.Mov.Reg(asm.R4, asm.RFP),
+			asm.Add.Imm(asm.R4, -8),
+			asm.Mov.Imm(asm.R5, sampleSize),
+			asm.FnPerfEventOutput.Call(),
+			asm.Mov.Imm(asm.R0, 0),
+			asm.Return(),
+		},
+	})
+	qt.Assert(t, err, qt.IsNil)
+	defer prog.Close()
+
+	rd, err := NewReader(m, 4096)
+	qt.Assert(t, err, qt.IsNil)
+	defer rd.Close()
+
+	_, _, err = prog.Test(make([]byte, 14))
+	testutils.SkipIfNotSupported(t, err)
+	qt.Assert(t, err, qt.IsNil)
+
+	rec, err := rd.Read()
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, len(rec.RawSample) > sampleSize, qt.IsTrue, qt.Commentf("sample isn't padded"))
+	qt.Assert(t, AssertSize(rec.RawSample, sampleSize), qt.IsNil)
+}
@@ -0,0 +1,114 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+)
+
+// Runner reads events from several Readers until it is shut down.
+//
+// It is meant to replace the boilerplate of coordinating a signal, closing
+// readers and links, and waiting for read loops to exit:
+//
+//	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+//	defer stop()
+//
+//	var r events.Runner
+//	r.Add(rd, func(rec events.Record) error { ... })
+//	r.AddCloser(link)
+//	err := r.Run(ctx)
+//
+// The zero value is ready to use.
+type Runner struct {
+	loops   []readLoop
+	closers []io.Closer
+}
+
+type readLoop struct {
+	rd *Reader
+	fn func(Record) error
+}
+
+// Add registers a Reader, and a callback which is invoked for each Record
+// read from it.
+//
+// The callback is invoked from a separate goroutine for each Reader. Returning
+// an error from it shuts down the Runner.
+func (r *Runner) Add(rd *Reader, fn func(Record) error) {
+	r.loops = append(r.loops, readLoop{rd, fn})
+}
+
+// AddCloser registers a resource which is closed when the Runner shuts down,
+// usually a link which submits events to one of the Readers.
+func (r *Runner) AddCloser(c io.Closer) {
+	r.closers = append(r.closers, c)
+}
+
+// Run reads from all Readers until ctx is cancelled, or until reading from a
+// Reader or a callback fails.
+//
+// On shutdown it closes resources added via AddCloser in the reverse order of
+// registration, so that no more events are submitted. It then closes all
+// Readers and waits for all callbacks to return.
+//
+// Returns the first error from reading or invoking a callback, or the first
+// error from closing a resource. Returns nil if ctx was cancelled and all
+// resources were closed successfully.
+func (r *Runner) Run(ctx context.Context) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+
+	fail := func(err error) {
+		errOnce.Do(func() { firstErr = err })
+		cancel()
+	}
+
+	for i, loop := range r.loops {
+		wg.Add(1)
+		go func(i int, loop readLoop) {
+			defer wg.Done()
+
+			for {
+				rec, err := loop.rd.Read()
+				if errors.Is(err, ErrClosed) {
+					return
+				}
+				if err != nil {
+					fail(fmt.Errorf("reader %d: %w", i, err))
+					return
+				}
+
+				if err := loop.fn(rec); err != nil {
+					fail(fmt.Errorf("reader %d: %w", i, err))
+					return
+				}
+			}
+		}(i, loop)
+	}
+
+	<-ctx.Done()
+
+	for i := len(r.closers) - 1; i >= 0; i-- {
+		if err := r.closers[i].Close(); err != nil {
+			fail(fmt.Errorf("close: %w", err))
+		}
+	}
+
+	for i, loop := range r.loops {
+		if err := loop.rd.Close(); err != nil {
+			fail(fmt.Errorf("close reader %d: %w", i, err))
+		}
+	}
+
+	wg.Wait()
+	return firstErr
+}
@@ -0,0 +1,94 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/internal/testutils"
+)
+
+func TestRunner(t *testing.T) {
+	testutils.SkipOnOldKernel(t, "5.8", "BPF ring buffer")
+
+	m, err := ebpf.NewMap(&ebpf.MapSpec{Type: ebpf.RingBuf, MaxEntries: 4096})
+	qt.Assert(t, err, qt.IsNil)
+	defer m.Close()
+
+	prog := mustOutputProg(t, m)
+
+	rd, err := NewReader(m, 0)
+	qt.Assert(t, err, qt.IsNil)
+
+	var closed []string
+	var r Runner
+	r.AddCloser(closerFunc(func() error { closed = append(closed, "first"); return nil }))
+	r.AddCloser(closerFunc(func() error { closed = append(closed, "second"); return nil }))
+
+	errStop := errors.New("stop")
+	var records int
+	r.Add(rd, func(rec Record) error {
+		qt.Check(t, rec.RawSample, qt.HasLen, 8)
+		records++
+		if records == 2 {
+			return errStop
+		}
+		return nil
+	})
+
+	for i := 0; i < 2; i++ {
+		_, _, err := prog.Test(make([]byte, 14))
+		qt.Assert(t, err, qt.IsNil)
+	}
+
+	err = r.Run(context.Background())
+	qt.Assert(t, err, qt.ErrorIs, errStop)
+	qt.Assert(t, records, qt.Equals, 2)
+	qt.Assert(t, closed, qt.DeepEquals, []string{"second", "first"})
+
+	_, err = rd.Read()
+	qt.Assert(t, err, qt.ErrorIs, ErrClosed, qt.Commentf("reader wasn't closed"))
+}
+
+func TestRunnerCancel(t *testing.T) {
+	testutils.SkipOnOldKernel(t, "5.8", "BPF ring buffer")
+
+	m, err := ebpf.NewMap(&ebpf.MapSpec{Type: ebpf.RingBuf, MaxEntries: 4096})
+	qt.Assert(t, err, qt.IsNil)
+	defer m.Close()
+
+	rd, err := NewReader(m, 0)
+	qt.Assert(t, err, qt.IsNil)
+
+	var r Runner
+	r.Add(rd, func(Record) error { return nil })
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	qt.Assert(t, r.Run(ctx), qt.IsNil)
+}
+
+type closerFunc func() error
+
+func (fn closerFunc) Close() error { return fn() }
+
+// mustOutputProg returns a program which submits an 8 byte event to a ring
+// buffer each time it is run.
+func mustOutputProg(tb testing.TB, events *ebpf.Map) *ebpf.Program {
+	tb.Helper()
+
+	prog, err := ebpf.NewProgram(&ebpf.ProgramSpec{
+		Type:         ebpf.SocketFilter,
+		License:      "MIT",
+		Instructions: testutils.RingbufOutputInstructions(events.FD()),
+	})
+	if err != nil {
+		tb.Fatal(err)
+	}
+	tb.Cleanup(func() { prog.Close() })
+
+	return prog
+}
@@ -21,6 +21,9 @@ type bpfEvent struct {
 	Daddr uint32
 }
 
+// bpfEventSize is the size of bpfEvent in bytes, according to BTF.
+const bpfEventSize = 28
+
 // loadBpf returns the embedded CollectionSpec for bpf.
 func loadBpf() (*ebpf.CollectionSpec, error) {
 	reader := bytes.NewReader(_BpfBytes)
@@ -21,6 +21,9 @@ type bpfEvent struct {
 	Msg  [500]uint8
 }
 
+// bpfEventSize is the size of bpfEvent in bytes, according to BTF.
+const bpfEventSize = 592
+
 // loadBpf returns the embedded CollectionSpec for bpf.
 func loadBpf() (*ebpf.CollectionSpec, error) {
 	reader := bytes.NewReader(_BpfBytes)
@@ -18,6 +18,9 @@ type bpfEvent struct {
 	Line [80]uint8
 }
 
+// bpfEventSize is the size of bpfEvent in bytes, according to BTF.
+const bpfEventSize = 84
+
 // loadBpf returns the embedded CollectionSpec for bpf.
 func loadBpf() (*ebpf.CollectionSpec, error) {
 	reader := bytes.NewReader(_BpfBytes)
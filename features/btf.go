@@ -0,0 +1,34 @@
+package features
+
+import (
+	"errors"
+	"os"
+
+	"github.com/cilium/ebpf/btf"
+	"github.com/cilium/ebpf/internal"
+)
+
+// HaveKernelBTF probes the running kernel for BTF describing its own types,
+// which is required for CO-RE relocations and tracing programs like fentry.
+//
+// Kernel BTF is either exposed via /sys/kernel/btf/vmlinux or by a vmlinux
+// ELF in one of the well-known locations on disk.
+//
+// See the package documentation for the meaning of the error return value.
+func HaveKernelBTF() error {
+	return haveKernelBTF()
+}
+
+var haveKernelBTF = internal.FeatureTest("kernel BTF", "5.4", func() error {
+	_, err := os.Stat("/sys/kernel/btf/vmlinux")
+	if err == nil {
+		return nil
+	}
+	if !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	// Scans the file system for a vmlinux ELF with BTF.
+	_, err = btf.LoadKernelSpec()
+	return err
+})
@@ -0,0 +1,15 @@
+package features
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/cilium/ebpf"
+)
+
+func TestHaveKernelBTF(t *testing.T) {
+	err := HaveKernelBTF()
+	if err != nil && !errors.Is(err, ebpf.ErrNotSupported) {
+		t.Fatal("Unexpected error:", err)
+	}
+}
@@ -1,6 +1,7 @@
 package features
 
 import (
+	"bytes"
 	"errors"
 	"fmt"
 	"os"
@@ -8,6 +9,8 @@ import (
 	"unsafe"
 
 	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/asm"
+	"github.com/cilium/ebpf/internal"
 	"github.com/cilium/ebpf/internal/sys"
 	"github.com/cilium/ebpf/internal/unix"
 )
@@ -60,8 +63,9 @@ func createMapTypeAttr(mt ebpf.MapType) *sys.MapCreateAttr {
 		var align int
 		keySize = uint32(8 + unsafe.Sizeof(align))
 		maxEntries = 0
-	case ebpf.Queue, ebpf.Stack:
-		// keySize needs to be 0, see alloc_check for queue and stack maps
+	case ebpf.Queue, ebpf.Stack, ebpf.BloomFilter:
+		// keySize needs to be 0, see alloc_check for queue, stack and bloom
+		// filter maps
 		keySize = 0
 	case ebpf.RingBuf:
 		// keySize and valueSize need to be 0
@@ -97,6 +101,10 @@ func createMapTypeAttr(mt ebpf.MapType) *sys.MapCreateAttr {
 
 // HaveMapType probes the running kernel for the availability of the specified map type.
 //
+// For RingBuf, the probe also checks that a program can reserve and discard a
+// record, since merely creating the map doesn't guarantee that the helpers
+// to use it are available.
+//
 // See the package documentation for the meaning of the error return value.
 func HaveMapType(mt ebpf.MapType) error {
 	if err := validateMaptype(mt); err != nil {
@@ -154,6 +162,9 @@ func haveMapType(mt ebpf.MapType) error {
 		err = fmt.Errorf("unexpected error during feature probe: %w", err)
 
 	default:
+		if mt == ebpf.RingBuf {
+			err = probeRingBufReserve(fd)
+		}
 		fd.Close()
 	}
 
@@ -162,6 +173,54 @@ func haveMapType(mt ebpf.MapType) error {
 	return err
 }
 
+// probeRingBufReserve checks that a program can reserve and discard a record
+// in the ring buffer rb, since some kernels allow creating a ring buffer but
+// lack the helpers to use it.
+func probeRingBufReserve(rb *sys.FD) error {
+	insns := asm.Instructions{
+		asm.LoadMapPtr(asm.R1, rb.Int()),
+		asm.Mov.Imm(asm.R2, 8),
+		asm.Mov.Imm(asm.R3, 0),
+		asm.FnRingbufReserve.Call(),
+		asm.JEq.Imm(asm.R0, 0, "exit"),
+		asm.Mov.Reg(asm.R1, asm.R0),
+		asm.Mov.Imm(asm.R2, 0),
+		asm.FnRingbufDiscard.Call(),
+		asm.Mov.Imm(asm.R0, 0).WithSymbol("exit"),
+		asm.Return(),
+	}
+
+	buf := bytes.NewBuffer(make([]byte, 0, insns.Size()))
+	if err := insns.Marshal(buf, internal.NativeEndian); err != nil {
+		return err
+	}
+
+	bytecode := buf.Bytes()
+	fd, err := sys.ProgLoad(&sys.ProgLoadAttr{
+		ProgType: sys.ProgType(ebpf.SocketFilter),
+		Insns:    sys.NewSlicePointer(bytecode),
+		InsnCnt:  uint32(len(bytecode) / asm.InstructionSize),
+		License:  sys.NewStringPointer("MIT"),
+	})
+	switch {
+	case errors.Is(err, unix.EINVAL), errors.Is(err, unix.EACCES):
+		return &internal.UnsupportedFeatureError{
+			Name:           "bpf_ringbuf_reserve and bpf_ringbuf_discard",
+			MinimumVersion: internal.Version{5, 8},
+		}
+
+	// EPERM is kept as-is and is not converted or wrapped.
+	case errors.Is(err, unix.EPERM):
+		return err
+
+	case err != nil:
+		return fmt.Errorf("unexpected error during feature probe: %w", err)
+	}
+
+	fd.Close()
+	return nil
+}
+
 func isMapOfMaps(mt ebpf.MapType) bool {
 	switch mt {
 	case ebpf.ArrayOfMaps, ebpf.HashOfMaps:
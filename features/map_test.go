@@ -40,6 +40,7 @@ var mapTypeMinVersion = map[ebpf.MapType]string{
 	ebpf.RingBuf:             "5.8",
 	ebpf.InodeStorage:        "5.10",
 	ebpf.TaskStorage:         "5.11",
+	ebpf.BloomFilter:         "5.16",
 }
 
 func TestHaveMapType(t *testing.T) {
@@ -16,3 +16,21 @@ func LinuxVersionCode() (uint32, error) {
 	}
 	return v.Kernel(), nil
 }
+
+// Version is a kernel version in the form Major.Minor.Patch.
+type Version = internal.Version
+
+// KernelVersion returns the version of the currently running kernel.
+//
+// The version is read from the LINUX_VERSION_CODE embedded in the vDSO, which
+// is what the kernel itself uses to identify its version. It can differ from
+// the release string reported by uname: distributions like Ubuntu and Debian
+// use the patch level in uname for their own package versioning, and kernels
+// 4.4 and 4.9 clamp the patch level to 255. If the vDSO isn't available, the
+// version is parsed from the uname release instead.
+//
+// The same caveats as for LinuxVersionCode apply: prefer feature probes over
+// comparing kernel versions.
+func KernelVersion() (Version, error) {
+	return internal.KernelVersion()
+}
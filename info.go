@@ -30,6 +30,15 @@ type MapInfo struct {
 	Flags      uint32
 	// Name as supplied by user space at load time. Available from 4.15.
 	Name string
+	// Memlock is the amount of kernel memory in bytes charged to the map, as
+	// reported in /proc/self/fdinfo. Only populated by Map.Info.
+	//
+	// Zero if the kernel doesn't report it. Kernels before 6.4 report an
+	// estimate, which doesn't include the data pages of a RingBuf.
+	Memlock uint64
+
+	btf      btf.ID
+	btfValue btf.TypeID
 }
 
 func newMapInfoFromFd(fd *sys.FD) (*MapInfo, error) {
@@ -42,7 +51,7 @@ func newMapInfoFromFd(fd *sys.FD) (*MapInfo, error) {
 		return nil, err
 	}
 
-	return &MapInfo{
+	mi := &MapInfo{
 		MapType(info.Type),
 		MapID(info.Id),
 		info.KeySize,
@@ -50,7 +59,21 @@ func newMapInfoFromFd(fd *sys.FD) (*MapInfo, error) {
 		info.MaxEntries,
 		info.MapFlags,
 		unix.ByteSliceToString(info.Name[:]),
-	}, nil
+		0,
+		btf.ID(info.BtfId),
+		btf.TypeID(info.BtfValueTypeId),
+	}
+	return mi, nil
+}
+
+// mapMemlock returns the kernel memory used by a map, or zero if the kernel
+// doesn't report it.
+func mapMemlock(fd *sys.FD) uint64 {
+	var memlock uint64
+	if err := scanFdInfo(fd, map[string]interface{}{"memlock": &memlock}); err != nil {
+		return 0
+	}
+	return memlock
 }
 
 func newMapInfoFromProc(fd *sys.FD) (*MapInfo, error) {
@@ -77,6 +100,75 @@ func (mi *MapInfo) ID() (MapID, bool) {
 	return mi.id, mi.id > 0
 }
 
+// HasSpinLock returns true if the map's value contains a struct
+// bpf_spin_lock, according to the BTF of the map.
+//
+// The kernel doesn't overwrite the lock when updating an element from user
+// space, so the bytes of a value at the offset of the lock are ignored.
+//
+// Returns false if the map was created without BTF. Requires CAP_SYS_ADMIN.
+func (mi *MapInfo) HasSpinLock() (bool, error) {
+	return mi.valueContains("bpf_spin_lock")
+}
+
+// HasTimer returns true if the map's value contains a struct bpf_timer,
+// according to the BTF of the map.
+//
+// The kernel manages the state of the timer and doesn't overwrite it when
+// updating an element from user space, so the bytes of a value at the offset
+// of the timer are ignored.
+//
+// Returns false if the map was created without BTF. Requires CAP_SYS_ADMIN.
+func (mi *MapInfo) HasTimer() (bool, error) {
+	return mi.valueContains("bpf_timer")
+}
+
+// valueContains returns true if the map's value type contains a struct with
+// the given name.
+func (mi *MapInfo) valueContains(name string) (bool, error) {
+	if mi.btf == 0 || mi.btfValue == 0 {
+		return false, nil
+	}
+
+	h, err := btf.NewHandleFromID(mi.btf)
+	if err != nil {
+		return false, fmt.Errorf("map BTF: %w", err)
+	}
+	defer h.Close()
+
+	typ, err := h.Spec().TypeByID(mi.btfValue)
+	if err != nil {
+		return false, fmt.Errorf("map value type: %w", err)
+	}
+
+	return containsStruct(typ, name), nil
+}
+
+// containsStruct returns true if typ is or contains a struct with the given
+// name, either as a member or as the element of an array.
+func containsStruct(typ btf.Type, name string) bool {
+	switch v := btf.UnderlyingType(typ).(type) {
+	case *btf.Struct:
+		if v.Name == name {
+			return true
+		}
+		for _, m := range v.Members {
+			if containsStruct(m.Type, name) {
+				return true
+			}
+		}
+	case *btf.Union:
+		for _, m := range v.Members {
+			if containsStruct(m.Type, name) {
+				return true
+			}
+		}
+	case *btf.Array:
+		return containsStruct(v.Type, name)
+	}
+	return false
+}
+
 // programStats holds statistics of a program.
 type programStats struct {
 	// Total accumulated runtime of the program ins ns.
@@ -97,8 +189,13 @@ type ProgramInfo struct {
 	btf   btf.ID
 	stats *programStats
 
-	maps  []MapID
-	insns []byte
+	attachBTFObj  btf.ID
+	attachBTFType btf.TypeID
+	attachType    *AttachType
+
+	maps       []MapID
+	insns      []byte
+	jitedInsns []byte
 }
 
 func newProgramInfoFromFd(fd *sys.FD) (*ProgramInfo, error) {
@@ -121,6 +218,8 @@ func newProgramInfoFromFd(fd *sys.FD) (*ProgramInfo, error) {
 			runtime:  time.Duration(info.RunTimeNs),
 			runCount: info.RunCnt,
 		},
+		attachBTFObj:  btf.ID(info.AttachBtfObjId),
+		attachBTFType: btf.TypeID(info.AttachBtfId),
 	}
 
 	// Start with a clean struct for the second call, otherwise we may get EFAULT.
@@ -138,12 +237,28 @@ func newProgramInfoFromFd(fd *sys.FD) (*ProgramInfo, error) {
 		info2.XlatedProgInsns = sys.NewSlicePointer(pi.insns)
 	}
 
-	if info.NrMapIds > 0 || info.XlatedProgLen > 0 {
+	if info.JitedProgLen > 0 {
+		pi.jitedInsns = make([]byte, info.JitedProgLen)
+		info2.JitedProgLen = info.JitedProgLen
+		info2.JitedProgInsns = sys.NewSlicePointer(pi.jitedInsns)
+	}
+
+	if info.NrMapIds > 0 || info.XlatedProgLen > 0 || info.JitedProgLen > 0 {
 		if err := sys.ObjInfo(fd, &info2); err != nil {
 			return nil, err
 		}
 	}
 
+	// The kernel reports the length of the instructions, but zeroes the
+	// pointer instead of copying them if raw dumps aren't allowed, for
+	// example due to kptr_restrict.
+	if info2.XlatedProgInsns == (sys.Pointer{}) {
+		pi.insns = nil
+	}
+	if info2.JitedProgInsns == (sys.Pointer{}) {
+		pi.jitedInsns = nil
+	}
+
 	return &pi, nil
 }
 
@@ -208,6 +323,29 @@ func (pi *ProgramInfo) Runtime() (time.Duration, bool) {
 	return time.Duration(0), false
 }
 
+// AttachTarget returns the BTF object and the ID of the type within it which
+// the program was loaded against, for example the function traced by a
+// Tracing program.
+//
+// Available from 6.0.
+//
+// The bool return value indicates whether this optional field is available and
+// populated.
+func (pi *ProgramInfo) AttachTarget() (btf.ID, btf.TypeID, bool) {
+	return pi.attachBTFObj, pi.attachBTFType, pi.attachBTFType > 0
+}
+
+// AttachType returns the attach type the program was loaded with.
+//
+// The kernel doesn't report the attach type, so the bool return value is only
+// true if the program was loaded by this process from a ProgramSpec.
+func (pi *ProgramInfo) AttachType() (AttachType, bool) {
+	if pi.attachType == nil {
+		return AttachNone, false
+	}
+	return *pi.attachType, true
+}
+
 // Instructions returns the 'xlated' instruction stream of the program
 // after it has been verified and rewritten by the kernel. These instructions
 // cannot be loaded back into the kernel as-is, this is mainly used for
@@ -221,11 +359,18 @@ func (pi *ProgramInfo) Runtime() (time.Duration, bool) {
 //
 // The first instruction is marked as a symbol using the Program's name.
 //
-// Available from 4.13. Requires CAP_BPF or equivalent.
+// Available from 4.13. Requires CAP_BPF or equivalent and the kernel to allow
+// raw dumps, see kernel.kptr_restrict. Otherwise an error wrapping
+// os.ErrPermission is returned.
 func (pi *ProgramInfo) Instructions() (asm.Instructions, error) {
 	// If the calling process is not BPF-capable or if the kernel doesn't
-	// support getting xlated instructions, the field will be zero.
+	// support getting xlated instructions, the field will be zero. Kernels
+	// which return the program ID also return instructions to privileged
+	// callers.
 	if len(pi.insns) == 0 {
+		if pi.id != 0 {
+			return nil, fmt.Errorf("kernel withheld instructions, requires CAP_BPF and raw dumps: %w", os.ErrPermission)
+		}
 		return nil, fmt.Errorf("insufficient permissions or unsupported kernel: %w", ErrNotSupported)
 	}
 
@@ -241,6 +386,16 @@ func (pi *ProgramInfo) Instructions() (asm.Instructions, error) {
 	return insns, nil
 }
 
+// JitedInsns returns the machine code of the program as generated by the JIT
+// compiler, for example to pass it to a disassembler.
+//
+// The bool return value is false if the program wasn't JIT compiled, if the
+// calling process isn't BPF-capable, or if the kernel doesn't allow raw dumps,
+// see kernel.kptr_restrict. Available from 4.13.
+func (pi *ProgramInfo) JitedInsns() ([]byte, bool) {
+	return pi.jitedInsns, len(pi.jitedInsns) > 0
+}
+
 // MapIDs returns the maps related to the program.
 //
 // Available from 4.15.
@@ -3,6 +3,7 @@ package ebpf
 import (
 	"errors"
 	"fmt"
+	"os"
 	"strings"
 	"testing"
 
@@ -164,6 +165,38 @@ func TestProgramInfoMapIDs(t *testing.T) {
 	}
 }
 
+func TestProgramInfoAttachType(t *testing.T) {
+	prog := mustSocketFilter(t)
+
+	info, err := prog.Info()
+	qt.Assert(t, err, qt.IsNil)
+	attachType, ok := info.AttachType()
+	qt.Assert(t, ok, qt.IsTrue)
+	qt.Assert(t, attachType, qt.Equals, AttachNone)
+
+	clone, err := prog.Clone()
+	qt.Assert(t, err, qt.IsNil)
+	defer clone.Close()
+
+	info, err = clone.Info()
+	qt.Assert(t, err, qt.IsNil)
+	_, ok = info.AttachType()
+	qt.Assert(t, ok, qt.IsTrue)
+
+	id, ok := info.ID()
+	if !ok {
+		t.Skip("Program IDs are not supported")
+	}
+	fromID, err := NewProgramFromID(id)
+	qt.Assert(t, err, qt.IsNil)
+	defer fromID.Close()
+
+	info, err = fromID.Info()
+	qt.Assert(t, err, qt.IsNil)
+	_, ok = info.AttachType()
+	qt.Assert(t, ok, qt.IsFalse, qt.Commentf("attach type of a program from an ID isn't known"))
+}
+
 func TestScanFdInfoReader(t *testing.T) {
 	tests := []struct {
 		fields map[string]interface{}
@@ -318,3 +351,73 @@ func testStats(prog *Program) error {
 
 	return nil
 }
+
+func TestMapInfoMemlock(t *testing.T) {
+	hash := createHash()
+	defer hash.Close()
+
+	info, err := hash.Info()
+	if err != nil {
+		t.Fatal("Can't get map info:", err)
+	}
+	if info.Memlock == 0 {
+		t.Error("Expected memlock of hash map to be reported")
+	}
+
+	testutils.SkipOnOldKernel(t, "6.4", "memory usage of ring buffer")
+
+	ring, err := NewMap(&MapSpec{
+		Type:       RingBuf,
+		MaxEntries: uint32(os.Getpagesize()),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ring.Close()
+
+	info, err = ring.Info()
+	if err != nil {
+		t.Fatal("Can't get map info:", err)
+	}
+	if min := uint64(os.Getpagesize()); info.Memlock < min {
+		t.Errorf("Expected memlock of ring buffer to be at least %d, got %d", min, info.Memlock)
+	}
+}
+
+func TestMapInfoHasSpinLock(t *testing.T) {
+	testutils.SkipOnOldKernel(t, "5.1", "bpf_spin_lock")
+
+	spec, err := LoadCollectionSpec(fmt.Sprintf("testdata/map_spin_lock-%s.elf", internal.ClangEndian))
+	if err != nil {
+		t.Fatal("Can't parse ELF:", err)
+	}
+
+	m, err := NewMap(spec.Maps["spin_lock_map"])
+	testutils.SkipIfNotSupported(t, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	info, err := m.Info()
+	qt.Assert(t, err, qt.IsNil)
+
+	hasLock, err := info.HasSpinLock()
+	testutils.SkipIfNotSupported(t, err)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, hasLock, qt.IsTrue)
+
+	hasTimer, err := info.HasTimer()
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, hasTimer, qt.IsFalse)
+
+	hash := createHash()
+	defer hash.Close()
+
+	info, err = hash.Info()
+	qt.Assert(t, err, qt.IsNil)
+
+	hasLock, err = info.HasSpinLock()
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, hasLock, qt.IsFalse, qt.Commentf("map without BTF"))
+}
@@ -0,0 +1,12 @@
+package internal
+
+import "time"
+
+// Now returns the current time.
+//
+// All timestamps taken in user space, as opposed to those provided by the
+// kernel, must be obtained via Now so that tests can replace it with a
+// deterministic clock. See testutils.StubClock.
+//
+// Defaults to time.Now.
+var Now = time.Now
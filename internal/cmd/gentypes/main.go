@@ -155,8 +155,14 @@ import (
 			"ProgInfo", "bpf_prog_info",
 			[]patch{
 				replace(objName, "name"),
+				replace(pointer, "jited_prog_insns"),
 				replace(pointer, "xlated_prog_insns"),
 				replace(pointer, "map_ids"),
+				// Added in 6.0, which is newer than the vmlinux BTF.
+				appendMembers(
+					btf.Member{Name: "attach_btf_obj_id", Type: &btf.Int{Size: 4}},
+					btf.Member{Name: "attach_btf_id", Type: &btf.Int{Size: 4}},
+				),
 			},
 		},
 		{
@@ -312,6 +318,13 @@ import (
 				truncateAfter("next_id"),
 			},
 		},
+		{
+			"BtfGetNextId", retError, "obj_next_id", "BPF_BTF_GET_NEXT_ID",
+			[]patch{
+				choose(0, "start_id"), rename("start_id", "id"),
+				truncateAfter("next_id"),
+			},
+		},
 		// These piggy back on the obj_next_id decl, but only support the
 		// first field...
 		{
@@ -664,6 +677,47 @@ func truncateAfter(name string) patch {
 	}
 }
 
+// appendMembers adds members to the end of a struct, growing it if
+// necessary. The offsets of the new members are ignored, each member is
+// naturally aligned.
+func appendMembers(members ...btf.Member) patch {
+	return func(s *btf.Struct) error {
+		offset := 0
+		if n := len(s.Members); n > 0 {
+			last := s.Members[n-1]
+			size, err := btf.Sizeof(last.Type)
+			if err != nil {
+				return err
+			}
+			offset = int(last.Offset.Bytes()) + size
+		}
+
+		for _, m := range members {
+			for _, existing := range s.Members {
+				if existing.Name == m.Name {
+					return fmt.Errorf("member %q already exists", m.Name)
+				}
+			}
+
+			size, err := btf.Sizeof(m.Type)
+			if err != nil {
+				return err
+			}
+
+			offset = internal.Align(offset, size)
+			m.Offset = btf.Bits(offset * 8)
+			s.Members = append(s.Members, m)
+			offset += size
+		}
+
+		// bpf_*_info structs are 8 byte aligned.
+		if size := uint32(internal.Align(offset, 8)); size > s.Size {
+			s.Size = size
+		}
+		return nil
+	}
+}
+
 func rename(from, to string) patch {
 	return func(s *btf.Struct) error {
 		for i, m := range s.Members {
@@ -0,0 +1,99 @@
+package internal
+
+import (
+	"encoding/binary"
+	"fmt"
+	"reflect"
+)
+
+// DecodeError is returned when a buffer doesn't have the size of the encoded
+// representation of a Go type.
+type DecodeError struct {
+	// The type which was decoded into.
+	Type reflect.Type
+	// The first field which extends past the end of the buffer, for example
+	// "Addr.Port" or "Comm[3]". Empty if the buffer is too long, or if
+	// Type isn't a struct or array.
+	Field string
+	// Offset of Field in the encoded representation of Type.
+	Offset int
+	// The size of the encoded representation of Type.
+	Size int
+	// The length of the buffer.
+	BufferLen int
+}
+
+// NewDecodeError creates an error describing why a buffer of bufLen bytes
+// can't be decoded into typ using encoding/binary.
+func NewDecodeError(typ reflect.Type, bufLen int) *DecodeError {
+	de := &DecodeError{
+		Type:      typ,
+		Size:      binarySize(typ),
+		BufferLen: bufLen,
+	}
+
+	if bufLen < de.Size {
+		de.Field, de.Offset = truncatedField(typ, bufLen)
+	}
+
+	return de
+}
+
+func (de *DecodeError) Error() string {
+	if de.Field == "" {
+		return fmt.Sprintf("decoding %s: buffer of %d bytes doesn't match size %d", de.Type, de.BufferLen, de.Size)
+	}
+
+	return fmt.Sprintf("decoding %s: buffer of %d bytes is shorter than size %d: field %s at offset %d is truncated",
+		de.Type, de.BufferLen, de.Size, de.Field, de.Offset)
+}
+
+// binarySize returns the size of the encoded representation of typ, or -1
+// if it doesn't have a fixed size.
+func binarySize(typ reflect.Type) int {
+	return binary.Size(reflect.New(typ).Interface())
+}
+
+// truncatedField returns the name and offset of the innermost field of typ
+// which extends past the first n bytes.
+func truncatedField(typ reflect.Type, n int) (string, int) {
+	switch typ.Kind() {
+	case reflect.Struct:
+		offset := 0
+		for i := 0; i < typ.NumField(); i++ {
+			field := typ.Field(i)
+			size := binarySize(field.Type)
+			if size < 0 {
+				return "", 0
+			}
+
+			if offset+size > n {
+				name, inner := truncatedField(field.Type, n-offset)
+				if name == "" {
+					return field.Name, offset
+				}
+				if name[0] != '[' {
+					name = "." + name
+				}
+				return field.Name + name, offset + inner
+			}
+
+			offset += size
+		}
+
+	case reflect.Array:
+		size := binarySize(typ.Elem())
+		if size <= 0 {
+			return "", 0
+		}
+
+		i := n / size
+		name, inner := truncatedField(typ.Elem(), n-i*size)
+		if name != "" && name[0] != '[' {
+			name = "." + name
+		}
+		return fmt.Sprintf("[%d]%s", i, name), i*size + inner
+	}
+
+	return "", 0
+}
@@ -0,0 +1,52 @@
+package internal
+
+import (
+	"reflect"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestDecodeError(t *testing.T) {
+	type addr struct {
+		IP   [4]uint8
+		Port uint16
+	}
+
+	type event struct {
+		Pid  uint32
+		Comm [4]uint8
+		_    [2]byte
+		Addr addr
+		Ts   uint64
+	}
+
+	typ := reflect.TypeOf(event{})
+
+	for _, tt := range []struct {
+		bufLen int
+		field  string
+		offset int
+	}{
+		{0, "Pid", 0},
+		{2, "Pid", 0},
+		{5, "Comm[1]", 5},
+		{9, "_[1]", 9},
+		{12, "Addr.IP[2]", 12},
+		{15, "Addr.Port", 14},
+		{20, "Ts", 16},
+		{24, "", 0},
+		{30, "", 0},
+	} {
+		de := NewDecodeError(typ, tt.bufLen)
+		qt.Assert(t, de.Size, qt.Equals, 24)
+		qt.Assert(t, de.BufferLen, qt.Equals, tt.bufLen)
+		qt.Assert(t, de.Field, qt.Equals, tt.field, qt.Commentf("buffer of %d bytes", tt.bufLen))
+		qt.Assert(t, de.Offset, qt.Equals, tt.offset, qt.Commentf("buffer of %d bytes", tt.bufLen))
+	}
+
+	qt.Assert(t, NewDecodeError(typ, 15).Error(), qt.Equals,
+		"decoding internal.event: buffer of 15 bytes is shorter than size 24: field Addr.Port at offset 14 is truncated")
+	qt.Assert(t, NewDecodeError(reflect.TypeOf(uint32(0)), 2).Error(), qt.Equals,
+		"decoding uint32: buffer of 2 bytes doesn't match size 4")
+}
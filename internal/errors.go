@@ -4,6 +4,9 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"sort"
+	"strconv"
+	"strings"
 
 	"github.com/cilium/ebpf/internal/unix"
 )
@@ -13,7 +16,7 @@ import (
 //
 // logErr should be the error returned by the syscall that generated
 // the log. It is used to check for truncation of the output.
-func ErrorWithLog(err error, log []byte, logErr error) error {
+func ErrorWithLog(err error, log []byte, logErr error) *VerifierError {
 	// Convert verifier log C string by truncating it on the first 0 byte
 	// and trimming trailing whitespace before interpreting as a Go string.
 	if i := bytes.IndexByte(log, 0); i != -1 {
@@ -25,13 +28,31 @@ func ErrorWithLog(err error, log []byte, logErr error) error {
 		logStr += " (truncated...)"
 	}
 
-	return &VerifierError{err, logStr}
+	return &VerifierError{err, logStr, nil}
+}
+
+// SourceLine is the location in source code of the instruction at Offset and
+// all instructions following it, up to the next SourceLine.
+type SourceLine struct {
+	// Offset of the instruction in raw BPF instructions.
+	Offset int
+	// Location in source code, usually "file:line".
+	Location string
 }
 
 // VerifierError includes information from the eBPF verifier.
 type VerifierError struct {
-	cause error
-	log   string
+	cause  error
+	log    string
+	source []SourceLine
+}
+
+// SetSourceLines records the source locations of the instructions the
+// verifier log refers to, which are used by WithSource.
+//
+// lines must be sorted by Offset.
+func (le *VerifierError) SetSourceLines(lines []SourceLine) {
+	le.source = lines
 }
 
 func (le *VerifierError) Unwrap() error {
@@ -45,3 +66,55 @@ func (le *VerifierError) Error() string {
 
 	return fmt.Sprintf("%s: %s", le.cause, le.log)
 }
+
+// WithSource returns the verifier log, with each line which refers to an
+// instruction annotated with the instruction's location in source code.
+//
+// Source locations are only known if the program was built with line info,
+// usually by compiling with -g. Otherwise the log is returned unchanged, and
+// instructions are only identified by their index.
+func (le *VerifierError) WithSource() string {
+	if len(le.source) == 0 {
+		return le.log
+	}
+
+	var b strings.Builder
+	lines := strings.Split(le.log, "\n")
+	for i, line := range lines {
+		b.WriteString(line)
+		if loc := le.sourceOf(line); loc != "" {
+			b.WriteString(" ; ")
+			b.WriteString(loc)
+		}
+		if i < len(lines)-1 {
+			b.WriteByte('\n')
+		}
+	}
+	return b.String()
+}
+
+// sourceOf returns the source location of the instruction a line of the
+// verifier log refers to, if any.
+//
+// The verifier prefixes such lines with the offset of the instruction, for
+// example "12: (b7) r0 = 0".
+func (le *VerifierError) sourceOf(line string) string {
+	i := strings.IndexByte(line, ':')
+	if i <= 0 {
+		return ""
+	}
+
+	offset, err := strconv.Atoi(line[:i])
+	if err != nil || offset < 0 {
+		return ""
+	}
+
+	// Find the last SourceLine at or before offset.
+	j := sort.Search(len(le.source), func(j int) bool {
+		return le.source[j].Offset > offset
+	})
+	if j == 0 {
+		return ""
+	}
+	return le.source[j-1].Location
+}
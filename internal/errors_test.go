@@ -28,3 +28,22 @@ func TestErrorWithLog(t *testing.T) {
 		t.Fatalf("\nwant: %s\ngot: %s", want, got)
 	}
 }
+
+func TestVerifierErrorWithSource(t *testing.T) {
+	log := []byte("0: (b7) r0 = 0\n1: (b7) r1 = 1\nR0=inv0\n2: (95) exit\nprocessed 3 insns")
+	err := ErrorWithLog(errors.New("test"), log, nil)
+
+	if got := err.WithSource(); got != string(log) {
+		t.Fatalf("Log without source lines was modified:\n%s", got)
+	}
+
+	err.SetSourceLines([]SourceLine{
+		{1, "prog.c:10"},
+		{2, "prog.c:12"},
+	})
+
+	want := "0: (b7) r0 = 0\n1: (b7) r1 = 1 ; prog.c:10\nR0=inv0\n2: (95) exit ; prog.c:12\nprocessed 3 insns"
+	if got := err.WithSource(); got != want {
+		t.Fatalf("\nwant: %s\ngot: %s", want, got)
+	}
+}
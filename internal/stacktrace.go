@@ -0,0 +1,96 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"runtime"
+	"sync/atomic"
+)
+
+// errorStackTraces is non-zero if errors should be annotated with the stack at
+// which they were returned.
+var errorStackTraces uint32
+
+// SetErrorStackTraces enables or disables annotating errors with stack traces,
+// see AddStackTrace.
+func SetErrorStackTraces(enabled bool) {
+	var value uint32
+	if enabled {
+		value = 1
+	}
+	atomic.StoreUint32(&errorStackTraces, value)
+}
+
+// StackTraceError is an error annotated with the stack at which it was
+// returned by the library.
+type StackTraceError struct {
+	Err error
+	// Program counters of the stack, as returned by runtime.Callers.
+	Stack []uintptr
+}
+
+func (se *StackTraceError) Error() string {
+	return se.Err.Error()
+}
+
+func (se *StackTraceError) Unwrap() error {
+	return se.Err
+}
+
+// Frames returns the function invocations of the stack, innermost first.
+func (se *StackTraceError) Frames() *runtime.Frames {
+	return runtime.CallersFrames(se.Stack)
+}
+
+// Format the error.
+//
+// Understood verbs are %s and %v, which print only the error, and %+v, which
+// also prints the stack.
+func (se *StackTraceError) Format(f fmt.State, verb rune) {
+	switch verb {
+	case 's':
+		fmt.Fprint(f, se.Error())
+
+	case 'v':
+		fmt.Fprint(f, se.Error())
+		if !f.Flag('+') {
+			return
+		}
+
+		frames := se.Frames()
+		for {
+			frame, more := frames.Next()
+			fmt.Fprintf(f, "\n\t%s\n\t\t%s:%d", frame.Function, frame.File, frame.Line)
+			if !more {
+				break
+			}
+		}
+
+	default:
+		fmt.Fprintf(f, "%%!%c(BADVERB)", verb)
+	}
+}
+
+// AddStackTrace wraps *err in a StackTraceError containing the stack of the
+// caller if stack traces are enabled. It is meant to be deferred by exported
+// functions with a named error result:
+//
+//	defer internal.AddStackTrace(&err)
+//
+// Does nothing if *err is nil or already contains a StackTraceError, so that
+// the innermost stack is preserved.
+func AddStackTrace(err *error) {
+	if *err == nil || atomic.LoadUint32(&errorStackTraces) == 0 {
+		return
+	}
+
+	var ste *StackTraceError
+	if errors.As(*err, &ste) {
+		return
+	}
+
+	pcs := make([]uintptr, 32)
+	// Skip runtime.Callers and AddStackTrace.
+	n := runtime.Callers(2, pcs)
+	*err = &StackTraceError{*err, pcs[:n]}
+}
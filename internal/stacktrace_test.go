@@ -0,0 +1,46 @@
+package internal
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func failWithStackTrace(in error) (err error) {
+	defer AddStackTrace(&err)
+
+	return in
+}
+
+func TestAddStackTrace(t *testing.T) {
+	errFoo := errors.New("foo")
+
+	err := failWithStackTrace(errFoo)
+	qt.Assert(t, err, qt.Equals, errFoo, qt.Commentf("stack traces are disabled by default"))
+
+	SetErrorStackTraces(true)
+	defer SetErrorStackTraces(false)
+
+	qt.Assert(t, failWithStackTrace(nil), qt.IsNil)
+
+	err = failWithStackTrace(errFoo)
+	qt.Assert(t, errors.Is(err, errFoo), qt.IsTrue)
+	qt.Assert(t, err.Error(), qt.Equals, "foo")
+
+	var ste *StackTraceError
+	qt.Assert(t, errors.As(err, &ste), qt.IsTrue)
+
+	frame, _ := ste.Frames().Next()
+	qt.Assert(t, frame.Function, qt.Matches, `.*\.failWithStackTrace`)
+	qt.Assert(t, fmt.Sprintf("%+v", err), qt.Contains, "failWithStackTrace")
+	qt.Assert(t, strings.Contains(fmt.Sprintf("%v", err), "\n"), qt.IsFalse)
+
+	// The innermost stack is preserved.
+	wrapped := failWithStackTrace(fmt.Errorf("bar: %w", err))
+	var outer *StackTraceError
+	qt.Assert(t, errors.As(wrapped, &outer), qt.IsTrue)
+	qt.Assert(t, outer, qt.Equals, ste)
+}
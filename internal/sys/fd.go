@@ -13,15 +13,21 @@ import (
 var ErrClosedFd = unix.EBADF
 
 type FD struct {
-	raw int
+	raw   int
+	stack LeakStack
 }
 
 func newFD(value int) *FD {
-	fd := &FD{value}
-	runtime.SetFinalizer(fd, (*FD).Close)
+	fd := &FD{value, NewLeakStack()}
+	runtime.SetFinalizer(fd, (*FD).finalize)
 	return fd
 }
 
+func (fd *FD) finalize() {
+	fd.stack.Warn("fd " + fd.String())
+	_ = fd.Close()
+}
+
 // NewFD wraps a raw fd with a finalizer.
 //
 // You must not use the raw fd after calling this function, since the underlying
@@ -75,6 +81,12 @@ func (fd *FD) Forget() {
 	runtime.SetFinalizer(fd, nil)
 }
 
+// SuppressLeakWarning stops fd from warning if it is garbage collected without
+// being closed. Used when fd is owned by an object which warns instead.
+func (fd *FD) SuppressLeakWarning() {
+	fd.stack = nil
+}
+
 func (fd *FD) Dup() (*FD, error) {
 	if fd.raw < 0 {
 		return nil, ErrClosedFd
@@ -0,0 +1,66 @@
+package sys
+
+import (
+	"fmt"
+	"log"
+	"runtime"
+	"strings"
+	"sync/atomic"
+)
+
+// leakWarnings is non-zero if objects should record their creation stack.
+var leakWarnings uint32
+
+// logLeak is replaced in tests.
+var logLeak = log.Print
+
+// SetLeakWarnings enables or disables warnings about objects which are
+// garbage collected without being closed.
+//
+// Only objects created after enabling warnings are tracked.
+func SetLeakWarnings(enabled bool) {
+	var value uint32
+	if enabled {
+		value = 1
+	}
+	atomic.StoreUint32(&leakWarnings, value)
+}
+
+// LeakStack is the stack at which a tracked object was created.
+//
+// It is nil if leak warnings were disabled at the time.
+type LeakStack []uintptr
+
+// NewLeakStack captures the stack of the caller if leak warnings are enabled.
+func NewLeakStack() LeakStack {
+	if atomic.LoadUint32(&leakWarnings) == 0 {
+		return nil
+	}
+
+	pcs := make([]uintptr, 32)
+	// Skip runtime.Callers and NewLeakStack.
+	n := runtime.Callers(2, pcs)
+	return LeakStack(pcs[:n])
+}
+
+// Warn logs that obj was garbage collected without being closed.
+//
+// Does nothing if ls is nil.
+func (ls LeakStack) Warn(obj string) {
+	if ls == nil {
+		return
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "ebpf: %s was garbage collected without being closed, created at:\n", obj)
+	frames := runtime.CallersFrames(ls)
+	for {
+		frame, more := frames.Next()
+		fmt.Fprintf(&b, "\t%s\n\t\t%s:%d\n", frame.Function, frame.File, frame.Line)
+		if !more {
+			break
+		}
+	}
+
+	logLeak(b.String())
+}
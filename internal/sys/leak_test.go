@@ -0,0 +1,75 @@
+package sys
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"runtime"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/cilium/ebpf/internal/unix"
+	qt "github.com/frankban/quicktest"
+)
+
+func TestLeakWarnings(t *testing.T) {
+	warnings := make(chan string, 1)
+	logLeak = func(v ...interface{}) {
+		warnings <- fmt.Sprint(v...)
+	}
+	defer func() { logLeak = log.Print }()
+
+	qt.Assert(t, NewLeakStack(), qt.IsNil, qt.Commentf("warnings are disabled by default"))
+
+	SetLeakWarnings(true)
+	defer SetLeakWarnings(false)
+
+	leakFD(t)
+
+	deadline := time.After(time.Second)
+	for {
+		runtime.GC()
+		select {
+		case warning := <-warnings:
+			qt.Assert(t, warning, qt.Matches, `(?s)ebpf: fd \d+ was garbage collected without being closed, created at:.*leakFD.*`)
+			return
+		case <-deadline:
+			t.Fatal("No warning for leaked fd")
+		case <-time.After(10 * time.Millisecond):
+		}
+	}
+}
+
+func leakFD(t *testing.T) {
+	t.Helper()
+
+	for i := 0; i < 2; i++ {
+		raw, err := unix.Open(os.DevNull, syscall.O_RDONLY|syscall.O_CLOEXEC, 0)
+		qt.Assert(t, err, qt.IsNil)
+
+		fd, err := NewFD(raw)
+		qt.Assert(t, err, qt.IsNil)
+
+		if i == 0 {
+			// Closing the fd prevents a warning.
+			qt.Assert(t, fd.Close(), qt.IsNil)
+		}
+	}
+}
+
+func TestSuppressLeakWarning(t *testing.T) {
+	SetLeakWarnings(true)
+	defer SetLeakWarnings(false)
+
+	raw, err := unix.Open(os.DevNull, syscall.O_RDONLY|syscall.O_CLOEXEC, 0)
+	qt.Assert(t, err, qt.IsNil)
+
+	fd, err := NewFD(raw)
+	qt.Assert(t, err, qt.IsNil)
+	defer fd.Close()
+
+	qt.Assert(t, fd.stack, qt.IsNotNil)
+	fd.SuppressLeakWarning()
+	qt.Assert(t, fd.stack, qt.IsNil)
+}
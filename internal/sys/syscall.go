@@ -1,17 +1,35 @@
 package sys
 
 import (
+	"errors"
 	"runtime"
+	"sync/atomic"
 	"syscall"
 	"unsafe"
 
 	"github.com/cilium/ebpf/internal/unix"
 )
 
+// ErrSyscallsDisabled is returned by BPF after a call to DisableSyscalls.
+var ErrSyscallsDisabled = errors.New("bpf syscalls are disabled")
+
+// syscallsDisabled is non-zero once DisableSyscalls has been called.
+var syscallsDisabled uint32
+
+// DisableSyscalls makes all subsequent calls to BPF fail with
+// ErrSyscallsDisabled.
+func DisableSyscalls() {
+	atomic.StoreUint32(&syscallsDisabled, 1)
+}
+
 // BPF wraps SYS_BPF.
 //
 // Any pointers contained in attr must use the Pointer type from this package.
 func BPF(cmd Cmd, attr unsafe.Pointer, size uintptr) (uintptr, error) {
+	if atomic.LoadUint32(&syscallsDisabled) != 0 {
+		return 0, ErrSyscallsDisabled
+	}
+
 	for {
 		r1, _, errNo := unix.Syscall(unix.SYS_BPF, uintptr(cmd), uintptr(attr), size)
 		runtime.KeepAlive(attr)
@@ -31,6 +49,101 @@ func BPF(cmd Cmd, attr unsafe.Pointer, size uintptr) (uintptr, error) {
 	}
 }
 
+// RawTracepointOpenCookieAttr is RawTracepointOpenAttr with the cookie field
+// added in Linux 6.10. The field is missing from the BTF
+// used to generate types.go.
+type RawTracepointOpenCookieAttr struct {
+	Name   Pointer
+	ProgFd uint32
+	_      [4]byte
+	Cookie uint64
+}
+
+func RawTracepointOpenCookie(attr *RawTracepointOpenCookieAttr) (*FD, error) {
+	fd, err := BPF(BPF_RAW_TRACEPOINT_OPEN, unsafe.Pointer(attr), unsafe.Sizeof(*attr))
+	if err != nil {
+		return nil, err
+	}
+	return NewFD(int(fd))
+}
+
+// BPF_LINK_TYPE_KPROBE_MULTI was added in Linux 5.18 and is missing from the
+// BTF used to generate types.go.
+const BPF_LINK_TYPE_KPROBE_MULTI LinkType = 8
+
+// BPF_F_KPROBE_MULTI_RETURN attaches a kprobe.multi link to function exits.
+const BPF_F_KPROBE_MULTI_RETURN = 1 << 0
+
+// LinkCreateKprobeMultiAttr is LinkCreateAttr with the kprobe_multi fields
+// added in Linux 5.18. The fields are missing from the BTF used to generate
+// types.go.
+type LinkCreateKprobeMultiAttr struct {
+	ProgFd           uint32
+	TargetFd         uint32
+	AttachType       AttachType
+	Flags            uint32
+	KprobeMultiFlags uint32
+	Count            uint32
+	Syms             Pointer
+	Addrs            Pointer
+	Cookies          Pointer
+}
+
+func LinkCreateKprobeMulti(attr *LinkCreateKprobeMultiAttr) (*FD, error) {
+	fd, err := BPF(BPF_LINK_CREATE, unsafe.Pointer(attr), unsafe.Sizeof(*attr))
+	if err != nil {
+		return nil, err
+	}
+	return NewFD(int(fd))
+}
+
+// ProgQueryAttr is the attr of BPF_PROG_QUERY, which is missing from the BTF
+// used to generate types.go.
+type ProgQueryAttr struct {
+	TargetFd    uint32
+	AttachType  AttachType
+	QueryFlags  uint32
+	AttachFlags uint32
+	ProgIds     Pointer
+	ProgCount   uint32
+	_           [4]byte
+}
+
+func ProgQuery(attr *ProgQueryAttr) error {
+	_, err := BPF(BPF_PROG_QUERY, unsafe.Pointer(attr), unsafe.Sizeof(*attr))
+	return err
+}
+
+// BPF_LINK_TYPE_TCX was added in Linux 6.6 and is missing from the BTF used
+// to generate types.go.
+const BPF_LINK_TYPE_TCX LinkType = 11
+
+// LinkCreateTcxAttr is LinkCreateAttr with the tcx fields added in Linux 6.6.
+// The fields are missing from the BTF used to generate types.go.
+type LinkCreateTcxAttr struct {
+	ProgFd           uint32
+	TargetIfindex    uint32
+	AttachType       AttachType
+	Flags            uint32
+	RelativeFdOrId   uint32
+	_                [4]byte
+	ExpectedRevision uint64
+}
+
+// TcxLinkInfo is the tcx specific part of LinkInfo.
+type TcxLinkInfo struct {
+	Ifindex    uint32
+	AttachType AttachType
+}
+
+func LinkCreateTcx(attr *LinkCreateTcxAttr) (*FD, error) {
+	fd, err := BPF(BPF_LINK_CREATE, unsafe.Pointer(attr), unsafe.Sizeof(*attr))
+	if err != nil {
+		return nil, err
+	}
+	return NewFD(int(fd))
+}
+
 // Info is implemented by all structs that can be passed to the ObjInfo syscall.
 //
 //    MapInfo
@@ -121,3 +234,73 @@ func (se *syscallError) Is(target error) bool {
 func (se *syscallError) Unwrap() error {
 	return se.errno
 }
+
+// BPF_TOKEN_CREATE was added in Linux 6.9 and is missing from the BTF used to
+// generate types.go.
+const BPF_TOKEN_CREATE Cmd = 36
+
+// BPF_F_TOKEN_FD is set in the flags of MapCreateTokenAttr, ProgLoadTokenAttr
+// and BtfLoadTokenAttr if they contain a BPF token.
+const BPF_F_TOKEN_FD = 1 << 16
+
+type TokenCreateAttr struct {
+	Flags   uint32
+	BpffsFd uint32
+}
+
+func TokenCreate(attr *TokenCreateAttr) (*FD, error) {
+	fd, err := BPF(BPF_TOKEN_CREATE, unsafe.Pointer(attr), unsafe.Sizeof(*attr))
+	if err != nil {
+		return nil, err
+	}
+	return NewFD(int(fd))
+}
+
+// MapCreateTokenAttr is MapCreateAttr with the BPF token field added in Linux
+// 6.9.
+type MapCreateTokenAttr struct {
+	MapCreateAttr
+	ValueTypeBtfObjFd int32
+	MapTokenFd        int32
+}
+
+func MapCreateToken(attr *MapCreateTokenAttr) (*FD, error) {
+	fd, err := BPF(BPF_MAP_CREATE, unsafe.Pointer(attr), unsafe.Sizeof(*attr))
+	if err != nil {
+		return nil, err
+	}
+	return NewFD(int(fd))
+}
+
+// ProgLoadTokenAttr is ProgLoadAttr with the BPF token field added in Linux
+// 6.9. The padding of ProgLoadAttr holds the log_true_size output field.
+type ProgLoadTokenAttr struct {
+	ProgLoadAttr
+	ProgTokenFd int32
+	_           [4]byte
+}
+
+func ProgLoadToken(attr *ProgLoadTokenAttr) (*FD, error) {
+	fd, err := BPF(BPF_PROG_LOAD, unsafe.Pointer(attr), unsafe.Sizeof(*attr))
+	if err != nil {
+		return nil, err
+	}
+	return NewFD(int(fd))
+}
+
+// BtfLoadTokenAttr is BtfLoadAttr with the flags and BPF token fields added in
+// Linux 6.9. The padding of BtfLoadAttr holds the btf_log_true_size output
+// field.
+type BtfLoadTokenAttr struct {
+	BtfLoadAttr
+	BtfFlags   uint32
+	BtfTokenFd int32
+}
+
+func BtfLoadToken(attr *BtfLoadTokenAttr) (*FD, error) {
+	fd, err := BPF(BPF_BTF_LOAD, unsafe.Pointer(attr), unsafe.Sizeof(*attr))
+	if err != nil {
+		return nil, err
+	}
+	return NewFD(int(fd))
+}
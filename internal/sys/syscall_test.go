@@ -2,6 +2,7 @@ package sys
 
 import (
 	"errors"
+	"sync/atomic"
 	"testing"
 
 	"github.com/cilium/ebpf/internal/unix"
@@ -54,3 +55,13 @@ func TestSyscallError(t *testing.T) {
 		t.Error("Error is the SyscallError")
 	}
 }
+
+func TestDisableSyscalls(t *testing.T) {
+	DisableSyscalls()
+	defer atomic.StoreUint32(&syscallsDisabled, 0)
+
+	_, err := MapCreate(&MapCreateAttr{})
+	if !errors.Is(err, ErrSyscallsDisabled) {
+		t.Fatal("Expected ErrSyscallsDisabled, got", err)
+	}
+}
@@ -483,7 +483,7 @@ type ProgInfo struct {
 	Tag                  [8]uint8
 	JitedProgLen         uint32
 	XlatedProgLen        uint32
-	JitedProgInsns       uint64
+	JitedProgInsns       Pointer
 	XlatedProgInsns      Pointer
 	LoadTime             uint64
 	CreatedByUid         uint32
@@ -514,6 +514,8 @@ type ProgInfo struct {
 	RunCnt               uint64
 	RecursionMisses      uint64
 	VerifiedInsns        uint32
+	AttachBtfObjId       uint32
+	AttachBtfId          uint32
 	_                    [4]byte
 }
 
@@ -536,6 +538,16 @@ func BtfGetFdById(attr *BtfGetFdByIdAttr) (*FD, error) {
 	return NewFD(int(fd))
 }
 
+type BtfGetNextIdAttr struct {
+	Id     uint32
+	NextId uint32
+}
+
+func BtfGetNextId(attr *BtfGetNextIdAttr) error {
+	_, err := BPF(BPF_BTF_GET_NEXT_ID, unsafe.Pointer(attr), unsafe.Sizeof(*attr))
+	return err
+}
+
 type BtfLoadAttr struct {
 	Btf         Pointer
 	BtfLogBuf   Pointer
@@ -0,0 +1,33 @@
+package testutils
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cilium/ebpf/internal"
+)
+
+// StubClock makes internal.Now return the times produced by next for the
+// duration of the test.
+//
+// Tests using StubClock must not run in parallel.
+func StubClock(tb testing.TB, next func() time.Time) {
+	tb.Helper()
+
+	old := internal.Now
+	internal.Now = next
+	tb.Cleanup(func() {
+		internal.Now = old
+	})
+}
+
+// FixedClock returns a clock for StubClock which starts at start and advances
+// by step on every call.
+func FixedClock(start time.Time, step time.Duration) func() time.Time {
+	now := start
+	return func() time.Time {
+		t := now
+		now = now.Add(step)
+		return t
+	}
+}
@@ -0,0 +1,23 @@
+package testutils
+
+import (
+	"github.com/cilium/ebpf/asm"
+)
+
+// RingbufOutputInstructions returns a SocketFilter program which submits an
+// 8 byte event of zeroes to the ring buffer identified by fd each time it is
+// run.
+func RingbufOutputInstructions(fd int) asm.Instructions {
+	return asm.Instructions{
+		asm.Mov.Imm(asm.R1, 0),
+		asm.StoreMem(asm.RFP, -8, asm.R1, asm.DWord),
+		asm.LoadMapPtr(asm.R1, fd),
+		asm.Mov.Reg(asm.R2, asm.RFP),
+		asm.Add.Imm(asm.R2, -8),
+		asm.Mov.Imm(asm.R3, 8),
+		asm.Mov.Imm(asm.R4, 0),
+		asm.FnRingbufOutput.Call(),
+		asm.Mov.Imm(asm.R0, 0),
+		asm.Return(),
+	}
+}
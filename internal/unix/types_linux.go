@@ -16,6 +16,7 @@ const (
 	ENOSPC  = linux.ENOSPC
 	EINVAL  = linux.EINVAL
 	EPOLLIN = linux.EPOLLIN
+	POLLIN  = linux.POLLIN
 	EINTR   = linux.EINTR
 	EPERM   = linux.EPERM
 	ESRCH   = linux.ESRCH
@@ -24,8 +25,11 @@ const (
 	E2BIG   = linux.E2BIG
 	EFAULT  = linux.EFAULT
 	EACCES  = linux.EACCES
+	EBUSY   = linux.EBUSY
 	// ENOTSUPP is not the same as ENOTSUP or EOPNOTSUP
-	ENOTSUPP = syscall.Errno(0x20c)
+	ENOTSUPP   = syscall.Errno(0x20c)
+	EOPNOTSUPP = linux.EOPNOTSUPP
+	ESTALE     = linux.ESTALE
 
 	BPF_F_NO_PREALLOC        = linux.BPF_F_NO_PREALLOC
 	BPF_F_NUMA_NODE          = linux.BPF_F_NUMA_NODE
@@ -43,10 +47,16 @@ const (
 	BPF_RINGBUF_HDR_SZ       = linux.BPF_RINGBUF_HDR_SZ
 	SYS_BPF                  = linux.SYS_BPF
 	F_DUPFD_CLOEXEC          = linux.F_DUPFD_CLOEXEC
+	F_GETFL                  = linux.F_GETFL
+	F_SETFL                  = linux.F_SETFL
+	F_SETOWN                 = linux.F_SETOWN
+	F_SETSIG                 = linux.F_SETSIG
+	O_ASYNC                  = linux.O_ASYNC
 	EPOLL_CTL_ADD            = linux.EPOLL_CTL_ADD
 	EPOLL_CLOEXEC            = linux.EPOLL_CLOEXEC
 	O_CLOEXEC                = linux.O_CLOEXEC
 	O_NONBLOCK               = linux.O_NONBLOCK
+	CLONE_NEWNET             = linux.CLONE_NEWNET
 	PROT_READ                = linux.PROT_READ
 	PROT_WRITE               = linux.PROT_WRITE
 	MAP_SHARED               = linux.MAP_SHARED
@@ -58,6 +68,10 @@ const (
 	PERF_EVENT_IOC_ENABLE    = linux.PERF_EVENT_IOC_ENABLE
 	PERF_EVENT_IOC_SET_BPF   = linux.PERF_EVENT_IOC_SET_BPF
 	PerfBitWatermark         = linux.PerfBitWatermark
+	PERF_SAMPLE_TID          = linux.PERF_SAMPLE_TID
+	PERF_SAMPLE_TIME         = linux.PERF_SAMPLE_TIME
+	PERF_SAMPLE_CALLCHAIN    = linux.PERF_SAMPLE_CALLCHAIN
+	PERF_SAMPLE_CPU          = linux.PERF_SAMPLE_CPU
 	PERF_SAMPLE_RAW          = linux.PERF_SAMPLE_RAW
 	PERF_FLAG_FD_CLOEXEC     = linux.PERF_FLAG_FD_CLOEXEC
 	RLIM_INFINITY            = linux.RLIM_INFINITY
@@ -100,6 +114,11 @@ func Statfs(path string, buf *Statfs_t) (err error) {
 	return linux.Statfs(path, buf)
 }
 
+// Fstatfs is a wrapper
+func Fstatfs(fd int, buf *Statfs_t) (err error) {
+	return linux.Fstatfs(fd, buf)
+}
+
 // Close is a wrapper
 func Close(fd int) (err error) {
 	return linux.Close(fd)
@@ -113,6 +132,14 @@ func EpollWait(epfd int, events []EpollEvent, msec int) (n int, err error) {
 	return linux.EpollWait(epfd, events, msec)
 }
 
+// PollFd is a wrapper
+type PollFd = linux.PollFd
+
+// Poll is a wrapper
+func Poll(fds []PollFd, timeout int) (n int, err error) {
+	return linux.Poll(fds, timeout)
+}
+
 // EpollCtl is a wrapper
 func EpollCtl(epfd int, op int, fd int, event *EpollEvent) (err error) {
 	return linux.EpollCtl(epfd, op, fd, event)
@@ -177,6 +204,16 @@ func Gettid() int {
 	return linux.Gettid()
 }
 
+// Setns is a wrapper
+func Setns(fd int, nstype int) (err error) {
+	return linux.Setns(fd, nstype)
+}
+
+// Unshare is a wrapper
+func Unshare(flags int) (err error) {
+	return linux.Unshare(flags)
+}
+
 // Tgkill is a wrapper
 func Tgkill(tgid int, tid int, sig syscall.Signal) (err error) {
 	return linux.Tgkill(tgid, tid, sig)
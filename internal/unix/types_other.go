@@ -25,8 +25,11 @@ const (
 	E2BIG  = syscall.Errno(0)
 	EFAULT = syscall.EFAULT
 	EACCES = syscall.Errno(0)
+	EBUSY  = syscall.EBUSY
 	// ENOTSUPP is not the same as ENOTSUP or EOPNOTSUP
-	ENOTSUPP = syscall.Errno(0x20c)
+	ENOTSUPP   = syscall.Errno(0x20c)
+	EOPNOTSUPP = syscall.Errno(0)
+	ESTALE     = syscall.Errno(0)
 
 	BPF_F_NO_PREALLOC        = 0
 	BPF_F_NUMA_NODE          = 0
@@ -44,11 +47,18 @@ const (
 	BPF_RINGBUF_HDR_SZ       = 0
 	SYS_BPF                  = 321
 	F_DUPFD_CLOEXEC          = 0x406
+	F_GETFL                  = 0x3
+	F_SETFL                  = 0x4
+	F_SETOWN                 = 0x8
+	F_SETSIG                 = 0xa
+	O_ASYNC                  = 0x2000
 	EPOLLIN                  = 0x1
+	POLLIN                   = 0x1
 	EPOLL_CTL_ADD            = 0x1
 	EPOLL_CLOEXEC            = 0x80000
 	O_CLOEXEC                = 0x80000
 	O_NONBLOCK               = 0x800
+	CLONE_NEWNET             = 0x40000000
 	PROT_READ                = 0x1
 	PROT_WRITE               = 0x2
 	MAP_SHARED               = 0x1
@@ -60,6 +70,10 @@ const (
 	PERF_EVENT_IOC_ENABLE    = 0
 	PERF_EVENT_IOC_SET_BPF   = 0
 	PerfBitWatermark         = 0x4000
+	PERF_SAMPLE_TID          = 0x2
+	PERF_SAMPLE_TIME         = 0x4
+	PERF_SAMPLE_CALLCHAIN    = 0x20
+	PERF_SAMPLE_CPU          = 0x80
 	PERF_SAMPLE_RAW          = 0x400
 	PERF_FLAG_FD_CLOEXEC     = 0x8
 	RLIM_INFINITY            = 0x7fffffffffffffff
@@ -118,6 +132,11 @@ func Statfs(path string, buf *Statfs_t) error {
 	return errNonLinux
 }
 
+// Fstatfs is a wrapper
+func Fstatfs(fd int, buf *Statfs_t) error {
+	return errNonLinux
+}
+
 // Close is a wrapper
 func Close(fd int) (err error) {
 	return errNonLinux
@@ -135,6 +154,18 @@ func EpollWait(epfd int, events []EpollEvent, msec int) (n int, err error) {
 	return 0, errNonLinux
 }
 
+// PollFd is a wrapper
+type PollFd struct {
+	Fd      int32
+	Events  int16
+	Revents int16
+}
+
+// Poll is a wrapper
+func Poll(fds []PollFd, timeout int) (n int, err error) {
+	return 0, errNonLinux
+}
+
 // EpollCtl is a wrapper
 func EpollCtl(epfd int, op int, fd int, event *EpollEvent) (err error) {
 	return errNonLinux
@@ -245,6 +276,16 @@ func Gettid() int {
 	return -1
 }
 
+// Setns is a wrapper
+func Setns(fd int, nstype int) (err error) {
+	return errNonLinux
+}
+
+// Unshare is a wrapper
+func Unshare(flags int) (err error) {
+	return errNonLinux
+}
+
 // Tgkill is a wrapper
 func Tgkill(tgid int, tid int, sig syscall.Signal) (err error) {
 	return errNonLinux
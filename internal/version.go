@@ -102,10 +102,23 @@ func KernelVersion() (Version, error) {
 // detectKernelVersion returns the version of the running kernel.
 func detectKernelVersion() (Version, error) {
 	vc, err := vdsoVersion()
-	if err != nil {
+	if err == nil {
+		return NewVersionFromCode(vc), nil
+	}
+
+	// Some environments don't map a vDSO with a version note into the
+	// process. Fall back to the release reported by uname, whose patch level
+	// may be distribution specific.
+	release, rerr := KernelRelease()
+	if rerr != nil {
 		return Version{}, err
 	}
-	return NewVersionFromCode(vc), nil
+
+	v, rerr := NewVersion(release)
+	if rerr != nil {
+		return Version{}, fmt.Errorf("%w (parse uname release: %v)", err, rerr)
+	}
+	return v, nil
 }
 
 // KernelRelease returns the release string of the running kernel.
@@ -0,0 +1,40 @@
+package ebpf
+
+import (
+	"encoding/binary"
+	"fmt"
+	"net"
+
+	"github.com/cilium/ebpf/internal"
+)
+
+// IPToKey converts ip into the bytes of a map key holding an address, as
+// used by BPF programs.
+//
+// IPv4 addresses, including IPv4-mapped IPv6 addresses, are converted to a
+// 4 byte uint32 encoded in byteOrder. Use binary.BigEndian if the program
+// uses addresses in network byte order as found in packets and sockets, and
+// nil for the native byte order if it converts them with bpf_ntohl. IPv6
+// addresses are converted to a 16 byte array in network byte order, and
+// byteOrder is ignored.
+//
+// Returns an error if ip isn't a valid IPv4 or IPv6 address.
+func IPToKey(ip net.IP, byteOrder binary.ByteOrder) ([]byte, error) {
+	if byteOrder == nil {
+		byteOrder = internal.NativeEndian
+	}
+
+	if v4 := ip.To4(); v4 != nil {
+		key := make([]byte, net.IPv4len)
+		byteOrder.PutUint32(key, binary.BigEndian.Uint32(v4))
+		return key, nil
+	}
+
+	if len(ip) != net.IPv6len {
+		return nil, fmt.Errorf("invalid IP address %s", ip)
+	}
+
+	key := make([]byte, net.IPv6len)
+	copy(key, ip)
+	return key, nil
+}
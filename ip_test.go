@@ -0,0 +1,35 @@
+package ebpf
+
+import (
+	"encoding/binary"
+	"net"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestIPToKey(t *testing.T) {
+	for _, tc := range []struct {
+		ip    string
+		order binary.ByteOrder
+		want  []byte
+	}{
+		{"192.0.2.1", binary.BigEndian, []byte{192, 0, 2, 1}},
+		{"192.0.2.1", binary.LittleEndian, []byte{1, 2, 0, 192}},
+		{"::ffff:192.0.2.1", binary.BigEndian, []byte{192, 0, 2, 1}},
+		{"2001:db8::1", binary.LittleEndian, []byte{0x20, 0x01, 0x0d, 0xb8, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 1}},
+	} {
+		key, err := IPToKey(net.ParseIP(tc.ip), tc.order)
+		qt.Assert(t, err, qt.IsNil)
+		qt.Assert(t, key, qt.DeepEquals, tc.want, qt.Commentf("%s in %s", tc.ip, tc.order))
+	}
+
+	key, err := IPToKey(net.IPv4(192, 0, 2, 1).To4(), nil)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, key, qt.HasLen, 4)
+
+	for _, ip := range []net.IP{nil, {1, 2, 3}} {
+		_, err := IPToKey(ip, binary.BigEndian)
+		qt.Assert(t, err, qt.IsNotNil)
+	}
+}
@@ -0,0 +1,57 @@
+package link
+
+import (
+	"fmt"
+)
+
+// AttachSpec describes one of the attachments created by AttachAll.
+type AttachSpec struct {
+	// Name identifies the attachment in errors, for example "kprobe
+	// __sys_recvfrom".
+	Name string
+
+	// Attach creates the link, usually by calling one of the functions in
+	// this package:
+	//
+	//	func() (link.Link, error) {
+	//		return link.Kprobe("__sys_recvfrom", prog, nil)
+	//	}
+	Attach func() (Link, error)
+}
+
+// AttachAll creates the links described by specs in order.
+//
+// If one of them fails, all links created so far are closed in reverse order
+// and the error is returned, so that either all or none of the programs are
+// attached. The returned links are in the same order as specs.
+func AttachAll(specs []AttachSpec) ([]Link, error) {
+	links := make([]Link, 0, len(specs))
+	for i, spec := range specs {
+		name := spec.Name
+		if name == "" {
+			name = fmt.Sprintf("attachment %d", i)
+		}
+
+		if spec.Attach == nil {
+			closeLinks(links)
+			return nil, fmt.Errorf("%s: missing Attach function: %w", name, errInvalidInput)
+		}
+
+		l, err := spec.Attach()
+		if err != nil {
+			closeLinks(links)
+			return nil, fmt.Errorf("%s: %w", name, err)
+		}
+
+		links = append(links, l)
+	}
+
+	return links, nil
+}
+
+// closeLinks closes links in reverse order, ignoring errors.
+func closeLinks(links []Link) {
+	for i := len(links) - 1; i >= 0; i-- {
+		_ = links[i].Close()
+	}
+}
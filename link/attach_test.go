@@ -0,0 +1,41 @@
+package link
+
+import (
+	"errors"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestAttachAll(t *testing.T) {
+	var closed []int
+	attach := func(id int) AttachSpec {
+		return AttachSpec{
+			Attach: func() (Link, error) {
+				return &fakeLink{id: id, closed: &closed}, nil
+			},
+		}
+	}
+
+	links, err := AttachAll([]AttachSpec{attach(0), attach(1)})
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, links, qt.HasLen, 2)
+	qt.Assert(t, links[0].(*fakeLink).id, qt.Equals, 0)
+	qt.Assert(t, links[1].(*fakeLink).id, qt.Equals, 1)
+	qt.Assert(t, closed, qt.HasLen, 0)
+
+	errAttach := errors.New("attach failed")
+	links, err = AttachAll([]AttachSpec{
+		attach(0),
+		attach(1),
+		{Name: "broken", Attach: func() (Link, error) { return nil, errAttach }},
+		attach(3),
+	})
+	qt.Assert(t, err, qt.ErrorIs, errAttach)
+	qt.Assert(t, err, qt.ErrorMatches, "broken: .*")
+	qt.Assert(t, links, qt.IsNil)
+	qt.Assert(t, closed, qt.DeepEquals, []int{1, 0})
+
+	_, err = AttachAll([]AttachSpec{{}})
+	qt.Assert(t, err, qt.ErrorIs, errInvalidInput)
+}
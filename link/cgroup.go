@@ -4,35 +4,223 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"time"
+	"unsafe"
 
 	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/internal"
+	"github.com/cilium/ebpf/internal/sys"
+	"github.com/cilium/ebpf/internal/unix"
 )
 
-type cgroupAttachFlags uint32
+// ErrNotCgroup is returned by AttachCgroupFD if the fd doesn't refer to a
+// cgroupv2 directory.
+var ErrNotCgroup = errors.New("not a cgroupv2 directory")
+
+// CgroupAttachFlags control how a program is attached to a cgroup using
+// BPF_PROG_ATTACH.
+type CgroupAttachFlags uint32
 
 // cgroup attach flags
 const (
-	flagAllowOverride cgroupAttachFlags = 1 << iota
-	flagAllowMulti
+	// CgroupAllowOverride allows programs attached to descendant cgroups to
+	// override this program. Corresponds to BPF_F_ALLOW_OVERRIDE.
+	CgroupAllowOverride CgroupAttachFlags = 1 << iota
+	// CgroupAllowMulti allows multiple programs to be attached to the same
+	// cgroup and hook, all of which are executed. Corresponds to
+	// BPF_F_ALLOW_MULTI.
+	CgroupAllowMulti
 	flagReplace
 )
 
 type CgroupOptions struct {
 	// Path to a cgroupv2 folder.
 	Path string
-	// One of the AttachCgroup* constants
+	// One of the AttachCgroup* constants. AttachCGroupGetsockopt and
+	// AttachCGroupSetsockopt need kernel 5.3+, see SockoptContext.
 	Attach ebpf.AttachType
 	// Program must be of type CGroup*, and the attach type must match Attach.
+	// CGroupSKB programs return a verdict such as ebpf.CGroupSKBAllow, and
+	// can be tested using ebpf.MakeSkBuff before attaching them.
 	Program *ebpf.Program
+
+	// Flags used to attach Program. If either Flags or ReplaceProgram are
+	// set, the program is attached using BPF_PROG_ATTACH instead of a
+	// bpf_link. CgroupAllowOverride and CgroupAllowMulti are mutually
+	// exclusive.
+	Flags CgroupAttachFlags
+	// ReplaceProgram is atomically replaced by Program. It must currently be
+	// attached to the cgroup and requires CgroupAllowMulti.
+	//
+	// Needs kernel 5.5+.
+	ReplaceProgram *ebpf.Program
 }
 
 // AttachCgroup links a BPF program to a cgroup.
-func AttachCgroup(opts CgroupOptions) (Link, error) {
+//
+// By default a bpf_link is created if the kernel supports it. Otherwise the
+// program is attached in CgroupAllowMulti mode, falling back to
+// CgroupAllowOverride on kernels which don't support it.
+func AttachCgroup(opts CgroupOptions) (_ Link, err error) {
+	defer internal.AddStackTrace(&err)
+
+	if opts.Flags != 0 || opts.ReplaceProgram != nil {
+		if err := checkCgroupAttachFlags(opts.Flags, opts.ReplaceProgram); err != nil {
+			return nil, err
+		}
+	}
+
 	cgroup, err := os.Open(opts.Path)
 	if err != nil {
 		return nil, fmt.Errorf("can't open cgroup: %s", err)
 	}
 
+	return attachCgroup(cgroup, opts)
+}
+
+// AttachCgroupFD links a BPF program to a cgroup given as a file descriptor,
+// for example one received from a container runtime.
+//
+// fd must refer to a cgroupv2 directory, otherwise an error wrapping
+// ErrNotCgroup is returned. It is duplicated, so the caller may
+// close it once the function returns. The program is attached in the same way
+// as by AttachCgroup with default flags.
+func AttachCgroupFD(fd int, attach ebpf.AttachType, prog *ebpf.Program) (_ Link, err error) {
+	defer internal.AddStackTrace(&err)
+
+	if fd < 0 {
+		return nil, fmt.Errorf("invalid cgroup fd %d: %w", fd, ErrNotCgroup)
+	}
+
+	var statfs unix.Statfs_t
+	if err := unix.Fstatfs(fd, &statfs); err != nil {
+		return nil, fmt.Errorf("cgroup fd: %w", err)
+	}
+	if uint64(statfs.Type) != cgroup2FSType {
+		return nil, fmt.Errorf("fd %d is not on a cgroupv2 filesystem: %w", fd, ErrNotCgroup)
+	}
+
+	dup, err := unix.FcntlInt(uintptr(fd), unix.F_DUPFD_CLOEXEC, 0)
+	if err != nil {
+		return nil, fmt.Errorf("can't duplicate cgroup fd: %w", err)
+	}
+
+	cgroup := os.NewFile(uintptr(dup), "cgroup")
+	fi, err := cgroup.Stat()
+	if err != nil {
+		cgroup.Close()
+		return nil, fmt.Errorf("cgroup fd: %w", err)
+	}
+	if !fi.IsDir() {
+		cgroup.Close()
+		return nil, fmt.Errorf("fd %d is not a directory: %w", fd, ErrNotCgroup)
+	}
+
+	return attachCgroup(cgroup, CgroupOptions{
+		Attach:  attach,
+		Program: prog,
+	})
+}
+
+// CgroupAttachment is a program attached to a cgroup, see QueryCgroup.
+type CgroupAttachment struct {
+	// ID of the attached program.
+	ID ebpf.ProgramID
+	// Flags of the attach point, which are the same for all programs
+	// attached to it.
+	Flags CgroupAttachFlags
+}
+
+// QueryCgroup returns the programs attached directly to a cgroup at the given
+// attach type, in the order in which they are executed.
+//
+// Programs attached to ancestors of the cgroup aren't included. Needs kernel
+// 4.15+.
+func QueryCgroup(path string, attach ebpf.AttachType) ([]CgroupAttachment, error) {
+	if err := haveProgQuery(); err != nil {
+		return nil, err
+	}
+
+	cgroup, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("can't open cgroup: %s", err)
+	}
+	defer cgroup.Close()
+
+	attr := sys.ProgQueryAttr{
+		TargetFd:   uint32(cgroup.Fd()),
+		AttachType: sys.AttachType(attach),
+	}
+
+	// Query the number of programs first, and retry if programs are attached
+	// in between the two calls.
+	var ids []uint32
+	for {
+		if err := sys.ProgQuery(&attr); err != nil && !errors.Is(err, unix.ENOSPC) {
+			return nil, fmt.Errorf("query cgroup: %w", err)
+		}
+
+		if int(attr.ProgCount) <= len(ids) {
+			ids = ids[:attr.ProgCount]
+			break
+		}
+
+		ids = make([]uint32, attr.ProgCount)
+		attr.ProgIds = sys.NewPointer(unsafe.Pointer(&ids[0]))
+	}
+
+	attachments := make([]CgroupAttachment, 0, len(ids))
+	for _, id := range ids {
+		attachments = append(attachments, CgroupAttachment{
+			ID:    ebpf.ProgramID(id),
+			Flags: CgroupAttachFlags(attr.AttachFlags),
+		})
+	}
+
+	return attachments, nil
+}
+
+// DetachCgroupProgram detaches the program with the given ID from a cgroup,
+// for example one returned by QueryCgroup.
+//
+// Only works for programs attached using BPF_PROG_ATTACH. Programs attached
+// via a bpf_link are detached by closing or unpinning the link.
+func DetachCgroupProgram(path string, attach ebpf.AttachType, id ebpf.ProgramID) error {
+	prog, err := ebpf.NewProgramFromID(id)
+	if err != nil {
+		return fmt.Errorf("program %d: %w", id, err)
+	}
+	defer prog.Close()
+
+	cgroup, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("can't open cgroup: %s", err)
+	}
+	defer cgroup.Close()
+
+	err = RawDetachProgram(RawDetachProgramOptions{
+		Target:  int(cgroup.Fd()),
+		Program: prog,
+		Attach:  attach,
+	})
+	if err != nil {
+		return fmt.Errorf("cgroup: %w", err)
+	}
+	return nil
+}
+
+// cgroup2FSType is the magic number of cgroupv2 filesystems.
+const cgroup2FSType = 0x63677270
+
+// attachCgroup attaches a program to cgroup, which is closed on error.
+func attachCgroup(cgroup *os.File, opts CgroupOptions) (Link, error) {
+	if isSockoptAttachType(opts.Attach) {
+		if err := haveCgroupSockopt(); err != nil {
+			cgroup.Close()
+			return nil, fmt.Errorf("attach %s: %w", opts.Attach, err)
+		}
+	}
+
 	clone, err := opts.Program.Clone()
 	if err != nil {
 		cgroup.Close()
@@ -40,12 +228,16 @@ func AttachCgroup(opts CgroupOptions) (Link, error) {
 	}
 
 	var cg Link
-	cg, err = newLinkCgroup(cgroup, opts.Attach, clone)
-	if errors.Is(err, ErrNotSupported) {
-		cg, err = newProgAttachCgroup(cgroup, opts.Attach, clone, flagAllowMulti)
-	}
-	if errors.Is(err, ErrNotSupported) {
-		cg, err = newProgAttachCgroup(cgroup, opts.Attach, clone, flagAllowOverride)
+	if opts.Flags != 0 || opts.ReplaceProgram != nil {
+		cg, err = newProgAttachCgroup(cgroup, opts.Attach, clone, opts.Flags, opts.ReplaceProgram)
+	} else {
+		cg, err = newLinkCgroup(cgroup, opts.Attach, clone)
+		if errors.Is(err, ErrNotSupported) {
+			cg, err = newProgAttachCgroup(cgroup, opts.Attach, clone, CgroupAllowMulti, nil)
+		}
+		if errors.Is(err, ErrNotSupported) {
+			cg, err = newProgAttachCgroup(cgroup, opts.Attach, clone, CgroupAllowOverride, nil)
+		}
 	}
 	if err != nil {
 		cgroup.Close()
@@ -56,35 +248,67 @@ func AttachCgroup(opts CgroupOptions) (Link, error) {
 	return cg, nil
 }
 
+// checkCgroupAttachFlags rejects flag combinations which the kernel doesn't
+// accept, since it only returns EINVAL for them.
+func checkCgroupAttachFlags(flags CgroupAttachFlags, replace *ebpf.Program) error {
+	if unknown := flags &^ (CgroupAllowOverride | CgroupAllowMulti); unknown != 0 {
+		return fmt.Errorf("unknown cgroup attach flags %#x: %w", uint32(unknown), errInvalidInput)
+	}
+
+	if flags&CgroupAllowOverride != 0 && flags&CgroupAllowMulti != 0 {
+		return fmt.Errorf("CgroupAllowOverride and CgroupAllowMulti are mutually exclusive: %w", errInvalidInput)
+	}
+
+	if replace != nil && flags&CgroupAllowMulti == 0 {
+		return fmt.Errorf("replacing a program requires CgroupAllowMulti: %w", errInvalidInput)
+	}
+
+	return nil
+}
+
 type progAttachCgroup struct {
 	cgroup     *os.File
 	current    *ebpf.Program
 	attachType ebpf.AttachType
-	flags      cgroupAttachFlags
+	flags      CgroupAttachFlags
+	created    time.Time
 }
 
 var _ Link = (*progAttachCgroup)(nil)
 
 func (cg *progAttachCgroup) isLink() {}
 
-func newProgAttachCgroup(cgroup *os.File, attach ebpf.AttachType, prog *ebpf.Program, flags cgroupAttachFlags) (*progAttachCgroup, error) {
-	if flags&flagAllowMulti > 0 {
+func (cg *progAttachCgroup) Created() time.Time {
+	return cg.created
+}
+
+// newProgAttachCgroup attaches prog to cgroup using BPF_PROG_ATTACH. If replace
+// is not nil it is atomically replaced by prog.
+func newProgAttachCgroup(cgroup *os.File, attach ebpf.AttachType, prog *ebpf.Program, flags CgroupAttachFlags, replace *ebpf.Program) (*progAttachCgroup, error) {
+	if flags&CgroupAllowMulti > 0 {
 		if err := haveProgAttachReplace(); err != nil {
 			return nil, fmt.Errorf("can't support multiple programs: %w", err)
 		}
 	}
 
-	err := RawAttachProgram(RawAttachProgramOptions{
+	args := RawAttachProgramOptions{
 		Target:  int(cgroup.Fd()),
 		Program: prog,
 		Flags:   uint32(flags),
 		Attach:  attach,
-	})
+	}
+
+	if replace != nil {
+		args.Flags |= uint32(flagReplace)
+		args.Replace = replace
+	}
+
+	err := RawAttachProgram(args)
 	if err != nil {
 		return nil, fmt.Errorf("cgroup: %w", err)
 	}
 
-	return &progAttachCgroup{cgroup, prog, attach, flags}, nil
+	return &progAttachCgroup{cgroup, prog, attach, flags, internal.Now()}, nil
 }
 
 func (cg *progAttachCgroup) Close() error {
@@ -115,7 +339,7 @@ func (cg *progAttachCgroup) Update(prog *ebpf.Program) error {
 		Flags:   uint32(cg.flags),
 	}
 
-	if cg.flags&flagAllowMulti > 0 {
+	if cg.flags&CgroupAllowMulti > 0 {
 		// Atomically replacing multiple programs requires at least
 		// 5.5 (commit 7dd68b3279f17921 "bpf: Support replacing cgroup-bpf
 		// program in MULTI mode")
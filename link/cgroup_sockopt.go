@@ -0,0 +1,49 @@
+package link
+
+import (
+	"unsafe"
+
+	"github.com/cilium/ebpf"
+)
+
+// SockoptContext mirrors struct bpf_sockopt, the context passed to programs
+// attached to AttachCGroupGetsockopt and AttachCGroupSetsockopt.
+//
+// The kernel always reserves 8 bytes for the pointer fields, so they are
+// represented as uint64 regardless of the architecture. Use the Sockopt*Offset
+// constants to access the fields from eBPF assembly, or compare them against
+// the offsets of a struct defined in C.
+type SockoptContext struct {
+	// struct bpf_sock *sk
+	Sk uint64
+	// void *optval, the start of the option value.
+	Optval uint64
+	// void *optval_end, the end of the option value.
+	OptvalEnd uint64
+	// The level as passed to getsockopt or setsockopt, e.g. SOL_SOCKET.
+	Level int32
+	// The option name, e.g. SO_RCVBUF.
+	Optname int32
+	// Length of the option value. Programs may change it.
+	Optlen int32
+	// Return value of the kernel's getsockopt handler. Only available to
+	// AttachCGroupGetsockopt programs.
+	Retval int32
+}
+
+// Offsets of the fields of struct bpf_sockopt.
+const (
+	SockoptSkOffset        = int16(unsafe.Offsetof(SockoptContext{}.Sk))
+	SockoptOptvalOffset    = int16(unsafe.Offsetof(SockoptContext{}.Optval))
+	SockoptOptvalEndOffset = int16(unsafe.Offsetof(SockoptContext{}.OptvalEnd))
+	SockoptLevelOffset     = int16(unsafe.Offsetof(SockoptContext{}.Level))
+	SockoptOptnameOffset   = int16(unsafe.Offsetof(SockoptContext{}.Optname))
+	SockoptOptlenOffset    = int16(unsafe.Offsetof(SockoptContext{}.Optlen))
+	SockoptRetvalOffset    = int16(unsafe.Offsetof(SockoptContext{}.Retval))
+)
+
+// isSockoptAttachType returns true if attach is one of the cgroup sockopt
+// hooks.
+func isSockoptAttachType(attach ebpf.AttachType) bool {
+	return attach == ebpf.AttachCGroupGetsockopt || attach == ebpf.AttachCGroupSetsockopt
+}
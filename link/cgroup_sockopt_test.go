@@ -0,0 +1,68 @@
+package link
+
+import (
+	"testing"
+	"unsafe"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/asm"
+	"github.com/cilium/ebpf/internal/testutils"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestSockoptContextLayout(t *testing.T) {
+	qt.Assert(t, unsafe.Sizeof(SockoptContext{}), qt.Equals, uintptr(40))
+	qt.Assert(t, SockoptOptvalEndOffset, qt.Equals, int16(16))
+	qt.Assert(t, SockoptRetvalOffset, qt.Equals, int16(36))
+}
+
+func TestAttachCgroupSockopt(t *testing.T) {
+	testutils.SkipIfNotSupported(t, haveCgroupSockopt())
+
+	cgroup := testutils.CreateCgroup(t)
+
+	for _, attach := range []ebpf.AttachType{ebpf.AttachCGroupGetsockopt, ebpf.AttachCGroupSetsockopt} {
+		t.Run(attach.String(), func(t *testing.T) {
+			// Access all fields to make sure the verifier agrees with the
+			// layout of SockoptContext.
+			insns := asm.Instructions{
+				asm.LoadMem(asm.R2, asm.R1, SockoptSkOffset, asm.DWord),
+				asm.LoadMem(asm.R2, asm.R1, SockoptOptvalOffset, asm.DWord),
+				asm.LoadMem(asm.R2, asm.R1, SockoptOptvalEndOffset, asm.DWord),
+				asm.LoadMem(asm.R2, asm.R1, SockoptLevelOffset, asm.Word),
+				asm.LoadMem(asm.R2, asm.R1, SockoptOptnameOffset, asm.Word),
+				asm.LoadMem(asm.R2, asm.R1, SockoptOptlenOffset, asm.Word),
+			}
+			if attach == ebpf.AttachCGroupGetsockopt {
+				insns = append(insns, asm.LoadMem(asm.R2, asm.R1, SockoptRetvalOffset, asm.Word))
+			}
+			insns = append(insns,
+				asm.Mov.Imm(asm.R0, 1),
+				asm.Return(),
+			)
+
+			prog, err := ebpf.NewProgram(&ebpf.ProgramSpec{
+				Type:         ebpf.CGroupSockopt,
+				AttachType:   attach,
+				License:      "MIT",
+				Instructions: insns,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer prog.Close()
+
+			link, err := AttachCgroup(CgroupOptions{
+				Path:    cgroup.Name(),
+				Attach:  attach,
+				Program: prog,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			testLink(t, link, prog)
+		})
+	}
+}
@@ -1,6 +1,9 @@
 package link
 
 import (
+	"errors"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/cilium/ebpf"
@@ -31,10 +34,95 @@ func TestAttachCgroup(t *testing.T) {
 	}
 }
 
+func TestAttachCgroupFD(t *testing.T) {
+	cgroup, prog := mustCgroupFixtures(t)
+
+	f, err := os.Open(cgroup.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	link, err := AttachCgroupFD(int(f.Fd()), ebpf.AttachCGroupInetEgress, prog)
+	// The link must not depend on the caller's fd.
+	f.Close()
+	testutils.SkipIfNotSupported(t, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := link.Close(); err != nil {
+		t.Fatal("Can't close link:", err)
+	}
+
+	devNull, err := os.Open(os.DevNull)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer devNull.Close()
+
+	_, err = AttachCgroupFD(int(devNull.Fd()), ebpf.AttachCGroupInetEgress, prog)
+	if !errors.Is(err, ErrNotCgroup) {
+		t.Fatal("Expected ErrNotCgroup for an fd which isn't a cgroup, got", err)
+	}
+
+	procs, err := os.Open(filepath.Join(cgroup.Name(), "cgroup.procs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer procs.Close()
+
+	_, err = AttachCgroupFD(int(procs.Fd()), ebpf.AttachCGroupInetEgress, prog)
+	if !errors.Is(err, ErrNotCgroup) {
+		t.Fatal("Expected ErrNotCgroup for a file in a cgroup, got", err)
+	}
+}
+
+func TestQueryCgroup(t *testing.T) {
+	cgroup, prog := mustCgroupFixtures(t)
+
+	err := RawAttachProgram(RawAttachProgramOptions{
+		Target:  int(cgroup.Fd()),
+		Program: prog,
+		Attach:  ebpf.AttachCGroupInetEgress,
+		Flags:   uint32(CgroupAllowMulti),
+	})
+	testutils.SkipIfNotSupported(t, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	info, err := prog.Info()
+	if err != nil {
+		t.Fatal(err)
+	}
+	id, _ := info.ID()
+
+	attachments, err := QueryCgroup(cgroup.Name(), ebpf.AttachCGroupInetEgress)
+	testutils.SkipIfNotSupported(t, err)
+	if err != nil {
+		t.Fatal("Can't query cgroup:", err)
+	}
+	if len(attachments) != 1 || attachments[0] != (CgroupAttachment{id, CgroupAllowMulti}) {
+		t.Fatalf("Expected program %d with CgroupAllowMulti, got %v", id, attachments)
+	}
+
+	if err := DetachCgroupProgram(cgroup.Name(), ebpf.AttachCGroupInetEgress, id); err != nil {
+		t.Fatal("Can't detach program:", err)
+	}
+
+	attachments, err = QueryCgroup(cgroup.Name(), ebpf.AttachCGroupInetEgress)
+	if err != nil {
+		t.Fatal("Can't query cgroup:", err)
+	}
+	if len(attachments) != 0 {
+		t.Fatal("Expected no programs after detaching, got", attachments)
+	}
+}
+
 func TestProgAttachCgroup(t *testing.T) {
 	cgroup, prog := mustCgroupFixtures(t)
 
-	link, err := newProgAttachCgroup(cgroup, ebpf.AttachCGroupInetEgress, prog, 0)
+	link, err := newProgAttachCgroup(cgroup, ebpf.AttachCGroupInetEgress, prog, 0, nil)
 	if err != nil {
 		t.Fatal("Can't create link:", err)
 	}
@@ -45,7 +133,7 @@ func TestProgAttachCgroup(t *testing.T) {
 func TestProgAttachCgroupAllowMulti(t *testing.T) {
 	cgroup, prog := mustCgroupFixtures(t)
 
-	link, err := newProgAttachCgroup(cgroup, ebpf.AttachCGroupInetEgress, prog, flagAllowMulti)
+	link, err := newProgAttachCgroup(cgroup, ebpf.AttachCGroupInetEgress, prog, CgroupAllowMulti, nil)
 	testutils.SkipIfNotSupported(t, err)
 	if err != nil {
 		t.Fatal("Can't create link:", err)
@@ -68,3 +156,60 @@ func TestLinkCgroup(t *testing.T) {
 
 	testLink(t, link, prog)
 }
+
+func TestAttachCgroupFlags(t *testing.T) {
+	cgroup, prog := mustCgroupFixtures(t)
+
+	for _, opts := range []CgroupOptions{
+		{Flags: CgroupAllowOverride | CgroupAllowMulti},
+		{Flags: 1 << 31},
+		{Flags: CgroupAllowOverride, ReplaceProgram: prog},
+		{ReplaceProgram: prog},
+	} {
+		opts.Path = cgroup.Name()
+		opts.Attach = ebpf.AttachCGroupInetEgress
+		opts.Program = prog
+
+		if _, err := AttachCgroup(opts); !errors.Is(err, errInvalidInput) {
+			t.Errorf("Flags %#x with replace %t: expected errInvalidInput, got %v", opts.Flags, opts.ReplaceProgram != nil, err)
+		}
+	}
+
+	old, err := AttachCgroup(CgroupOptions{
+		Path:    cgroup.Name(),
+		Attach:  ebpf.AttachCGroupInetEgress,
+		Program: prog,
+		Flags:   CgroupAllowMulti,
+	})
+	testutils.SkipIfNotSupported(t, err)
+	if err != nil {
+		t.Fatal("Can't attach program:", err)
+	}
+	defer old.Close()
+
+	if _, ok := old.(*progAttachCgroup); !ok {
+		t.Fatalf("Expected progAttachCgroup, got %T instead", old)
+	}
+
+	prog2 := mustLoadProgram(t, ebpf.CGroupSKB, ebpf.AttachCGroupInetEgress, "")
+	replaced, err := AttachCgroup(CgroupOptions{
+		Path:           cgroup.Name(),
+		Attach:         ebpf.AttachCGroupInetEgress,
+		Program:        prog2,
+		Flags:          CgroupAllowMulti,
+		ReplaceProgram: prog,
+	})
+	testutils.SkipIfNotSupported(t, err)
+	if err != nil {
+		t.Fatal("Can't replace program:", err)
+	}
+
+	if err := replaced.Close(); err != nil {
+		t.Fatal("Can't detach replacing program:", err)
+	}
+
+	// prog was replaced, so detaching it must fail.
+	if err := old.Close(); err == nil {
+		t.Error("Detaching a replaced program doesn't return an error")
+	}
+}
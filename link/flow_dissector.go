@@ -0,0 +1,230 @@
+package link
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/internal"
+	"github.com/cilium/ebpf/internal/sys"
+	"github.com/cilium/ebpf/internal/unix"
+)
+
+// ErrFlowDissectorExists is returned by AttachFlowDissector if the network
+// namespace already has a flow dissector.
+var ErrFlowDissectorExists = fmt.Errorf("flow dissector already attached: %w", os.ErrExist)
+
+// FlowDissectorOptions control AttachFlowDissector.
+type FlowDissectorOptions struct {
+	// File descriptor of the network namespace to attach to, for example
+	// obtained by opening /proc/<pid>/ns/net of a process in a container.
+	// Zero attaches to the network namespace of the calling process.
+	NetNS int
+	// Program must be of type FlowDissector.
+	Program *ebpf.Program
+}
+
+// AttachFlowDissector replaces the kernel's flow dissector in a network
+// namespace with an eBPF program.
+//
+// A network namespace can only have a single flow dissector. Returns an error
+// wrapping ErrFlowDissectorExists if another program is already attached.
+//
+// Uses a bpf_link if the kernel supports it (Linux 5.7), and BPF_PROG_ATTACH
+// otherwise.
+func AttachFlowDissector(opts FlowDissectorOptions) (_ Link, err error) {
+	defer internal.AddStackTrace(&err)
+
+	if opts.Program == nil {
+		return nil, fmt.Errorf("program cannot be nil: %w", errInvalidInput)
+	}
+	if t := opts.Program.Type(); t != ebpf.FlowDissector {
+		return nil, fmt.Errorf("eBPF program type %s is not FlowDissector: %w", t, errInvalidInput)
+	}
+
+	ns, closeNS, err := openNetNS(opts.NetNS)
+	if err != nil {
+		return nil, err
+	}
+	defer closeNS()
+
+	err = haveBPFLink()
+	if errors.Is(err, ErrNotSupported) {
+		fd, err := newProgAttachFlowDissector(ns, opts.Program)
+		if err != nil {
+			return nil, err
+		}
+		return fd, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	fd, err := sys.LinkCreate(&sys.LinkCreateAttr{
+		TargetFd:   uint32(ns),
+		ProgFd:     uint32(opts.Program.FD()),
+		AttachType: sys.AttachType(ebpf.AttachFlowDissector),
+	})
+	if errors.Is(err, unix.EEXIST) || errors.Is(err, unix.E2BIG) {
+		// EEXIST if a program is attached via BPF_PROG_ATTACH, E2BIG if
+		// there is another link.
+		return nil, ErrFlowDissectorExists
+	}
+	if err != nil {
+		return nil, fmt.Errorf("attach flow dissector: %w", err)
+	}
+
+	return &NetNsLink{RawLink{fd, "", internal.Now()}}, nil
+}
+
+// progAttachFlowDissector is a flow dissector attached via BPF_PROG_ATTACH,
+// which always targets the network namespace of the calling thread.
+type progAttachFlowDissector struct {
+	netns   *os.File
+	prog    *ebpf.Program
+	created time.Time
+}
+
+var _ Link = (*progAttachFlowDissector)(nil)
+
+func newProgAttachFlowDissector(ns int, program *ebpf.Program) (*progAttachFlowDissector, error) {
+	dup, err := unix.FcntlInt(uintptr(ns), unix.F_DUPFD_CLOEXEC, 1)
+	if err != nil {
+		return nil, fmt.Errorf("duplicate network namespace fd: %w", err)
+	}
+	netns := os.NewFile(uintptr(dup), "netns")
+
+	// BPF_PROG_ATTACH silently replaces a flow dissector attached the same
+	// way, so check for one first.
+	attached, err := flowDissectorAttached(int(netns.Fd()))
+	if err != nil {
+		netns.Close()
+		return nil, err
+	}
+	if attached {
+		netns.Close()
+		return nil, ErrFlowDissectorExists
+	}
+
+	prog, err := program.Clone()
+	if err != nil {
+		netns.Close()
+		return nil, err
+	}
+
+	err = inNetNS(int(netns.Fd()), func() error {
+		return RawAttachProgram(RawAttachProgramOptions{
+			Program: prog,
+			Attach:  ebpf.AttachFlowDissector,
+		})
+	})
+	if errors.Is(err, unix.EEXIST) {
+		err = ErrFlowDissectorExists
+	}
+	if err != nil {
+		prog.Close()
+		netns.Close()
+		return nil, err
+	}
+
+	return &progAttachFlowDissector{netns, prog, internal.Now()}, nil
+}
+
+// flowDissectorAttached returns true if the network namespace ns has a flow
+// dissector. Returns false if the kernel can't query flow dissectors (before
+// Linux 5.0).
+func flowDissectorAttached(ns int) (bool, error) {
+	attr := sys.ProgQueryAttr{
+		TargetFd:   uint32(ns),
+		AttachType: sys.AttachType(ebpf.AttachFlowDissector),
+	}
+
+	err := sys.ProgQuery(&attr)
+	if errors.Is(err, unix.EINVAL) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("query flow dissector: %w", err)
+	}
+
+	return attr.ProgCount > 0, nil
+}
+
+func (fd *progAttachFlowDissector) isLink() {}
+
+func (fd *progAttachFlowDissector) Created() time.Time {
+	return fd.created
+}
+
+func (fd *progAttachFlowDissector) Close() error {
+	defer fd.netns.Close()
+	defer fd.prog.Close()
+
+	return inNetNS(int(fd.netns.Fd()), func() error {
+		return RawDetachProgram(RawDetachProgramOptions{
+			Program: fd.prog,
+			Attach:  ebpf.AttachFlowDissector,
+		})
+	})
+}
+
+func (fd *progAttachFlowDissector) Update(prog *ebpf.Program) error {
+	if prog.Type() != ebpf.FlowDissector {
+		return fmt.Errorf("eBPF program type %s is not FlowDissector: %w", prog.Type(), errInvalidInput)
+	}
+
+	// The kernel refuses to replace a program with itself.
+	if sameProgram(prog, fd.prog) {
+		return nil
+	}
+
+	new, err := prog.Clone()
+	if err != nil {
+		return err
+	}
+
+	// Attaching a flow dissector replaces the existing one.
+	err = inNetNS(int(fd.netns.Fd()), func() error {
+		return RawAttachProgram(RawAttachProgramOptions{
+			Program: new,
+			Attach:  ebpf.AttachFlowDissector,
+		})
+	})
+	if err != nil {
+		new.Close()
+		return fmt.Errorf("can't update flow dissector: %w", err)
+	}
+
+	fd.prog.Close()
+	fd.prog = new
+	return nil
+}
+
+func (fd *progAttachFlowDissector) Pin(string) error {
+	return fmt.Errorf("can't pin flow dissector: %w", ErrNotSupported)
+}
+
+func (fd *progAttachFlowDissector) Unpin() error {
+	return fmt.Errorf("can't unpin flow dissector: %w", ErrNotSupported)
+}
+
+func (fd *progAttachFlowDissector) Info() (*Info, error) {
+	return nil, fmt.Errorf("can't get flow dissector info: %w", ErrNotSupported)
+}
+
+func sameProgram(a, b *ebpf.Program) bool {
+	aInfo, err := a.Info()
+	if err != nil {
+		return false
+	}
+	bInfo, err := b.Info()
+	if err != nil {
+		return false
+	}
+
+	aID, aOK := aInfo.ID()
+	bID, bOK := bInfo.ID()
+	return aOK && bOK && aID == bID
+}
@@ -6,6 +6,7 @@ import (
 	"unsafe"
 
 	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/internal"
 	"github.com/cilium/ebpf/internal/sys"
 )
 
@@ -24,7 +25,9 @@ type IterOptions struct {
 }
 
 // AttachIter attaches a BPF seq_file iterator.
-func AttachIter(opts IterOptions) (*Iter, error) {
+func AttachIter(opts IterOptions) (_ *Iter, err error) {
+	defer internal.AddStackTrace(&err)
+
 	if err := haveBPFLink(); err != nil {
 		return nil, err
 	}
@@ -55,7 +58,7 @@ func AttachIter(opts IterOptions) (*Iter, error) {
 		return nil, fmt.Errorf("can't link iterator: %w", err)
 	}
 
-	return &Iter{RawLink{fd, ""}}, err
+	return &Iter{RawLink{fd, "", internal.Now()}}, err
 }
 
 // Iter represents an attached bpf_iter.
@@ -1,10 +1,12 @@
 package link
 
 import (
+	"bufio"
 	"bytes"
 	"crypto/rand"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -14,12 +16,14 @@ import (
 	"unsafe"
 
 	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/internal"
 	"github.com/cilium/ebpf/internal/sys"
 	"github.com/cilium/ebpf/internal/unix"
 )
 
 var (
 	kprobeEventsPath = filepath.Join(tracefsPath, "kprobe_events")
+	kallsymsPath     = "/proc/kallsyms"
 
 	kprobeRetprobeBit = struct {
 		once  sync.Once
@@ -28,15 +32,33 @@ var (
 	}{}
 )
 
+// errSymbolNotFound is wrapped by errors caused by a probe target which doesn't
+// exist in the kernel. It matches os.ErrNotExist, but unlike os.ErrNotExist
+// returned from the file system it doesn't mean that tracefs or one of its
+// files is missing.
+var errSymbolNotFound = symbolNotFoundError{}
+
+type symbolNotFoundError struct{}
+
+func (symbolNotFoundError) Error() string { return os.ErrNotExist.Error() }
+func (symbolNotFoundError) Unwrap() error { return os.ErrNotExist }
+
+// TracefsGroupPrefix is the prefix of the group of all trace events created
+// by this package in tracefs. See CleanupTracefs.
+const TracefsGroupPrefix = "ebpf"
+
 type probeType uint8
 
 type probeArgs struct {
 	symbol, group, path          string
 	offset, refCtrOffset, cookie uint64
-	pid                          int
+	pid, retprobeMaxActive       int
 	ret                          bool
 }
 
+// kretprobeMaxActiveMax must match KRETPROBE_MAXACTIVE_MAX in the kernel sources.
+const kretprobeMaxActiveMax = 4096
+
 // KprobeOptions defines additional parameters that will be used
 // when loading Kprobes.
 type KprobeOptions struct {
@@ -48,7 +70,38 @@ type KprobeOptions struct {
 	// Offset of the kprobe relative to the traced symbol.
 	// Can be used to insert kprobes at arbitrary offsets in kernel functions,
 	// e.g. in places where functions have been inlined.
+	//
+	// The kernel rejects offsets which are outside of the function or which
+	// don't fall on an instruction boundary, in which case an error wrapping
+	// os.ErrNotExist is returned.
 	Offset uint64
+	// Maximum number of concurrently running instances of a Kretprobe. Once
+	// the limit is reached, returns of the traced function are silently
+	// missed. Must be between 1 and 4096. Zero lets the kernel pick a default,
+	// which is usually based on the number of CPUs.
+	//
+	// The perf_kprobe PMU doesn't support this setting, so a non-zero value
+	// forces the use of tracefs. Only valid for Kretprobe.
+	RetprobeMaxActive int
+	// SelfTest requests running the program once using BPF_PROG_TEST_RUN
+	// before attaching it.
+	//
+	// Kprobe programs can't be run with BPF_PROG_TEST_RUN, so this is
+	// currently a no-op and the program is attached without a test run.
+	SelfTest bool
+	// ModuleAware attaches the kprobe again whenever the kernel module
+	// containing the symbol is unloaded and loaded again, instead of silently
+	// losing it. Reloads are detected by polling sysfs, so events which occur
+	// right after a reload may be missed. This is best-effort.
+	//
+	// Has no effect for symbols which aren't part of a module. The module
+	// must be loaded when attaching.
+	ModuleAware bool
+	// OnReattach is called from a background goroutine with the result of
+	// each attempt to reattach a ModuleAware kprobe. Failed attempts are
+	// retried periodically. It may call methods of the Link, including Close.
+	// May be nil.
+	OnReattach func(error)
 }
 
 const (
@@ -99,7 +152,13 @@ func (pt probeType) RetprobeBit() (uint64, error) {
 // Losing the reference to the resulting Link (kp) will close the Kprobe
 // and prevent further execution of prog. The Link must be Closed during
 // program shutdown to avoid leaking system resources.
-func Kprobe(symbol string, prog *ebpf.Program, opts *KprobeOptions) (Link, error) {
+func Kprobe(symbol string, prog *ebpf.Program, opts *KprobeOptions) (_ Link, err error) {
+	defer internal.AddStackTrace(&err)
+
+	if opts != nil && opts.ModuleAware {
+		return newModuleAwareKprobe(symbol, prog, opts, false)
+	}
+
 	k, err := kprobe(symbol, prog, opts, false)
 	if err != nil {
 		return nil, err
@@ -123,7 +182,13 @@ func Kprobe(symbol string, prog *ebpf.Program, opts *KprobeOptions) (Link, error
 // Losing the reference to the resulting Link (kp) will close the Kretprobe
 // and prevent further execution of prog. The Link must be Closed during
 // program shutdown to avoid leaking system resources.
-func Kretprobe(symbol string, prog *ebpf.Program, opts *KprobeOptions) (Link, error) {
+func Kretprobe(symbol string, prog *ebpf.Program, opts *KprobeOptions) (_ Link, err error) {
+	defer internal.AddStackTrace(&err)
+
+	if opts != nil && opts.ModuleAware {
+		return newModuleAwareKprobe(symbol, prog, opts, true)
+	}
+
 	k, err := kprobe(symbol, prog, opts, true)
 	if err != nil {
 		return nil, err
@@ -138,6 +203,131 @@ func Kretprobe(symbol string, prog *ebpf.Program, opts *KprobeOptions) (Link, er
 	return lnk, nil
 }
 
+// KprobeAny attaches the given eBPF program to the first symbol out of
+// candidates which exists in the running kernel. This is useful for symbols
+// which are named differently across kernel versions or architectures:
+//
+//	kp, sym, err := KprobeAny([]string{"__sys_recvfrom", "sys_recvfrom"}, prog, nil)
+//
+// The name of the symbol the program was attached to is returned alongside
+// the Link. Returns an error wrapping os.ErrNotExist if none of the candidates
+// exist. Any other error aborts the search and is returned immediately,
+// including os.ErrNotExist caused by a missing tracefs.
+func KprobeAny(candidates []string, prog *ebpf.Program, opts *KprobeOptions) (Link, string, error) {
+	if len(candidates) == 0 {
+		return nil, "", fmt.Errorf("no candidate symbols given: %w", errInvalidInput)
+	}
+
+	for _, symbol := range candidates {
+		lnk, err := Kprobe(symbol, prog, opts)
+		if errors.Is(err, errSymbolNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, "", fmt.Errorf("symbol %s: %w", symbol, err)
+		}
+
+		return lnk, symbol, nil
+	}
+
+	return nil, "", fmt.Errorf("none of the symbols %s exist: %w", strings.Join(candidates, ", "), errSymbolNotFound)
+}
+
+// SyscallKprobe attaches the given eBPF program to the kernel entry point of
+// a system call, given its name without any prefix. For example, recvfrom():
+//
+//	kp, err := SyscallKprobe("recvfrom", prog, nil)
+//
+// The name of the entry point depends on the architecture and on the kernel
+// version, for example __x64_sys_recvfrom, __arm64_sys_recvfrom or
+// sys_recvfrom. The first of these which is listed in /proc/kallsyms is
+// used, falling back to __sys_recvfrom which some kernels call from the
+// entry point.
+//
+// Returns an error wrapping os.ErrNotExist if the kernel has none of the
+// entry points. Other errors, for example due to a missing tracefs, are
+// returned as is.
+func SyscallKprobe(name string, prog *ebpf.Program, opts *KprobeOptions) (Link, error) {
+	candidates, err := syscallSymbols(name)
+	if err != nil {
+		return nil, err
+	}
+
+	lnk, _, err := KprobeAny(candidates, prog, opts)
+	if err != nil {
+		return nil, fmt.Errorf("syscall %s: %w", name, err)
+	}
+
+	return lnk, nil
+}
+
+// syscallSymbols returns the entry points of the given system call which
+// exist in the running kernel, in order of preference.
+//
+// Returns all possible entry points if kallsyms can't be read.
+func syscallSymbols(name string) ([]string, error) {
+	if !isValidKprobeSymbol(name) {
+		return nil, fmt.Errorf("syscall '%s' must be a valid symbol name: %w", name, errInvalidInput)
+	}
+
+	candidates := []string{"sys_" + name, "__sys_" + name}
+	if prefixed := platformPrefix("sys_" + name); prefixed != candidates[0] {
+		candidates = append([]string{prefixed}, candidates...)
+	}
+
+	f, err := os.Open(kallsymsPath)
+	if err != nil {
+		return candidates, nil
+	}
+	defer f.Close()
+
+	symbols, err := filterKallsyms(f, candidates)
+	if err != nil {
+		return nil, fmt.Errorf("read %s: %w", kallsymsPath, err)
+	}
+
+	if len(symbols) == 0 {
+		return nil, fmt.Errorf("syscall %s: none of the symbols %s are in %s: %w",
+			name, strings.Join(candidates, ", "), kallsymsPath, errSymbolNotFound)
+	}
+
+	return symbols, nil
+}
+
+// filterKallsyms returns the subset of candidates which are listed in r,
+// which has the format of /proc/kallsyms. Preserves the order of candidates.
+func filterKallsyms(r io.Reader, candidates []string) ([]string, error) {
+	found := make(map[string]bool, len(candidates))
+	for _, candidate := range candidates {
+		found[candidate] = false
+	}
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		// Lines have the form "address type name [module]".
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 {
+			continue
+		}
+
+		if _, ok := found[fields[2]]; ok {
+			found[fields[2]] = true
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	var symbols []string
+	for _, candidate := range candidates {
+		if found[candidate] {
+			symbols = append(symbols, candidate)
+		}
+	}
+
+	return symbols, nil
+}
+
 // isValidKprobeSymbol implements the equivalent of a regex match
 // against "^[a-zA-Z_][0-9a-zA-Z_.]*$".
 func isValidKprobeSymbol(s string) bool {
@@ -190,24 +380,37 @@ func kprobe(symbol string, prog *ebpf.Program, opts *KprobeOptions, ret bool) (*
 	if opts != nil {
 		args.cookie = opts.Cookie
 		args.offset = opts.Offset
+		args.retprobeMaxActive = opts.RetprobeMaxActive
 	}
 
-	// Use kprobe PMU if the kernel has it available.
-	tp, err := pmuKprobe(args)
-	if errors.Is(err, os.ErrNotExist) {
-		args.symbol = platformPrefix(symbol)
-		tp, err = pmuKprobe(args)
-	}
-	if err == nil {
-		return tp, nil
+	if args.retprobeMaxActive != 0 {
+		if !ret {
+			return nil, fmt.Errorf("RetprobeMaxActive is only valid for kretprobes: %w", errInvalidInput)
+		}
+		if args.retprobeMaxActive < 0 || args.retprobeMaxActive > kretprobeMaxActiveMax {
+			return nil, fmt.Errorf("RetprobeMaxActive %d must be between 1 and %d: %w", args.retprobeMaxActive, kretprobeMaxActiveMax, errInvalidInput)
+		}
 	}
-	if err != nil && !errors.Is(err, ErrNotSupported) {
-		return nil, fmt.Errorf("creating perf_kprobe PMU: %w", err)
+
+	// Use kprobe PMU if the kernel has it available. It doesn't support
+	// setting maxactive, so go straight to tracefs in that case.
+	if args.retprobeMaxActive == 0 {
+		tp, err := pmuKprobe(args)
+		if errors.Is(err, os.ErrNotExist) {
+			args.symbol = platformPrefix(symbol)
+			tp, err = pmuKprobe(args)
+		}
+		if err == nil {
+			return tp, nil
+		}
+		if err != nil && !errors.Is(err, ErrNotSupported) {
+			return nil, fmt.Errorf("creating perf_kprobe PMU: %w", err)
+		}
 	}
 
 	// Use tracefs if kprobe PMU is missing.
 	args.symbol = symbol
-	tp, err = tracefsKprobe(args)
+	tp, err := tracefsKprobe(args)
 	if errors.Is(err, os.ErrNotExist) {
 		args.symbol = platformPrefix(symbol)
 		tp, err = tracefsKprobe(args)
@@ -305,12 +508,12 @@ func pmuProbe(typ probeType, args probeArgs) (*perfEvent, error) {
 	// when trying to create a kretprobe for a missing symbol. Make sure ENOENT
 	// is returned to the caller.
 	if errors.Is(err, os.ErrNotExist) || errors.Is(err, unix.EINVAL) {
-		return nil, fmt.Errorf("symbol '%s+%#x' not found: %w", args.symbol, args.offset, os.ErrNotExist)
+		return nil, fmt.Errorf("symbol '%s+%#x' not found: %w", args.symbol, args.offset, errSymbolNotFound)
 	}
 	// Since commit ab105a4fb894, -EILSEQ is returned when a kprobe sym+offset is resolved
 	// to an invalid insn boundary.
 	if errors.Is(err, syscall.EILSEQ) {
-		return nil, fmt.Errorf("symbol '%s+%#x' not found (bad insn boundary): %w", args.symbol, args.offset, os.ErrNotExist)
+		return nil, fmt.Errorf("symbol '%s+%#x' not found (bad insn boundary): %w", args.symbol, args.offset, errSymbolNotFound)
 	}
 	// Since at least commit cb9a19fe4aa51, ENOTSUPP is returned
 	// when attempting to set a uprobe on a trap instruction.
@@ -354,7 +557,7 @@ func tracefsProbe(typ probeType, args probeArgs) (*perfEvent, error) {
 	// Generate a random string for each trace event we attempt to create.
 	// This value is used as the 'group' token in tracefs to allow creating
 	// multiple kprobe trace events with the same name.
-	group, err := randomGroup("ebpf")
+	group, err := randomGroup(TracefsGroupPrefix)
 	if err != nil {
 		return nil, fmt.Errorf("randomizing group name: %w", err)
 	}
@@ -426,10 +629,10 @@ func createTraceFSProbeEvent(typ probeType, args probeArgs) error {
 		// Leaving the kretprobe's MAXACTIVE set to 0 (or absent) will make the
 		// kernel default to NR_CPUS. This is desired in most eBPF cases since
 		// subsampling or rate limiting logic can be more accurately implemented in
-		// the eBPF program itself.
+		// the eBPF program itself. It can be overridden via RetprobeMaxActive.
 		// See Documentation/kprobes.txt for more details.
 		token = kprobeToken(args)
-		pe = fmt.Sprintf("%s:%s/%s %s", probePrefix(args.ret), args.group, sanitizeSymbol(args.symbol), token)
+		pe = fmt.Sprintf("%s:%s/%s %s", probePrefix(args.ret, args.retprobeMaxActive), args.group, sanitizeSymbol(args.symbol), token)
 	case uprobeType:
 		// The uprobe_events syntax is as follows:
 		// p[:[GRP/]EVENT] PATH:OFFSET [FETCHARGS] : Set a probe
@@ -442,7 +645,7 @@ func createTraceFSProbeEvent(typ probeType, args probeArgs) error {
 		//
 		// See Documentation/trace/uprobetracer.txt for more details.
 		token = uprobeToken(args)
-		pe = fmt.Sprintf("%s:%s/%s %s", probePrefix(args.ret), args.group, args.symbol, token)
+		pe = fmt.Sprintf("%s:%s/%s %s", probePrefix(args.ret, 0), args.group, args.symbol, token)
 	}
 	_, err = f.WriteString(pe)
 	// Since commit 97c753e62e6c, ENOENT is correctly returned instead of EINVAL
@@ -451,17 +654,17 @@ func createTraceFSProbeEvent(typ probeType, args probeArgs) error {
 	// EINVAL is also returned on pre-5.2 kernels when the `SYM[+offs]` token
 	// is resolved to an invalid insn boundary.
 	if errors.Is(err, os.ErrNotExist) || errors.Is(err, unix.EINVAL) {
-		return fmt.Errorf("token %s: %w", token, os.ErrNotExist)
+		return fmt.Errorf("token %s: %w", token, errSymbolNotFound)
 	}
 	// Since commit ab105a4fb894, -EILSEQ is returned when a kprobe sym+offset is resolved
 	// to an invalid insn boundary.
 	if errors.Is(err, syscall.EILSEQ) {
-		return fmt.Errorf("token %s: bad insn boundary: %w", token, os.ErrNotExist)
+		return fmt.Errorf("token %s: bad insn boundary: %w", token, errSymbolNotFound)
 	}
 	// ERANGE is returned when the `SYM[+offs]` token is too big and cannot
 	// be resolved.
 	if errors.Is(err, syscall.ERANGE) {
-		return fmt.Errorf("token %s: offset too big: %w", token, os.ErrNotExist)
+		return fmt.Errorf("token %s: offset too big: %w", token, errSymbolNotFound)
 	}
 	if err != nil {
 		return fmt.Errorf("writing '%s' to '%s': %w", pe, typ.EventsPath(), err)
@@ -479,16 +682,112 @@ func closeTraceFSProbeEvent(typ probeType, group, symbol string) error {
 	}
 	defer f.Close()
 
+	return removeTraceFSProbeEvent(f, typ, group, sanitizeSymbol(symbol))
+}
+
+func removeTraceFSProbeEvent(f *os.File, typ probeType, group, event string) error {
 	// See [k,u]probe_events syntax above. The probe type does not need to be specified
 	// for removals.
-	pe := fmt.Sprintf("-:%s/%s", group, sanitizeSymbol(symbol))
-	if _, err = f.WriteString(pe); err != nil {
+	pe := fmt.Sprintf("-:%s/%s", group, event)
+	if _, err := f.WriteString(pe); err != nil {
 		return fmt.Errorf("writing '%s' to '%s': %w", pe, typ.EventsPath(), err)
 	}
 
 	return nil
 }
 
+// CleanupTracefs removes all kprobe and uprobe trace events whose group starts
+// with prefix from <tracefs>/[k,u]probe_events.
+//
+// Trace events are only created when attaching via the legacy tracefs API, and
+// are normally removed when the Link is closed. They outlive the process if it
+// exits without closing its links, for example due to a crash. Use
+// TracefsGroupPrefix to remove events created by this library. Probes attached
+// via the perf_[k,u]probe PMU are released by the kernel and aren't affected.
+//
+// Events which are still in use by another process can't be removed. All
+// other matching events are removed, and the first error is returned.
+func CleanupTracefs(prefix string) error {
+	if prefix == "" || !isValidTraceID(prefix) {
+		return fmt.Errorf("prefix '%s' must be non-empty, alphanumeric or underscore: %w", prefix, errInvalidInput)
+	}
+
+	var firstErr error
+	for _, typ := range []probeType{kprobeType, uprobeType} {
+		if err := cleanupTraceFSProbeEvents(typ, prefix); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
+
+func cleanupTraceFSProbeEvents(typ probeType, prefix string) error {
+	f, err := os.OpenFile(typ.EventsPath(), os.O_RDWR|os.O_APPEND, 0666)
+	if errors.Is(err, os.ErrNotExist) {
+		// tracefs isn't mounted, or the kernel doesn't support this probe type.
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("error opening %s: %w", typ.EventsPath(), err)
+	}
+	defer f.Close()
+
+	events, err := parseTraceFSProbeEvents(f)
+	if err != nil {
+		return fmt.Errorf("reading %s: %w", typ.EventsPath(), err)
+	}
+
+	var firstErr error
+	for _, ev := range events {
+		if !strings.HasPrefix(ev.group, prefix) {
+			continue
+		}
+
+		if err := removeTraceFSProbeEvent(f, typ, ev.group, ev.event); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+
+	return firstErr
+}
+
+type traceFSProbeEvent struct {
+	group, event string
+}
+
+// parseTraceFSProbeEvents parses the contents of <tracefs>/[k,u]probe_events.
+//
+// Each line has the following format:
+//
+//	p:ebpf_5678/p_my_kprobe __x64_sys_execve
+//	r:ebpf_1234/readline /bin/bash:0x0000000000012345
+func parseTraceFSProbeEvents(r io.Reader) ([]traceFSProbeEvent, error) {
+	var events []traceFSProbeEvent
+
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 0 {
+			continue
+		}
+
+		i := strings.IndexByte(fields[0], ':')
+		if i == -1 {
+			return nil, fmt.Errorf("invalid trace event %q", scanner.Text())
+		}
+
+		parts := strings.SplitN(fields[0][i+1:], "/", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid trace event %q", scanner.Text())
+		}
+
+		events = append(events, traceFSProbeEvent{parts[0], parts[1]})
+	}
+
+	return events, scanner.Err()
+}
+
 // randomGroup generates a pseudorandom string for use as a tracefs group name.
 // Returns an error when the output string would exceed 63 characters (kernel
 // limitation), when rand.Read() fails or when prefix contains characters not
@@ -511,8 +810,11 @@ func randomGroup(prefix string) (string, error) {
 	return group, nil
 }
 
-func probePrefix(ret bool) string {
+func probePrefix(ret bool, maxActive int) string {
 	if ret {
+		if maxActive > 0 {
+			return fmt.Sprintf("r%d", maxActive)
+		}
 		return "r"
 	}
 	return "p"
@@ -0,0 +1,264 @@
+package link
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/internal"
+)
+
+var (
+	sysModulePath = "/sys/module"
+	// moduleWatchInterval is how often a module aware kprobe checks whether
+	// its module was reloaded. Replaced in tests.
+	moduleWatchInterval = time.Second
+)
+
+// kallsymsModule returns the kernel module which contains symbol according
+// to r, which has the format of /proc/kallsyms. Returns an empty string if the
+// symbol is part of vmlinux.
+//
+// Returns an error wrapping os.ErrNotExist if the symbol isn't listed.
+func kallsymsModule(r io.Reader, symbol string) (string, error) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		// Lines have the form "address type name [module]".
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 3 || fields[2] != symbol {
+			continue
+		}
+
+		if len(fields) < 4 {
+			return "", nil
+		}
+		return strings.Trim(fields[3], "[]"), nil
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+
+	return "", fmt.Errorf("symbol %s: %w", symbol, errSymbolNotFound)
+}
+
+// moduleAwareKprobe attaches a kprobe to a symbol in a kernel module, and
+// attaches it again whenever the module is reloaded.
+type moduleAwareKprobe struct {
+	module     string
+	attach     func() (Link, error)
+	onReattach func(error)
+
+	mu      sync.Mutex
+	current Link
+	// The state of the module directory in sysfs when current was attached.
+	loaded  os.FileInfo
+	closed  bool
+	created time.Time
+
+	stopOnce sync.Once
+	stop     chan struct{}
+	done     chan struct{}
+}
+
+var _ Link = (*moduleAwareKprobe)(nil)
+
+// newModuleAwareKprobe attaches a kprobe with all options except ModuleAware.
+//
+// prog is cloned, since it must remain valid for reattaching.
+func newModuleAwareKprobe(symbol string, prog *ebpf.Program, opts *KprobeOptions, ret bool) (Link, error) {
+	f, err := os.Open(kallsymsPath)
+	if err != nil {
+		return nil, fmt.Errorf("module aware kprobe: %w", err)
+	}
+	defer f.Close()
+
+	module, err := kallsymsModule(f, symbol)
+	if err != nil {
+		return nil, fmt.Errorf("module aware kprobe: %w", err)
+	}
+
+	onceOpts := *opts
+	onceOpts.ModuleAware = false
+	if module == "" {
+		// Symbols in vmlinux never go away.
+		if ret {
+			return Kretprobe(symbol, prog, &onceOpts)
+		}
+		return Kprobe(symbol, prog, &onceOpts)
+	}
+
+	clone, err := prog.Clone()
+	if err != nil {
+		return nil, err
+	}
+
+	attach := func() (Link, error) {
+		if ret {
+			return Kretprobe(symbol, clone, &onceOpts)
+		}
+		return Kprobe(symbol, clone, &onceOpts)
+	}
+
+	mk, err := startModuleAwareKprobe(module, attach, opts.OnReattach)
+	if err != nil {
+		clone.Close()
+		return nil, err
+	}
+
+	// Close the clone after the watcher has exited.
+	go func() {
+		<-mk.done
+		clone.Close()
+	}()
+
+	return mk, nil
+}
+
+// startModuleAwareKprobe attaches the kprobe and starts watching module.
+func startModuleAwareKprobe(module string, attach func() (Link, error), onReattach func(error)) (*moduleAwareKprobe, error) {
+	loaded, err := os.Stat(filepath.Join(sysModulePath, module))
+	if err != nil {
+		return nil, fmt.Errorf("module %s: %w", module, err)
+	}
+
+	current, err := attach()
+	if err != nil {
+		return nil, err
+	}
+
+	mk := &moduleAwareKprobe{
+		module:     module,
+		attach:     attach,
+		onReattach: onReattach,
+		current:    current,
+		loaded:     loaded,
+		created:    internal.Now(),
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+
+	go mk.watch()
+	return mk, nil
+}
+
+func (mk *moduleAwareKprobe) watch() {
+	defer close(mk.done)
+
+	ticker := time.NewTicker(moduleWatchInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-mk.stop:
+			return
+		case <-ticker.C:
+			mk.check()
+		}
+	}
+}
+
+// check detaches the kprobe if the module was unloaded, and reattaches it
+// once the module is live again.
+//
+// onReattach is invoked without holding mu, so that it may call methods of
+// mk.
+func (mk *moduleAwareKprobe) check() {
+	attempted, err := mk.reattach()
+	if attempted && mk.onReattach != nil {
+		mk.onReattach(err)
+	}
+}
+
+// reattach returns true if it attempted to attach the kprobe again, and the
+// result of the attempt.
+func (mk *moduleAwareKprobe) reattach() (bool, error) {
+	dir := filepath.Join(sysModulePath, mk.module)
+
+	mk.mu.Lock()
+	defer mk.mu.Unlock()
+
+	if mk.closed {
+		return false, nil
+	}
+
+	loaded, err := os.Stat(dir)
+	if err == nil && mk.loaded != nil && os.SameFile(loaded, mk.loaded) {
+		return false, nil
+	}
+
+	// The module is gone, or was reloaded since attaching.
+	if mk.current != nil {
+		_ = mk.current.Close()
+		mk.current, mk.loaded = nil, nil
+	}
+
+	if err != nil {
+		return false, nil
+	}
+
+	state, err := os.ReadFile(filepath.Join(dir, "initstate"))
+	if err != nil || !bytes.Equal(bytes.TrimSpace(state), []byte("live")) {
+		return false, nil
+	}
+
+	current, err := mk.attach()
+	if err == nil {
+		mk.current, mk.loaded = current, loaded
+	}
+	return true, err
+}
+
+func (mk *moduleAwareKprobe) isLink() {}
+
+// Created returns the time the kprobe was first attached.
+func (mk *moduleAwareKprobe) Created() time.Time {
+	return mk.created
+}
+
+func (mk *moduleAwareKprobe) Update(*ebpf.Program) error {
+	return fmt.Errorf("can't update module aware kprobe: %w", ErrNotSupported)
+}
+
+func (mk *moduleAwareKprobe) Pin(string) error {
+	return fmt.Errorf("can't pin module aware kprobe: %w", ErrNotSupported)
+}
+
+func (mk *moduleAwareKprobe) Unpin() error {
+	return fmt.Errorf("can't unpin module aware kprobe: %w", ErrNotSupported)
+}
+
+// Info returns metadata of the currently attached kprobe.
+func (mk *moduleAwareKprobe) Info() (*Info, error) {
+	mk.mu.Lock()
+	defer mk.mu.Unlock()
+
+	if mk.current == nil {
+		return nil, fmt.Errorf("module %s isn't loaded: %w", mk.module, os.ErrNotExist)
+	}
+	return mk.current.Info()
+}
+
+// Close detaches the kprobe and stops watching the module. It doesn't wait for
+// the watcher to exit, so that it may be called from OnReattach.
+func (mk *moduleAwareKprobe) Close() error {
+	mk.stopOnce.Do(func() { close(mk.stop) })
+
+	mk.mu.Lock()
+	defer mk.mu.Unlock()
+
+	mk.closed = true
+	if mk.current == nil {
+		return nil
+	}
+
+	err := mk.current.Close()
+	mk.current = nil
+	return err
+}
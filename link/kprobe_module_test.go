@@ -0,0 +1,123 @@
+package link
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestKallsymsModule(t *testing.T) {
+	kallsyms := strings.Join([]string{
+		"0000000000000000 T vprintk",
+		"0000000000000000 t nf_conntrack_in\t[nf_conntrack]",
+	}, "\n")
+
+	mod, err := kallsymsModule(strings.NewReader(kallsyms), "vprintk")
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, mod, qt.Equals, "")
+
+	mod, err = kallsymsModule(strings.NewReader(kallsyms), "nf_conntrack_in")
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, mod, qt.Equals, "nf_conntrack")
+
+	_, err = kallsymsModule(strings.NewReader(kallsyms), "bogus")
+	qt.Assert(t, errors.Is(err, os.ErrNotExist), qt.IsTrue)
+}
+
+func TestModuleAwareKprobeReattach(t *testing.T) {
+	oldPath, oldInterval := sysModulePath, moduleWatchInterval
+	sysModulePath, moduleWatchInterval = t.TempDir(), time.Millisecond
+	defer func() { sysModulePath, moduleWatchInterval = oldPath, oldInterval }()
+
+	modDir := filepath.Join(sysModulePath, "fake")
+	load := func() {
+		qt.Assert(t, os.Mkdir(modDir, 0755), qt.IsNil)
+		qt.Assert(t, os.WriteFile(filepath.Join(modDir, "initstate"), []byte("live\n"), 0644), qt.IsNil)
+	}
+
+	var attached int
+	var closed []int
+	attach := func() (Link, error) {
+		attached++
+		return &fakeLink{id: attached, closed: &closed}, nil
+	}
+
+	_, err := startModuleAwareKprobe("fake", attach, nil)
+	qt.Assert(t, errors.Is(err, os.ErrNotExist), qt.IsTrue)
+
+	load()
+	reattached := make(chan error, 1)
+	mk, err := startModuleAwareKprobe("fake", attach, func(err error) { reattached <- err })
+	qt.Assert(t, err, qt.IsNil)
+
+	// Simulate a module reload. Keep the old directory around so that the
+	// new one gets a different inode.
+	qt.Assert(t, os.Rename(modDir, filepath.Join(sysModulePath, "old")), qt.IsNil)
+	load()
+
+	select {
+	case err := <-reattached:
+		qt.Assert(t, err, qt.IsNil)
+	case <-time.After(time.Second):
+		t.Fatal("kprobe wasn't reattached")
+	}
+
+	qt.Assert(t, mk.Close(), qt.IsNil)
+	qt.Assert(t, attached, qt.Equals, 2)
+	qt.Assert(t, closed, qt.DeepEquals, []int{1, 2})
+}
+
+func TestModuleAwareKprobeReattachCallback(t *testing.T) {
+	oldPath, oldInterval := sysModulePath, moduleWatchInterval
+	sysModulePath, moduleWatchInterval = t.TempDir(), time.Millisecond
+	defer func() { sysModulePath, moduleWatchInterval = oldPath, oldInterval }()
+
+	modDir := filepath.Join(sysModulePath, "fake")
+	load := func() {
+		qt.Assert(t, os.Mkdir(modDir, 0755), qt.IsNil)
+		qt.Assert(t, os.WriteFile(filepath.Join(modDir, "initstate"), []byte("live\n"), 0644), qt.IsNil)
+	}
+	load()
+
+	var closed []int
+	attach := func() (Link, error) {
+		return &fakeLink{closed: &closed}, nil
+	}
+
+	// The callback must be able to use the link it belongs to.
+	self := make(chan *moduleAwareKprobe, 1)
+	results := make(chan error, 1)
+	mk, err := startModuleAwareKprobe("fake", attach, func(error) {
+		mk := <-self
+		if _, err := mk.Info(); err != nil {
+			results <- err
+			return
+		}
+		results <- mk.Close()
+	})
+	qt.Assert(t, err, qt.IsNil)
+	self <- mk
+
+	qt.Assert(t, os.Rename(modDir, filepath.Join(sysModulePath, "old")), qt.IsNil)
+	load()
+
+	select {
+	case err := <-results:
+		qt.Assert(t, err, qt.IsNil)
+	case <-time.After(time.Second):
+		t.Fatal("Callback deadlocked or wasn't called")
+	}
+
+	select {
+	case <-mk.done:
+	case <-time.After(time.Second):
+		t.Fatal("Watcher didn't exit after Close")
+	}
+	qt.Assert(t, mk.Close(), qt.IsNil)
+	qt.Assert(t, closed, qt.HasLen, 2)
+}
@@ -0,0 +1,150 @@
+package link
+
+import (
+	"errors"
+	"os"
+	"syscall"
+	"testing"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/asm"
+	"github.com/cilium/ebpf/internal/testutils"
+	"github.com/cilium/ebpf/internal/unix"
+	qt "github.com/frankban/quicktest"
+)
+
+var kprobeMultiSyms = []string{"vprintk", "inet6_release"}
+
+func TestKprobeMulti(t *testing.T) {
+	testutils.SkipIfNotSupported(t, haveBPFLinkKprobeMulti())
+
+	prog := mustLoadProgram(t, ebpf.Kprobe, ebpf.AttachTraceKprobeMulti, "")
+
+	km, err := KprobeMulti(prog, KprobeMultiOptions{Symbols: kprobeMultiSyms})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer km.Close()
+
+	testLink(t, km, prog)
+}
+
+func TestKprobeMultiCookies(t *testing.T) {
+	testutils.SkipIfNotSupported(t, haveBPFLinkKprobeMulti())
+
+	// Records the cookie of each invocation as a key.
+	cookies, err := ebpf.NewMap(&ebpf.MapSpec{
+		Type:       ebpf.Hash,
+		KeySize:    8,
+		ValueSize:  8,
+		MaxEntries: 16,
+	})
+	qt.Assert(t, err, qt.IsNil)
+	defer cookies.Close()
+
+	prog, err := ebpf.NewProgram(&ebpf.ProgramSpec{
+		Type:       ebpf.Kprobe,
+		AttachType: ebpf.AttachTraceKprobeMulti,
+		License:    "MIT",
+		Instructions: asm.Instructions{
+			// u64 key = bpf_get_attach_cookie(ctx)
+			asm.FnGetAttachCookie.Call(),
+			asm.StoreMem(asm.RFP, -8, asm.R0, asm.DWord),
+
+			// u64 val = 1
+			asm.Mov.Imm(asm.R1, 1),
+			asm.StoreMem(asm.RFP, -16, asm.R1, asm.DWord),
+
+			// bpf_map_update_elem(...)
+			asm.LoadMapPtr(asm.R1, cookies.FD()),
+			asm.Mov.Reg(asm.R2, asm.RFP),
+			asm.Add.Imm(asm.R2, -8),
+			asm.Mov.Reg(asm.R3, asm.RFP),
+			asm.Add.Imm(asm.R3, -16),
+			asm.Mov.Imm(asm.R4, 0),
+			asm.FnMapUpdateElem.Call(),
+
+			asm.Mov.Imm(asm.R0, 0),
+			asm.Return(),
+		},
+	})
+	testutils.SkipIfNotSupported(t, err)
+	qt.Assert(t, err, qt.IsNil)
+	defer prog.Close()
+
+	// Closing a socket invokes the release function of its family.
+	families := []int{syscall.AF_INET, syscall.AF_INET6}
+	km, err := KprobeMulti(prog, KprobeMultiOptions{
+		Symbols: []string{"inet_release", "inet6_release"},
+		Cookies: []uint64{1, 2},
+	})
+	if errors.Is(err, os.ErrNotExist) {
+		t.Skip("Socket release functions aren't available:", err)
+	}
+	qt.Assert(t, err, qt.IsNil)
+	defer km.Close()
+
+	for _, family := range families {
+		fd, err := syscall.Socket(family, syscall.SOCK_DGRAM, 0)
+		if errors.Is(err, syscall.EAFNOSUPPORT) {
+			t.Skip("Address family not supported:", family)
+		}
+		qt.Assert(t, err, qt.IsNil)
+		qt.Assert(t, syscall.Close(fd), qt.IsNil)
+	}
+
+	for _, cookie := range []uint64{1, 2} {
+		var val uint64
+		err := cookies.Lookup(cookie, &val)
+		qt.Assert(t, err, qt.IsNil, qt.Commentf("cookie %d wasn't seen", cookie))
+	}
+}
+
+func TestKretprobeMulti(t *testing.T) {
+	testutils.SkipIfNotSupported(t, haveBPFLinkKprobeMulti())
+
+	prog := mustLoadProgram(t, ebpf.Kprobe, ebpf.AttachTraceKprobeMulti, "")
+
+	km, err := KretprobeMulti(prog, KprobeMultiOptions{Symbols: kprobeMultiSyms})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer km.Close()
+
+	testLink(t, km, prog)
+}
+
+func TestKprobeMultiInput(t *testing.T) {
+	// Program type that loads on all kernels. Not expected to link successfully.
+	prog := mustLoadProgram(t, ebpf.SocketFilter, 0, "")
+
+	for _, opts := range []KprobeMultiOptions{
+		// One of Symbols or Addresses is required.
+		{},
+		// Symbols and Addresses are mutually exclusive.
+		{Symbols: []string{"foo"}, Addresses: []uintptr{1}},
+		// One Symbol, two cookies.
+		{Symbols: []string{"one"}, Cookies: []uint64{2, 3}},
+	} {
+		_, err := KprobeMulti(prog, opts)
+		if !errors.Is(err, errInvalidInput) {
+			t.Errorf("Expected errInvalidInput for %+v, got %v", opts, err)
+		}
+	}
+}
+
+func TestKprobeMultiErrors(t *testing.T) {
+	testutils.SkipIfNotSupported(t, haveBPFLinkKprobeMulti())
+
+	prog := mustLoadProgram(t, ebpf.Kprobe, ebpf.AttachTraceKprobeMulti, "")
+
+	// Nonexistent kernel symbol.
+	_, err := KprobeMulti(prog, KprobeMultiOptions{Symbols: []string{"bogus"}})
+	if !errors.Is(err, os.ErrNotExist) && !errors.Is(err, unix.EINVAL) {
+		t.Fatalf("expected ErrNotExist or EINVAL, got: %s", err)
+	}
+}
+
+func TestHaveBPFLinkKprobeMulti(t *testing.T) {
+	testutils.CheckFeatureTest(t, haveBPFLinkKprobeMulti)
+}
@@ -4,9 +4,11 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"strings"
 	"testing"
 
 	qt "github.com/frankban/quicktest"
+	"github.com/google/go-cmp/cmp"
 
 	"github.com/cilium/ebpf"
 	"github.com/cilium/ebpf/asm"
@@ -54,6 +56,17 @@ func TestKprobe(t *testing.T) {
 	testLink(t, k, prog)
 }
 
+func TestKprobeSelfTest(t *testing.T) {
+	prog := mustLoadProgram(t, ebpf.Kprobe, 0, "")
+
+	// Kprobes can't be test run, so SelfTest doesn't affect attaching.
+	k, err := Kprobe(ksym, prog, &KprobeOptions{SelfTest: true})
+	qt.Assert(t, err, qt.IsNil)
+	defer k.Close()
+
+	testLink(t, k, prog)
+}
+
 func TestKretprobe(t *testing.T) {
 	prog := mustLoadProgram(t, ebpf.Kprobe, 0, "")
 
@@ -82,6 +95,57 @@ func TestKretprobe(t *testing.T) {
 	testLink(t, k, prog)
 }
 
+func TestKprobeAny(t *testing.T) {
+	c := qt.New(t)
+
+	prog := mustLoadProgram(t, ebpf.Kprobe, 0, "")
+
+	k, sym, err := KprobeAny([]string{"bogus", ksym}, prog, nil)
+	c.Assert(err, qt.IsNil)
+	defer k.Close()
+	c.Assert(sym, qt.Equals, ksym)
+
+	_, _, err = KprobeAny([]string{"bogus", "bogus2"}, prog, nil)
+	c.Assert(err, qt.ErrorIs, os.ErrNotExist, qt.Commentf("got error: %s", err))
+	c.Assert(err, qt.ErrorIs, errSymbolNotFound, qt.Commentf("got error: %s", err))
+
+	_, _, err = KprobeAny(nil, prog, nil)
+	c.Assert(err, qt.ErrorIs, errInvalidInput, qt.Commentf("got error: %s", err))
+
+	// Invalid input must not be mistaken for a missing symbol.
+	_, _, err = KprobeAny([]string{"bogus", ksym}, nil, nil)
+	c.Assert(err, qt.ErrorIs, errInvalidInput, qt.Commentf("got error: %s", err))
+}
+
+func TestSyscallKprobe(t *testing.T) {
+	c := qt.New(t)
+
+	prog := mustLoadProgram(t, ebpf.Kprobe, 0, "")
+
+	k, err := SyscallKprobe("getpid", prog, nil)
+	c.Assert(err, qt.IsNil)
+	defer k.Close()
+
+	_, err = SyscallKprobe("bogus", prog, nil)
+	c.Assert(err, qt.ErrorIs, os.ErrNotExist, qt.Commentf("got error: %s", err))
+	c.Assert(err, qt.ErrorIs, errSymbolNotFound, qt.Commentf("got error: %s", err))
+
+	_, err = SyscallKprobe("", prog, nil)
+	c.Assert(err, qt.ErrorIs, errInvalidInput, qt.Commentf("got error: %s", err))
+}
+
+func TestFilterKallsyms(t *testing.T) {
+	kallsyms := strings.NewReader(`ffffffff81000000 T _stext
+ffffffff81d340b0 T __sys_recvfrom
+ffffffff81d34190 T __x64_sys_recvfrom
+ffffffffc0a01000 t sys_recvfrom	[bogus_module]
+`)
+
+	symbols, err := filterKallsyms(kallsyms, []string{"__x64_sys_recvfrom", "__ia32_sys_recvfrom", "sys_recvfrom", "__sys_recvfrom"})
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, symbols, qt.DeepEquals, []string{"__x64_sys_recvfrom", "sys_recvfrom", "__sys_recvfrom"})
+}
+
 func TestKprobeErrors(t *testing.T) {
 	c := qt.New(t)
 
@@ -100,6 +164,28 @@ func TestKprobeErrors(t *testing.T) {
 	c.Assert(errors.Is(err, errInvalidInput), qt.IsTrue)
 }
 
+func TestKretprobeMaxActive(t *testing.T) {
+	c := qt.New(t)
+
+	prog := mustLoadProgram(t, ebpf.Kprobe, 0, "")
+
+	_, err := Kprobe(ksym, prog, &KprobeOptions{RetprobeMaxActive: 8})
+	c.Assert(err, qt.ErrorIs, errInvalidInput, qt.Commentf("got error: %s", err))
+
+	for _, maxActive := range []int{-1, kretprobeMaxActiveMax + 1} {
+		_, err := Kretprobe(ksym, prog, &KprobeOptions{RetprobeMaxActive: maxActive})
+		c.Assert(err, qt.ErrorIs, errInvalidInput, qt.Commentf("maxActive %d, got error: %s", maxActive, err))
+	}
+
+	c.Assert(probePrefix(true, 0), qt.Equals, "r")
+	c.Assert(probePrefix(true, 16), qt.Equals, "r16")
+	c.Assert(probePrefix(false, 16), qt.Equals, "p")
+
+	k, err := Kretprobe(ksym, prog, &KprobeOptions{RetprobeMaxActive: 512})
+	c.Assert(err, qt.IsNil)
+	defer k.Close()
+}
+
 // Test k(ret)probe creation using perf_kprobe PMU.
 func TestKprobeCreatePMU(t *testing.T) {
 	// Requires at least 4.17 (e12f03d7031a "perf/core: Implement the 'perf_kprobe' PMU")
@@ -427,3 +513,45 @@ func TestKprobeToken(t *testing.T) {
 		})
 	}
 }
+
+func TestParseTraceFSProbeEvents(t *testing.T) {
+	events, err := parseTraceFSProbeEvents(strings.NewReader(
+		"p:kprobes/p_vprintk_0 vprintk\n" +
+			"r16:ebpf_1234/r_vprintk vprintk\n" +
+			"\n" +
+			"p:ebpf_5678/main /bin/bash:0x0000000000012345\n",
+	))
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, events, qt.CmpEquals(cmp.AllowUnexported(traceFSProbeEvent{})), []traceFSProbeEvent{
+		{"kprobes", "p_vprintk_0"},
+		{"ebpf_1234", "r_vprintk"},
+		{"ebpf_5678", "main"},
+	})
+
+	_, err = parseTraceFSProbeEvents(strings.NewReader("bogus\n"))
+	qt.Assert(t, err, qt.IsNotNil)
+}
+
+func TestCleanupTracefs(t *testing.T) {
+	qt.Assert(t, errors.Is(CleanupTracefs(""), errInvalidInput), qt.IsTrue)
+	qt.Assert(t, errors.Is(CleanupTracefs("ebpf/"), errInvalidInput), qt.IsTrue)
+
+	if _, err := os.Stat(kprobeEventsPath); err != nil {
+		t.Skip("tracefs not available:", err)
+	}
+
+	args := probeArgs{symbol: ksym, pid: perfAllThreads}
+	k, err := tracefsKprobe(args)
+	testutils.SkipIfNotSupported(t, err)
+	qt.Assert(t, err, qt.IsNil)
+	defer k.Close()
+
+	// The event is in use and can't be removed.
+	qt.Assert(t, CleanupTracefs(k.group), qt.IsNotNil)
+
+	qt.Assert(t, k.fd.Close(), qt.IsNil)
+	qt.Assert(t, CleanupTracefs(k.group), qt.IsNil)
+
+	_, err = getTraceEventID(k.group, sanitizeSymbol(ksym))
+	qt.Assert(t, errors.Is(err, os.ErrNotExist), qt.IsTrue)
+}
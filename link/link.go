@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/binary"
 	"fmt"
+	"time"
 
 	"github.com/cilium/ebpf"
 	"github.com/cilium/ebpf/btf"
@@ -42,6 +43,13 @@ type Link interface {
 	// May return an error wrapping ErrNotSupported.
 	Info() (*Info, error)
 
+	// Created returns the time at which the link was created or loaded from
+	// a pin by this process.
+	//
+	// The kernel doesn't record when a link was created, so this is a user
+	// space timestamp.
+	Created() time.Time
+
 	// Prevent external users from implementing this interface.
 	isLink()
 }
@@ -77,6 +85,10 @@ func wrapRawLink(raw *RawLink) (Link, error) {
 		return &Iter{*raw}, nil
 	case NetNsType:
 		return &NetNsLink{*raw}, nil
+	case KprobeMultiType:
+		return &kprobeMultiLink{*raw}, nil
+	case TCXType:
+		return &tcxLink{*raw}, nil
 	default:
 		return raw, nil
 	}
@@ -111,6 +123,7 @@ type TracingInfo sys.TracingLinkInfo
 type CgroupInfo sys.CgroupLinkInfo
 type NetNsInfo sys.NetNsLinkInfo
 type XDPInfo sys.XDPLinkInfo
+type TCXInfo sys.TcxLinkInfo
 
 // Tracing returns tracing type-specific link info.
 //
@@ -144,6 +157,14 @@ func (r Info) XDP() *XDPInfo {
 	return e
 }
 
+// TCX returns tcx type-specific link info.
+//
+// Returns nil if the type-specific link info isn't available.
+func (r Info) TCX() *TCXInfo {
+	e, _ := r.extra.(*TCXInfo)
+	return e
+}
+
 // RawLink is the low-level API to bpf_link.
 //
 // You should consider using the higher level interfaces in this
@@ -151,10 +172,13 @@ func (r Info) XDP() *XDPInfo {
 type RawLink struct {
 	fd         *sys.FD
 	pinnedPath string
+	created    time.Time
 }
 
 // AttachRawLink creates a raw link.
-func AttachRawLink(opts RawLinkOptions) (*RawLink, error) {
+func AttachRawLink(opts RawLinkOptions) (_ *RawLink, err error) {
+	defer internal.AddStackTrace(&err)
+
 	if err := haveBPFLink(); err != nil {
 		return nil, err
 	}
@@ -180,7 +204,7 @@ func AttachRawLink(opts RawLinkOptions) (*RawLink, error) {
 		return nil, fmt.Errorf("can't create link: %s", err)
 	}
 
-	return &RawLink{fd, ""}, nil
+	return &RawLink{fd, "", internal.Now()}, nil
 }
 
 func loadPinnedRawLink(fileName string, opts *ebpf.LoadPinOptions) (*RawLink, error) {
@@ -192,11 +216,16 @@ func loadPinnedRawLink(fileName string, opts *ebpf.LoadPinOptions) (*RawLink, er
 		return nil, fmt.Errorf("load pinned link: %w", err)
 	}
 
-	return &RawLink{fd, fileName}, nil
+	return &RawLink{fd, fileName, internal.Now()}, nil
 }
 
 func (l *RawLink) isLink() {}
 
+// Created implements the Link interface.
+func (l *RawLink) Created() time.Time {
+	return l.created
+}
+
 // FD returns the raw file descriptor.
 func (l *RawLink) FD() int {
 	return l.fd.Int()
@@ -292,6 +321,8 @@ func (l *RawLink) Info() (*Info, error) {
 		extra = &XDPInfo{}
 	case PerfEventType:
 		// no extra
+	case TCXType:
+		extra = &TCXInfo{}
 	default:
 		return nil, fmt.Errorf("unknown link info type: %d", info.Type)
 	}
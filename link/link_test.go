@@ -7,6 +7,7 @@ import (
 	"path/filepath"
 	"reflect"
 	"testing"
+	"time"
 
 	"github.com/cilium/ebpf"
 	"github.com/cilium/ebpf/asm"
@@ -47,6 +48,10 @@ func TestRawLink(t *testing.T) {
 		t.Error("Link program ID doesn't match program ID")
 	}
 
+	if created := link.Created(); created.IsZero() || created.After(time.Now()) {
+		t.Error("Invalid link creation time:", created)
+	}
+
 	testLink(t, &linkCgroup{*link}, prog)
 }
 
@@ -91,6 +96,10 @@ func mustCgroupFixtures(t *testing.T) (*os.File, *ebpf.Program) {
 func testLink(t *testing.T, link Link, prog *ebpf.Program) {
 	t.Helper()
 
+	if link.Created().IsZero() {
+		t.Errorf("%T.Created returns the zero time", link)
+	}
+
 	tmp, err := os.MkdirTemp("/sys/fs/bpf", "ebpf-test")
 	if err != nil {
 		t.Fatal(err)
@@ -210,3 +219,20 @@ func mustLoadProgram(tb testing.TB, typ ebpf.ProgramType, attachType ebpf.Attach
 
 	return prog
 }
+
+// fakeLink is a Link which appends its id to closed when it is closed, so
+// that tests can check which links were closed and in which order.
+type fakeLink struct {
+	RawLink
+	id     int
+	closed *[]int
+}
+
+func (fl *fakeLink) Close() error {
+	*fl.closed = append(*fl.closed, fl.id)
+	return nil
+}
+
+func (fl *fakeLink) Info() (*Info, error) {
+	return &Info{Type: PerfEventType}, nil
+}
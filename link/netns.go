@@ -2,8 +2,12 @@ package link
 
 import (
 	"fmt"
+	"os"
+	"runtime"
 
 	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/internal"
+	"github.com/cilium/ebpf/internal/unix"
 )
 
 // NetNsLink is a program attached to a network namespace.
@@ -12,7 +16,12 @@ type NetNsLink struct {
 }
 
 // AttachNetNs attaches a program to a network namespace.
-func AttachNetNs(ns int, prog *ebpf.Program) (*NetNsLink, error) {
+//
+// ns is a file descriptor of the namespace, for example obtained by opening
+// /proc/<pid>/ns/net of a process in a container.
+func AttachNetNs(ns int, prog *ebpf.Program) (_ *NetNsLink, err error) {
+	defer internal.AddStackTrace(&err)
+
 	var attach ebpf.AttachType
 	switch t := prog.Type(); t {
 	case ebpf.FlowDissector:
@@ -34,3 +43,80 @@ func AttachNetNs(ns int, prog *ebpf.Program) (*NetNsLink, error) {
 
 	return &NetNsLink{*link}, nil
 }
+
+// openNetNS returns ns, or opens the network namespace of the calling process
+// if ns is zero. The returned function releases the namespace and must be
+// called once the fd is no longer needed.
+func openNetNS(ns int) (int, func(), error) {
+	if ns != 0 {
+		return ns, func() {}, nil
+	}
+
+	f, err := os.Open("/proc/self/ns/net")
+	if err != nil {
+		return 0, nil, fmt.Errorf("open network namespace: %w", err)
+	}
+
+	return int(f.Fd()), func() { f.Close() }, nil
+}
+
+// inNetNS invokes fn with the calling thread in the network namespace given
+// by the fd ns, and moves the thread back into its original namespace
+// afterwards. fn is invoked in the current namespace if ns is zero.
+//
+// fn runs on a separate goroutine locked to its thread. If the original
+// namespace can't be restored the thread stays locked, so that the runtime
+// destroys it instead of reusing it in the wrong namespace. A panic in fn is
+// propagated to the caller once the namespace has been restored.
+func inNetNS(ns int, fn func() error) error {
+	if ns == 0 {
+		return fn()
+	}
+
+	type result struct {
+		err      error
+		panicked interface{}
+	}
+
+	results := make(chan result, 1)
+	go func() {
+		var res result
+		defer func() { results <- res }()
+
+		runtime.LockOSThread()
+
+		orig, err := os.Open(fmt.Sprintf("/proc/self/task/%d/ns/net", unix.Gettid()))
+		if err != nil {
+			runtime.UnlockOSThread()
+			res.err = fmt.Errorf("open current network namespace: %w", err)
+			return
+		}
+		defer orig.Close()
+
+		if err := unix.Setns(ns, unix.CLONE_NEWNET); err != nil {
+			runtime.UnlockOSThread()
+			res.err = fmt.Errorf("enter network namespace: %w", err)
+			return
+		}
+
+		defer func() {
+			if err := unix.Setns(int(orig.Fd()), unix.CLONE_NEWNET); err != nil {
+				res.err = fmt.Errorf("restore network namespace: %w", err)
+				return
+			}
+			runtime.UnlockOSThread()
+		}()
+
+		defer func() {
+			res.panicked = recover()
+		}()
+
+		res.err = fn()
+	}()
+
+	res := <-results
+	if res.panicked != nil {
+		panic(res.panicked)
+	}
+	return res.err
+}
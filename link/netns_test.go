@@ -1,11 +1,14 @@
 package link
 
 import (
+	"errors"
 	"os"
+	"runtime"
 	"testing"
 
 	"github.com/cilium/ebpf"
 	"github.com/cilium/ebpf/asm"
+	"github.com/cilium/ebpf/internal"
 	"github.com/cilium/ebpf/internal/testutils"
 )
 
@@ -28,6 +31,113 @@ func TestSkLookup(t *testing.T) {
 	testLink(t, link, prog)
 }
 
+func TestAttachSkLookup(t *testing.T) {
+	testutils.SkipIfNotSupported(t, haveSkLookup())
+
+	prog := mustLoadProgram(t, ebpf.SkLookup, ebpf.AttachSkLookup, "")
+
+	// Multiple programs can be attached to the same namespace.
+	first, err := AttachSkLookup(SkLookupOptions{Program: prog})
+	if err != nil {
+		t.Fatal("Can't attach link:", err)
+	}
+	defer first.Close()
+
+	link, err := AttachSkLookup(SkLookupOptions{Program: prog})
+	if err != nil {
+		t.Fatal("Can't attach second link:", err)
+	}
+
+	testLink(t, link, prog)
+
+	_, err = AttachSkLookup(SkLookupOptions{Program: mustLoadProgram(t, ebpf.SocketFilter, 0, "")})
+	if !errors.Is(err, errInvalidInput) {
+		t.Fatal("Expected errInvalidInput for a socket filter, got", err)
+	}
+}
+
+func TestAttachFlowDissector(t *testing.T) {
+	testutils.SkipOnOldKernel(t, "5.7", "flow dissector bpf_link")
+
+	prog := mustLoadProgram(t, ebpf.FlowDissector, ebpf.AttachFlowDissector, "")
+
+	netns, err := os.Open("/proc/self/ns/net")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer netns.Close()
+
+	link, err := AttachFlowDissector(FlowDissectorOptions{NetNS: int(netns.Fd()), Program: prog})
+	if err != nil {
+		t.Fatal("Can't attach flow dissector:", err)
+	}
+
+	_, err = AttachFlowDissector(FlowDissectorOptions{Program: prog})
+	if !errors.Is(err, ErrFlowDissectorExists) {
+		t.Error("Attaching a second flow dissector doesn't return ErrFlowDissectorExists:", err)
+	}
+
+	testLink(t, link, prog)
+
+	_, err = AttachFlowDissector(FlowDissectorOptions{Program: mustLoadProgram(t, ebpf.SocketFilter, 0, "")})
+	if !errors.Is(err, errInvalidInput) {
+		t.Error("Attaching a socket filter doesn't return an error:", err)
+	}
+}
+
+func TestProgAttachFlowDissector(t *testing.T) {
+	testutils.SkipOnOldKernel(t, "4.20", "flow dissector")
+
+	prog := mustLoadProgram(t, ebpf.FlowDissector, ebpf.AttachFlowDissector, "")
+
+	netns, err := os.Open("/proc/self/ns/net")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer netns.Close()
+
+	link, err := newProgAttachFlowDissector(int(netns.Fd()), prog)
+	if err != nil {
+		t.Fatal("Can't attach flow dissector:", err)
+	}
+
+	// Existing programs can only be detected on kernels which can query
+	// flow dissectors.
+	if !testutils.MustKernelVersion().Less(internal.Version{5, 0, 0}) {
+		_, err = newProgAttachFlowDissector(int(netns.Fd()), prog)
+		if !errors.Is(err, ErrFlowDissectorExists) {
+			t.Error("Attaching a second flow dissector doesn't return ErrFlowDissectorExists:", err)
+		}
+	}
+
+	testLink(t, link, prog)
+}
+
+func TestInNetNSPanic(t *testing.T) {
+	netns := mustNewNetNS(t)
+
+	var inside string
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("Panic in fn isn't propagated")
+			}
+		}()
+
+		_ = inNetNS(int(netns.Fd()), func() error {
+			inside = currentNetNS(t)
+			panic("fn")
+		})
+	}()
+
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	if inside == currentNetNS(t) {
+		t.Fatal("fn didn't run in the target network namespace")
+	}
+}
+
 func createSkLookupProgram() (*ebpf.Program, error) {
 	prog, err := ebpf.NewProgram(&ebpf.ProgramSpec{
 		Type:       ebpf.SkLookup,
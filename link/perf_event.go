@@ -9,6 +9,7 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
+	"time"
 	"unsafe"
 
 	"github.com/cilium/ebpf"
@@ -108,10 +109,72 @@ func (pe *perfEvent) Close() error {
 	return nil
 }
 
+// PerfEvent is a Link backed by a perf event, as returned by Kprobe,
+// Kretprobe, Uprobe, Uretprobe and Tracepoint.
+type PerfEvent interface {
+	Link
+
+	// PerfEvent returns a duplicate of the file descriptor of the perf
+	// event, for example to issue PERF_EVENT_IOC_* ioctls. The caller must
+	// close the file.
+	PerfEvent() (*os.File, error)
+}
+
+// EnablePerfEvent resumes a perf event based Link paused by
+// DisablePerfEvent. Does nothing if the Link isn't paused.
+//
+// Returns an error wrapping ErrNotSupported if l can't be paused.
+func EnablePerfEvent(l Link) error {
+	pl, ok := l.(pausableLink)
+	if !ok {
+		return fmt.Errorf("%T is not a perf event: %w", l, ErrNotSupported)
+	}
+
+	return pl.resume()
+}
+
+// DisablePerfEvent pauses a perf event based Link without closing the perf
+// event. The program doesn't execute until the Link is resumed via
+// EnablePerfEvent. Does nothing if the Link is already paused.
+//
+// The kernel executes programs attached to a perf event even if the event is
+// disabled via PERF_EVENT_IOC_DISABLE, so the program is detached from the
+// event instead. This requires a bpf_link (Linux 5.15) and the privileges to
+// obtain the program by its ID. Info is not available while the Link is
+// paused.
+//
+// Returns an error wrapping ErrNotSupported if l can't be paused.
+func DisablePerfEvent(l Link) error {
+	pl, ok := l.(pausableLink)
+	if !ok {
+		return fmt.Errorf("%T is not a perf event: %w", l, ErrNotSupported)
+	}
+
+	return pl.pause()
+}
+
+// pausableLink is a Link which can temporarily detach its program.
+type pausableLink interface {
+	pause() error
+	resume() error
+}
+
+func (pe *perfEvent) file() (*os.File, error) {
+	fd, err := pe.fd.Dup()
+	if err != nil {
+		return nil, err
+	}
+
+	return fd.File("perf-event"), nil
+}
+
 // perfEventLink represents a bpf perf link.
 type perfEventLink struct {
 	RawLink
-	pe *perfEvent
+	pe    *perfEvent
+	stack sys.LeakStack
+	// The program detached by pause, or nil.
+	paused *ebpf.Program
 }
 
 func (pl *perfEventLink) isLink() {}
@@ -136,6 +199,11 @@ func (pl *perfEventLink) Unpin() error {
 }
 
 func (pl *perfEventLink) Close() error {
+	runtime.SetFinalizer(pl, nil)
+	if pl.paused != nil {
+		pl.paused.Close()
+		pl.paused = nil
+	}
 	if err := pl.pe.Close(); err != nil {
 		return fmt.Errorf("perf event link close: %w", err)
 	}
@@ -146,14 +214,90 @@ func (pl *perfEventLink) Update(prog *ebpf.Program) error {
 	return fmt.Errorf("perf event link update: %w", ErrNotSupported)
 }
 
+func (pl *perfEventLink) PerfEvent() (*os.File, error) {
+	return pl.pe.file()
+}
+
+func (pl *perfEventLink) pause() error {
+	if pl.paused != nil {
+		return nil
+	}
+
+	// Keep the program alive, the link may hold the only reference to it.
+	info, err := pl.Info()
+	if err != nil {
+		return fmt.Errorf("pause perf event: %w", err)
+	}
+
+	prog, err := ebpf.NewProgramFromID(info.Program)
+	if err != nil {
+		return fmt.Errorf("pause perf event: %w", err)
+	}
+
+	if err := pl.fd.Close(); err != nil {
+		prog.Close()
+		return fmt.Errorf("pause perf event: %w", err)
+	}
+
+	pl.paused = prog
+	return nil
+}
+
+func (pl *perfEventLink) resume() error {
+	if pl.paused == nil {
+		return nil
+	}
+
+	fd, err := sys.LinkCreatePerfEvent(&sys.LinkCreatePerfEventAttr{
+		ProgFd:     uint32(pl.paused.FD()),
+		TargetFd:   pl.pe.fd.Uint(),
+		AttachType: sys.BPF_PERF_EVENT,
+		BpfCookie:  pl.pe.cookie,
+	})
+	if err != nil {
+		return fmt.Errorf("resume perf event: %w", err)
+	}
+	fd.SuppressLeakWarning()
+
+	pl.fd = fd
+	pl.paused.Close()
+	pl.paused = nil
+	return nil
+}
+
 // perfEventIoctl implements Link and handles the perf event lifecycle
 // via ioctl().
 type perfEventIoctl struct {
 	*perfEvent
+	stack   sys.LeakStack
+	created time.Time
 }
 
 func (pi *perfEventIoctl) isLink() {}
 
+func (pi *perfEventIoctl) Created() time.Time {
+	return pi.created
+}
+
+func (pi *perfEventIoctl) Close() error {
+	runtime.SetFinalizer(pi, nil)
+	return pi.perfEvent.Close()
+}
+
+func (pi *perfEventIoctl) PerfEvent() (*os.File, error) {
+	return pi.perfEvent.file()
+}
+
+// Programs attached via PERF_EVENT_IOC_SET_BPF can't be detached without
+// closing the perf event, see Update.
+func (pi *perfEventIoctl) pause() error {
+	return fmt.Errorf("pause perf event ioctl: %w", ErrNotSupported)
+}
+
+func (pi *perfEventIoctl) resume() error {
+	return fmt.Errorf("resume perf event ioctl: %w", ErrNotSupported)
+}
+
 // Since 4.15 (e87c6bc3852b "bpf: permit multiple bpf attachments for a single perf event"),
 // calling PERF_EVENT_IOC_SET_BPF appends the given program to a prog_array
 // owned by the perf event, which means multiple programs can be attached
@@ -226,10 +370,16 @@ func attachPerfEventIoctl(pe *perfEvent, prog *ebpf.Program) (*perfEventIoctl, e
 		return nil, fmt.Errorf("enable perf event: %s", err)
 	}
 
-	pi := &perfEventIoctl{pe}
+	pi := &perfEventIoctl{pe, sys.NewLeakStack(), internal.Now()}
+
+	// The link warns about being leaked, not the fds it owns.
+	pe.fd.SuppressLeakWarning()
 
 	// Close the perf event when its reference is lost to avoid leaking system resources.
-	runtime.SetFinalizer(pi, (*perfEventIoctl).Close)
+	runtime.SetFinalizer(pi, func(pi *perfEventIoctl) {
+		pi.stack.Warn("perf event link")
+		_ = pi.Close()
+	})
 	return pi, nil
 }
 
@@ -247,10 +397,17 @@ func attachPerfEventLink(pe *perfEvent, prog *ebpf.Program) (*perfEventLink, err
 		return nil, fmt.Errorf("cannot create bpf perf link: %v", err)
 	}
 
-	pl := &perfEventLink{RawLink{fd: fd}, pe}
+	pl := &perfEventLink{RawLink{fd: fd, created: internal.Now()}, pe, sys.NewLeakStack(), nil}
+
+	// The link warns about being leaked, not the fds it owns.
+	pe.fd.SuppressLeakWarning()
+	fd.SuppressLeakWarning()
 
 	// Close the perf event when its reference is lost to avoid leaking system resources.
-	runtime.SetFinalizer(pl, (*perfEventLink).Close)
+	runtime.SetFinalizer(pl, func(pl *perfEventLink) {
+		pl.stack.Warn("perf event link")
+		_ = pl.Close()
+	})
 	return pl, nil
 }
 
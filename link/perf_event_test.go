@@ -3,8 +3,10 @@ package link
 import (
 	"errors"
 	"os"
+	"os/exec"
 	"testing"
 
+	"github.com/cilium/ebpf"
 	"github.com/cilium/ebpf/internal/testutils"
 	qt "github.com/frankban/quicktest"
 )
@@ -77,3 +79,54 @@ func TestTraceValidID(t *testing.T) {
 func TestHaveBPFLinkPerfEvent(t *testing.T) {
 	testutils.CheckFeatureTest(t, haveBPFLinkPerfEvent)
 }
+
+func TestPerfEventDisable(t *testing.T) {
+	m, prog := newUpdaterMapProg(t, ebpf.Kprobe)
+
+	up, err := bashEx.Uprobe(bashSym, prog, nil)
+	testutils.SkipIfNotSupported(t, err)
+	qt.Assert(t, err, qt.IsNil)
+
+	pe, ok := up.(PerfEvent)
+	qt.Assert(t, ok, qt.IsTrue, qt.Commentf("%T is not a PerfEvent", up))
+
+	f, err := pe.PerfEvent()
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, f.Close(), qt.IsNil)
+
+	trigger := func() {
+		t.Helper()
+		qt.Assert(t, exec.Command("/bin/bash", "--help").Run(), qt.IsNil)
+	}
+
+	// The program doesn't run while the event is disabled.
+	err = DisablePerfEvent(up)
+	testutils.SkipIfNotSupported(t, err)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, DisablePerfEvent(up), qt.IsNil)
+	trigger()
+	assertMapValue(t, m, 0, 0)
+
+	qt.Assert(t, EnablePerfEvent(up), qt.IsNil)
+	qt.Assert(t, EnablePerfEvent(up), qt.IsNil)
+	trigger()
+	assertMapValue(t, m, 0, 1)
+
+	// Closing a paused link releases the program.
+	qt.Assert(t, DisablePerfEvent(up), qt.IsNil)
+	qt.Assert(t, up.Close(), qt.IsNil)
+}
+
+func TestPerfEventDisableNotSupported(t *testing.T) {
+	testutils.SkipOnOldKernel(t, "5.9", "BPF_LINK_TYPE_XDP")
+
+	l, err := AttachXDP(XDPOptions{
+		Program:   mustLoadProgram(t, ebpf.XDP, 0, ""),
+		Interface: IfIndexLO,
+	})
+	qt.Assert(t, err, qt.IsNil)
+	defer l.Close()
+
+	qt.Assert(t, DisablePerfEvent(l), qt.ErrorIs, ErrNotSupported)
+	qt.Assert(t, EnablePerfEvent(l), qt.ErrorIs, ErrNotSupported)
+}
@@ -4,6 +4,7 @@ import (
 	"fmt"
 
 	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/internal"
 	"github.com/cilium/ebpf/internal/sys"
 )
 
@@ -24,7 +25,9 @@ type RawAttachProgramOptions struct {
 //
 // You should use one of the higher level abstractions available in this
 // package if possible.
-func RawAttachProgram(opts RawAttachProgramOptions) error {
+func RawAttachProgram(opts RawAttachProgramOptions) (err error) {
+	defer internal.AddStackTrace(&err)
+
 	if err := haveProgAttach(); err != nil {
 		return err
 	}
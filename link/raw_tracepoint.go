@@ -3,9 +3,12 @@ package link
 import (
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/internal"
 	"github.com/cilium/ebpf/internal/sys"
+	"github.com/cilium/ebpf/internal/unix"
 )
 
 type RawTracepointOptions struct {
@@ -13,12 +16,19 @@ type RawTracepointOptions struct {
 	Name string
 	// Program must be of type RawTracepoint*
 	Program *ebpf.Program
+	// Arbitrary value that can be fetched from an eBPF program
+	// via `bpf_get_attach_cookie()`.
+	//
+	// Needs kernel 6.10+.
+	Cookie uint64
 }
 
 // AttachRawTracepoint links a BPF program to a raw_tracepoint.
 //
 // Requires at least Linux 4.17.
-func AttachRawTracepoint(opts RawTracepointOptions) (Link, error) {
+func AttachRawTracepoint(opts RawTracepointOptions) (_ Link, err error) {
+	defer internal.AddStackTrace(&err)
+
 	if t := opts.Program.Type(); t != ebpf.RawTracepoint && t != ebpf.RawTracepointWritable {
 		return nil, fmt.Errorf("invalid program type %s, expected RawTracepoint(Writable)", t)
 	}
@@ -26,10 +36,23 @@ func AttachRawTracepoint(opts RawTracepointOptions) (Link, error) {
 		return nil, fmt.Errorf("invalid program: %w", sys.ErrClosedFd)
 	}
 
-	fd, err := sys.RawTracepointOpen(&sys.RawTracepointOpenAttr{
-		Name:   sys.NewStringPointer(opts.Name),
-		ProgFd: uint32(opts.Program.FD()),
-	})
+	var fd *sys.FD
+	if opts.Cookie == 0 {
+		fd, err = sys.RawTracepointOpen(&sys.RawTracepointOpenAttr{
+			Name:   sys.NewStringPointer(opts.Name),
+			ProgFd: uint32(opts.Program.FD()),
+		})
+	} else {
+		fd, err = sys.RawTracepointOpenCookie(&sys.RawTracepointOpenCookieAttr{
+			Name:   sys.NewStringPointer(opts.Name),
+			ProgFd: uint32(opts.Program.FD()),
+			Cookie: opts.Cookie,
+		})
+		// Kernels without support for cookies reject the larger attribute.
+		if errors.Is(err, unix.E2BIG) {
+			return nil, fmt.Errorf("raw_tracepoint cookies: %w", ErrNotSupported)
+		}
+	}
 	if err != nil {
 		return nil, err
 	}
@@ -38,24 +61,29 @@ func AttachRawTracepoint(opts RawTracepointOptions) (Link, error) {
 	if errors.Is(err, ErrNotSupported) {
 		// Prior to commit 70ed506c3bbc ("bpf: Introduce pinnable bpf_link abstraction")
 		// raw_tracepoints are just a plain fd.
-		return &simpleRawTracepoint{fd}, nil
+		return &simpleRawTracepoint{fd, internal.Now()}, nil
 	}
 
 	if err != nil {
 		return nil, err
 	}
 
-	return &rawTracepoint{RawLink{fd: fd}}, nil
+	return &rawTracepoint{RawLink{fd: fd, created: internal.Now()}}, nil
 }
 
 type simpleRawTracepoint struct {
-	fd *sys.FD
+	fd      *sys.FD
+	created time.Time
 }
 
 var _ Link = (*simpleRawTracepoint)(nil)
 
 func (frt *simpleRawTracepoint) isLink() {}
 
+func (frt *simpleRawTracepoint) Created() time.Time {
+	return frt.created
+}
+
 func (frt *simpleRawTracepoint) Close() error {
 	return frt.fd.Close()
 }
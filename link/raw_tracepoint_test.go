@@ -40,3 +40,23 @@ func TestRawTracepoint_writable(t *testing.T) {
 
 	testLink(t, link, prog)
 }
+
+func TestRawTracepointCookie(t *testing.T) {
+	testutils.SkipOnOldKernel(t, "4.17", "BPF_RAW_TRACEPOINT API")
+
+	prog := mustLoadProgram(t, ebpf.RawTracepoint, 0, "")
+
+	link, err := AttachRawTracepoint(RawTracepointOptions{
+		Name:    "cgroup_mkdir",
+		Program: prog,
+		Cookie:  1,
+	})
+	testutils.SkipIfNotSupported(t, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := link.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
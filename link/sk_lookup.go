@@ -0,0 +1,53 @@
+package link
+
+import (
+	"fmt"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/internal"
+)
+
+// SkLookupOptions control AttachSkLookup.
+type SkLookupOptions struct {
+	// Network namespace to attach to, see FlowDissectorOptions.NetNS.
+	NetNS int
+	// Program must be of type SkLookup. The kernel only allows loading such
+	// programs with AttachSkLookup as the attach type.
+	Program *ebpf.Program
+}
+
+// AttachSkLookup attaches a program to a network namespace, which is then
+// invoked to select a socket for incoming connections and packets.
+//
+// Multiple programs can be attached to the same namespace, and are executed
+// in the order in which they were attached. The program is detached by
+// closing the link.
+//
+// Needs kernel 5.9+.
+func AttachSkLookup(opts SkLookupOptions) (_ *NetNsLink, err error) {
+	defer internal.AddStackTrace(&err)
+
+	if opts.Program == nil {
+		return nil, fmt.Errorf("program cannot be nil: %w", errInvalidInput)
+	}
+	if t := opts.Program.Type(); t != ebpf.SkLookup {
+		return nil, fmt.Errorf("eBPF program type %s is not SkLookup: %w", t, errInvalidInput)
+	}
+
+	if err := haveSkLookup(); err != nil {
+		return nil, err
+	}
+
+	ns, closeNS, err := openNetNS(opts.NetNS)
+	if err != nil {
+		return nil, err
+	}
+	defer closeNS()
+
+	link, err := AttachNetNs(ns, opts.Program)
+	if err != nil {
+		return nil, fmt.Errorf("attach sk_lookup: %w", err)
+	}
+
+	return link, nil
+}
@@ -1,9 +1,13 @@
 package link
 
 import (
+	"fmt"
+	"os"
 	"syscall"
+	"time"
 
 	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/internal"
 	"github.com/cilium/ebpf/internal/unix"
 )
 
@@ -38,3 +42,103 @@ func DetachSocketFilter(conn syscall.Conn) error {
 	}
 	return err
 }
+
+// AttachSocketFilterFD attaches a SocketFilter BPF program to the socket
+// identified by fd. The Link holds a duplicate of fd, so fd may be closed
+// independently. Closing the returned Link detaches the program, it doesn't
+// close fd.
+//
+// Only one program can be attached to a socket at a time. Attaching a
+// program replaces any program previously attached to the socket.
+func AttachSocketFilterFD(fd int, program *ebpf.Program) (Link, error) {
+	if program == nil {
+		return nil, fmt.Errorf("program cannot be nil: %w", errInvalidInput)
+	}
+	if program.Type() != ebpf.SocketFilter {
+		return nil, fmt.Errorf("eBPF program type %s is not SocketFilter: %w", program.Type(), errInvalidInput)
+	}
+
+	// SO_TYPE is available on all sockets, use it to check that fd is one.
+	if _, err := syscall.GetsockoptInt(fd, unix.SOL_SOCKET, syscall.SO_TYPE); err != nil {
+		return nil, fmt.Errorf("fd %d: %w", fd, err)
+	}
+
+	dup, err := unix.FcntlInt(uintptr(fd), unix.F_DUPFD_CLOEXEC, 1)
+	if err != nil {
+		return nil, fmt.Errorf("duplicate socket fd: %w", err)
+	}
+	sock := os.NewFile(uintptr(dup), "socket")
+
+	prog, err := program.Clone()
+	if err != nil {
+		sock.Close()
+		return nil, err
+	}
+
+	if err := syscall.SetsockoptInt(int(sock.Fd()), unix.SOL_SOCKET, unix.SO_ATTACH_BPF, prog.FD()); err != nil {
+		prog.Close()
+		sock.Close()
+		return nil, fmt.Errorf("attach socket filter: %w", err)
+	}
+
+	return &socketFilterLink{sock, prog, internal.Now()}, nil
+}
+
+type socketFilterLink struct {
+	sock    *os.File
+	prog    *ebpf.Program
+	created time.Time
+}
+
+var _ Link = (*socketFilterLink)(nil)
+
+func (sf *socketFilterLink) isLink() {}
+
+func (sf *socketFilterLink) Created() time.Time {
+	return sf.created
+}
+
+func (sf *socketFilterLink) Update(prog *ebpf.Program) error {
+	if prog == nil {
+		return fmt.Errorf("program cannot be nil: %w", errInvalidInput)
+	}
+	if prog.Type() != ebpf.SocketFilter {
+		return fmt.Errorf("eBPF program type %s is not SocketFilter: %w", prog.Type(), errInvalidInput)
+	}
+
+	new, err := prog.Clone()
+	if err != nil {
+		return err
+	}
+
+	if err := syscall.SetsockoptInt(int(sf.sock.Fd()), unix.SOL_SOCKET, unix.SO_ATTACH_BPF, new.FD()); err != nil {
+		new.Close()
+		return fmt.Errorf("can't update socket filter: %w", err)
+	}
+
+	sf.prog.Close()
+	sf.prog = new
+	return nil
+}
+
+func (sf *socketFilterLink) Close() error {
+	defer sf.prog.Close()
+	defer sf.sock.Close()
+
+	if err := syscall.SetsockoptInt(int(sf.sock.Fd()), unix.SOL_SOCKET, unix.SO_DETACH_BPF, 0); err != nil {
+		return fmt.Errorf("detach socket filter: %w", err)
+	}
+	return nil
+}
+
+func (sf *socketFilterLink) Pin(string) error {
+	return fmt.Errorf("can't pin socket filter: %w", ErrNotSupported)
+}
+
+func (sf *socketFilterLink) Unpin() error {
+	return fmt.Errorf("can't unpin socket filter: %w", ErrNotSupported)
+}
+
+func (sf *socketFilterLink) Info() (*Info, error) {
+	return nil, fmt.Errorf("can't get socket filter info: %w", ErrNotSupported)
+}
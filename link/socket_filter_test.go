@@ -1,10 +1,14 @@
 package link
 
 import (
+	"errors"
 	"net"
+	"os"
+	"syscall"
 	"testing"
 
 	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/internal/unix"
 )
 
 func TestSocketFilterAttach(t *testing.T) {
@@ -26,3 +30,67 @@ func TestSocketFilterAttach(t *testing.T) {
 		t.Fatal(err)
 	}
 }
+
+func TestAttachSocketFilterFD(t *testing.T) {
+	prog := mustLoadProgram(t, ebpf.SocketFilter, 0, "")
+
+	fd, err := syscall.Socket(syscall.AF_INET, syscall.SOCK_DGRAM, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer syscall.Close(fd)
+
+	l, err := AttachSocketFilterFD(fd, prog)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := l.Update(prog); err != nil {
+		t.Fatal("Can't update socket filter:", err)
+	}
+
+	if err := l.Update(nil); !errors.Is(err, errInvalidInput) {
+		t.Error("Updating with a nil program doesn't return errInvalidInput, got", err)
+	}
+
+	if err := l.Close(); err != nil {
+		t.Fatal("Can't detach socket filter:", err)
+	}
+
+	if err := syscall.SetsockoptInt(fd, syscall.SOL_SOCKET, unix.SO_DETACH_BPF, 0); err == nil {
+		t.Error("Socket filter is still attached after Close")
+	}
+
+	// The link keeps working after the caller closed its fd.
+	fd2, err := syscall.Dup(fd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	l, err = AttachSocketFilterFD(fd2, prog)
+	if err != nil {
+		t.Fatal(err)
+	}
+	syscall.Close(fd2)
+
+	if err := l.Update(prog); err != nil {
+		t.Fatal("Can't update socket filter after closing fd:", err)
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal("Can't detach socket filter after closing fd:", err)
+	}
+
+	if _, err := AttachSocketFilterFD(fd, mustLoadProgram(t, ebpf.XDP, 0, "")); !errors.Is(err, errInvalidInput) {
+		t.Error("Attaching a program of the wrong type doesn't return errInvalidInput, got", err)
+	}
+
+	f, err := os.CreateTemp("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if _, err := AttachSocketFilterFD(int(f.Fd()), prog); !errors.Is(err, syscall.ENOTSOCK) {
+		t.Error("Attaching to a file doesn't return ENOTSOCK, got", err)
+	}
+}
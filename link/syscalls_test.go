@@ -17,3 +17,11 @@ func TestHaveProgAttachReplace(t *testing.T) {
 func TestHaveBPFLink(t *testing.T) {
 	testutils.CheckFeatureTest(t, haveBPFLink)
 }
+
+func TestHaveCgroupSockopt(t *testing.T) {
+	testutils.CheckFeatureTest(t, haveCgroupSockopt)
+}
+
+func TestHaveSkLookup(t *testing.T) {
+	testutils.CheckFeatureTest(t, haveSkLookup)
+}
@@ -0,0 +1,184 @@
+package link
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/internal"
+	"github.com/cilium/ebpf/internal/sys"
+	"github.com/cilium/ebpf/internal/unix"
+)
+
+// Flags of BPF_LINK_CREATE and BPF_PROG_ATTACH which specify the position of
+// a program relative to others.
+const (
+	flagBefore = 1 << 3
+	flagAfter  = 1 << 4
+	flagID     = 1 << 5
+	flagLink   = 1 << 13
+)
+
+// Anchor is the position of a program relative to the other programs
+// attached to the same hook.
+type Anchor interface {
+	// anchor returns the fd or ID of the relative object and the flags
+	// describing it.
+	anchor() (fdOrID, flags uint32, _ error)
+}
+
+type headAnchor struct{}
+
+func (headAnchor) anchor() (uint32, uint32, error) { return 0, flagBefore, nil }
+
+// HeadAnchor places a program before all other programs.
+func HeadAnchor() Anchor {
+	return headAnchor{}
+}
+
+type tailAnchor struct{}
+
+func (tailAnchor) anchor() (uint32, uint32, error) { return 0, flagAfter, nil }
+
+// TailAnchor places a program after all other programs.
+func TailAnchor() Anchor {
+	return tailAnchor{}
+}
+
+type programAnchor struct {
+	prog  *ebpf.Program
+	flags uint32
+}
+
+func (pa programAnchor) anchor() (uint32, uint32, error) {
+	fd := pa.prog.FD()
+	if fd < 0 {
+		return 0, 0, fmt.Errorf("anchor program: %w", sys.ErrClosedFd)
+	}
+	return uint32(fd), pa.flags, nil
+}
+
+// BeforeProgram places a program before prog, which must be attached to the
+// same hook.
+func BeforeProgram(prog *ebpf.Program) Anchor {
+	return programAnchor{prog, flagBefore}
+}
+
+// AfterProgram places a program after prog, which must be attached to the
+// same hook.
+func AfterProgram(prog *ebpf.Program) Anchor {
+	return programAnchor{prog, flagAfter}
+}
+
+type linkAnchor struct {
+	link  Link
+	flags uint32
+}
+
+func (la linkAnchor) anchor() (uint32, uint32, error) {
+	info, err := la.link.Info()
+	if err != nil {
+		return 0, 0, fmt.Errorf("anchor link: %w", err)
+	}
+	return uint32(info.ID), la.flags | flagLink | flagID, nil
+}
+
+// BeforeLink places a program before the program attached by link, which
+// must be attached to the same hook.
+func BeforeLink(link Link) Anchor {
+	return linkAnchor{link, flagBefore}
+}
+
+// AfterLink places a program after the program attached by link, which must
+// be attached to the same hook.
+func AfterLink(link Link) Anchor {
+	return linkAnchor{link, flagAfter}
+}
+
+type TCXOptions struct {
+	// Index of the interface to attach to.
+	Interface int
+	// Program to attach. Must be of type SchedCLS.
+	Program *ebpf.Program
+	// AttachTCXIngress or AttachTCXEgress.
+	Attach ebpf.AttachType
+	// Position of Program relative to the other programs attached to the
+	// same hook. Defaults to appending Program.
+	Anchor Anchor
+	// Only attach if the revision of the hook, which is incremented each
+	// time a program is attached or detached, matches. Zero disables the
+	// check.
+	ExpectedRevision uint64
+	// File descriptor of the network namespace which contains Interface.
+	// Zero means the network namespace of the calling thread. See
+	// XDPOptions.NetNS.
+	NetNS int
+}
+
+// AttachTCX links a SchedCLS program to the ingress or egress tcx hook of an
+// interface (Linux 6.6+). Multiple programs can be attached to the same hook,
+// and are executed in order.
+//
+// Returns an error wrapping ErrNotSupported if the kernel doesn't support tcx.
+// Older kernels require attaching via a clsact qdisc using netlink instead.
+func AttachTCX(opts TCXOptions) (_ Link, err error) {
+	defer internal.AddStackTrace(&err)
+
+	if t := opts.Program.Type(); t != ebpf.SchedCLS {
+		return nil, fmt.Errorf("invalid program type %s, expected SchedCLS", t)
+	}
+
+	if opts.Attach != ebpf.AttachTCXIngress && opts.Attach != ebpf.AttachTCXEgress {
+		return nil, fmt.Errorf("invalid attach type %s, expected TCXIngress or TCXEgress", opts.Attach)
+	}
+
+	if opts.Interface < 1 {
+		return nil, fmt.Errorf("invalid interface index: %d", opts.Interface)
+	}
+
+	if err := haveTCX(); err != nil {
+		return nil, err
+	}
+
+	progFd := opts.Program.FD()
+	if progFd < 0 {
+		return nil, fmt.Errorf("invalid program: %s", sys.ErrClosedFd)
+	}
+
+	attr := sys.LinkCreateTcxAttr{
+		ProgFd:           uint32(progFd),
+		TargetIfindex:    uint32(opts.Interface),
+		AttachType:       sys.AttachType(opts.Attach),
+		ExpectedRevision: opts.ExpectedRevision,
+	}
+
+	if opts.Anchor != nil {
+		fdOrID, flags, err := opts.Anchor.anchor()
+		if err != nil {
+			return nil, err
+		}
+		attr.RelativeFdOrId = fdOrID
+		attr.Flags = flags
+	}
+
+	var fd *sys.FD
+	err = inNetNS(opts.NetNS, func() (err error) {
+		fd, err = sys.LinkCreateTcx(&attr)
+		return err
+	})
+	if fd != nil && err != nil {
+		fd.Close()
+	}
+	if errors.Is(err, unix.ESTALE) {
+		return nil, fmt.Errorf("attach tcx link: revision doesn't match: %w", err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("attach tcx link: %w", err)
+	}
+
+	return &tcxLink{RawLink{fd, "", internal.Now()}}, nil
+}
+
+type tcxLink struct {
+	RawLink
+}
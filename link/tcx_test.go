@@ -0,0 +1,79 @@
+package link
+
+import (
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/internal/sys"
+	"github.com/cilium/ebpf/internal/testutils"
+)
+
+func TestAttachTCX(t *testing.T) {
+	testutils.SkipOnOldKernel(t, "6.6", "tcx")
+
+	prog := mustLoadProgram(t, ebpf.SchedCLS, 0, "")
+
+	for _, attach := range []ebpf.AttachType{ebpf.AttachTCXIngress, ebpf.AttachTCXEgress} {
+		t.Run(attach.String(), func(t *testing.T) {
+			first, err := AttachTCX(TCXOptions{
+				Interface: IfIndexLO,
+				Program:   prog,
+				Attach:    attach,
+			})
+			qt.Assert(t, err, qt.IsNil)
+			defer first.Close()
+
+			info, err := first.Info()
+			qt.Assert(t, err, qt.IsNil)
+			qt.Assert(t, info.Type, qt.Equals, TCXType)
+			qt.Assert(t, info.TCX(), qt.DeepEquals, &TCXInfo{Ifindex: IfIndexLO, AttachType: sys.AttachType(attach)})
+
+			for _, anchor := range []Anchor{
+				HeadAnchor(),
+				TailAnchor(),
+				BeforeLink(first),
+				AfterLink(first),
+				BeforeProgram(prog),
+				AfterProgram(prog),
+			} {
+				other := mustLoadProgram(t, ebpf.SchedCLS, 0, "")
+				l, err := AttachTCX(TCXOptions{
+					Interface: IfIndexLO,
+					Program:   other,
+					Attach:    attach,
+					Anchor:    anchor,
+				})
+				qt.Assert(t, err, qt.IsNil, qt.Commentf("anchor %T", anchor))
+				qt.Assert(t, l.Close(), qt.IsNil)
+			}
+
+			_, err = AttachTCX(TCXOptions{
+				Interface:        IfIndexLO,
+				Program:          mustLoadProgram(t, ebpf.SchedCLS, 0, ""),
+				Attach:           attach,
+				ExpectedRevision: 1,
+			})
+			qt.Assert(t, err, qt.IsNotNil, qt.Commentf("stale revision must be rejected"))
+		})
+	}
+}
+
+func TestAttachTCXErrors(t *testing.T) {
+	prog := mustLoadProgram(t, ebpf.SchedCLS, 0, "")
+
+	_, err := AttachTCX(TCXOptions{Interface: IfIndexLO, Program: prog, Attach: ebpf.AttachXDP})
+	qt.Assert(t, err, qt.IsNotNil)
+
+	_, err = AttachTCX(TCXOptions{Interface: 0, Program: prog, Attach: ebpf.AttachTCXIngress})
+	qt.Assert(t, err, qt.IsNotNil)
+
+	xdp := mustLoadProgram(t, ebpf.XDP, 0, "")
+	_, err = AttachTCX(TCXOptions{Interface: IfIndexLO, Program: xdp, Attach: ebpf.AttachTCXIngress})
+	qt.Assert(t, err, qt.IsNotNil)
+}
+
+func TestHaveTCX(t *testing.T) {
+	testutils.CheckFeatureTest(t, haveTCX)
+}
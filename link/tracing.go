@@ -1,10 +1,15 @@
 package link
 
 import (
+	"errors"
 	"fmt"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/cilium/ebpf"
 	"github.com/cilium/ebpf/btf"
+	"github.com/cilium/ebpf/internal"
 	"github.com/cilium/ebpf/internal/sys"
 )
 
@@ -25,7 +30,9 @@ func (f *tracing) Update(new *ebpf.Program) error {
 //
 //	AttachFreplace(dispatcher, "function", replacement)
 //	AttachFreplace(nil, "", replacement)
-func AttachFreplace(targetProg *ebpf.Program, name string, prog *ebpf.Program) (Link, error) {
+func AttachFreplace(targetProg *ebpf.Program, name string, prog *ebpf.Program) (_ Link, err error) {
+	defer internal.AddStackTrace(&err)
+
 	if (name == "") != (targetProg == nil) {
 		return nil, fmt.Errorf("must provide both or neither of name and targetProg: %w", errInvalidInput)
 	}
@@ -106,7 +113,7 @@ func attachBTFID(program *ebpf.Program) (Link, error) {
 		return nil, err
 	}
 
-	raw := RawLink{fd: fd}
+	raw := RawLink{fd: fd, created: internal.Now()}
 	info, err := raw.Info()
 	if err != nil {
 		raw.Close()
@@ -119,13 +126,20 @@ func attachBTFID(program *ebpf.Program) (Link, error) {
 		return &rawTracepoint{raw}, nil
 	}
 
-	return &tracing{RawLink: RawLink{fd: fd}}, nil
+	return &tracing{RawLink: RawLink{fd: fd, created: internal.Now()}}, nil
 }
 
 // AttachTracing links a tracing (fentry/fexit/fmod_ret) BPF program or
 // a BTF-powered raw tracepoint (tp_btf) BPF Program to a BPF hook defined
 // in kernel modules.
-func AttachTracing(opts TracingOptions) (Link, error) {
+//
+// The hook is resolved when loading the program, based on
+// ProgramSpec.AttachTo. Unless ProgramOptions.KernelTypes is set, targets
+// which aren't part of vmlinux are searched in the BTF of loaded kernel
+// modules in /sys/kernel/btf, which requires Linux 5.11.
+func AttachTracing(opts TracingOptions) (_ Link, err error) {
+	defer internal.AddStackTrace(&err)
+
 	if t := opts.Program.Type(); t != ebpf.Tracing {
 		return nil, fmt.Errorf("invalid program type %s, expected Tracing", t)
 	}
@@ -133,12 +147,259 @@ func AttachTracing(opts TracingOptions) (Link, error) {
 	return attachBTFID(opts.Program)
 }
 
+// AttachTracingPair attaches an fentry and an fexit program to the same kernel
+// function, for example to measure its latency.
+//
+// entry must be loaded with AttachTraceFEntry and exit with AttachTraceFExit.
+// Since the traced function is chosen when loading a program, target is only
+// used to check that both programs trace the function of that name. If target
+// is empty, the programs are only checked to trace the same function.
+//
+// The programs are checked before attaching either of them, based on
+// ProgramInfo. On kernels which don't report the target of a program, or for
+// programs which weren't loaded from a ProgramSpec, the remaining checks are
+// done on the attached links, which are closed again if the checks fail.
+//
+// Closing the returned Link detaches entry before exit, so that exit runs
+// for every invocation of the function which entry saw.
+func AttachTracingPair(entry, exit *ebpf.Program, target string) (Link, error) {
+	if entry == nil || exit == nil {
+		return nil, fmt.Errorf("entry and exit programs are required: %w", errInvalidInput)
+	}
+	for _, prog := range []*ebpf.Program{entry, exit} {
+		if t := prog.Type(); t != ebpf.Tracing {
+			return nil, fmt.Errorf("invalid program type %s, expected Tracing: %w", t, errInvalidInput)
+		}
+	}
+
+	checked, err := checkTracingPrograms(entry, exit, target)
+	if err != nil {
+		return nil, err
+	}
+
+	entryLink, err := attachBTFID(entry)
+	if err != nil {
+		return nil, fmt.Errorf("entry: %w", err)
+	}
+
+	exitLink, err := attachBTFID(exit)
+	if err != nil {
+		entryLink.Close()
+		return nil, fmt.Errorf("exit: %w", err)
+	}
+
+	pair := &tracingPair{entryLink, exitLink}
+	if checked {
+		return pair, nil
+	}
+
+	if err := pair.check(target); err != nil {
+		pair.Close()
+		return nil, err
+	}
+
+	return pair, nil
+}
+
+// checkTracingPrograms returns an error if entry and exit don't trace the
+// entry and exit of the same function.
+//
+// Returns true if all checks were done, false if the program info lacks
+// the attach type or target of a program.
+func checkTracingPrograms(entry, exit *ebpf.Program, target string) (bool, error) {
+	entryInfo, err := entry.Info()
+	if err != nil {
+		return false, fmt.Errorf("entry: %w", err)
+	}
+
+	exitInfo, err := exit.Info()
+	if err != nil {
+		return false, fmt.Errorf("exit: %w", err)
+	}
+
+	entryAttach, entryKnown := entryInfo.AttachType()
+	if entryKnown && entryAttach != ebpf.AttachTraceFEntry {
+		return false, fmt.Errorf("entry has attach type %s, expected %s: %w", entryAttach, ebpf.AttachTraceFEntry, errInvalidInput)
+	}
+
+	exitAttach, exitKnown := exitInfo.AttachType()
+	if exitKnown && exitAttach != ebpf.AttachTraceFExit {
+		return false, fmt.Errorf("exit has attach type %s, expected %s: %w", exitAttach, ebpf.AttachTraceFExit, errInvalidInput)
+	}
+	complete := entryKnown && exitKnown
+
+	entryObj, entryType, entryOK := entryInfo.AttachTarget()
+	exitObj, exitType, exitOK := exitInfo.AttachTarget()
+	if !entryOK || !exitOK {
+		return false, nil
+	}
+
+	if entryObj != exitObj || entryType != exitType {
+		return false, fmt.Errorf("entry and exit trace different functions: %w", errInvalidInput)
+	}
+
+	if target == "" {
+		return complete, nil
+	}
+
+	name, err := btf.TypeNameByID(entryObj, entryType)
+	if err != nil {
+		return false, fmt.Errorf("target of entry: %w", err)
+	}
+	if name != target {
+		return false, fmt.Errorf("programs trace %s instead of %s: %w", name, target, errInvalidInput)
+	}
+
+	return complete, nil
+}
+
+type tracingPair struct {
+	entry, exit Link
+}
+
+var _ Link = (*tracingPair)(nil)
+
+func (tp *tracingPair) isLink() {}
+
+func (tp *tracingPair) Created() time.Time {
+	return tp.entry.Created()
+}
+
+// check returns an error if the links don't trace the entry and exit of the
+// same function.
+func (tp *tracingPair) check(target string) error {
+	entry, err := tracingInfo(tp.entry)
+	if err != nil {
+		return fmt.Errorf("entry: %w", err)
+	}
+
+	exit, err := tracingInfo(tp.exit)
+	if err != nil {
+		return fmt.Errorf("exit: %w", err)
+	}
+
+	if at := ebpf.AttachType(entry.AttachType); at != ebpf.AttachTraceFEntry {
+		return fmt.Errorf("entry has attach type %s, expected %s: %w", at, ebpf.AttachTraceFEntry, errInvalidInput)
+	}
+	if at := ebpf.AttachType(exit.AttachType); at != ebpf.AttachTraceFExit {
+		return fmt.Errorf("exit has attach type %s, expected %s: %w", at, ebpf.AttachTraceFExit, errInvalidInput)
+	}
+
+	if entry.TargetObjId != exit.TargetObjId || entry.TargetBtfId != exit.TargetBtfId {
+		return fmt.Errorf("entry and exit trace different functions: %w", errInvalidInput)
+	}
+
+	if target == "" {
+		return nil
+	}
+
+	name, err := entry.TargetName()
+	if err != nil {
+		return err
+	}
+	if name != target {
+		return fmt.Errorf("programs trace %s instead of %s: %w", name, target, errInvalidInput)
+	}
+
+	return nil
+}
+
+func tracingInfo(l Link) (*TracingInfo, error) {
+	info, err := l.Info()
+	if err != nil {
+		return nil, err
+	}
+
+	ti := info.Tracing()
+	if ti == nil {
+		return nil, fmt.Errorf("link type %d is not a tracing link: %w", info.Type, errInvalidInput)
+	}
+
+	return ti, nil
+}
+
+func (tp *tracingPair) Update(*ebpf.Program) error {
+	return fmt.Errorf("can't update tracing pair: %w", ErrNotSupported)
+}
+
+func (tp *tracingPair) Pin(string) error {
+	return fmt.Errorf("can't pin tracing pair: %w", ErrNotSupported)
+}
+
+func (tp *tracingPair) Unpin() error {
+	return fmt.Errorf("can't unpin tracing pair: %w", ErrNotSupported)
+}
+
+func (tp *tracingPair) Info() (*Info, error) {
+	return nil, fmt.Errorf("can't get info of tracing pair: %w", ErrNotSupported)
+}
+
+func (tp *tracingPair) Close() error {
+	entryErr := tp.entry.Close()
+	exitErr := tp.exit.Close()
+	if entryErr != nil {
+		return fmt.Errorf("close entry: %w", entryErr)
+	}
+	if exitErr != nil {
+		return fmt.Errorf("close exit: %w", exitErr)
+	}
+	return nil
+}
+
 // AttachLSM links a Linux security module (LSM) BPF Program to a BPF
 // hook defined in kernel modules.
-func AttachLSM(opts LSMOptions) (Link, error) {
+//
+// Requires a kernel built with CONFIG_BPF_LSM and "bpf" in the list of active
+// LSMs, see the lsm= kernel parameter. Returns an error wrapping
+// ErrNotSupported otherwise.
+func AttachLSM(opts LSMOptions) (_ Link, err error) {
+	defer internal.AddStackTrace(&err)
+
 	if t := opts.Program.Type(); t != ebpf.LSM {
 		return nil, fmt.Errorf("invalid program type %s, expected LSM", t)
 	}
 
+	if err := haveBPFLSM(lsmListPath); err != nil {
+		return nil, err
+	}
+
 	return attachBTFID(opts.Program)
 }
+
+const lsmListPath = "/sys/kernel/security/lsm"
+
+// haveBPFLSM returns an error wrapping ErrNotSupported if the list of active
+// LSMs at path doesn't contain "bpf".
+//
+// The check is skipped if securityfs isn't mounted.
+func haveBPFLSM(path string) error {
+	list, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("read active LSMs: %w", err)
+	}
+
+	for _, lsm := range strings.Split(strings.TrimSpace(string(list)), ",") {
+		if lsm == "bpf" {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("bpf is not an active LSM (active: %s), add it to the lsm= kernel parameter: %w", strings.TrimSpace(string(list)), ErrNotSupported)
+}
+
+// TargetName returns the name of the function or hook the tracing link is
+// attached to, as found in the kernel's BTF. For LSM programs this is the
+// hook name prefixed with "bpf_lsm_", for example "bpf_lsm_file_mprotect".
+//
+// Targets in kernel modules are supported. Requires CAP_SYS_ADMIN.
+func (ti *TracingInfo) TargetName() (string, error) {
+	name, err := btf.TypeNameByID(btf.ID(ti.TargetObjId), btf.TypeID(ti.TargetBtfId))
+	if err != nil {
+		return "", fmt.Errorf("target BTF: %w", err)
+	}
+
+	return name, nil
+}
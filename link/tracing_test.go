@@ -1,6 +1,9 @@
 package link
 
 import (
+	"errors"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/cilium/ebpf"
@@ -94,15 +97,91 @@ func TestTracing(t *testing.T) {
 	}
 }
 
+func TestAttachTracingPair(t *testing.T) {
+	testutils.SkipOnOldKernel(t, "5.11", "BPF_LINK_TYPE_TRACING")
+
+	entry := mustLoadProgram(t, ebpf.Tracing, ebpf.AttachTraceFEntry, "inet_dgram_connect")
+	exit := mustLoadProgram(t, ebpf.Tracing, ebpf.AttachTraceFExit, "inet_dgram_connect")
+
+	pair, err := AttachTracingPair(entry, exit, "inet_dgram_connect")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := pair.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = AttachTracingPair(exit, entry, "")
+	if !errors.Is(err, errInvalidInput) {
+		t.Fatal("Expected errInvalidInput for swapped programs, got", err)
+	}
+
+	other := mustLoadProgram(t, ebpf.Tracing, ebpf.AttachTraceFExit, "inet_dgram_connect")
+	_, err = AttachTracingPair(entry, other, "tcp_close")
+	if !errors.Is(err, errInvalidInput) {
+		t.Fatal("Expected errInvalidInput for wrong target, got", err)
+	}
+}
+
+func TestAttachTracingPairInput(t *testing.T) {
+	prog := mustLoadProgram(t, ebpf.SocketFilter, 0, "")
+
+	if _, err := AttachTracingPair(nil, prog, ""); !errors.Is(err, errInvalidInput) {
+		t.Error("Expected errInvalidInput for nil program, got", err)
+	}
+	if _, err := AttachTracingPair(prog, prog, ""); !errors.Is(err, errInvalidInput) {
+		t.Error("Expected errInvalidInput for non-tracing programs, got", err)
+	}
+}
+
 func TestLSM(t *testing.T) {
 	testutils.SkipOnOldKernel(t, "5.11", "BPF_LINK_TYPE_TRACING")
 
 	prog := mustLoadProgram(t, ebpf.LSM, ebpf.AttachLSMMac, "file_mprotect")
 
 	link, err := AttachLSM(LSMOptions{Program: prog})
+	testutils.SkipIfNotSupported(t, err)
 	if err != nil {
 		t.Fatal(err)
 	}
 
+	info, err := link.Info()
+	if err != nil {
+		t.Fatal(err)
+	}
+	name, err := info.Tracing().TargetName()
+	if err != nil {
+		t.Fatal("Can't get target name:", err)
+	}
+	if name != "bpf_lsm_file_mprotect" {
+		t.Error("Expected target bpf_lsm_file_mprotect, got", name)
+	}
+
 	testLink(t, link, prog)
 }
+
+func TestHaveBPFLSM(t *testing.T) {
+	dir := t.TempDir()
+
+	for list, supported := range map[string]bool{
+		"lockdown,capability,bpf\n":      true,
+		"capability,landlock,apparmor\n": false,
+	} {
+		path := filepath.Join(dir, "lsm")
+		if err := os.WriteFile(path, []byte(list), 0644); err != nil {
+			t.Fatal(err)
+		}
+
+		err := haveBPFLSM(path)
+		if supported && err != nil {
+			t.Errorf("%q: unexpected error: %s", list, err)
+		}
+		if !supported && !errors.Is(err, ErrNotSupported) {
+			t.Errorf("%q: expected ErrNotSupported, got %v", list, err)
+		}
+	}
+
+	if err := haveBPFLSM(filepath.Join(dir, "missing")); err != nil {
+		t.Error("Missing LSM list returns an error:", err)
+	}
+}
@@ -94,6 +94,11 @@ func OpenExecutable(path string) (*Executable, error) {
 		return nil, fmt.Errorf("parse ELF file: %w", err)
 	}
 
+	return newExecutable(path, se)
+}
+
+// newExecutable creates an Executable from the already parsed ELF at path.
+func newExecutable(path string, se *internal.SafeELFFile) (*Executable, error) {
 	if se.Type != elf.ET_EXEC && se.Type != elf.ET_DYN {
 		// ELF is not an executable or a shared object.
 		return nil, errors.New("the given file is not an executable or a shared object")
@@ -192,7 +197,9 @@ func (ex *Executable) offset(symbol string) (uint64, error) {
 //
 // Functions provided by shared libraries can currently not be traced and
 // will result in an ErrNotSupported.
-func (ex *Executable) Uprobe(symbol string, prog *ebpf.Program, opts *UprobeOptions) (Link, error) {
+func (ex *Executable) Uprobe(symbol string, prog *ebpf.Program, opts *UprobeOptions) (_ Link, err error) {
+	defer internal.AddStackTrace(&err)
+
 	u, err := ex.uprobe(symbol, prog, opts, false)
 	if err != nil {
 		return nil, err
@@ -224,7 +231,9 @@ func (ex *Executable) Uprobe(symbol string, prog *ebpf.Program, opts *UprobeOpti
 //
 // Functions provided by shared libraries can currently not be traced and
 // will result in an ErrNotSupported.
-func (ex *Executable) Uretprobe(symbol string, prog *ebpf.Program, opts *UprobeOptions) (Link, error) {
+func (ex *Executable) Uretprobe(symbol string, prog *ebpf.Program, opts *UprobeOptions) (_ Link, err error) {
+	defer internal.AddStackTrace(&err)
+
 	u, err := ex.uprobe(symbol, prog, opts, true)
 	if err != nil {
 		return nil, err
@@ -0,0 +1,395 @@
+package link
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/internal"
+)
+
+// USDTOptions defines the probe to attach to when calling USDT.
+type USDTOptions struct {
+	// Path of the executable or shared library containing the probe.
+	Path string
+	// Provider and name of the probe, as passed to DTRACE_PROBE in C.
+	Provider, Name string
+	// Program must be of type Kprobe.
+	Program *ebpf.Program
+	// Only trigger the probe in the given process ID.
+	PID int
+	// Arbitrary value that can be fetched from an eBPF program
+	// via `bpf_get_attach_cookie()`.
+	//
+	// Needs kernel 5.15+.
+	Cookie uint64
+}
+
+// USDTProbe is a user statically-defined tracing probe, as found in the
+// .note.stapsdt section of an ELF.
+type USDTProbe struct {
+	Provider, Name string
+	// Offset of the probe site in the ELF file.
+	Offset uint64
+	// Offset of the semaphore in the ELF file, or zero if the probe doesn't
+	// use a semaphore.
+	SemaphoreOffset uint64
+	// Location of the arguments of the probe.
+	Arguments []USDTArgument
+}
+
+// USDTArgument describes where the value of a USDT probe argument can be
+// found when the probe fires.
+type USDTArgument struct {
+	// Size of the argument in bytes.
+	Size int
+	// Whether the argument is a signed integer.
+	Signed bool
+	// Location of the argument in the architecture specific assembler
+	// syntax used by the compiler, for example "%rdi" or "-4(%rbp)".
+	Location string
+}
+
+// USDTProbes returns all USDT probes defined in the executable or shared
+// library at path.
+//
+// Returns an empty slice if the ELF contains no probes.
+func USDTProbes(path string) ([]USDTProbe, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, fmt.Errorf("open file '%s': %w", path, err)
+	}
+	defer f.Close()
+
+	se, err := internal.NewSafeELFFile(f)
+	if err != nil {
+		return nil, fmt.Errorf("parse ELF file: %w", err)
+	}
+
+	return loadUSDTProbes(se)
+}
+
+// USDT attaches the given eBPF program to all sites of a USDT probe.
+//
+// The probe is attached as a Uprobe at the location found in the .note.stapsdt
+// section of the ELF. Probes guarded by a semaphore have their semaphore
+// incremented by the kernel for as long as the Link exists, which requires
+// Linux 4.20 or later.
+//
+// If the probe is inlined at multiple sites, Update and Close apply to all of
+// them and Pin, Unpin and Info are not supported.
+//
+// Returns an error wrapping ErrNoSymbol if the probe doesn't exist.
+func USDT(opts USDTOptions) (Link, error) {
+	if opts.Provider == "" || opts.Name == "" {
+		return nil, fmt.Errorf("provider and name cannot be empty: %w", errInvalidInput)
+	}
+
+	if opts.Path == "" {
+		return nil, fmt.Errorf("path cannot be empty")
+	}
+
+	f, err := os.Open(opts.Path)
+	if err != nil {
+		return nil, fmt.Errorf("open file '%s': %w", opts.Path, err)
+	}
+	defer f.Close()
+
+	// Parse the ELF once for both the symbols and the probes.
+	se, err := internal.NewSafeELFFile(f)
+	if err != nil {
+		return nil, fmt.Errorf("parse ELF file: %w", err)
+	}
+
+	ex, err := newExecutable(opts.Path, se)
+	if err != nil {
+		return nil, err
+	}
+
+	probes, err := loadUSDTProbes(se)
+	if err != nil {
+		return nil, err
+	}
+
+	var sites []USDTProbe
+	for _, probe := range probes {
+		if probe.Provider == opts.Provider && probe.Name == opts.Name {
+			sites = append(sites, probe)
+		}
+	}
+
+	if len(sites) == 0 {
+		return nil, fmt.Errorf("usdt probe %s:%s in %s: %w", opts.Provider, opts.Name, opts.Path, ErrNoSymbol)
+	}
+
+	symbol := opts.Provider + ":" + opts.Name
+
+	var links []Link
+	for _, site := range sites {
+		lnk, err := ex.Uprobe(symbol, opts.Program, &UprobeOptions{
+			Offset:       site.Offset,
+			PID:          opts.PID,
+			RefCtrOffset: site.SemaphoreOffset,
+			Cookie:       opts.Cookie,
+		})
+		if err != nil {
+			for _, l := range links {
+				l.Close()
+			}
+			return nil, fmt.Errorf("usdt probe %s at %#x: %w", symbol, site.Offset, err)
+		}
+
+		links = append(links, lnk)
+	}
+
+	if len(links) == 1 {
+		return links[0], nil
+	}
+
+	return &usdtLink{links}, nil
+}
+
+// usdtLink groups the uprobes attached to the sites of a single USDT probe.
+type usdtLink struct {
+	links []Link
+}
+
+var _ Link = (*usdtLink)(nil)
+
+func (ul *usdtLink) isLink() {}
+
+func (ul *usdtLink) Created() time.Time {
+	if len(ul.links) == 0 {
+		return time.Time{}
+	}
+	return ul.links[0].Created()
+}
+
+func (ul *usdtLink) Update(prog *ebpf.Program) error {
+	for _, l := range ul.links {
+		if err := l.Update(prog); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (ul *usdtLink) Pin(string) error {
+	return fmt.Errorf("pin usdt: %w", ErrNotSupported)
+}
+
+func (ul *usdtLink) Unpin() error {
+	return fmt.Errorf("unpin usdt: %w", ErrNotSupported)
+}
+
+func (ul *usdtLink) Info() (*Info, error) {
+	return nil, fmt.Errorf("can't get usdt info: %w", ErrNotSupported)
+}
+
+func (ul *usdtLink) Close() error {
+	var firstErr error
+	for _, l := range ul.links {
+		if err := l.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+const (
+	stapsdtNoteName = "stapsdt"
+	stapsdtNoteType = 3
+)
+
+func loadUSDTProbes(f *internal.SafeELFFile) ([]USDTProbe, error) {
+	notes := f.Section(".note.stapsdt")
+	if notes == nil {
+		return nil, nil
+	}
+
+	data, err := notes.Data()
+	if err != nil {
+		return nil, fmt.Errorf("read .note.stapsdt: %w", err)
+	}
+
+	addrSize := 4
+	if f.Class == elf.ELFCLASS64 {
+		addrSize = 8
+	}
+
+	probes, err := parseUSDTNotes(data, f.ByteOrder, addrSize)
+	if err != nil {
+		return nil, err
+	}
+
+	// Binaries modified by prelink record the original address of the
+	// .stapsdt.base section in each note, so that the displacement can be
+	// applied to the probe addresses.
+	base := f.Section(".stapsdt.base")
+
+	result := make([]USDTProbe, 0, len(probes))
+	for _, probe := range probes {
+		pc, sema := probe.pc, probe.semaphore
+		if base != nil && probe.base != 0 {
+			pc += base.Addr - probe.base
+			if sema != 0 {
+				sema += base.Addr - probe.base
+			}
+		}
+
+		off, err := addressToOffset(f, pc, true)
+		if err != nil {
+			return nil, fmt.Errorf("usdt probe %s:%s: %w", probe.provider, probe.name, err)
+		}
+
+		var semaOff uint64
+		if sema != 0 {
+			semaOff, err = addressToOffset(f, sema, false)
+			if err != nil {
+				return nil, fmt.Errorf("usdt probe %s:%s semaphore: %w", probe.provider, probe.name, err)
+			}
+		}
+
+		args, err := parseUSDTArguments(probe.args)
+		if err != nil {
+			return nil, fmt.Errorf("usdt probe %s:%s: %w", probe.provider, probe.name, err)
+		}
+
+		result = append(result, USDTProbe{
+			Provider:        probe.provider,
+			Name:            probe.name,
+			Offset:          off,
+			SemaphoreOffset: semaOff,
+			Arguments:       args,
+		})
+	}
+
+	return result, nil
+}
+
+// addressToOffset converts a virtual address into an offset in the ELF file,
+// using the loadable segment containing the address.
+func addressToOffset(f *internal.SafeELFFile, addr uint64, exec bool) (uint64, error) {
+	for _, prog := range f.Progs {
+		if prog.Type != elf.PT_LOAD {
+			continue
+		}
+		if exec && prog.Flags&elf.PF_X == 0 {
+			continue
+		}
+
+		if prog.Vaddr <= addr && addr < prog.Vaddr+prog.Memsz {
+			return addr - prog.Vaddr + prog.Off, nil
+		}
+	}
+
+	return 0, fmt.Errorf("address %#x is not in a loadable segment", addr)
+}
+
+// usdtNote is the raw content of a stapsdt ELF note.
+type usdtNote struct {
+	pc, base, semaphore  uint64
+	provider, name, args string
+}
+
+// parseUSDTNotes decodes the notes contained in a .note.stapsdt section.
+//
+// See https://sourceware.org/systemtap/wiki/UserSpaceProbeImplementation
+func parseUSDTNotes(data []byte, bo binary.ByteOrder, addrSize int) ([]usdtNote, error) {
+	var notes []usdtNote
+	for len(data) > 0 {
+		if len(data) < 12 {
+			return nil, errors.New("truncated note header")
+		}
+
+		nameSize := int(bo.Uint32(data[0:]))
+		descSize := int(bo.Uint32(data[4:]))
+		typ := bo.Uint32(data[8:])
+		data = data[12:]
+
+		nameEnd := internal.Align(nameSize, 4)
+		descEnd := nameEnd + internal.Align(descSize, 4)
+		if nameSize < 0 || descSize < 0 || len(data) < descEnd {
+			return nil, errors.New("truncated note")
+		}
+
+		name := string(bytes.TrimRight(data[:nameSize], "\x00"))
+		desc := data[nameEnd : nameEnd+descSize]
+		data = data[descEnd:]
+
+		if name != stapsdtNoteName || typ != stapsdtNoteType {
+			continue
+		}
+
+		note, err := parseUSDTNote(desc, bo, addrSize)
+		if err != nil {
+			return nil, err
+		}
+
+		notes = append(notes, note)
+	}
+
+	return notes, nil
+}
+
+func parseUSDTNote(desc []byte, bo binary.ByteOrder, addrSize int) (usdtNote, error) {
+	if len(desc) < 3*addrSize {
+		return usdtNote{}, errors.New("truncated stapsdt note")
+	}
+
+	readAddr := func() uint64 {
+		var addr uint64
+		if addrSize == 8 {
+			addr = bo.Uint64(desc)
+		} else {
+			addr = uint64(bo.Uint32(desc))
+		}
+		desc = desc[addrSize:]
+		return addr
+	}
+
+	var note usdtNote
+	note.pc = readAddr()
+	note.base = readAddr()
+	note.semaphore = readAddr()
+
+	strs := strings.SplitN(string(desc), "\x00", 4)
+	if len(strs) < 4 {
+		return usdtNote{}, errors.New("stapsdt note is missing provider, name or arguments")
+	}
+
+	note.provider, note.name, note.args = strs[0], strs[1], strs[2]
+	return note, nil
+}
+
+// parseUSDTArguments decodes an argument string like "-4@%eax 8@(%rbx)".
+func parseUSDTArguments(spec string) ([]USDTArgument, error) {
+	var args []USDTArgument
+	for _, field := range strings.Fields(spec) {
+		i := strings.IndexByte(field, '@')
+		if i == -1 {
+			return nil, fmt.Errorf("argument %q: missing size", field)
+		}
+
+		size, err := strconv.Atoi(field[:i])
+		if err != nil || size == 0 {
+			return nil, fmt.Errorf("argument %q: invalid size", field)
+		}
+
+		arg := USDTArgument{Size: size, Location: field[i+1:]}
+		if size < 0 {
+			arg.Size, arg.Signed = -size, true
+		}
+
+		args = append(args, arg)
+	}
+
+	return args, nil
+}
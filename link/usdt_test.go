@@ -0,0 +1,201 @@
+package link
+
+import (
+	"bytes"
+	"debug/elf"
+	"encoding/binary"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+	"github.com/google/go-cmp/cmp"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/internal"
+)
+
+func TestParseUSDTNotes(t *testing.T) {
+	var buf bytes.Buffer
+	writeNote := func(name string, typ uint32, desc []byte) {
+		nameBytes := append([]byte(name), 0)
+		binary.Write(&buf, binary.LittleEndian, uint32(len(nameBytes)))
+		binary.Write(&buf, binary.LittleEndian, uint32(len(desc)))
+		binary.Write(&buf, binary.LittleEndian, typ)
+		for _, b := range [][]byte{nameBytes, desc} {
+			buf.Write(b)
+			if n := len(b) % 4; n != 0 {
+				buf.Write(make([]byte, 4-n))
+			}
+		}
+	}
+
+	var desc bytes.Buffer
+	binary.Write(&desc, binary.LittleEndian, []uint64{0x1000, 0x2000, 0x3000})
+	desc.WriteString("libc\x00setjmp\x00-4@%eax 8@-8(%rbp)\x00")
+
+	writeNote("stapsdt", stapsdtNoteType, desc.Bytes())
+	writeNote("GNU", 1, []byte{1, 2, 3})
+
+	notes, err := parseUSDTNotes(buf.Bytes(), binary.LittleEndian, 8)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, notes, qt.CmpEquals(cmp.AllowUnexported(usdtNote{})), []usdtNote{
+		{0x1000, 0x2000, 0x3000, "libc", "setjmp", "-4@%eax 8@-8(%rbp)"},
+	})
+
+	_, err = parseUSDTNotes(buf.Bytes()[:buf.Len()-1], binary.LittleEndian, 8)
+	qt.Assert(t, err, qt.IsNotNil)
+}
+
+func TestUSDTProbes(t *testing.T) {
+	tests := []struct {
+		name           string
+		pc, base, sema uint64
+		// Address of the .stapsdt.base section, or zero if there is none.
+		baseSection     uint64
+		offset, semaOff uint64
+		wantErr         bool
+	}{
+		{name: "no semaphore", pc: 0x401010, offset: 0x1010},
+		{name: "semaphore", pc: 0x401010, sema: 0x403008, offset: 0x1010, semaOff: 0x2008},
+		{name: "prelinked", pc: 0x401010, base: 0x401800, sema: 0x403008, baseSection: 0x401900, offset: 0x1110, semaOff: 0x2108},
+		{name: "base without section", pc: 0x401010, base: 0x401800, offset: 0x1010},
+		{name: "pc outside executable segment", pc: 0x403010, wantErr: true},
+		{name: "semaphore outside segments", pc: 0x401010, sema: 0x500000, wantErr: true},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			var desc bytes.Buffer
+			binary.Write(&desc, binary.LittleEndian, []uint64{test.pc, test.base, test.sema})
+			desc.WriteString("provider\x00probe\x00-4@%eax\x00")
+
+			path := filepath.Join(t.TempDir(), "usdt")
+			err := os.WriteFile(path, usdtFixtureELF(desc.Bytes(), test.baseSection), 0644)
+			qt.Assert(t, err, qt.IsNil)
+
+			probes, err := USDTProbes(path)
+			if test.wantErr {
+				qt.Assert(t, err, qt.IsNotNil)
+				return
+			}
+			qt.Assert(t, err, qt.IsNil)
+			qt.Assert(t, probes, qt.DeepEquals, []USDTProbe{{
+				Provider:        "provider",
+				Name:            "probe",
+				Offset:          test.offset,
+				SemaphoreOffset: test.semaOff,
+				Arguments:       []USDTArgument{{4, true, "%eax"}},
+			}})
+		})
+	}
+}
+
+// usdtFixtureELF returns a little endian 64 bit ELF with a single stapsdt note
+// containing desc.
+//
+// The ELF has an executable segment at 0x401000 and a data segment at
+// 0x403000, located at offsets 0x1000 and 0x2000 respectively. If baseAddr
+// isn't zero the ELF also has a .stapsdt.base section at that address.
+func usdtFixtureELF(desc []byte, baseAddr uint64) []byte {
+	const (
+		progOff  = 0x40
+		notesOff = 0x100
+	)
+	bo := binary.LittleEndian
+
+	var notes bytes.Buffer
+	binary.Write(&notes, bo, []uint32{uint32(len(stapsdtNoteName) + 1), uint32(len(desc)), stapsdtNoteType})
+	notes.WriteString(stapsdtNoteName + "\x00")
+	notes.Write(desc)
+	notes.Write(make([]byte, internal.Align(notes.Len(), 4)-notes.Len()))
+
+	strtab := []byte("\x00.note.stapsdt\x00.stapsdt.base\x00.shstrtab\x00")
+	strtabOff := uint64(notesOff + notes.Len())
+	shOff := uint64(internal.Align(int(strtabOff)+len(strtab), 8))
+
+	sections := []elf.Section64{
+		{},
+		{Name: 1, Type: uint32(elf.SHT_NOTE), Off: notesOff, Size: uint64(notes.Len()), Addralign: 4},
+		{Name: 29, Type: uint32(elf.SHT_STRTAB), Off: strtabOff, Size: uint64(len(strtab)), Addralign: 1},
+	}
+	if baseAddr != 0 {
+		sections = append(sections, elf.Section64{
+			Name: 15, Type: uint32(elf.SHT_NOBITS), Flags: uint64(elf.SHF_ALLOC), Addr: baseAddr, Size: 1, Addralign: 1,
+		})
+	}
+
+	progs := []elf.Prog64{
+		{Type: uint32(elf.PT_LOAD), Flags: uint32(elf.PF_R | elf.PF_X), Off: 0x1000, Vaddr: 0x401000, Memsz: 0x1000, Align: 0x1000},
+		{Type: uint32(elf.PT_LOAD), Flags: uint32(elf.PF_R | elf.PF_W), Off: 0x2000, Vaddr: 0x403000, Memsz: 0x1000, Align: 0x1000},
+	}
+
+	header := elf.Header64{
+		Type:      uint16(elf.ET_EXEC),
+		Machine:   uint16(elf.EM_X86_64),
+		Version:   uint32(elf.EV_CURRENT),
+		Phoff:     progOff,
+		Shoff:     shOff,
+		Ehsize:    uint16(binary.Size(elf.Header64{})),
+		Phentsize: uint16(binary.Size(elf.Prog64{})),
+		Phnum:     uint16(len(progs)),
+		Shentsize: uint16(binary.Size(elf.Section64{})),
+		Shnum:     uint16(len(sections)),
+		Shstrndx:  2,
+	}
+	copy(header.Ident[:], elf.ELFMAG)
+	header.Ident[elf.EI_CLASS] = byte(elf.ELFCLASS64)
+	header.Ident[elf.EI_DATA] = byte(elf.ELFDATA2LSB)
+	header.Ident[elf.EI_VERSION] = byte(elf.EV_CURRENT)
+
+	buf := make([]byte, shOff)
+	var hdrs bytes.Buffer
+	binary.Write(&hdrs, bo, &header)
+	binary.Write(&hdrs, bo, progs)
+	copy(buf, hdrs.Bytes())
+	copy(buf[notesOff:], notes.Bytes())
+	copy(buf[strtabOff:], strtab)
+
+	out := bytes.NewBuffer(buf)
+	binary.Write(out, bo, sections)
+	return out.Bytes()
+}
+
+func TestParseUSDTArguments(t *testing.T) {
+	args, err := parseUSDTArguments("-4@%eax 8@-8(%rbp) 1@$5")
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, args, qt.DeepEquals, []USDTArgument{
+		{4, true, "%eax"},
+		{8, false, "-8(%rbp)"},
+		{1, false, "$5"},
+	})
+
+	args, err = parseUSDTArguments("")
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, args, qt.HasLen, 0)
+
+	for _, spec := range []string{"%eax", "x@%eax", "0@%eax"} {
+		_, err := parseUSDTArguments(spec)
+		qt.Assert(t, err, qt.IsNotNil, qt.Commentf("spec %q", spec))
+	}
+}
+
+func TestUSDTMissingProbe(t *testing.T) {
+	prog := mustLoadProgram(t, ebpf.Kprobe, 0, "")
+
+	_, err := USDT(USDTOptions{
+		Path:     "/bin/bash",
+		Provider: "bogus",
+		Name:     "probe",
+		Program:  prog,
+	})
+	if !errors.Is(err, ErrNoSymbol) {
+		t.Fatal("Expected ErrNoSymbol, got", err)
+	}
+
+	_, err = USDT(USDTOptions{Path: "/bin/bash", Program: prog})
+	if !errors.Is(err, errInvalidInput) {
+		t.Fatal("Expected errInvalidInput for missing provider and name, got", err)
+	}
+}
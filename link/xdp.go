@@ -1,9 +1,13 @@
 package link
 
 import (
+	"errors"
 	"fmt"
+	"net"
 
 	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/internal"
+	"github.com/cilium/ebpf/internal/unix"
 )
 
 // XDPAttachFlags represents how XDP program will be attached to interface.
@@ -31,10 +35,21 @@ type XDPOptions struct {
 	// Only one XDP mode should be set, without flag defaults
 	// to driver/generic mode (best effort).
 	Flags XDPAttachFlags
+
+	// NetNS is a file descriptor of the network namespace which contains
+	// Interface, for example /proc/<pid>/ns/net of a process in a container.
+	// The program is attached from within that namespace, and the calling
+	// thread is moved back into its original namespace afterwards.
+	//
+	// Zero means the network namespace of the calling thread. Requires
+	// CAP_SYS_ADMIN.
+	NetNS int
 }
 
 // AttachXDP links an XDP BPF program to an XDP hook.
-func AttachXDP(opts XDPOptions) (Link, error) {
+func AttachXDP(opts XDPOptions) (_ Link, err error) {
+	defer internal.AddStackTrace(&err)
+
 	if t := opts.Program.Type(); t != ebpf.XDP {
 		return nil, fmt.Errorf("invalid program type %s, expected XDP", t)
 	}
@@ -43,12 +58,84 @@ func AttachXDP(opts XDPOptions) (Link, error) {
 		return nil, fmt.Errorf("invalid interface index: %d", opts.Interface)
 	}
 
-	rawLink, err := AttachRawLink(RawLinkOptions{
-		Program: opts.Program,
-		Attach:  ebpf.AttachXDP,
-		Target:  opts.Interface,
-		Flags:   uint32(opts.Flags),
+	var rawLink *RawLink
+	err = inNetNS(opts.NetNS, func() (err error) {
+		rawLink, err = AttachRawLink(RawLinkOptions{
+			Program: opts.Program,
+			Attach:  ebpf.AttachXDP,
+			Target:  opts.Interface,
+			Flags:   uint32(opts.Flags),
+		})
+		return err
 	})
+	if err != nil {
+		if rawLink != nil {
+			rawLink.Close()
+		}
+		return nil, err
+	}
+
+	return rawLink, nil
+}
+
+// XDPLinks are the links created by AttachXDPMulti, in the order of the
+// interfaces passed to it.
+type XDPLinks []Link
+
+// Close detaches the program from all interfaces.
+//
+// All links are closed even if closing some of them fails, in which case
+// the first error is returned.
+func (xl XDPLinks) Close() error {
+	var firstErr error
+	for _, l := range xl {
+		if err := l.Close(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// AttachXDPMulti links an XDP BPF program to the XDP hooks of multiple
+// interfaces, given by name.
+//
+// If attaching to any of the interfaces fails, the program is detached from
+// the interfaces it was already attached to and the returned error identifies
+// the failing interface. Interfaces which don't support the mode requested by
+// flags, for example because their driver lacks native XDP support, return an
+// error wrapping ErrNotSupported.
+func AttachXDPMulti(program *ebpf.Program, interfaces []string, flags XDPAttachFlags) (XDPLinks, error) {
+	if len(interfaces) == 0 {
+		return nil, fmt.Errorf("no interfaces given: %w", errInvalidInput)
+	}
+
+	if modes := flags & (XDPGenericMode | XDPDriverMode | XDPOffloadMode); modes&(modes-1) != 0 {
+		return nil, fmt.Errorf("only one XDP mode can be set, got flags %#x: %w", uint32(flags), errInvalidInput)
+	}
+
+	links := make(XDPLinks, 0, len(interfaces))
+	for _, name := range interfaces {
+		iface, err := net.InterfaceByName(name)
+		if err != nil {
+			links.Close()
+			return nil, fmt.Errorf("interface %s: %w", name, err)
+		}
+
+		l, err := AttachXDP(XDPOptions{
+			Program:   program,
+			Interface: iface.Index,
+			Flags:     flags,
+		})
+		if errors.Is(err, unix.EOPNOTSUPP) {
+			err = fmt.Errorf("mode not supported by driver: %w", ErrNotSupported)
+		}
+		if err != nil {
+			links.Close()
+			return nil, fmt.Errorf("interface %s: %w", name, err)
+		}
+
+		links = append(links, l)
+	}
 
-	return rawLink, err
+	return links, nil
 }
@@ -1,10 +1,14 @@
 package link
 
 import (
+	"fmt"
+	"os"
+	"runtime"
 	"testing"
 
 	"github.com/cilium/ebpf"
 	"github.com/cilium/ebpf/internal/testutils"
+	"github.com/cilium/ebpf/internal/unix"
 )
 
 const IfIndexLO = 1
@@ -21,6 +25,133 @@ func TestAttachXDP(t *testing.T) {
 	if err != nil {
 		t.Fatal(err)
 	}
+	defer l.Close()
 
 	testLink(t, l, prog)
 }
+
+func TestAttachXDPMulti(t *testing.T) {
+	testutils.SkipOnOldKernel(t, "5.9", "BPF_LINK_TYPE_XDP")
+
+	prog := mustLoadProgram(t, ebpf.XDP, 0, "")
+
+	// Use lo of a new network namespace, which can't have a program attached
+	// by another test. For example bpffs releases links pinned by testLink
+	// asynchronously. The thread is never unlocked, so that the runtime
+	// destroys it once the test returns.
+	runtime.LockOSThread()
+	if err := unix.Unshare(unix.CLONE_NEWNET); err != nil {
+		t.Skip("Can't create network namespace:", err)
+	}
+
+	links, err := AttachXDPMulti(prog, []string{"lo"}, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(links) != 1 {
+		t.Fatal("Expected one link, got", len(links))
+	}
+	if err := links.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// Attaching twice to the same interface fails, which must detach the
+	// first link again.
+	if _, err := AttachXDPMulti(prog, []string{"lo", "lo"}, 0); err == nil {
+		t.Fatal("Attaching twice to lo doesn't fail")
+	}
+
+	links, err = AttachXDPMulti(prog, []string{"lo"}, 0)
+	if err != nil {
+		t.Fatal("Can't attach after partial failure:", err)
+	}
+	links.Close()
+
+	if _, err := AttachXDPMulti(prog, []string{"bogus-iface"}, 0); err == nil {
+		t.Error("Attaching to a missing interface doesn't fail")
+	}
+	if _, err := AttachXDPMulti(prog, []string{"lo"}, XDPGenericMode|XDPDriverMode); err == nil {
+		t.Error("Attaching with multiple modes doesn't fail")
+	}
+}
+
+func TestAttachXDPNetNS(t *testing.T) {
+	testutils.SkipOnOldKernel(t, "5.9", "BPF_LINK_TYPE_XDP")
+
+	prog := mustLoadProgram(t, ebpf.XDP, 0, "")
+	netns := mustNewNetNS(t)
+
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+
+	before := currentNetNS(t)
+
+	l, err := AttachXDP(XDPOptions{
+		Program:   prog,
+		Interface: IfIndexLO,
+		NetNS:     int(netns.Fd()),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	if after := currentNetNS(t); after != before {
+		t.Fatal("Network namespace of the thread wasn't restored")
+	}
+
+	// lo in the current namespace is a different interface, and therefore
+	// doesn't have a program attached yet.
+	l2, err := AttachXDP(XDPOptions{
+		Program:   prog,
+		Interface: IfIndexLO,
+	})
+	if err != nil {
+		t.Fatal("Can't attach to lo in the current namespace:", err)
+	}
+	l2.Close()
+}
+
+// mustNewNetNS returns a file descriptor of a new network namespace.
+func mustNewNetNS(tb testing.TB) *os.File {
+	tb.Helper()
+
+	type result struct {
+		f   *os.File
+		err error
+	}
+
+	results := make(chan result)
+	go func() {
+		// Never unlock the thread, so that the runtime destroys it once the
+		// goroutine exits.
+		runtime.LockOSThread()
+
+		if err := unix.Unshare(unix.CLONE_NEWNET); err != nil {
+			results <- result{nil, err}
+			return
+		}
+
+		f, err := os.Open(fmt.Sprintf("/proc/self/task/%d/ns/net", unix.Gettid()))
+		results <- result{f, err}
+	}()
+
+	res := <-results
+	if res.err != nil {
+		tb.Skip("Can't create network namespace:", res.err)
+	}
+	tb.Cleanup(func() { res.f.Close() })
+
+	return res.f
+}
+
+// currentNetNS identifies the network namespace of the calling thread.
+func currentNetNS(tb testing.TB) string {
+	tb.Helper()
+
+	ns, err := os.Readlink(fmt.Sprintf("/proc/self/task/%d/ns/net", unix.Gettid()))
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return ns
+}
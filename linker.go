@@ -3,6 +3,8 @@ package ebpf
 import (
 	"errors"
 	"fmt"
+	"os"
+	"path/filepath"
 	"sync"
 
 	"github.com/cilium/ebpf/asm"
@@ -160,6 +162,17 @@ func applyRelocations(insns asm.Instructions, local, target *btf.Spec) error {
 	return nil
 }
 
+// hasCORERelocations returns true if any of the instructions needs to be
+// relocated against the kernel's BTF.
+func hasCORERelocations(insns asm.Instructions) bool {
+	for i := range insns {
+		if btf.CORERelocationMetadata(&insns[i]) != nil {
+			return true
+		}
+	}
+	return false
+}
+
 // fixupAndValidate is called by the ELF reader right before marshaling the
 // instruction stream. It performs last-minute adjustments to the program and
 // runs some sanity checks before sending it off to the kernel.
@@ -202,6 +215,17 @@ func fixupProbeReadKernel(ins *asm.Instruction) {
 var kernelBTF struct {
 	sync.Mutex
 	spec *btf.Spec
+	// The BTF of kernel modules which contained a target, split from spec.
+	// Every module spec also indexes all of spec, so only modules which are
+	// actually used are kept around.
+	modules map[string]kernelModuleSpec
+}
+
+type kernelModuleSpec struct {
+	spec *btf.Spec
+	// The file in kernelBTFDir the spec was loaded from, which is recreated
+	// if the module is reloaded.
+	file os.FileInfo
 }
 
 // maybeLoadKernelBTF loads the current kernel's BTF if spec is nil, otherwise
@@ -224,3 +248,53 @@ func maybeLoadKernelBTF(spec *btf.Spec) (*btf.Spec, error) {
 	kernelBTF.spec, err = btf.LoadKernelSpec()
 	return kernelBTF.spec, err
 }
+
+// loadKernelModuleBTF loads the BTF of a kernel module, split from the cached
+// kernel BTF.
+//
+// Returns the cached BTF if the module was passed to cacheKernelModuleBTF and
+// hasn't been reloaded since. Otherwise the BTF is parsed on every call.
+func loadKernelModuleBTF(module string) (kernelModuleSpec, error) {
+	vmlinux, err := maybeLoadKernelBTF(nil)
+	if err != nil {
+		return kernelModuleSpec{}, err
+	}
+
+	fh, err := os.Open(filepath.Join(kernelBTFDir, module))
+	if err != nil {
+		return kernelModuleSpec{}, err
+	}
+	defer fh.Close()
+
+	file, err := fh.Stat()
+	if err != nil {
+		return kernelModuleSpec{}, err
+	}
+
+	kernelBTF.Lock()
+	cached, ok := kernelBTF.modules[module]
+	kernelBTF.Unlock()
+
+	if ok && os.SameFile(cached.file, file) {
+		return cached, nil
+	}
+
+	spec, err := btf.LoadSplitSpecFromReader(fh, vmlinux)
+	if err != nil {
+		return kernelModuleSpec{}, fmt.Errorf("module %s: %w", module, err)
+	}
+
+	return kernelModuleSpec{spec, file}, nil
+}
+
+// cacheKernelModuleBTF caches the BTF of a kernel module until the module is
+// reloaded.
+func cacheKernelModuleBTF(module string, spec kernelModuleSpec) {
+	kernelBTF.Lock()
+	defer kernelBTF.Unlock()
+
+	if kernelBTF.modules == nil {
+		kernelBTF.modules = make(map[string]kernelModuleSpec)
+	}
+	kernelBTF.modules[module] = spec
+}
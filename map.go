@@ -6,8 +6,12 @@ import (
 	"fmt"
 	"io"
 	"math/rand"
+	"os"
 	"path/filepath"
 	"reflect"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 	"unsafe"
 
@@ -24,6 +28,7 @@ var (
 	ErrKeyExist         = errors.New("key already exists")
 	ErrIterationAborted = errors.New("iteration aborted")
 	ErrMapIncompatible  = errors.New("map spec is incompatible with existing map")
+	ErrMapFrozen        = errors.New("map is frozen")
 	errMapNoBTFValue    = errors.New("map spec does not contain a BTF Value")
 )
 
@@ -34,6 +39,12 @@ type MapOptions struct {
 	// error is returned.
 	PinPath        string
 	LoadPinOptions LoadPinOptions
+
+	// TokenFD is a BPF token delegated by a privileged process, which
+	// allows creating maps without privileges. Zero doesn't use a token.
+	//
+	// Needs kernel 6.9+.
+	TokenFD int
 }
 
 // MapID represents the unique ID of an eBPF map
@@ -60,8 +71,21 @@ type MapSpec struct {
 	// Specify numa node during map creation
 	// (effective only if unix.BPF_F_NUMA_NODE flag is set,
 	// which can be imported from golang.org/x/sys/unix)
+	//
+	// The node must be online. Not all map types support NUMA placement,
+	// the kernel rejects the flag for example for per-CPU hash maps.
 	NumaNode uint32
 
+	// MapExtra is passed to the kernel as map_extra and has a different
+	// meaning for each map type. Only the following types use it, it must
+	// be zero for all others:
+	//
+	//   - BloomFilter: the number of hash functions in the lower four bits,
+	//     between 1 and 15. Zero uses the kernel's default of five.
+	//
+	// Ring buffers are configured via MaxEntries and Flags instead.
+	MapExtra uint64
+
 	// The initial contents of the map. May be nil.
 	Contents []MapKV
 
@@ -77,6 +101,12 @@ type MapSpec struct {
 	Extra *bytes.Reader
 
 	// The key and value type of this map. May be nil.
+	//
+	// If BTF is not nil, both types must be part of it and their sizes must
+	// match KeySize and ValueSize. They are then passed to the kernel when
+	// creating the map, which allows tools like bpftool to display typed
+	// contents. This works for maps created at runtime as well, by using
+	// types from a Spec loaded via btf.LoadSpec.
 	Key, Value btf.Type
 
 	// The BTF associated with this map.
@@ -111,6 +141,39 @@ func (ms *MapSpec) hasBTF() bool {
 	return ms.BTF != nil && ms.Type.hasBTF()
 }
 
+// checkBTFSizes returns an error if the size of Key or Value doesn't match
+// KeySize or ValueSize.
+func (ms *MapSpec) checkBTFSizes() error {
+	for _, t := range []struct {
+		name string
+		typ  btf.Type
+		size uint32
+	}{
+		{"key", ms.Key, ms.KeySize},
+		{"value", ms.Value, ms.ValueSize},
+	} {
+		if t.typ == nil {
+			return fmt.Errorf("%s type is missing", t.name)
+		}
+
+		if _, ok := t.typ.(*btf.Void); ok {
+			// The kernel doesn't know the type.
+			continue
+		}
+
+		size, err := btf.Sizeof(t.typ)
+		if err != nil {
+			return fmt.Errorf("%s type: %w", t.name, err)
+		}
+
+		if uint32(size) != t.size {
+			return fmt.Errorf("%s type %s has size %d, expected %d", t.name, t.typ, size, t.size)
+		}
+	}
+
+	return nil
+}
+
 func (ms *MapSpec) clampPerfEventArraySize() error {
 	if ms.Type != PerfEventArray {
 		return nil
@@ -179,6 +242,59 @@ func (ms *MapSpec) checkCompatibility(m *Map) error {
 	return nil
 }
 
+// NewInnerMap creates a map which can be stored in a map of maps created
+// from ms, such as an ArrayOfMaps or HashOfMaps.
+//
+// inner is usually a copy of ms.InnerMap with a different MaxEntries. The
+// kernel requires the type, key size, value size and flags of inner to match
+// the template, which is checked before creating the map. Array-like maps
+// must also match MaxEntries, unless the template has the BPF_F_INNER_MAP
+// flag (Linux 5.10+). A nil inner creates a map from the template.
+//
+// Returns an error wrapping ErrMapIncompatible if inner doesn't match.
+func (ms *MapSpec) NewInnerMap(inner *MapSpec) (*Map, error) {
+	if ms.Type != ArrayOfMaps && ms.Type != HashOfMaps {
+		return nil, fmt.Errorf("%s is not a map of maps", ms.Type)
+	}
+
+	template := ms.InnerMap
+	if template == nil {
+		return nil, fmt.Errorf("%s requires InnerMap", ms.Type)
+	}
+
+	if inner == nil {
+		inner = template
+	}
+
+	if err := template.checkInnerMap(inner); err != nil {
+		return nil, fmt.Errorf("inner map: %w", err)
+	}
+
+	return NewMap(inner)
+}
+
+// checkInnerMap returns an error if inner can't be stored in a map of maps
+// using ms as the template.
+func (ms *MapSpec) checkInnerMap(inner *MapSpec) error {
+	switch {
+	case inner.Type != ms.Type:
+		return fmt.Errorf("expected type %v, got %v: %w", ms.Type, inner.Type, ErrMapIncompatible)
+
+	case inner.KeySize != ms.KeySize:
+		return fmt.Errorf("expected key size %v, got %v: %w", ms.KeySize, inner.KeySize, ErrMapIncompatible)
+
+	case inner.ValueSize != ms.ValueSize:
+		return fmt.Errorf("expected value size %v, got %v: %w", ms.ValueSize, inner.ValueSize, ErrMapIncompatible)
+
+	case inner.Flags != ms.Flags:
+		return fmt.Errorf("expected flags %v, got %v: %w", ms.Flags, inner.Flags, ErrMapIncompatible)
+
+	case inner.MaxEntries != ms.MaxEntries && ms.Type.isArray() && ms.Flags&unix.BPF_F_INNER_MAP == 0:
+		return fmt.Errorf("expected max entries %v, got %v (template requires BPF_F_INNER_MAP to differ): %w", ms.MaxEntries, inner.MaxEntries, ErrMapIncompatible)
+	}
+	return nil
+}
+
 // Map represents a Map file descriptor.
 //
 // It is not safe to close a map which is used by other goroutines.
@@ -199,6 +315,8 @@ type Map struct {
 	pinnedPath string
 	// Per CPU maps return values larger than the size in the spec
 	fullValueSize int
+	// Memory mapping of a BPF_F_MMAPABLE map, created by Memory.
+	memory *mapMemory
 }
 
 // NewMapFromFD creates a map from a raw fd.
@@ -240,7 +358,9 @@ func NewMap(spec *MapSpec) (*Map, error) {
 // by calling rlimit.RemoveMemlock() prior to calling NewMapWithOptions.
 //
 // May return an error wrapping ErrMapIncompatible.
-func NewMapWithOptions(spec *MapSpec, opts MapOptions) (*Map, error) {
+func NewMapWithOptions(spec *MapSpec, opts MapOptions) (_ *Map, err error) {
+	defer internal.AddStackTrace(&err)
+
 	handles := newHandleCache()
 	defer handles.close()
 
@@ -367,6 +487,15 @@ func (spec *MapSpec) createMap(inner *sys.FD, opts MapOptions, handles *handleCa
 		}
 		spec.ValueSize = 4
 
+	case BloomFilter:
+		if spec.KeySize != 0 {
+			return nil, errors.New("KeySize must be zero for bloom filter")
+		}
+
+		if spec.MapExtra > 0xf {
+			return nil, fmt.Errorf("MapExtra %#x exceeds 15 hash functions for bloom filter", spec.MapExtra)
+		}
+
 	case PerfEventArray:
 		if spec.KeySize != 0 && spec.KeySize != 4 {
 			return nil, errors.New("KeySize must be zero or four for perf event array")
@@ -387,6 +516,10 @@ func (spec *MapSpec) createMap(inner *sys.FD, opts MapOptions, handles *handleCa
 		}
 	}
 
+	if spec.MapExtra != 0 && spec.Type != BloomFilter {
+		return nil, fmt.Errorf("MapExtra is not supported for %s", spec.Type)
+	}
+
 	if spec.Flags&(unix.BPF_F_RDONLY_PROG|unix.BPF_F_WRONLY_PROG) > 0 || spec.Freeze {
 		if err := haveMapMutabilityModifiers(); err != nil {
 			return nil, fmt.Errorf("map create: %w", err)
@@ -407,6 +540,16 @@ func (spec *MapSpec) createMap(inner *sys.FD, opts MapOptions, handles *handleCa
 			return nil, fmt.Errorf("map create: %w", err)
 		}
 	}
+	if spec.Flags&unix.BPF_F_NUMA_NODE > 0 {
+		if err := checkNUMANode(spec.NumaNode); err != nil {
+			return nil, fmt.Errorf("map create: %w", err)
+		}
+	}
+	if opts.TokenFD != 0 {
+		if err := haveBPFToken(); err != nil {
+			return nil, fmt.Errorf("map create: %w", err)
+		}
+	}
 
 	attr := sys.MapCreateAttr{
 		MapType:    sys.MapType(spec.Type),
@@ -415,6 +558,7 @@ func (spec *MapSpec) createMap(inner *sys.FD, opts MapOptions, handles *handleCa
 		MaxEntries: spec.MaxEntries,
 		MapFlags:   spec.Flags,
 		NumaNode:   spec.NumaNode,
+		MapExtra:   spec.MapExtra,
 	}
 
 	if inner != nil {
@@ -426,20 +570,24 @@ func (spec *MapSpec) createMap(inner *sys.FD, opts MapOptions, handles *handleCa
 	}
 
 	if spec.hasBTF() {
-		handle, err := handles.btfHandle(spec.BTF)
+		handle, err := handles.btfHandle(spec.BTF, opts.TokenFD)
 		if err != nil && !errors.Is(err, btf.ErrNotSupported) {
 			return nil, fmt.Errorf("load BTF: %w", err)
 		}
 
 		if handle != nil {
+			if err := spec.checkBTFSizes(); err != nil {
+				return nil, err
+			}
+
 			keyTypeID, err := spec.BTF.TypeID(spec.Key)
 			if err != nil {
-				return nil, err
+				return nil, fmt.Errorf("key type: %w", err)
 			}
 
 			valueTypeID, err := spec.BTF.TypeID(spec.Value)
 			if err != nil {
-				return nil, err
+				return nil, fmt.Errorf("value type: %w", err)
 			}
 
 			attr.BtfFd = uint32(handle.FD())
@@ -448,7 +596,16 @@ func (spec *MapSpec) createMap(inner *sys.FD, opts MapOptions, handles *handleCa
 		}
 	}
 
-	fd, err := sys.MapCreate(&attr)
+	var fd *sys.FD
+	if opts.TokenFD != 0 {
+		attr.MapFlags |= sys.BPF_F_TOKEN_FD
+		fd, err = sys.MapCreateToken(&sys.MapCreateTokenAttr{
+			MapCreateAttr: attr,
+			MapTokenFd:    int32(opts.TokenFD),
+		})
+	} else {
+		fd, err = sys.MapCreate(&attr)
+	}
 	if err != nil {
 		if errors.Is(err, unix.EPERM) {
 			return nil, fmt.Errorf("map create: %w (MEMLOCK may be too low, consider rlimit.RemoveMemlock)", err)
@@ -481,6 +638,7 @@ func newMap(fd *sys.FD, name string, typ MapType, keySize, valueSize, maxEntries
 		flags,
 		"",
 		int(valueSize),
+		&mapMemory{},
 	}
 
 	if !typ.hasPerCPUValue() {
@@ -530,7 +688,12 @@ func (m *Map) Flags() uint32 {
 
 // Info returns metadata about the map.
 func (m *Map) Info() (*MapInfo, error) {
-	return newMapInfoFromFd(m.fd)
+	info, err := newMapInfoFromFd(m.fd)
+	if err != nil {
+		return nil, err
+	}
+	info.Memlock = mapMemlock(m.fd)
+	return info, nil
 }
 
 // MapLookupFlags controls the behaviour of the map lookup calls.
@@ -554,6 +717,215 @@ func (m *Map) Lookup(key, valueOut interface{}) error {
 	return m.unmarshalValue(valueOut, valueBytes)
 }
 
+// LookupOK retrieves a value from a Map, and reports whether the key exists.
+//
+// Unlike Lookup, a missing key isn't treated as an error: LookupOK returns
+// false and leaves valueOut untouched in that case.
+func (m *Map) LookupOK(key, valueOut interface{}) (bool, error) {
+	err := m.Lookup(key, valueOut)
+	if errors.Is(err, ErrKeyNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// LookupCPU retrieves the value of key for a single CPU from a map with
+// per-CPU values, and decodes it into valueOut. valueOut is a pointer to the
+// value of a single CPU, not to a slice.
+//
+// The kernel always copies the values of all CPUs, so LookupCPU isn't
+// cheaper than Lookup. There is no counterpart for updates: Update and Put
+// always write the values of all CPUs.
+//
+// Returns an error if cpu isn't a possible CPU, and ErrKeyNotExist if the key
+// doesn't exist.
+func (m *Map) LookupCPU(key interface{}, cpu int, valueOut interface{}) error {
+	if !m.typ.hasPerCPUValue() {
+		return fmt.Errorf("%s doesn't have per-CPU values", m.typ)
+	}
+
+	possibleCPUs, err := internal.PossibleCPUs()
+	if err != nil {
+		return err
+	}
+	if cpu < 0 || cpu >= possibleCPUs {
+		return fmt.Errorf("cpu %d is out of range of %d possible CPUs", cpu, possibleCPUs)
+	}
+
+	valueBytes := make([]byte, m.fullValueSize)
+	if err := m.lookup(key, sys.NewSlicePointer(valueBytes), 0); err != nil {
+		return err
+	}
+
+	step := m.fullValueSize / possibleCPUs
+	elem := valueBytes[cpu*step : cpu*step+int(m.valueSize)]
+	return unmarshalBytes(valueOut, elem)
+}
+
+// Contains reports whether key exists in the Map.
+//
+// The kernel always copies the value of an existing key to user space, but
+// Contains doesn't decode it. This makes it cheaper than Lookup for maps with
+// large values.
+//
+// For a BloomFilter, which has no keys, Contains reports whether the given
+// value may have been added to the filter. False positives are possible.
+func (m *Map) Contains(key interface{}) (bool, error) {
+	var err error
+	if m.typ == BloomFilter {
+		var valuePtr sys.Pointer
+		valuePtr, err = m.marshalValue(key)
+		if err != nil {
+			return false, fmt.Errorf("can't marshal value: %w", err)
+		}
+		err = m.lookup(nil, valuePtr, 0)
+	} else {
+		valueBytes := make([]byte, m.fullValueSize)
+		err = m.lookup(key, sys.NewSlicePointer(valueBytes), 0)
+	}
+	if errors.Is(err, ErrKeyNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
+// LookupPartial retrieves a part of the value of a key, starting at offset.
+//
+// The kernel always copies the full value, so the value is looked up into a
+// temporary buffer and only the requested part is copied into out. This
+// avoids decoding or keeping around the full value when only a prefix, e.g.
+// a header, is of interest.
+//
+// Returns the number of bytes copied into out, which is less than len(out)
+// if the value ends before offset+len(out). Returns an error if the map has
+// per-CPU values or if offset is outside of the value.
+func (m *Map) LookupPartial(key interface{}, out []byte, offset int) (int, error) {
+	if m.typ.hasPerCPUValue() {
+		return 0, fmt.Errorf("map type %s doesn't support partial lookups", m.typ)
+	}
+
+	if offset < 0 || offset > int(m.valueSize) {
+		return 0, fmt.Errorf("offset %d is outside of value of size %d", offset, m.valueSize)
+	}
+
+	valueBytes := make([]byte, m.fullValueSize)
+	if err := m.lookup(key, sys.NewSlicePointer(valueBytes), 0); err != nil {
+		return 0, err
+	}
+
+	return copy(out, valueBytes[offset:]), nil
+}
+
+// LookupPerCPU retrieves the values of a key in a per-CPU map.
+//
+// valuesOut must be a pointer to a slice, which is resized to hold one value
+// for each possible CPU.
+//
+// Returns an error if the map doesn't have per-CPU values.
+func (m *Map) LookupPerCPU(key, valuesOut interface{}) error {
+	if !m.typ.hasPerCPUValue() {
+		return fmt.Errorf("map type %s doesn't have per-CPU values", m.typ)
+	}
+
+	return m.Lookup(key, valuesOut)
+}
+
+// SumPerCPU retrieves the values of a key in a per-CPU map and writes
+// their sum to valueOut.
+//
+// valueOut must be a pointer to an integer or floating point number, or to
+// a struct or array made up of those. Values of structs and arrays are summed
+// field by field, respectively element by element.
+//
+// Returns an error if the map doesn't have per-CPU values.
+func (m *Map) SumPerCPU(key, valueOut interface{}) error {
+	if !m.typ.hasPerCPUValue() {
+		return fmt.Errorf("map type %s doesn't have per-CPU values", m.typ)
+	}
+
+	out := reflect.ValueOf(valueOut)
+	if out.Kind() != reflect.Ptr || out.IsNil() {
+		return fmt.Errorf("valueOut must be a non-nil pointer, got %T", valueOut)
+	}
+
+	sum := reflect.New(out.Type().Elem()).Elem()
+	if err := checkSummable(sum.Type()); err != nil {
+		return err
+	}
+
+	values := reflect.New(reflect.SliceOf(sum.Type()))
+	if err := m.Lookup(key, values.Interface()); err != nil {
+		return err
+	}
+
+	for i := 0; i < values.Elem().Len(); i++ {
+		addValue(sum, values.Elem().Index(i))
+	}
+
+	out.Elem().Set(sum)
+	return nil
+}
+
+// checkSummable returns an error if addValue can't handle typ.
+func checkSummable(typ reflect.Type) error {
+	switch typ.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return nil
+
+	case reflect.Array:
+		return checkSummable(typ.Elem())
+
+	case reflect.Struct:
+		for i := 0; i < typ.NumField(); i++ {
+			field := typ.Field(i)
+			if field.PkgPath != "" {
+				return fmt.Errorf("can't sum unexported field %s of %s", field.Name, typ)
+			}
+			if err := checkSummable(field.Type); err != nil {
+				return fmt.Errorf("field %s: %w", field.Name, err)
+			}
+		}
+		return nil
+
+	default:
+		return fmt.Errorf("can't sum values of type %s", typ)
+	}
+}
+
+// addValue adds src to dst, which must have been validated by checkSummable.
+func addValue(dst, src reflect.Value) {
+	switch dst.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		dst.SetInt(dst.Int() + src.Int())
+
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		dst.SetUint(dst.Uint() + src.Uint())
+
+	case reflect.Float32, reflect.Float64:
+		dst.SetFloat(dst.Float() + src.Float())
+
+	case reflect.Array:
+		for i := 0; i < dst.Len(); i++ {
+			addValue(dst.Index(i), src.Index(i))
+		}
+
+	case reflect.Struct:
+		for i := 0; i < dst.NumField(); i++ {
+			addValue(dst.Field(i), src.Field(i))
+		}
+	}
+}
+
 // LookupWithFlags retrieves a value from a Map with flags.
 //
 // Passing LookupLock flag will look up the value of a spin-locked
@@ -670,6 +1042,36 @@ func (m *Map) Put(key, value interface{}) error {
 	return m.Update(key, value, UpdateAny)
 }
 
+// Insert creates a value in the map.
+//
+// It is equivalent to calling Update with UpdateNoExist. Returns an error
+// wrapping ErrKeyExist if the key already exists, which is always the case
+// for array based maps.
+func (m *Map) Insert(key, value interface{}) error {
+	if err := m.Update(key, value, UpdateNoExist); err != nil {
+		return fmt.Errorf("insert: %w", err)
+	}
+	return nil
+}
+
+// Replace changes the value of an existing key.
+//
+// It is equivalent to calling Update with UpdateExist. Returns an error
+// wrapping ErrKeyNotExist if the key doesn't exist.
+func (m *Map) Replace(key, value interface{}) error {
+	if err := m.Update(key, value, UpdateExist); err != nil {
+		return fmt.Errorf("replace: %w", err)
+	}
+	return nil
+}
+
+// Upsert replaces or creates a value in the map.
+//
+// It is equivalent to Put.
+func (m *Map) Upsert(key, value interface{}) error {
+	return m.Put(key, value)
+}
+
 // Update changes the value of a key.
 func (m *Map) Update(key, value interface{}, flags MapUpdateFlags) error {
 	keyPtr, err := m.marshalKey(key)
@@ -696,6 +1098,48 @@ func (m *Map) Update(key, value interface{}, flags MapUpdateFlags) error {
 	return nil
 }
 
+// Add inserts a value into a BloomFilter.
+//
+// Returns an error if the Map isn't a BloomFilter.
+func (m *Map) Add(value interface{}) error {
+	if m.typ != BloomFilter {
+		return fmt.Errorf("can't add values to %s, only to %s", m.typ, BloomFilter)
+	}
+
+	return m.Update(nil, value, UpdateAny)
+}
+
+// Push adds a value to a Queue or Stack.
+//
+// Returns an error if the map is full.
+func (m *Map) Push(value interface{}) error {
+	if m.typ != Queue && m.typ != Stack {
+		return fmt.Errorf("can't push to %s, only to %s and %s", m.typ, Queue, Stack)
+	}
+
+	return m.Update(nil, value, UpdateAny)
+}
+
+// Pop removes the next value from a Queue or Stack and stores it in valueOut.
+//
+// Queues return values in the order they were pushed, stacks return the most
+// recently pushed value first. Returns false and no error if the map is empty.
+func (m *Map) Pop(valueOut interface{}) (bool, error) {
+	if m.typ != Queue && m.typ != Stack {
+		return false, fmt.Errorf("can't pop from %s, only from %s and %s", m.typ, Queue, Stack)
+	}
+
+	err := m.LookupAndDelete(nil, valueOut)
+	if errors.Is(err, ErrKeyNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
+
 // Delete removes a value.
 //
 // Returns ErrKeyNotExist if the key does not exist.
@@ -716,6 +1160,164 @@ func (m *Map) Delete(key interface{}) error {
 	return nil
 }
 
+// UpdateProgram stores prog at index in a ProgramArray, atomically replacing
+// any program previously stored at that index.
+//
+// Returns an error if the program's type differs from the type of the program
+// it replaces. The kernel additionally rejects programs which are incompatible
+// with the programs already stored in the array.
+func (m *Map) UpdateProgram(index uint32, prog *Program) error {
+	if !m.typ.canStoreProgram() {
+		return fmt.Errorf("can't store program in %s", m.typ)
+	}
+
+	if prog == nil {
+		return errors.New("can't store nil program")
+	}
+
+	// Looking up a ProgramArray requires at least 4.12 and privileges to
+	// open the program by ID. Leave validation to the kernel in that case.
+	var old *Program
+	if err := m.Lookup(index, &old); err == nil {
+		defer old.Close()
+
+		if old.Type() != prog.Type() {
+			return fmt.Errorf("program type %s doesn't match type %s of program at index %d", prog.Type(), old.Type(), index)
+		}
+	}
+
+	return m.Update(index, prog, UpdateAny)
+}
+
+// DeleteProgram removes the program stored at index in a ProgramArray.
+//
+// Returns ErrKeyNotExist if no program is stored at index.
+func (m *Map) DeleteProgram(index uint32) error {
+	if !m.typ.canStoreProgram() {
+		return fmt.Errorf("can't delete program from %s", m.typ)
+	}
+
+	return m.Delete(index)
+}
+
+// Clear removes all entries from the map.
+//
+// The behaviour depends on the type of the map:
+//   - Array and PerCPUArray elements can't be deleted, so every element is
+//     overwritten with zeroes instead.
+//   - Arrays of file descriptors or references, like ProgramArray, DevMap or
+//     SockMap, are cleared by deleting every index once.
+//   - For all other maps keys are collected in chunks and removed using
+//     BPF_MAP_DELETE_BATCH. Kernels or map types which don't support batch
+//     operations fall back to deleting keys one by one.
+//
+// Clear is not atomic. Entries added concurrently may or may not be removed.
+func (m *Map) Clear() error {
+	if m.typ == Array || m.typ == PerCPUArray {
+		return m.clearArray()
+	}
+
+	if m.typ.hasEmptyArraySlots() {
+		// Iterating these maps returns indices of empty slots as well, so
+		// the loop below would never terminate.
+		return m.clearArraySlots()
+	}
+
+	keys := make([]byte, 0, clearBatchSize*int(m.keySize))
+	for {
+		keys = keys[:0]
+
+		// Deleting elements invalidates the position of the iterator, so
+		// always start from the first key.
+		var key interface{}
+		for len(keys) < cap(keys) {
+			next, err := m.NextKeyBytes(key)
+			if err != nil {
+				return fmt.Errorf("clear: %w", err)
+			}
+			if next == nil {
+				break
+			}
+
+			keys = append(keys, next...)
+			key = next
+		}
+
+		if len(keys) == 0 {
+			return nil
+		}
+
+		if err := m.deleteKeys(keys); err != nil {
+			return fmt.Errorf("clear: %w", err)
+		}
+	}
+}
+
+// clearBatchSize is the number of keys removed at once by Clear.
+const clearBatchSize = 256
+
+// deleteKeys removes a buffer of consecutive marshaled keys from the map.
+func (m *Map) deleteKeys(keys []byte) error {
+	count := len(keys) / int(m.keySize)
+
+	if haveBatchAPI() == nil {
+		attr := sys.MapDeleteBatchAttr{
+			MapFd: m.fd.Uint(),
+			Keys:  sys.NewSlicePointer(keys),
+			Count: uint32(count),
+		}
+
+		err := sys.MapDeleteBatch(&attr)
+		if err == nil || errors.Is(err, unix.ENOENT) {
+			// ENOENT means that a key was removed concurrently, which is
+			// fine since the outer loop retries from the start.
+			return nil
+		}
+		if !errors.Is(err, unix.EINVAL) && !errors.Is(err, unix.ENOTSUPP) {
+			return fmt.Errorf("batch delete: %w", wrapMapError(err))
+		}
+		// Some map types don't implement batch operations.
+	}
+
+	for i := 0; i < count; i++ {
+		key := keys[i*int(m.keySize) : (i+1)*int(m.keySize)]
+		if err := m.Delete(key); err != nil && !errors.Is(err, ErrKeyNotExist) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// clearArraySlots deletes every index of an array with empty slots.
+func (m *Map) clearArraySlots() error {
+	for i := uint32(0); i < m.maxEntries; i++ {
+		if err := m.Delete(i); err != nil && !errors.Is(err, ErrKeyNotExist) {
+			return fmt.Errorf("clear: index %d: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+// clearArray overwrites every element of an array with zeroes.
+func (m *Map) clearArray() error {
+	attr := sys.MapUpdateElemAttr{
+		MapFd: m.fd.Uint(),
+		Value: sys.NewSlicePointer(make([]byte, m.fullValueSize)),
+	}
+
+	var key uint32
+	attr.Key = sys.NewPointer(unsafe.Pointer(&key))
+	for key = 0; key < m.maxEntries; key++ {
+		if err := sys.MapUpdateElem(&attr); err != nil {
+			return fmt.Errorf("clear index %d: %w", key, wrapMapError(err))
+		}
+	}
+
+	return nil
+}
+
 // NextKey finds the key following an initial key.
 //
 // See NextKeyBytes for details.
@@ -753,6 +1355,170 @@ func (m *Map) NextKeyBytes(key interface{}) ([]byte, error) {
 	return nextKey, err
 }
 
+// NextKeys returns up to n keys following startKey, for paging through a map
+// without holding all of its keys in memory.
+//
+// startKey is either nil, a key or a cursor returned by a previous call. keys
+// is a slice whose element type is the type of startKey, or []byte if
+// startKey is nil. Pass a nil pointer of the key type, for example
+// (*uint32)(nil), to receive typed keys starting at the first key. Keys
+// following a cursor have the same type as the keys of the previous call.
+//
+// The keys are looked up in batches if the kernel supports it, otherwise one
+// key at a time. nextCursor is nil once the end of the map has been reached.
+// As with Keys, the result is inconsistent if the map is modified
+// concurrently.
+func (m *Map) NextKeys(startKey interface{}, n int) (keys interface{}, nextCursor interface{}, err error) {
+	if n <= 0 {
+		return nil, nil, fmt.Errorf("n must be positive")
+	}
+
+	cur, err := m.nextKeysCursor(startKey)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var (
+		buf   []byte
+		count int
+		next  *keysCursor
+	)
+	if cur.key == nil || cur.batch != nil {
+		buf, count, next, err = m.nextKeysBatch(cur, n)
+	}
+	if buf == nil && err == nil {
+		buf, count, next, err = m.nextKeysOneByOne(cur, n)
+	}
+	if err != nil {
+		return nil, nil, err
+	}
+
+	out := reflect.MakeSlice(reflect.SliceOf(cur.typ), count, count)
+	for i := 0; i < count; i++ {
+		key := buf[i*int(m.keySize) : (i+1)*int(m.keySize)]
+		if err := m.unmarshalKey(out.Index(i).Addr().Interface(), key); err != nil {
+			return nil, nil, fmt.Errorf("can't unmarshal key: %w", err)
+		}
+	}
+
+	if next == nil {
+		return out.Interface(), nil, nil
+	}
+	return out.Interface(), next, nil
+}
+
+// keysCursor is the cursor returned by NextKeys.
+type keysCursor struct {
+	// The type of the returned keys.
+	typ reflect.Type
+	// The last returned key, nil if starting at the first key.
+	key []byte
+	// The batch to continue with, nil if keys are looked up one by one.
+	batch []byte
+}
+
+func (m *Map) nextKeysCursor(startKey interface{}) (*keysCursor, error) {
+	if cur, ok := startKey.(*keysCursor); ok {
+		return cur, nil
+	}
+
+	if startKey == nil {
+		return &keysCursor{typ: reflect.TypeOf([]byte(nil))}, nil
+	}
+
+	value := reflect.ValueOf(startKey)
+	if value.Kind() == reflect.Ptr && value.IsNil() {
+		return &keysCursor{typ: value.Type().Elem()}, nil
+	}
+
+	key, err := marshalBytes(startKey, int(m.keySize))
+	if err != nil {
+		return nil, fmt.Errorf("can't marshal key: %w", err)
+	}
+
+	typ := value.Type()
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+
+	return &keysCursor{typ: typ, key: key}, nil
+}
+
+// batchTokenSize returns the size of the buffer for the token which
+// BPF_MAP_LOOKUP_BATCH uses to continue a batch. Hash maps use a u32 bucket
+// index as the token, which may be larger than the key.
+func (m *Map) batchTokenSize() int {
+	if m.keySize < 4 {
+		return 4
+	}
+	return int(m.keySize)
+}
+
+// nextKeysBatch looks up the keys following cur using BPF_MAP_LOOKUP_BATCH.
+//
+// Returns a nil buffer and no error if the batch API isn't available for the
+// map, or if the next batch holds more than n keys.
+func (m *Map) nextKeysBatch(cur *keysCursor, n int) ([]byte, int, *keysCursor, error) {
+	if haveBatchAPI() != nil || m.typ.hasPerCPUValue() {
+		return nil, 0, nil, nil
+	}
+
+	keyBuf := make([]byte, n*int(m.keySize))
+	valueBuf := make([]byte, n*int(m.fullValueSize))
+	nextBatch := make([]byte, m.batchTokenSize())
+
+	attr := sys.MapLookupBatchAttr{
+		MapFd:    m.fd.Uint(),
+		Keys:     sys.NewSlicePointer(keyBuf),
+		Values:   sys.NewSlicePointer(valueBuf),
+		Count:    uint32(n),
+		OutBatch: sys.NewSlicePointer(nextBatch),
+	}
+	if cur.batch != nil {
+		attr.InBatch = sys.NewSlicePointer(cur.batch)
+	}
+
+	_, err := sys.BPF(sys.BPF_MAP_LOOKUP_BATCH, unsafe.Pointer(&attr), unsafe.Sizeof(attr))
+	err = wrapMapError(err)
+	if errors.Is(err, ErrNotSupported) || errors.Is(err, unix.ENOSPC) {
+		return nil, 0, nil, nil
+	}
+	count := int(attr.Count)
+	if errors.Is(err, ErrKeyNotExist) || (err == nil && count == 0) {
+		return keyBuf, count, nil, nil
+	}
+	if err != nil {
+		return nil, 0, nil, fmt.Errorf("batch lookup: %w", err)
+	}
+
+	last := keyBuf[(count-1)*int(m.keySize) : count*int(m.keySize)]
+	return keyBuf, count, &keysCursor{cur.typ, last, nextBatch}, nil
+}
+
+// nextKeysOneByOne looks up the keys following cur using BPF_MAP_GET_NEXT_KEY.
+func (m *Map) nextKeysOneByOne(cur *keysCursor, n int) ([]byte, int, *keysCursor, error) {
+	keyBuf := make([]byte, n*int(m.keySize))
+
+	var prev interface{}
+	if cur.key != nil {
+		prev = cur.key
+	}
+
+	for i := 0; i < n; i++ {
+		key := keyBuf[i*int(m.keySize) : (i+1)*int(m.keySize)]
+		err := m.nextKey(prev, sys.NewSlicePointer(key))
+		if errors.Is(err, ErrKeyNotExist) {
+			return keyBuf, i, nil, nil
+		}
+		if err != nil {
+			return nil, 0, nil, err
+		}
+		prev = key
+	}
+
+	return keyBuf, n, &keysCursor{cur.typ, keyBuf[(n-1)*int(m.keySize):], nil}, nil
+}
+
 func (m *Map) nextKey(key interface{}, nextKeyOut sys.Pointer) error {
 	var (
 		keyPtr sys.Pointer
@@ -937,7 +1703,12 @@ func (m *Map) batchLookup(cmd sys.Cmd, startKey, nextKeyOut, keysOut, valuesOut
 // BatchUpdate updates the map with multiple keys and values
 // simultaneously.
 // "keys" and "values" must be of type slice, a pointer
-// to a slice or buffer will not work.
+// to a slice or buffer will not work. They must have the same length, and
+// their elements must match the key and value size of the map.
+//
+// Returns the number of elements which were written. The kernel stops at the
+// first element it fails to update, in which case the count is smaller than
+// the length of keys and an error is returned alongside it.
 func (m *Map) BatchUpdate(keys, values interface{}, opts *BatchOptions) (int, error) {
 	if err := haveBatchAPI(); err != nil {
 		return 0, err
@@ -959,7 +1730,7 @@ func (m *Map) BatchUpdate(keys, values interface{}, opts *BatchOptions) (int, er
 		err      error
 	)
 	if count != valuesValue.Len() {
-		return 0, fmt.Errorf("keys and values must be the same length")
+		return 0, fmt.Errorf("keys and values must be the same length: %d != %d", count, valuesValue.Len())
 	}
 	keyPtr, err := marshalPtr(keys, count*int(m.keySize))
 	if err != nil {
@@ -1031,11 +1802,72 @@ func (m *Map) BatchDelete(keys interface{}, opts *BatchOptions) (int, error) {
 // It's safe to create multiple iterators at the same time.
 //
 // It's not possible to guarantee that all keys in a map will be
-// returned if there are concurrent modifications to the map.
+// returned if there are concurrent modifications to the map. See
+// IterateSnapshot for an alternative which is less prone to this.
 func (m *Map) Iterate() *MapIterator {
 	return newMapIterator(m)
 }
 
+// IterateSnapshot traverses a copy of the map, which is made using
+// BPF_MAP_LOOKUP_BATCH on the first call to MapIterator.Next.
+//
+// The kernel copies the map a bucket at a time, so concurrent modifications
+// only affect the entries of the bucket being copied. This reduces the window
+// in which updates and LRU evictions cause keys to be missed, but doesn't
+// eliminate it: the result is still best effort for maps which are modified
+// concurrently.
+//
+// Iteration fails with an error wrapping ErrNotSupported if the kernel
+// doesn't support batch lookups (before Linux 5.6) or the map has per-CPU
+// values.
+func (m *Map) IterateSnapshot() *MapIterator {
+	return &MapIterator{target: m, useSnapshot: true}
+}
+
+// Keys returns an iterator over the keys of the Map, which doesn't look up
+// their values.
+func (m *Map) Keys() *KeyIterator {
+	return newKeyIterator(m)
+}
+
+// KeyCount returns the number of keys in the Map.
+//
+// The count is obtained by iterating all keys, see Keys. It may be out of
+// date by the time it is returned if the map is modified concurrently, and
+// keys may be counted more than once if keys are deleted concurrently.
+func (m *Map) KeyCount() (int, error) {
+	var (
+		key   []byte
+		count int
+	)
+
+	keys := m.Keys()
+	for keys.Next(&key) {
+		count++
+	}
+
+	return count, keys.Err()
+}
+
+// ElementCount returns the number of elements in the Map.
+//
+// The kernel doesn't report how many elements a map contains, except for
+// Array and PerCPUArray where every index always holds an element. For other
+// map types the elements are counted by iterating all keys with KeyCount,
+// which needs one syscall per element. This scan is only performed if
+// allowScan is true, otherwise an error wrapping ErrNotSupported is returned.
+func (m *Map) ElementCount(allowScan bool) (int, error) {
+	if m.typ == Array || m.typ == PerCPUArray {
+		return int(m.maxEntries), nil
+	}
+
+	if !allowScan {
+		return 0, fmt.Errorf("element count of %s requires a scan of all keys: %w", m.typ, ErrNotSupported)
+	}
+
+	return m.KeyCount()
+}
+
 // Close removes a Map
 func (m *Map) Close() error {
 	if m == nil {
@@ -1044,6 +1876,10 @@ func (m *Map) Close() error {
 		return nil
 	}
 
+	if m.memory != nil {
+		m.memory.unmap()
+	}
+
 	return m.fd.Close()
 }
 
@@ -1081,6 +1917,7 @@ func (m *Map) Clone() (*Map, error) {
 		m.flags,
 		"",
 		m.fullValueSize,
+		&mapMemory{},
 	}, nil
 }
 
@@ -1118,9 +1955,54 @@ func (m *Map) IsPinned() bool {
 	return m.pinnedPath != ""
 }
 
+// PollDeadline blocks until the map has data available, or until the deadline
+// expires. A zero deadline blocks indefinitely.
+//
+// Only ring buffers can be polled via the map itself. Readiness of a perf
+// event array is signalled by its per-CPU perf events instead, which are
+// managed by perf.Reader. Polling any other map type returns an error.
+//
+// Returns false if the deadline expired before data became available.
+func (m *Map) PollDeadline(t time.Time) (bool, error) {
+	if m.typ != RingBuf {
+		return false, fmt.Errorf("can't poll map of type %s", m.typ)
+	}
+
+	fds := []unix.PollFd{{Fd: int32(m.fd.Int()), Events: unix.POLLIN}}
+	for {
+		timeout := -1
+		if !t.IsZero() {
+			timeout = 0
+			if d := t.Sub(internal.Now()); d > 0 {
+				// Round up, otherwise poll returns early.
+				timeout = int((d + time.Millisecond - 1) / time.Millisecond)
+			}
+		}
+
+		n, err := unix.Poll(fds, timeout)
+		if errors.Is(err, unix.EINTR) {
+			continue
+		}
+		if err != nil {
+			return false, fmt.Errorf("poll map: %w", err)
+		}
+
+		if n > 0 {
+			return true, nil
+		}
+
+		if timeout == 0 || !internal.Now().Before(t) {
+			return false, nil
+		}
+	}
+}
+
 // Freeze prevents a map to be modified from user space.
 //
 // It makes no changes to kernel-side restrictions.
+//
+// Returns ErrMapFrozen if the map is already frozen, and ErrNotSupported
+// if the map type can't be frozen.
 func (m *Map) Freeze() error {
 	if err := haveMapMutabilityModifiers(); err != nil {
 		return fmt.Errorf("can't freeze map: %w", err)
@@ -1130,12 +2012,147 @@ func (m *Map) Freeze() error {
 		MapFd: m.fd.Uint(),
 	}
 
-	if err := sys.MapFreeze(&attr); err != nil {
-		return fmt.Errorf("can't freeze map: %w", err)
+	err := sys.MapFreeze(&attr)
+	if errors.Is(err, unix.EPERM) || errors.Is(err, unix.EBUSY) {
+		// The kernel returns EPERM for frozen maps since they are no longer
+		// writable, and EBUSY for concurrent freezes or writable mmaps.
+		if m.isFrozen() {
+			return fmt.Errorf("can't freeze map: %w", ErrMapFrozen)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("can't freeze map: %w", wrapMapError(err))
 	}
 	return nil
 }
 
+// isFrozen returns true if the kernel reports the map as frozen.
+func (m *Map) isFrozen() bool {
+	var frozen int
+	if err := scanFdInfo(m.fd, map[string]interface{}{"frozen": &frozen}); err != nil {
+		return false
+	}
+	return frozen != 0
+}
+
+type mapMemory struct {
+	mu     sync.Mutex
+	b      []byte
+	err    error
+	closed bool
+}
+
+// unmap releases the mapping, after which Memory returns an error.
+func (mm *mapMemory) unmap() {
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+
+	if mm.b != nil {
+		_ = unix.Munmap(mm.b)
+		mm.b = nil
+	}
+	mm.closed = true
+}
+
+// Memory returns the contents of an Array created with BPF_F_MMAPABLE, mapped
+// into the address space of the process. Reading from the slice doesn't
+// require a syscall, and reflects concurrent updates from eBPF programs.
+//
+// Each value occupies ValueSize rounded up to a multiple of 8 bytes, so the
+// value at index i starts at i*ceil(ValueSize/8)*8. Use atomic operations or
+// bpf_spin_lock to avoid reading torn values.
+//
+// The memory is mapped read-only: writing to the slice crashes the process.
+// It remains valid until the Map is closed, which unmaps it. The caller must
+// ensure that the slice isn't accessed concurrently with or after Close,
+// since that crashes the process as well. Clones of a Map must call Memory
+// separately.
+func (m *Map) Memory() ([]byte, error) {
+	if m.typ != Array {
+		return nil, fmt.Errorf("can't mmap %s: only arrays can be memory mapped", m.typ)
+	}
+
+	if m.flags&unix.BPF_F_MMAPABLE == 0 {
+		return nil, errors.New("can't mmap array: map wasn't created with BPF_F_MMAPABLE")
+	}
+
+	mm := m.memory
+	mm.mu.Lock()
+	defer mm.mu.Unlock()
+
+	if mm.closed {
+		return nil, errors.New("can't mmap array: map is closed")
+	}
+
+	if mm.b == nil && mm.err == nil {
+		size := internal.Align(int(m.valueSize), 8) * int(m.maxEntries)
+		b, err := unix.Mmap(m.fd.Int(), 0, internal.Align(size, os.Getpagesize()), unix.PROT_READ, unix.MAP_SHARED)
+		if err != nil {
+			mm.err = fmt.Errorf("can't mmap array: %w", err)
+		} else {
+			mm.b = b[:size]
+		}
+	}
+
+	return mm.b, mm.err
+}
+
+// checkNUMANode returns an error if node isn't an online NUMA node.
+//
+// Validation is left to the kernel if sysfs doesn't expose NUMA topology.
+func checkNUMANode(node uint32) error {
+	const online = "/sys/devices/system/node/online"
+
+	list, err := os.ReadFile(online)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	ok, err := nodeListContains(string(list), node)
+	if err != nil {
+		return fmt.Errorf("can't parse %s: %w", online, err)
+	}
+	if !ok {
+		return fmt.Errorf("NUMA node %d doesn't exist or is offline", node)
+	}
+	return nil
+}
+
+// nodeListContains returns true if node is part of a list like "0-2,4", as
+// produced by bitmap_list_string() in the Linux kernel.
+func nodeListContains(list string, node uint32) (bool, error) {
+	list = strings.TrimSpace(list)
+	if list == "" {
+		return false, nil
+	}
+
+	for _, r := range strings.Split(list, ",") {
+		bounds := strings.SplitN(r, "-", 2)
+
+		low, err := strconv.ParseUint(bounds[0], 10, 32)
+		if err != nil {
+			return false, fmt.Errorf("invalid range %q", r)
+		}
+
+		high := low
+		if len(bounds) == 2 {
+			high, err = strconv.ParseUint(bounds[1], 10, 32)
+			if err != nil || high < low {
+				return false, fmt.Errorf("invalid range %q", r)
+			}
+		}
+
+		if low <= uint64(node) && uint64(node) <= high {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
 // finalize populates the Map according to the Contents specified
 // in spec and freezes the Map if requested by spec.
 func (m *Map) finalize(spec *MapSpec) error {
@@ -1286,6 +2303,27 @@ func LoadPinnedMap(fileName string, opts *LoadPinOptions) (*Map, error) {
 	return m, err
 }
 
+// LoadPinnedMapTyped loads a Map from a BPF file and checks that it is
+// compatible with expect.
+//
+// The type, key and value size, maximum number of entries and flags of the
+// pinned map must match expect. This prevents using an incompatible map pinned
+// by a different version of a program. Returns an error wrapping
+// ErrMapIncompatible otherwise.
+func LoadPinnedMapTyped(fileName string, expect *MapSpec, opts *LoadPinOptions) (*Map, error) {
+	m, err := LoadPinnedMap(fileName, opts)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := expect.checkCompatibility(m); err != nil {
+		m.Close()
+		return nil, fmt.Errorf("use pinned map %s: %w", fileName, err)
+	}
+
+	return m, nil
+}
+
 // unmarshalMap creates a map from a map ID encoded in host endianness.
 func unmarshalMap(buf []byte) (*Map, error) {
 	if len(buf) != 4 {
@@ -1309,14 +2347,27 @@ func marshalMap(m *Map, length int) ([]byte, error) {
 
 // MapIterator iterates a Map.
 //
-// See Map.Iterate.
+// See Map.Iterate and Map.IterateSnapshot.
 type MapIterator struct {
 	target            *Map
 	prevKey           interface{}
 	prevBytes         []byte
 	count, maxEntries uint32
-	done              bool
-	err               error
+	// The number of times the kernel restarted iteration.
+	restarts int
+	skipped  int
+	done     bool
+	err      error
+
+	// Set by IterateSnapshot. snapshot is nil until the first call to Next.
+	useSnapshot bool
+	snapshot    *mapSnapshot
+}
+
+// mapSnapshot holds a copy of the keys and values of a map.
+type mapSnapshot struct {
+	keys, values []byte
+	count, pos   int
 }
 
 func newMapIterator(target *Map) *MapIterator {
@@ -1329,9 +2380,13 @@ func newMapIterator(target *Map) *MapIterator {
 
 // Next decodes the next key and value.
 //
-// Iterating a hash map from which keys are being deleted is not
-// safe. You may see the same key multiple times. Iteration may
-// also abort with an error, see IsIterationAborted.
+// The kernel restarts iteration from the first key if the previously returned
+// key is deleted concurrently, for example because it was evicted from an LRU
+// map, in which case keys are returned again. Keys which disappear before
+// their value can be looked up are skipped, see Skipped. Iteration aborts with
+// an error wrapping ErrIterationAborted if the kernel restarts iteration so
+// often that it doesn't terminate. Use IterateSnapshot to reduce the effect of
+// concurrent modifications.
 //
 // Returns false if there are no more entries. You must check
 // the result of Err afterwards.
@@ -1342,9 +2397,24 @@ func (mi *MapIterator) Next(keyOut, valueOut interface{}) bool {
 		return false
 	}
 
-	// For array-like maps NextKeyBytes returns nil only on after maxEntries
-	// iterations.
-	for mi.count <= mi.maxEntries {
+	if mi.useSnapshot {
+		return mi.nextSnapshot(keyOut, valueOut)
+	}
+
+	for {
+		// For array-like maps NextKeyBytes returns nil only on after maxEntries
+		// iterations. For other maps a walk returning more keys than the map
+		// can hold means that the kernel restarted from the first key since
+		// the previous key vanished. Restarts have their own budget.
+		if mi.count > mi.maxEntries {
+			mi.restarts++
+			if mi.restarts >= keyIteratorMaxWalks {
+				mi.err = fmt.Errorf("%w", ErrIterationAborted)
+				return false
+			}
+			mi.count = 0
+		}
+
 		var nextBytes []byte
 		nextBytes, mi.err = mi.target.NextKeyBytes(mi.prevKey)
 		if mi.err != nil {
@@ -1368,12 +2438,14 @@ func (mi *MapIterator) Next(keyOut, valueOut interface{}) bool {
 		if errors.Is(mi.err, ErrKeyNotExist) {
 			// Even though the key should be valid, we couldn't look up
 			// its value. If we're iterating a hash map this is probably
-			// because a concurrent delete removed the value before we
-			// could get it. This means that the next call to NextKeyBytes
-			// is very likely to restart iteration.
+			// because a concurrent delete or an LRU eviction removed the
+			// value before we could get it. This means that the next call
+			// to NextKeyBytes is very likely to restart iteration.
 			// If we're iterating one of the fd maps like
 			// ProgramArray it means that a given slot doesn't have
 			// a valid fd associated. It's OK to continue to the next slot.
+			mi.err = nil
+			mi.skipped++
 			continue
 		}
 		if mi.err != nil {
@@ -1383,9 +2455,45 @@ func (mi *MapIterator) Next(keyOut, valueOut interface{}) bool {
 		mi.err = mi.target.unmarshalKey(keyOut, nextBytes)
 		return mi.err == nil
 	}
+}
 
-	mi.err = fmt.Errorf("%w", ErrIterationAborted)
-	return false
+// nextSnapshot copies the map on the first call and returns the copied
+// entries one by one.
+func (mi *MapIterator) nextSnapshot(keyOut, valueOut interface{}) bool {
+	if mi.snapshot == nil {
+		mi.snapshot, mi.err = mi.target.snapshot()
+		if mi.err != nil {
+			return false
+		}
+	}
+
+	snap := mi.snapshot
+	if snap.pos >= snap.count {
+		mi.done = true
+		return false
+	}
+
+	keySize, valueSize := int(mi.target.keySize), int(mi.target.fullValueSize)
+	key := snap.keys[snap.pos*keySize : (snap.pos+1)*keySize]
+	value := snap.values[snap.pos*valueSize : (snap.pos+1)*valueSize]
+	snap.pos++
+
+	if mi.err = mi.target.unmarshalValue(valueOut, value); mi.err != nil {
+		return false
+	}
+
+	mi.err = mi.target.unmarshalKey(keyOut, key)
+	return mi.err == nil
+}
+
+// Skipped returns the number of keys which were skipped because they
+// disappeared between being returned by the kernel and having their value
+// looked up, for example because they were evicted from an LRU map.
+//
+// For maps of file descriptors such as ProgramArray this includes empty
+// slots. Always zero for iterators created by IterateSnapshot.
+func (mi *MapIterator) Skipped() int {
+	return mi.skipped
 }
 
 // Err returns any encountered error.
@@ -1397,6 +2505,143 @@ func (mi *MapIterator) Err() error {
 	return mi.err
 }
 
+// keyIteratorMaxWalks limits how often a KeyIterator or MapIterator walks the
+// map due to concurrent deletions before giving up.
+const keyIteratorMaxWalks = 8
+
+// KeyIterator iterates the keys of a Map, without looking up their values.
+//
+// See Map.Keys.
+type KeyIterator struct {
+	target          *Map
+	prevKey         interface{}
+	prevBytes       []byte
+	steps, maxSteps uint64
+	done            bool
+	err             error
+}
+
+func newKeyIterator(target *Map) *KeyIterator {
+	return &KeyIterator{
+		target:    target,
+		prevBytes: make([]byte, target.keySize),
+		maxSteps:  (uint64(target.maxEntries) + 1) * keyIteratorMaxWalks,
+	}
+}
+
+// Next decodes the next key into keyOut.
+//
+// The kernel restarts iteration from the first key if the previously
+// returned key is deleted concurrently, in which case keys are returned
+// again. Keys added during iteration may or may not be returned. Iteration
+// aborts with ErrIterationAborted if the map is modified so frequently that
+// it doesn't terminate.
+//
+// Returns false if there are no more keys. You must check the result of
+// Err afterwards.
+func (ki *KeyIterator) Next(keyOut interface{}) bool {
+	if ki.err != nil || ki.done {
+		return false
+	}
+
+	for ki.steps < ki.maxSteps {
+		var nextBytes []byte
+		nextBytes, ki.err = ki.target.NextKeyBytes(ki.prevKey)
+		if ki.err != nil {
+			return false
+		}
+
+		if nextBytes == nil {
+			ki.done = true
+			return false
+		}
+
+		ki.steps++
+		copy(ki.prevBytes, nextBytes)
+		ki.prevKey = ki.prevBytes
+
+		ki.err = ki.target.unmarshalKey(keyOut, nextBytes)
+		return ki.err == nil
+	}
+
+	ki.err = ErrIterationAborted
+	return false
+}
+
+// Err returns any encountered error.
+//
+// The method must be called after Next returns false.
+func (ki *KeyIterator) Err() error {
+	return ki.err
+}
+
+// snapshotBatchSize is the number of entries copied per BPF_MAP_LOOKUP_BATCH
+// by IterateSnapshot.
+const snapshotBatchSize = 4096
+
+// snapshot copies all entries of the map using BPF_MAP_LOOKUP_BATCH.
+func (m *Map) snapshot() (*mapSnapshot, error) {
+	if err := haveBatchAPI(); err != nil {
+		return nil, err
+	}
+	if m.typ.hasPerCPUValue() {
+		return nil, fmt.Errorf("snapshot of %s: %w", m.typ, ErrNotSupported)
+	}
+
+	n := snapshotBatchSize
+	if m.maxEntries > 0 && int(m.maxEntries) < n {
+		n = int(m.maxEntries)
+	}
+
+	keySize, valueSize := int(m.keySize), int(m.fullValueSize)
+	var (
+		snap     = &mapSnapshot{}
+		inBatch  []byte
+		outBatch = make([]byte, m.batchTokenSize())
+	)
+
+	for {
+		keyBuf := make([]byte, n*keySize)
+		valueBuf := make([]byte, n*valueSize)
+
+		attr := sys.MapLookupBatchAttr{
+			MapFd:    m.fd.Uint(),
+			Keys:     sys.NewSlicePointer(keyBuf),
+			Values:   sys.NewSlicePointer(valueBuf),
+			Count:    uint32(n),
+			OutBatch: sys.NewSlicePointer(outBatch),
+		}
+		if inBatch != nil {
+			attr.InBatch = sys.NewSlicePointer(inBatch)
+		}
+
+		_, err := sys.BPF(sys.BPF_MAP_LOOKUP_BATCH, unsafe.Pointer(&attr), unsafe.Sizeof(attr))
+		err = wrapMapError(err)
+		if errors.Is(err, unix.ENOSPC) {
+			// A single bucket holds more than n entries.
+			n *= 2
+			continue
+		}
+		if err != nil && !errors.Is(err, ErrKeyNotExist) {
+			return nil, fmt.Errorf("batch lookup: %w", err)
+		}
+
+		count := int(attr.Count)
+		snap.keys = append(snap.keys, keyBuf[:count*keySize]...)
+		snap.values = append(snap.values, valueBuf[:count*valueSize]...)
+		snap.count += count
+
+		if err != nil {
+			// ErrKeyNotExist signals the end of the map.
+			break
+		}
+
+		inBatch, outBatch = outBatch, make([]byte, m.batchTokenSize())
+	}
+
+	return snap, nil
+}
+
 // MapGetNextID returns the ID of the next eBPF map.
 //
 // Returns ErrNotExist, if there is no next eBPF map.
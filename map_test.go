@@ -9,6 +9,7 @@ import (
 	"reflect"
 	"sort"
 	"testing"
+	"time"
 	"unsafe"
 
 	"github.com/cilium/ebpf/asm"
@@ -71,6 +72,434 @@ func TestMap(t *testing.T) {
 	}
 }
 
+func TestMapLookupOK(t *testing.T) {
+	hash := createHash()
+	defer hash.Close()
+
+	if err := hash.Put("hello", uint32(21)); err != nil {
+		t.Fatal("Can't put:", err)
+	}
+
+	var v uint32
+	ok, err := hash.LookupOK("hello", &v)
+	if err != nil {
+		t.Fatal("Can't lookup existing key:", err)
+	}
+	if !ok {
+		t.Error("LookupOK returns false for an existing key")
+	}
+	if v != 21 {
+		t.Error("Want value 21, got", v)
+	}
+
+	ok, err = hash.LookupOK("world", &v)
+	if err != nil {
+		t.Fatal("LookupOK returns an error for a missing key:", err)
+	}
+	if ok {
+		t.Error("LookupOK returns true for a missing key")
+	}
+
+	if _, err := hash.LookupOK(uint64(0), &v); err == nil {
+		t.Error("LookupOK doesn't return an error for an invalid key")
+	}
+}
+
+func TestMapLookupDecodeError(t *testing.T) {
+	hash := createHash()
+	defer hash.Close()
+
+	if err := hash.Put("hello", uint32(21)); err != nil {
+		t.Fatal("Can't put:", err)
+	}
+
+	var value struct {
+		A uint32
+		B uint16
+	}
+	err := hash.Lookup("hello", &value)
+	var de *DecodeError
+	if !errors.As(err, &de) {
+		t.Fatal("Expected a DecodeError, got", err)
+	}
+	if de.Field != "B" || de.Offset != 4 {
+		t.Errorf("Expected field B at offset 4, got %s at offset %d", de.Field, de.Offset)
+	}
+}
+
+func TestMapContains(t *testing.T) {
+	hash := createHash()
+	defer hash.Close()
+
+	if err := hash.Put("hello", uint32(21)); err != nil {
+		t.Fatal("Can't put:", err)
+	}
+
+	ok, err := hash.Contains("hello")
+	if err != nil {
+		t.Fatal("Can't check existing key:", err)
+	}
+	if !ok {
+		t.Error("Contains returns false for an existing key")
+	}
+
+	ok, err = hash.Contains("world")
+	if err != nil {
+		t.Fatal("Contains returns an error for a missing key:", err)
+	}
+	if ok {
+		t.Error("Contains returns true for a missing key")
+	}
+
+	if _, err := hash.Contains(uint64(0)); err == nil {
+		t.Error("Contains doesn't return an error for an invalid key")
+	}
+}
+
+func TestMapInsertReplace(t *testing.T) {
+	hash := createHash()
+	defer hash.Close()
+
+	if err := hash.Replace("hello", uint32(1)); !errors.Is(err, ErrKeyNotExist) {
+		t.Fatal("Replacing a missing key doesn't return ErrKeyNotExist:", err)
+	}
+
+	if err := hash.Insert("hello", uint32(1)); err != nil {
+		t.Fatal("Can't insert:", err)
+	}
+
+	if err := hash.Insert("hello", uint32(2)); !errors.Is(err, ErrKeyExist) {
+		t.Fatal("Inserting an existing key doesn't return ErrKeyExist:", err)
+	}
+
+	if err := hash.Replace("hello", uint32(3)); err != nil {
+		t.Fatal("Can't replace:", err)
+	}
+
+	if err := hash.Upsert("world", uint32(4)); err != nil {
+		t.Fatal("Can't upsert:", err)
+	}
+
+	var value uint32
+	for key, want := range map[string]uint32{"hello": 3, "world": 4} {
+		if err := hash.Lookup(key, &value); err != nil {
+			t.Fatal("Can't lookup:", err)
+		}
+		if value != want {
+			t.Errorf("Expected %d for key %s, got %d", want, key, value)
+		}
+	}
+}
+
+func TestMapLookupPartial(t *testing.T) {
+	m, err := NewMap(&MapSpec{
+		Type:       Array,
+		KeySize:    4,
+		ValueSize:  8,
+		MaxEntries: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	if err := m.Put(uint32(0), [8]byte{1, 2, 3, 4, 5, 6, 7, 8}); err != nil {
+		t.Fatal("Can't put:", err)
+	}
+
+	out := make([]byte, 4)
+	n, err := m.LookupPartial(uint32(0), out, 2)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, n, qt.Equals, 4)
+	qt.Assert(t, out, qt.DeepEquals, []byte{3, 4, 5, 6})
+
+	n, err = m.LookupPartial(uint32(0), out, 6)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, n, qt.Equals, 2)
+	qt.Assert(t, out[:n], qt.DeepEquals, []byte{7, 8})
+
+	_, err = m.LookupPartial(uint32(0), out, 9)
+	qt.Assert(t, err, qt.IsNotNil)
+
+	_, err = m.LookupPartial(uint32(1), out, 0)
+	qt.Assert(t, err, qt.ErrorIs, ErrKeyNotExist)
+}
+
+func TestMapKeys(t *testing.T) {
+	hash, err := NewMap(&MapSpec{
+		Type:       Hash,
+		KeySize:    4,
+		ValueSize:  4,
+		MaxEntries: 10,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer hash.Close()
+
+	for i := uint32(0); i < 5; i++ {
+		if err := hash.Put(i, i); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	n, err := hash.KeyCount()
+	if err != nil {
+		t.Fatal("Can't count keys:", err)
+	}
+	if n != 5 {
+		t.Error("Expected 5 keys, got", n)
+	}
+
+	// Deleting the previous key during iteration makes the kernel restart
+	// from the first key, which must not abort iteration.
+	var (
+		key  uint32
+		seen = make(map[uint32]int)
+	)
+	keys := hash.Keys()
+	for keys.Next(&key) {
+		seen[key]++
+		if len(seen) == 2 {
+			if err := hash.Delete(key); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if err := keys.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(seen) != 5 {
+		t.Errorf("Expected 5 keys, got %v", seen)
+	}
+}
+
+func TestMapTokenFD(t *testing.T) {
+	if err := haveBPFToken(); err != nil {
+		_, err := NewMapWithOptions(&MapSpec{Type: Array, KeySize: 4, ValueSize: 4, MaxEntries: 1}, MapOptions{TokenFD: 1})
+		qt.Assert(t, err, qt.ErrorIs, ErrNotSupported)
+		t.Skip("BPF tokens aren't supported")
+	}
+
+	f, err := os.Open(os.DevNull)
+	qt.Assert(t, err, qt.IsNil)
+	defer f.Close()
+
+	// The kernel must reject the fd since it isn't a token.
+	_, err = NewMapWithOptions(&MapSpec{
+		Type:       Array,
+		KeySize:    4,
+		ValueSize:  4,
+		MaxEntries: 1,
+	}, MapOptions{TokenFD: int(f.Fd())})
+	qt.Assert(t, err, qt.IsNotNil)
+}
+
+func TestMapNextKeys(t *testing.T) {
+	for _, typ := range []MapType{Hash, Array, LPMTrie} {
+		t.Run(typ.String(), func(t *testing.T) {
+			spec := &MapSpec{
+				Type:       typ,
+				KeySize:    4,
+				ValueSize:  4,
+				MaxEntries: 10,
+			}
+			if typ == LPMTrie {
+				spec.KeySize = 8
+				spec.Flags = unix.BPF_F_NO_PREALLOC
+			}
+
+			m, err := NewMap(spec)
+			testutils.SkipIfNotSupported(t, err)
+			qt.Assert(t, err, qt.IsNil)
+			defer m.Close()
+
+			want := make(map[uint64]bool)
+			for i := uint64(0); i < 10; i++ {
+				k, key := i, interface{}(uint32(i))
+				if typ == LPMTrie {
+					// Prefix length 32 followed by the address.
+					k = 32 | i<<32
+					key = k
+				}
+				qt.Assert(t, m.Put(key, uint32(0)), qt.IsNil)
+				want[k] = true
+			}
+			qt.Assert(t, want, qt.HasLen, 10)
+
+			var cursor interface{} = (*uint32)(nil)
+			if typ == LPMTrie {
+				cursor = (*uint64)(nil)
+			}
+			got := make(map[uint64]bool)
+			for pages := 1; cursor != nil; pages++ {
+				var keys interface{}
+				keys, cursor, err = m.NextKeys(cursor, 3)
+				qt.Assert(t, err, qt.IsNil)
+
+				switch keys := keys.(type) {
+				case []uint32:
+					qt.Assert(t, len(keys) <= 3, qt.IsTrue)
+					for _, key := range keys {
+						got[uint64(key)] = true
+					}
+				case []uint64:
+					qt.Assert(t, len(keys) <= 3, qt.IsTrue)
+					for _, key := range keys {
+						got[key] = true
+					}
+				default:
+					t.Fatalf("Unexpected type %T", keys)
+				}
+
+				qt.Assert(t, pages <= 10, qt.IsTrue, qt.Commentf("NextKeys doesn't terminate"))
+			}
+			qt.Assert(t, got, qt.DeepEquals, want)
+		})
+	}
+
+	arr := createArray(t)
+	defer arr.Close()
+
+	keys, cursor, err := arr.NextKeys(nil, 1)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, keys, qt.DeepEquals, [][]byte{{0, 0, 0, 0}})
+	qt.Assert(t, cursor, qt.IsNotNil)
+
+	keys, _, err = arr.NextKeys(uint32(0), 1)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, keys, qt.DeepEquals, []uint32{1})
+
+	_, _, err = arr.NextKeys(nil, 0)
+	qt.Assert(t, err, qt.IsNotNil)
+
+	// The batch token of hash maps is larger than a one byte key.
+	small, err := NewMap(&MapSpec{
+		Type:       Hash,
+		KeySize:    1,
+		ValueSize:  4,
+		MaxEntries: 10,
+	})
+	qt.Assert(t, err, qt.IsNil)
+	defer small.Close()
+
+	for i := uint8(0); i < 10; i++ {
+		qt.Assert(t, small.Put(i, uint32(0)), qt.IsNil)
+	}
+
+	var smallCursor interface{} = (*uint8)(nil)
+	smallKeys := make(map[uint8]bool)
+	for pages := 1; smallCursor != nil; pages++ {
+		var keys interface{}
+		keys, smallCursor, err = small.NextKeys(smallCursor, 3)
+		qt.Assert(t, err, qt.IsNil)
+		for _, key := range keys.([]uint8) {
+			smallKeys[key] = true
+		}
+		qt.Assert(t, pages <= 10, qt.IsTrue, qt.Commentf("NextKeys doesn't terminate"))
+	}
+	qt.Assert(t, smallKeys, qt.HasLen, 10)
+}
+
+func TestMapElementCount(t *testing.T) {
+	hash := createHash()
+	defer hash.Close()
+
+	if err := hash.Put("hello", uint32(21)); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := hash.ElementCount(false); !errors.Is(err, ErrNotSupported) {
+		t.Error("Expected ErrNotSupported without scan, got", err)
+	}
+
+	n, err := hash.ElementCount(true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Error("Expected one element, got", n)
+	}
+
+	arr := createArray(t)
+	defer arr.Close()
+
+	n, err = arr.ElementCount(false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int(arr.MaxEntries()) {
+		t.Errorf("Expected %d elements in array, got %d", arr.MaxEntries(), n)
+	}
+}
+
+func TestMapSumPerCPU(t *testing.T) {
+	testutils.SkipOnOldKernel(t, "4.6", "per-CPU hash")
+
+	numCPU, err := internal.PossibleCPUs()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := NewMap(&MapSpec{
+		Type:       PerCPUHash,
+		KeySize:    4,
+		ValueSize:  16,
+		MaxEntries: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	type counters struct {
+		Packets uint64
+		Bytes   [2]uint32
+	}
+
+	values := make([]counters, numCPU)
+	for i := range values {
+		values[i] = counters{1, [2]uint32{uint32(i), 2}}
+	}
+	if err := m.Put(uint32(0), values); err != nil {
+		t.Fatal(err)
+	}
+
+	var perCPU []counters
+	if err := m.LookupPerCPU(uint32(0), &perCPU); err != nil {
+		t.Fatal("Can't lookup per-CPU values:", err)
+	}
+	if len(perCPU) != numCPU {
+		t.Fatalf("Expected %d values, got %d", numCPU, len(perCPU))
+	}
+
+	var sum counters
+	if err := m.SumPerCPU(uint32(0), &sum); err != nil {
+		t.Fatal("Can't sum per-CPU values:", err)
+	}
+	want := counters{uint64(numCPU), [2]uint32{uint32(numCPU * (numCPU - 1) / 2), uint32(2 * numCPU)}}
+	if sum != want {
+		t.Errorf("Expected sum %v, got %v", want, sum)
+	}
+
+	var bad struct{ S string }
+	if err := m.SumPerCPU(uint32(0), &bad); err == nil {
+		t.Error("SumPerCPU accepts a struct with a string field")
+	}
+
+	hash := createHash()
+	defer hash.Close()
+
+	var total uint32
+	if err := hash.SumPerCPU("hello", &total); err == nil {
+		t.Error("SumPerCPU accepts a map without per-CPU values")
+	}
+	if err := hash.LookupPerCPU("hello", &perCPU); err == nil {
+		t.Error("LookupPerCPU accepts a map without per-CPU values")
+	}
+}
+
 func TestBatchAPIArray(t *testing.T) {
 	if err := haveBatchAPI(); err != nil {
 		t.Skipf("batch api not available: %v", err)
@@ -213,6 +642,38 @@ func TestBatchAPIHash(t *testing.T) {
 	}
 }
 
+func TestBatchUpdatePartial(t *testing.T) {
+	if err := haveBatchAPI(); err != nil {
+		t.Skipf("batch api not available: %v", err)
+	}
+	m, err := NewMap(&MapSpec{
+		Type:       Hash,
+		KeySize:    4,
+		ValueSize:  4,
+		MaxEntries: 2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	if _, err := m.BatchUpdate([]uint32{0, 1}, []uint32{42}, nil); err == nil {
+		t.Error("BatchUpdate accepts slices of different length")
+	}
+
+	if _, err := m.BatchUpdate([]uint32{0}, []uint64{42}, nil); err == nil {
+		t.Error("BatchUpdate accepts values of the wrong size")
+	}
+
+	count, err := m.BatchUpdate([]uint32{0, 1, 2}, []uint32{42, 4242, 424242}, nil)
+	if err == nil {
+		t.Fatal("BatchUpdate doesn't return an error when the map is full")
+	}
+	if count != 2 {
+		t.Fatalf("BatchUpdate: expected count, %d, to be 2", count)
+	}
+}
+
 func TestBatchAPIMapDelete(t *testing.T) {
 	if err := haveBatchAPI(); err != nil {
 		t.Skipf("batch api not available: %v", err)
@@ -446,6 +907,36 @@ func TestMapPin(t *testing.T) {
 	}
 }
 
+func TestLoadPinnedMapTyped(t *testing.T) {
+	spec := &MapSpec{
+		Type:       Array,
+		KeySize:    4,
+		ValueSize:  4,
+		MaxEntries: 2,
+	}
+
+	m, err := NewMap(spec)
+	qt.Assert(t, err, qt.IsNil)
+	defer m.Close()
+
+	tmp := testutils.TempBPFFS(t)
+	path := filepath.Join(tmp, "map")
+
+	if err := m.Pin(path); err != nil {
+		testutils.SkipIfNotSupported(t, err)
+		t.Fatal(err)
+	}
+
+	pinned, err := LoadPinnedMapTyped(path, spec, nil)
+	qt.Assert(t, err, qt.IsNil)
+	pinned.Close()
+
+	incompatible := spec.Copy()
+	incompatible.MaxEntries = 3
+	_, err = LoadPinnedMapTyped(path, incompatible, nil)
+	qt.Assert(t, err, qt.ErrorIs, ErrMapIncompatible)
+}
+
 func TestNestedMapPin(t *testing.T) {
 	m, err := NewMap(&MapSpec{
 		Type:       ArrayOfMaps,
@@ -774,6 +1265,137 @@ func TestMapQueue(t *testing.T) {
 	}
 }
 
+func TestMapPushPop(t *testing.T) {
+	testutils.SkipOnOldKernel(t, "4.20", "map type queue and stack")
+
+	for _, test := range []struct {
+		typ  MapType
+		want []uint32
+	}{
+		{Queue, []uint32{1, 2, 3}},
+		{Stack, []uint32{3, 2, 1}},
+	} {
+		t.Run(test.typ.String(), func(t *testing.T) {
+			m, err := NewMap(&MapSpec{
+				Type:       test.typ,
+				ValueSize:  4,
+				MaxEntries: 3,
+			})
+			qt.Assert(t, err, qt.IsNil)
+			defer m.Close()
+
+			for _, v := range []uint32{1, 2, 3} {
+				qt.Assert(t, m.Push(v), qt.IsNil)
+			}
+			qt.Assert(t, m.Push(uint32(4)), qt.IsNotNil, qt.Commentf("Push to full map"))
+
+			var got []uint32
+			for {
+				var v uint32
+				ok, err := m.Pop(&v)
+				qt.Assert(t, err, qt.IsNil)
+				if !ok {
+					break
+				}
+				got = append(got, v)
+			}
+			qt.Assert(t, got, qt.DeepEquals, test.want)
+		})
+	}
+
+	hash := createHash()
+	defer hash.Close()
+
+	qt.Assert(t, hash.Push(uint32(1)), qt.IsNotNil)
+	_, err := hash.Pop(new(uint32))
+	qt.Assert(t, err, qt.IsNotNil)
+}
+
+func TestMapBloomFilter(t *testing.T) {
+	testutils.SkipOnOldKernel(t, "5.16", "map type bloom filter")
+
+	m, err := NewMap(&MapSpec{
+		Type:       BloomFilter,
+		ValueSize:  4,
+		MaxEntries: 16,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	if err := m.Add(uint32(42)); err != nil {
+		t.Fatal("Can't add value:", err)
+	}
+
+	ok, err := m.Contains(uint32(42))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !ok {
+		t.Error("Bloom filter doesn't contain added value")
+	}
+
+	// With 16 entries and 5 hashes, a false positive is very unlikely.
+	ok, err = m.Contains(uint32(4242))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ok {
+		t.Error("Bloom filter contains value which wasn't added")
+	}
+
+	_, err = NewMap(&MapSpec{
+		Type:       BloomFilter,
+		KeySize:    4,
+		ValueSize:  4,
+		MaxEntries: 16,
+	})
+	if err == nil {
+		t.Error("Bloom filter with a key should be rejected")
+	}
+
+	hash := createHash()
+	defer hash.Close()
+
+	if err := hash.Add(uint32(42)); err == nil {
+		t.Error("Add should only work on bloom filters")
+	}
+}
+
+func TestMapExtra(t *testing.T) {
+	testutils.SkipOnOldKernel(t, "5.16", "map type bloom filter")
+
+	spec := &MapSpec{
+		Type:       BloomFilter,
+		ValueSize:  4,
+		MaxEntries: 16,
+		MapExtra:   3,
+	}
+
+	m, err := NewMap(spec)
+	if err != nil {
+		t.Fatal("Can't create bloom filter with three hash functions:", err)
+	}
+	m.Close()
+
+	spec.MapExtra = 16
+	if _, err := NewMap(spec); err == nil {
+		t.Error("Bloom filter with more than 15 hash functions should be rejected")
+	}
+
+	_, err = NewMap(&MapSpec{
+		Type:       Hash,
+		KeySize:    4,
+		ValueSize:  4,
+		MaxEntries: 1,
+		MapExtra:   1,
+	})
+	if err == nil {
+		t.Error("MapExtra should be rejected for hash maps")
+	}
+}
+
 func TestMapInMap(t *testing.T) {
 	for _, typ := range []MapType{ArrayOfMaps, HashOfMaps} {
 		t.Run(typ.String(), func(t *testing.T) {
@@ -1018,26 +1640,185 @@ func TestMapIterate(t *testing.T) {
 	var value uint32
 	var keys []string
 
-	entries := hash.Iterate()
+	entries := hash.Iterate()
+	for entries.Next(&key, &value) {
+		keys = append(keys, key)
+	}
+
+	if err := entries.Err(); err != nil {
+		t.Fatal(err)
+	}
+
+	sort.Strings(keys)
+
+	if n := len(keys); n != 2 {
+		t.Fatal("Expected to get 2 keys, have", n)
+	}
+	if keys[0] != "hello" {
+		t.Error("Expected index 0 to be hello, got", keys[0])
+	}
+	if keys[1] != "world" {
+		t.Error("Expected index 1 to be hello, got", keys[1])
+	}
+}
+
+func TestMapIterateConcurrentDelete(t *testing.T) {
+	hash, err := NewMap(&MapSpec{
+		Type:       Hash,
+		KeySize:    4,
+		ValueSize:  4,
+		MaxEntries: 16,
+	})
+	qt.Assert(t, err, qt.IsNil)
+	defer hash.Close()
+
+	for i := uint32(0); i < 16; i++ {
+		qt.Assert(t, hash.Put(i, i), qt.IsNil)
+	}
+
+	// Deleting the current key makes the kernel restart iteration from the
+	// first key, like an LRU eviction would.
+	seen := make(map[uint32]int)
+	var key, value uint32
+	entries := hash.Iterate()
+	for entries.Next(&key, &value) {
+		seen[key]++
+		qt.Assert(t, hash.Delete(key), qt.IsNil)
+	}
+	qt.Assert(t, entries.Err(), qt.IsNil)
+	qt.Assert(t, seen, qt.HasLen, 16)
+	for k, n := range seen {
+		qt.Assert(t, n, qt.Equals, 1, qt.Commentf("key %d", k))
+	}
+}
+
+func TestMapIterateDeleteAndInsert(t *testing.T) {
+	hash, err := NewMap(&MapSpec{
+		Type:       Hash,
+		KeySize:    4,
+		ValueSize:  4,
+		MaxEntries: 16,
+	})
+	qt.Assert(t, err, qt.IsNil)
+	defer hash.Close()
+
+	for i := uint32(0); i < 16; i++ {
+		qt.Assert(t, hash.Put(i, i), qt.IsNil)
+	}
+
+	// Replacing the current key keeps the map full while making the kernel
+	// restart iteration, like an LRU eviction followed by an insert would.
+	seen := make(map[uint32]bool)
+	replaced := uint32(0)
+	var key, value uint32
+	entries := hash.Iterate()
+	for entries.Next(&key, &value) {
+		seen[key] = true
+		if key < 16 && replaced < 4 {
+			qt.Assert(t, hash.Delete(key), qt.IsNil)
+			qt.Assert(t, hash.Put(100+replaced, uint32(0)), qt.IsNil)
+			replaced++
+		}
+	}
+	qt.Assert(t, entries.Err(), qt.IsNil)
+	for i := uint32(0); i < 16; i++ {
+		qt.Assert(t, seen[i], qt.IsTrue, qt.Commentf("key %d", i))
+	}
+}
+
+func TestMapIterateSkipped(t *testing.T) {
+	arr, err := NewMap(&MapSpec{
+		Type:       ProgramArray,
+		KeySize:    4,
+		ValueSize:  4,
+		MaxEntries: 4,
+	})
+	qt.Assert(t, err, qt.IsNil)
+	defer arr.Close()
+
+	var key, value uint32
+	entries := arr.Iterate()
 	for entries.Next(&key, &value) {
-		keys = append(keys, key)
+		t.Fatal("Iterator returned an empty slot")
 	}
+	qt.Assert(t, entries.Err(), qt.IsNil)
+	qt.Assert(t, entries.Skipped(), qt.Equals, 4)
+}
 
-	if err := entries.Err(); err != nil {
-		t.Fatal(err)
+func TestMapIterateSnapshot(t *testing.T) {
+	if err := haveBatchAPI(); err != nil {
+		t.Skipf("batch api not available: %v", err)
 	}
 
-	sort.Strings(keys)
+	for _, typ := range []MapType{Hash, LRUHash, Array} {
+		t.Run(typ.String(), func(t *testing.T) {
+			m, err := NewMap(&MapSpec{
+				Type:       typ,
+				KeySize:    4,
+				ValueSize:  4,
+				MaxEntries: 8,
+			})
+			qt.Assert(t, err, qt.IsNil)
+			defer m.Close()
 
-	if n := len(keys); n != 2 {
-		t.Fatal("Expected to get 2 keys, have", n)
+			for i := uint32(0); i < 8; i++ {
+				qt.Assert(t, m.Put(i, i*10), qt.IsNil)
+			}
+
+			got := make(map[uint32]uint32)
+			var key, value uint32
+			entries := m.IterateSnapshot()
+			for entries.Next(&key, &value) {
+				got[key] = value
+				// Changes after the snapshot is taken aren't visible.
+				qt.Assert(t, m.Put(key, uint32(1)), qt.IsNil)
+			}
+			qt.Assert(t, entries.Err(), qt.IsNil)
+			qt.Assert(t, got, qt.HasLen, 8)
+			for k, v := range got {
+				qt.Assert(t, v, qt.Equals, k*10)
+			}
+		})
 	}
-	if keys[0] != "hello" {
-		t.Error("Expected index 0 to be hello, got", keys[0])
+
+	// The batch token of hash maps is larger than a one byte key.
+	small, err := NewMap(&MapSpec{
+		Type:       Hash,
+		KeySize:    1,
+		ValueSize:  4,
+		MaxEntries: 8,
+	})
+	qt.Assert(t, err, qt.IsNil)
+	defer small.Close()
+	for i := uint8(0); i < 8; i++ {
+		qt.Assert(t, small.Put(i, uint32(i)), qt.IsNil)
 	}
-	if keys[1] != "world" {
-		t.Error("Expected index 1 to be hello, got", keys[1])
+
+	var (
+		smallKey   uint8
+		smallValue uint32
+		smallCount int
+	)
+	smallEntries := small.IterateSnapshot()
+	for smallEntries.Next(&smallKey, &smallValue) {
+		qt.Assert(t, smallValue, qt.Equals, uint32(smallKey))
+		smallCount++
 	}
+	qt.Assert(t, smallEntries.Err(), qt.IsNil)
+	qt.Assert(t, smallCount, qt.Equals, 8)
+
+	perCPU, err := NewMap(&MapSpec{
+		Type:       PerCPUHash,
+		KeySize:    4,
+		ValueSize:  4,
+		MaxEntries: 1,
+	})
+	qt.Assert(t, err, qt.IsNil)
+	defer perCPU.Close()
+
+	entries := perCPU.IterateSnapshot()
+	qt.Assert(t, entries.Next(new(uint32), new([]uint32)), qt.IsFalse)
+	qt.Assert(t, errors.Is(entries.Err(), ErrNotSupported), qt.IsTrue)
 }
 
 func TestMapIterateHashKeyOneByteFull(t *testing.T) {
@@ -1354,6 +2135,42 @@ func TestPerCPUMarshaling(t *testing.T) {
 	}
 }
 
+func TestMapLookupCPU(t *testing.T) {
+	numCPU, err := internal.PossibleCPUs()
+	qt.Assert(t, err, qt.IsNil)
+
+	// Values are padded to 8 bytes for each CPU.
+	m, err := NewMap(&MapSpec{
+		Type:       PerCPUArray,
+		KeySize:    4,
+		ValueSize:  4,
+		MaxEntries: 1,
+	})
+	qt.Assert(t, err, qt.IsNil)
+	defer m.Close()
+
+	values := make([]uint32, numCPU)
+	for i := range values {
+		values[i] = uint32(i + 1)
+	}
+	qt.Assert(t, m.Put(uint32(0), values), qt.IsNil)
+
+	for cpu := 0; cpu < numCPU; cpu++ {
+		var v uint32
+		qt.Assert(t, m.LookupCPU(uint32(0), cpu, &v), qt.IsNil)
+		qt.Assert(t, v, qt.Equals, uint32(cpu+1))
+	}
+
+	var v uint32
+	qt.Assert(t, m.LookupCPU(uint32(0), numCPU, &v), qt.IsNotNil)
+	qt.Assert(t, m.LookupCPU(uint32(0), -1, &v), qt.IsNotNil)
+	qt.Assert(t, m.LookupCPU(uint32(1), 0, &v), qt.ErrorIs, ErrKeyNotExist)
+
+	hash := createHash()
+	defer hash.Close()
+	qt.Assert(t, hash.LookupCPU("hello", 0, &v), qt.IsNotNil)
+}
+
 type bpfCgroupStorageKey struct {
 	CgroupInodeId uint64
 	AttachType    AttachType
@@ -1599,6 +2416,94 @@ func TestMapContents(t *testing.T) {
 	}
 }
 
+func TestMapPollDeadline(t *testing.T) {
+	testutils.SkipOnOldKernel(t, "5.8", "BPF ring buffer")
+
+	m, err := NewMap(&MapSpec{Type: RingBuf, MaxEntries: 4096})
+	qt.Assert(t, err, qt.IsNil)
+	defer m.Close()
+
+	ready, err := m.PollDeadline(time.Now().Add(10 * time.Millisecond))
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, ready, qt.IsFalse, qt.Commentf("empty ring buffer is ready"))
+
+	prog, err := NewProgram(&ProgramSpec{
+		Type:         SocketFilter,
+		License:      "MIT",
+		Instructions: testutils.RingbufOutputInstructions(m.FD()),
+	})
+	qt.Assert(t, err, qt.IsNil)
+	defer prog.Close()
+
+	_, _, err = prog.Test(make([]byte, 14))
+	qt.Assert(t, err, qt.IsNil)
+
+	ready, err = m.PollDeadline(time.Now().Add(time.Second))
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, ready, qt.IsTrue)
+
+	hash := createHash()
+	defer hash.Close()
+
+	_, err = hash.PollDeadline(time.Time{})
+	qt.Assert(t, err, qt.IsNotNil)
+}
+
+func TestMapSpecNewInnerMap(t *testing.T) {
+	spec := &MapSpec{
+		Type:       HashOfMaps,
+		KeySize:    4,
+		MaxEntries: 2,
+		InnerMap: &MapSpec{
+			Type:       Hash,
+			KeySize:    4,
+			ValueSize:  4,
+			MaxEntries: 2,
+		},
+	}
+
+	outer, err := NewMap(spec)
+	testutils.SkipIfNotSupported(t, err)
+	qt.Assert(t, err, qt.IsNil)
+	defer outer.Close()
+
+	inner := spec.InnerMap.Copy()
+	inner.MaxEntries = 16
+	m, err := spec.NewInnerMap(inner)
+	qt.Assert(t, err, qt.IsNil)
+	defer m.Close()
+	qt.Assert(t, m.MaxEntries(), qt.Equals, uint32(16))
+	qt.Assert(t, outer.Put(uint32(0), m), qt.IsNil)
+
+	m, err = spec.NewInnerMap(nil)
+	qt.Assert(t, err, qt.IsNil)
+	m.Close()
+
+	inner = spec.InnerMap.Copy()
+	inner.ValueSize = 8
+	_, err = spec.NewInnerMap(inner)
+	qt.Assert(t, err, qt.ErrorIs, ErrMapIncompatible)
+
+	arrays := &MapSpec{
+		Type:       ArrayOfMaps,
+		KeySize:    4,
+		MaxEntries: 2,
+		InnerMap: &MapSpec{
+			Type:       Array,
+			KeySize:    4,
+			ValueSize:  4,
+			MaxEntries: 2,
+		},
+	}
+	inner = arrays.InnerMap.Copy()
+	inner.MaxEntries = 16
+	_, err = arrays.NewInnerMap(inner)
+	qt.Assert(t, err, qt.ErrorIs, ErrMapIncompatible, qt.Commentf("array size differs without BPF_F_INNER_MAP"))
+
+	_, err = spec.InnerMap.NewInnerMap(nil)
+	qt.Assert(t, err, qt.IsNotNil, qt.Commentf("not a map of maps"))
+}
+
 func TestMapFreeze(t *testing.T) {
 	arr := createArray(t)
 	defer arr.Close()
@@ -1613,6 +2518,215 @@ func TestMapFreeze(t *testing.T) {
 	if err := arr.Put(uint32(0), uint32(1)); err == nil {
 		t.Error("Freeze doesn't prevent modification from user space")
 	}
+
+	if err := arr.Freeze(); !errors.Is(err, ErrMapFrozen) {
+		t.Error("Freezing a frozen map doesn't return ErrMapFrozen, got", err)
+	}
+}
+
+func TestMapClear(t *testing.T) {
+	for _, typ := range []MapType{Hash, PerCPUHash, Array, PerCPUArray} {
+		t.Run(typ.String(), func(t *testing.T) {
+			m, err := NewMap(&MapSpec{
+				Type:       typ,
+				KeySize:    4,
+				ValueSize:  4,
+				MaxEntries: 1000,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer m.Close()
+
+			var value interface{} = uint32(42)
+			if typ.hasPerCPUValue() {
+				values := make([]uint32, m.fullValueSize/8)
+				for i := range values {
+					values[i] = 42
+				}
+				value = values
+			}
+
+			for i := uint32(0); i < 600; i++ {
+				if err := m.Put(i, value); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := m.Clear(); err != nil {
+				t.Fatal("Can't clear map:", err)
+			}
+
+			var (
+				n    int
+				prev interface{}
+			)
+			for {
+				key, err := m.NextKeyBytes(prev)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if key == nil {
+					break
+				}
+				prev = key
+				n++
+
+				value, err := m.LookupBytes(key)
+				if err != nil {
+					t.Fatal(err)
+				}
+				for _, b := range value {
+					if b != 0 {
+						t.Fatalf("Value at key %v isn't zeroed: %v", key, value)
+					}
+				}
+			}
+
+			if typ == Array || typ == PerCPUArray {
+				if n != int(m.MaxEntries()) {
+					t.Errorf("Expected %d elements, got %d", m.MaxEntries(), n)
+				}
+			} else if n != 0 {
+				t.Errorf("Expected an empty map, got %d elements", n)
+			}
+		})
+	}
+
+	t.Run("ProgramArray", func(t *testing.T) {
+		m, err := NewMap(&MapSpec{
+			Type:       ProgramArray,
+			KeySize:    4,
+			ValueSize:  4,
+			MaxEntries: 8,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer m.Close()
+
+		prog := mustSocketFilter(t)
+		for _, i := range []uint32{1, 5} {
+			if err := m.Put(i, prog); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if err := m.Clear(); err != nil {
+			t.Fatal("Can't clear map:", err)
+		}
+
+		for i := uint32(0); i < m.MaxEntries(); i++ {
+			var id ProgramID
+			if err := m.Lookup(i, &id); !errors.Is(err, ErrKeyNotExist) {
+				t.Errorf("Index %d isn't empty: %v", i, err)
+			}
+		}
+	})
+}
+
+func TestMapMemory(t *testing.T) {
+	testutils.SkipOnOldKernel(t, "5.5", "BPF_F_MMAPABLE")
+
+	m, err := NewMap(&MapSpec{
+		Type:       Array,
+		KeySize:    4,
+		ValueSize:  4,
+		MaxEntries: 4,
+		Flags:      unix.BPF_F_MMAPABLE,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer m.Close()
+
+	mem, err := m.Memory()
+	if err != nil {
+		t.Fatal("Can't mmap map:", err)
+	}
+
+	// Values are aligned to 8 bytes.
+	if len(mem) != 4*8 {
+		t.Fatalf("Expected %d bytes of memory, got %d", 4*8, len(mem))
+	}
+
+	if err := m.Put(uint32(1), uint32(42)); err != nil {
+		t.Fatal(err)
+	}
+
+	if v := internal.NativeEndian.Uint32(mem[8:12]); v != 42 {
+		t.Errorf("Expected value 42 at index 1, got %d", v)
+	}
+
+	mem2, err := m.Memory()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if &mem2[0] != &mem[0] {
+		t.Error("Memory doesn't return the same mapping")
+	}
+
+	clone, err := m.Clone()
+	if err != nil {
+		t.Fatal(err)
+	}
+	clone.Close()
+	if _, err := clone.Memory(); err == nil {
+		t.Error("Memory doesn't return an error after Close")
+	}
+
+	arr := createArray(t)
+	defer arr.Close()
+
+	if _, err := arr.Memory(); err == nil {
+		t.Error("Memory accepts a map without BPF_F_MMAPABLE")
+	}
+}
+
+func TestMapNumaNode(t *testing.T) {
+	spec := &MapSpec{
+		Type:       Hash,
+		KeySize:    4,
+		ValueSize:  4,
+		MaxEntries: 1,
+		Flags:      unix.BPF_F_NUMA_NODE,
+	}
+
+	m, err := NewMap(spec)
+	if err != nil {
+		t.Fatal("Can't create map on NUMA node 0:", err)
+	}
+	m.Close()
+
+	spec.NumaNode = 1 << 20
+	if _, err := NewMap(spec); err == nil {
+		t.Error("Creating a map on a non-existent NUMA node doesn't return an error")
+	}
+}
+
+func TestNodeListContains(t *testing.T) {
+	for _, tc := range []struct {
+		list string
+		node uint32
+		want bool
+	}{
+		{"0\n", 0, true},
+		{"0\n", 1, false},
+		{"0-3", 2, true},
+		{"0-1,3", 2, false},
+		{"0-1,3", 3, true},
+		{"0,2-4\n", 4, true},
+		{"", 0, false},
+	} {
+		ok, err := nodeListContains(tc.list, tc.node)
+		qt.Assert(t, err, qt.IsNil, qt.Commentf("list %q", tc.list))
+		qt.Assert(t, ok, qt.Equals, tc.want, qt.Commentf("node %d in %q", tc.node, tc.list))
+	}
+
+	for _, list := range []string{"0-", "x", "3-1", "0,,1"} {
+		_, err := nodeListContains(list, 9)
+		qt.Assert(t, err, qt.IsNotNil, qt.Commentf("list %q", list))
+	}
 }
 
 func TestMapGetNextID(t *testing.T) {
@@ -2095,3 +3209,41 @@ func ExampleMap_Iterate_nestedMapsAndProgramArrays() {
 		panic(fmt.Sprint("Iterator encountered an error:", err))
 	}
 }
+
+func TestMapSpecBTFTypes(t *testing.T) {
+	spec, err := btf.LoadSpec(fmt.Sprintf("testdata/loader-%s.elf", internal.ClangEndian))
+	qt.Assert(t, err, qt.IsNil)
+
+	typ, err := spec.AnyTypeByName("uint32_t")
+	qt.Assert(t, err, qt.IsNil)
+	u32, ok := btf.UnderlyingType(typ).(*btf.Int)
+	qt.Assert(t, ok, qt.IsTrue)
+
+	m, err := NewMap(&MapSpec{
+		Type:       Hash,
+		KeySize:    4,
+		ValueSize:  4,
+		MaxEntries: 1,
+		Key:        typ,
+		Value:      u32,
+		BTF:        spec,
+	})
+	testutils.SkipIfNotSupported(t, err)
+	qt.Assert(t, err, qt.IsNil)
+	defer m.Close()
+
+	info, err := m.Info()
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, info.btfValue, qt.Not(qt.Equals), btf.TypeID(0))
+
+	_, err = NewMap(&MapSpec{
+		Type:       Hash,
+		KeySize:    8,
+		ValueSize:  4,
+		MaxEntries: 1,
+		Key:        typ,
+		Value:      u32,
+		BTF:        spec,
+	})
+	qt.Assert(t, err, qt.ErrorMatches, ".*key type.*has size 4, expected 8")
+}
@@ -6,6 +6,7 @@ import (
 	"encoding/binary"
 	"errors"
 	"fmt"
+	"io"
 	"reflect"
 	"runtime"
 	"sync"
@@ -145,13 +146,25 @@ func unmarshalBytes(data interface{}, buf []byte) error {
 		rd := bytesReaderPool.Get().(*bytes.Reader)
 		rd.Reset(buf)
 		defer bytesReaderPool.Put(rd)
-		if err := binary.Read(rd, internal.NativeEndian, value); err != nil {
+		err := binary.Read(rd, internal.NativeEndian, value)
+		if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+			if typ := reflect.TypeOf(value); typ.Kind() == reflect.Ptr && binary.Size(value) > 0 {
+				return internal.NewDecodeError(typ.Elem(), len(buf))
+			}
+		}
+		if err != nil {
 			return fmt.Errorf("decoding %T: %v", value, err)
 		}
 		return nil
 	}
 }
 
+// DecodeError is returned when a value can't be decoded because the buffer
+// read from the kernel is too short. It identifies the first field which
+// doesn't fit into the buffer, which usually points at a mismatch between
+// the layout of a C type and its Go equivalent.
+type DecodeError = internal.DecodeError
+
 // marshalPerCPUValue encodes a slice containing one value per
 // possible CPU into a buffer of bytes.
 //
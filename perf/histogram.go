@@ -0,0 +1,91 @@
+package perf
+
+import (
+	"fmt"
+	"io"
+	"math/bits"
+	"strings"
+	"sync"
+)
+
+// histogramWidth is the number of characters used for the largest bucket.
+const histogramWidth = 40
+
+// Histogram aggregates values into power-of-two buckets, for example to
+// summarize latencies read from a perf event array.
+//
+// It is safe to call Observe and Print concurrently.
+type Histogram struct {
+	unit string
+
+	mu sync.Mutex
+	// Bucket i contains the values which need i bits to be represented.
+	buckets [65]uint64
+}
+
+// NewHistogram creates an empty histogram.
+//
+// unit is used to label the values when printing the histogram, e.g. "usecs".
+func NewHistogram(unit string) *Histogram {
+	return &Histogram{unit: unit}
+}
+
+// Observe adds v to the histogram.
+func (h *Histogram) Observe(v uint64) {
+	h.mu.Lock()
+	h.buckets[bits.Len64(v)]++
+	h.mu.Unlock()
+}
+
+// Print writes a chart of the histogram to w, in the same format as the log2
+// histograms of BCC tools:
+//
+//	     usecs               : count    distribution
+//	         2 -> 3          : 1        |********************                    |
+//	         4 -> 7          : 2        |****************************************|
+//
+// Only the range of buckets containing values is printed.
+func (h *Histogram) Print(w io.Writer) error {
+	h.mu.Lock()
+	buckets := h.buckets
+	h.mu.Unlock()
+
+	first, last := -1, -1
+	var max uint64
+	for i, count := range buckets {
+		if count == 0 {
+			continue
+		}
+		if first == -1 {
+			first = i
+		}
+		last = i
+		if count > max {
+			max = count
+		}
+	}
+
+	if _, err := fmt.Fprintf(w, "%-24s : count    distribution\n", fmt.Sprintf("%10s", h.unit)); err != nil {
+		return err
+	}
+
+	if first == -1 {
+		return nil
+	}
+
+	for i := first; i <= last; i++ {
+		var low, high uint64
+		if i > 0 {
+			low = 1 << (i - 1)
+			high = low<<1 - 1
+		}
+
+		stars := int(buckets[i] * histogramWidth / max)
+		_, err := fmt.Fprintf(w, "%10d -> %-10d : %-8d |%-*s|\n", low, high, buckets[i], histogramWidth, strings.Repeat("*", stars))
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
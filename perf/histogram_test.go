@@ -0,0 +1,54 @@
+package perf
+
+import (
+	"strings"
+	"sync"
+	"testing"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestHistogram(t *testing.T) {
+	h := NewHistogram("usecs")
+
+	var buf strings.Builder
+	qt.Assert(t, h.Print(&buf), qt.IsNil)
+	qt.Assert(t, buf.String(), qt.Equals, "     usecs               : count    distribution\n")
+
+	var wg sync.WaitGroup
+	for _, v := range []uint64{2, 5, 7, 40} {
+		wg.Add(1)
+		go func(v uint64) {
+			defer wg.Done()
+			h.Observe(v)
+		}(v)
+	}
+	wg.Wait()
+
+	buf.Reset()
+	qt.Assert(t, h.Print(&buf), qt.IsNil)
+	qt.Assert(t, buf.String(), qt.Equals, strings.Join([]string{
+		"     usecs               : count    distribution",
+		"         2 -> 3          : 1        |********************                    |",
+		"         4 -> 7          : 2        |****************************************|",
+		"         8 -> 15         : 0        |                                        |",
+		"        16 -> 31         : 0        |                                        |",
+		"        32 -> 63         : 1        |********************                    |",
+		"",
+	}, "\n"))
+}
+
+func TestHistogramZero(t *testing.T) {
+	h := NewHistogram("nsecs")
+	h.Observe(0)
+	h.Observe(1)
+
+	var buf strings.Builder
+	qt.Assert(t, h.Print(&buf), qt.IsNil)
+	qt.Assert(t, buf.String(), qt.Equals, strings.Join([]string{
+		"     nsecs               : count    distribution",
+		"         0 -> 0          : 1        |****************************************|",
+		"         1 -> 1          : 1        |****************************************|",
+		"",
+	}, "\n"))
+}
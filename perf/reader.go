@@ -5,19 +5,24 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
 	"os"
 	"runtime"
 	"sync"
+	"syscall"
+	"time"
 
 	"github.com/cilium/ebpf"
 	"github.com/cilium/ebpf/internal"
 	"github.com/cilium/ebpf/internal/epoll"
+	"github.com/cilium/ebpf/internal/sys"
 	"github.com/cilium/ebpf/internal/unix"
 )
 
 var (
-	ErrClosed = os.ErrClosed
-	errEOR    = errors.New("end of ring")
+	ErrClosed   = os.ErrClosed
+	errEOR      = errors.New("end of ring")
+	errRejected = errors.New("sample rejected")
 )
 
 var perfEventHeaderSize = binary.Size(perfEventHeader{})
@@ -33,17 +38,48 @@ func cpuForEvent(event *unix.EpollEvent) int {
 	return int(event.Pad)
 }
 
+// SampleType selects fields which are recorded alongside the data submitted
+// via bpf_perf_event_output. See PERF_SAMPLE_* in <linux/perf_event.h>.
+type SampleType uint64
+
+const (
+	// SampleTID populates Record.PID and Record.TID.
+	SampleTID SampleType = unix.PERF_SAMPLE_TID
+	// SampleTime populates Record.Timestamp.
+	SampleTime SampleType = unix.PERF_SAMPLE_TIME
+	// SampleCallchain populates Record.Callchain.
+	SampleCallchain SampleType = unix.PERF_SAMPLE_CALLCHAIN
+	// SampleCPU populates Record.CPU from the sample instead of from
+	// the per CPU buffer the sample was read from.
+	SampleCPU SampleType = unix.PERF_SAMPLE_CPU
+)
+
+const supportedSampleTypes = SampleTID | SampleTime | SampleCallchain | SampleCPU
+
 // Record contains either a sample or a counter of the
 // number of lost samples.
 type Record struct {
 	// The CPU this record was generated on.
 	CPU int
 
-	// The data submitted via bpf_perf_event_output.
+	// The data submitted via bpf_perf_event_output, without any of the
+	// fields selected by ReaderOptions.SampleType.
 	// Due to a kernel bug, this can contain between 0 and 7 bytes of trailing
 	// garbage from the ring depending on the input sample's length.
 	RawSample []byte
 
+	// The process and thread ID of the task which generated the sample.
+	// Only populated if SampleTID is set.
+	PID, TID uint32
+
+	// The time the sample was generated at, in nanoseconds as given by the
+	// kernel's perf clock. Only populated if SampleTime is set.
+	Timestamp uint64
+
+	// The kernel and user space call chain of the task which generated the
+	// sample. Only populated if SampleCallchain is set.
+	Callchain []uint64
+
 	// The number of samples which could not be output, since
 	// the ring buffer was full.
 	LostSamples uint64
@@ -51,8 +87,12 @@ type Record struct {
 
 // Read a record from a reader and tag it as being from the given CPU.
 //
-// buf must be at least perfEventHeaderSize bytes long.
-func readRecord(rd io.Reader, rec *Record, buf []byte) error {
+// buf must be at least perfEventHeaderSize bytes long. Samples are parsed
+// according to sampleType.
+//
+// Returns errRejected and skips the sample if accept is not nil and returns
+// false for its raw sample.
+func readRecord(rd io.Reader, rec *Record, buf []byte, sampleType SampleType, accept func([]byte) bool) error {
 	// Assert that the buffer is large enough.
 	buf = buf[:perfEventHeaderSize]
 	_, err := io.ReadFull(rd, buf)
@@ -71,14 +111,14 @@ func readRecord(rd io.Reader, rec *Record, buf []byte) error {
 	switch header.Type {
 	case unix.PERF_RECORD_LOST:
 		rec.RawSample = rec.RawSample[:0]
+		rec.PID, rec.TID, rec.Timestamp = 0, 0, 0
+		rec.Callchain = rec.Callchain[:0]
 		rec.LostSamples, err = readLostRecords(rd)
 		return err
 
 	case unix.PERF_RECORD_SAMPLE:
 		rec.LostSamples = 0
-		// We can reuse buf here because perfEventHeaderSize > perfEventSampleSize.
-		rec.RawSample, err = readRawSample(rd, buf, rec.RawSample)
-		return err
+		return readSample(rd, rec, buf, sampleType, int(header.Size)-perfEventHeaderSize, accept)
 
 	default:
 		return &unknownEventError{header.Type}
@@ -107,7 +147,86 @@ type perfEventSample struct {
 	Size uint32
 }
 
-func readRawSample(rd io.Reader, buf, sampleBuf []byte) ([]byte, error) {
+// readSample parses the body of a PERF_RECORD_SAMPLE which is size bytes long.
+//
+// The fields are laid out in the order given by 'struct perf_event_sample' in
+// the kernel sources, and must add up to exactly size bytes.
+func readSample(rd io.Reader, rec *Record, buf []byte, sampleType SampleType, size int, accept func([]byte) bool) error {
+	if size < 0 {
+		return fmt.Errorf("invalid sample size %d", size)
+	}
+
+	lr := &io.LimitedReader{R: rd, N: int64(size)}
+	// buf is at least perfEventHeaderSize bytes, which fits every fixed size field.
+	buf = buf[:8]
+
+	rec.PID, rec.TID, rec.Timestamp = 0, 0, 0
+	rec.Callchain = rec.Callchain[:0]
+
+	if sampleType&SampleTID != 0 {
+		if _, err := io.ReadFull(lr, buf); err != nil {
+			return fmt.Errorf("read sample tid: %v", err)
+		}
+		rec.PID = internal.NativeEndian.Uint32(buf[0:4])
+		rec.TID = internal.NativeEndian.Uint32(buf[4:8])
+	}
+
+	if sampleType&SampleTime != 0 {
+		if _, err := io.ReadFull(lr, buf); err != nil {
+			return fmt.Errorf("read sample time: %v", err)
+		}
+		rec.Timestamp = internal.NativeEndian.Uint64(buf)
+	}
+
+	if sampleType&SampleCPU != 0 {
+		if _, err := io.ReadFull(lr, buf); err != nil {
+			return fmt.Errorf("read sample cpu: %v", err)
+		}
+		rec.CPU = int(internal.NativeEndian.Uint32(buf[0:4]))
+	}
+
+	if sampleType&SampleCallchain != 0 {
+		if _, err := io.ReadFull(lr, buf); err != nil {
+			return fmt.Errorf("read sample callchain length: %v", err)
+		}
+
+		nr := internal.NativeEndian.Uint64(buf)
+		if nr > uint64(lr.N)/8 {
+			return fmt.Errorf("sample callchain of %d entries exceeds sample size", nr)
+		}
+
+		for i := uint64(0); i < nr; i++ {
+			if _, err := io.ReadFull(lr, buf); err != nil {
+				return fmt.Errorf("read sample callchain: %v", err)
+			}
+			rec.Callchain = append(rec.Callchain, internal.NativeEndian.Uint64(buf))
+		}
+	}
+
+	raw, err := readRawSample(lr, buf, rec.RawSample, accept)
+	if errors.Is(err, errRejected) {
+		if _, err := io.CopyN(io.Discard, lr, lr.N); err != nil {
+			return fmt.Errorf("discard sample: %v", err)
+		}
+		return errRejected
+	}
+	if err != nil {
+		return err
+	}
+	rec.RawSample = raw
+
+	if trailing := lr.N; trailing != 0 {
+		// Skip the remainder so that the next record can be read.
+		if _, err := io.CopyN(io.Discard, lr, trailing); err != nil {
+			return fmt.Errorf("discard sample: %v", err)
+		}
+		return fmt.Errorf("sample contains %d unexpected bytes, sample type mismatch", trailing)
+	}
+
+	return nil
+}
+
+func readRawSample(rd io.Reader, buf, sampleBuf []byte, accept func([]byte) bool) ([]byte, error) {
 	buf = buf[:perfEventSampleSize]
 	if _, err := io.ReadFull(rd, buf); err != nil {
 		return nil, fmt.Errorf("read sample size: %v", err)
@@ -117,6 +236,16 @@ func readRawSample(rd io.Reader, buf, sampleBuf []byte) ([]byte, error) {
 		internal.NativeEndian.Uint32(buf),
 	}
 
+	if accept != nil {
+		if view, ok := peek(rd, int(sample.Size)); ok {
+			if !accept(view) {
+				// The caller skips the sample.
+				return nil, errRejected
+			}
+			accept = nil
+		}
+	}
+
 	var data []byte
 	if size := int(sample.Size); cap(sampleBuf) < size {
 		data = make([]byte, size)
@@ -127,9 +256,37 @@ func readRawSample(rd io.Reader, buf, sampleBuf []byte) ([]byte, error) {
 	if _, err := io.ReadFull(rd, data); err != nil {
 		return nil, fmt.Errorf("read sample: %v", err)
 	}
+
+	if accept != nil && !accept(data) {
+		// The sample wraps around the end of the ring and couldn't be
+		// peeked at, evaluate the predicate on the copy instead.
+		return nil, errRejected
+	}
+
 	return data, nil
 }
 
+// peeker is implemented by readers which can return the next n bytes without
+// copying or consuming them.
+type peeker interface {
+	peek(n int) ([]byte, bool)
+}
+
+// peek returns a view of the next n bytes in rd if possible.
+func peek(rd io.Reader, n int) ([]byte, bool) {
+	switch r := rd.(type) {
+	case *io.LimitedReader:
+		if r.N < int64(n) {
+			return nil, false
+		}
+		return peek(r.R, n)
+	case peeker:
+		return r.peek(n)
+	default:
+		return nil, false
+	}
+}
+
 // Reader allows reading bpf_perf_event_output
 // from user space.
 type Reader struct {
@@ -147,12 +304,20 @@ type Reader struct {
 	epollEvents []unix.EpollEvent
 	epollRings  []*perfEventRing
 	eventHeader []byte
+	sampleType  SampleType
+	accept      func([]byte) bool
 
 	// pauseFds are a copy of the fds in 'rings', protected by 'pauseMu'.
 	// These allow Pause/Resume to be executed independently of any ongoing
 	// Read calls, which would otherwise need to be interrupted.
 	pauseMu  sync.Mutex
 	pauseFds []int
+
+	// lostMu protects 'lost', which is configured via OnLostThreshold.
+	lostMu sync.Mutex
+	lost   *lostThreshold
+
+	stack sys.LeakStack
 }
 
 // ReaderOptions control the behaviour of the user
@@ -162,6 +327,34 @@ type ReaderOptions struct {
 	// Read will process data. Must be smaller than PerCPUBuffer.
 	// The default is to start processing as soon as data is available.
 	Watermark int
+
+	// Additional fields to record for each sample. Record.RawSample
+	// only ever contains the data submitted by the eBPF program.
+	SampleType SampleType
+
+	// Signal sent to the process whenever a per CPU buffer has data ready,
+	// as determined by Watermark. This allows integrating the Reader with
+	// an event loop driven by signals. Zero disables signals.
+	//
+	// The signal must be handled via os/signal.Notify, otherwise its
+	// default action applies, which terminates the process for SIGIO.
+	// Signals of the same type are coalesced while pending, so a single
+	// signal may stand for many records. Read keeps working as usual and
+	// returns all available records before blocking again, so a goroutine
+	// calling Read in a loop drains the buffers after a signal.
+	AsyncSignal syscall.Signal
+
+	// Accept is called with the raw sample of each record before it is
+	// copied out of the per CPU buffer. Records for which it returns false
+	// are skipped by Read, ReadInto and WriteTo without allocating a
+	// RawSample. Nil accepts all records.
+	//
+	// The predicate sees the sample in the ring itself, including the up to
+	// 7 bytes of padding added by the kernel. It must not modify or retain
+	// the slice. If a sample wraps around the end of the ring the predicate
+	// is evaluated on a copy instead. Records of lost samples are always
+	// returned.
+	Accept func(raw []byte) bool
 }
 
 // NewReader creates a new reader with default options.
@@ -179,6 +372,14 @@ func NewReaderWithOptions(array *ebpf.Map, perCPUBuffer int, opts ReaderOptions)
 		return nil, errors.New("perCPUBuffer must be larger than 0")
 	}
 
+	if unsupported := opts.SampleType &^ supportedSampleTypes; unsupported != 0 {
+		return nil, fmt.Errorf("unsupported sample type %#x", uint64(unsupported))
+	}
+
+	if opts.AsyncSignal < 0 {
+		return nil, fmt.Errorf("invalid signal %d", int(opts.AsyncSignal))
+	}
+
 	var (
 		fds      []int
 		nCPU     = int(array.MaxEntries())
@@ -209,7 +410,7 @@ func NewReaderWithOptions(array *ebpf.Map, perCPUBuffer int, opts ReaderOptions)
 	// but doesn't allow using a wildcard like -1 to specify "all CPUs".
 	// Hence we have to create a ring for each CPU.
 	for i := 0; i < nCPU; i++ {
-		ring, err := newPerfEventRing(i, perCPUBuffer, opts.Watermark)
+		ring, err := newPerfEventRing(i, perCPUBuffer, opts.Watermark, opts.SampleType)
 		if errors.Is(err, unix.ENODEV) {
 			// The requested CPU is currently offline, skip it.
 			rings = append(rings, nil)
@@ -223,6 +424,12 @@ func NewReaderWithOptions(array *ebpf.Map, perCPUBuffer int, opts ReaderOptions)
 		rings = append(rings, ring)
 		pauseFds = append(pauseFds, ring.fd)
 
+		if opts.AsyncSignal != 0 {
+			if err := enableAsyncSignal(ring.fd, opts.AsyncSignal); err != nil {
+				return nil, fmt.Errorf("enable signal for CPU %d: %w", i, err)
+			}
+		}
+
 		if err := poller.Add(ring.fd, i); err != nil {
 			return nil, err
 		}
@@ -240,12 +447,18 @@ func NewReaderWithOptions(array *ebpf.Map, perCPUBuffer int, opts ReaderOptions)
 		epollEvents: make([]unix.EpollEvent, len(rings)),
 		epollRings:  make([]*perfEventRing, 0, len(rings)),
 		eventHeader: make([]byte, perfEventHeaderSize),
+		sampleType:  opts.SampleType,
+		accept:      opts.Accept,
 		pauseFds:    pauseFds,
+		stack:       sys.NewLeakStack(),
 	}
 	if err = pr.Resume(); err != nil {
 		return nil, err
 	}
-	runtime.SetFinalizer(pr, (*Reader).Close)
+	runtime.SetFinalizer(pr, func(pr *Reader) {
+		pr.stack.Warn("perf.Reader")
+		_ = pr.Close()
+	})
 	return pr, nil
 }
 
@@ -256,6 +469,8 @@ func NewReaderWithOptions(array *ebpf.Map, perCPUBuffer int, opts ReaderOptions)
 // Calls to perf_event_output from eBPF programs will return
 // ENOENT after calling this method.
 func (pr *Reader) Close() error {
+	runtime.SetFinalizer(pr, nil)
+
 	if err := pr.poller.Close(); err != nil {
 		if errors.Is(err, os.ErrClosed) {
 			return nil
@@ -296,6 +511,10 @@ func (pr *Reader) Read() (Record, error) {
 }
 
 // ReadInto is like Read except that it allows reusing Record and associated buffers.
+//
+// RawSample and Callchain of rec are overwritten, and only reallocated if
+// their capacity is too small for the next record. Copy them if they need
+// to outlive the next call to ReadInto with the same Record.
 func (pr *Reader) ReadInto(rec *Record) error {
 	pr.mu.Lock()
 	defer pr.mu.Unlock()
@@ -332,11 +551,67 @@ func (pr *Reader) ReadInto(rec *Record) error {
 			pr.epollRings = pr.epollRings[:len(pr.epollRings)-1]
 			continue
 		}
+		if err == errRejected {
+			continue
+		}
 
 		return err
 	}
 }
 
+// LostSamplesMarker is written by WriteTo instead of a sample length to
+// indicate a record of lost samples.
+const LostSamplesMarker = math.MaxUint32
+
+// WriteTo reads records and writes them to w until the Reader is closed.
+//
+// Each sample is written as a 4 byte length followed by RawSample. A record
+// of lost samples is written as LostSamplesMarker followed by the number of
+// lost samples as 8 bytes. All integers are in the host's native endianness.
+// Each record is passed to w in a single call to Write.
+//
+// Other fields of Record, such as CPU and the fields selected by
+// ReaderOptions.SampleType, aren't written. Use ReadInto if they are needed.
+//
+// Returns a nil error once the Reader is closed.
+func (pr *Reader) WriteTo(w io.Writer) (int64, error) {
+	var (
+		rec     Record
+		buf     []byte
+		written int64
+	)
+
+	for {
+		err := pr.ReadInto(&rec)
+		if errors.Is(err, ErrClosed) {
+			return written, nil
+		}
+		if err != nil {
+			return written, err
+		}
+
+		var hdr [12]byte
+		if rec.LostSamples > 0 {
+			internal.NativeEndian.PutUint32(hdr[:4], LostSamplesMarker)
+			internal.NativeEndian.PutUint64(hdr[4:], rec.LostSamples)
+			buf = append(buf[:0], hdr[:]...)
+		} else {
+			if uint64(len(rec.RawSample)) >= LostSamplesMarker {
+				return written, fmt.Errorf("sample of %d bytes is too large", len(rec.RawSample))
+			}
+			internal.NativeEndian.PutUint32(hdr[:4], uint32(len(rec.RawSample)))
+			buf = append(buf[:0], hdr[:4]...)
+			buf = append(buf, rec.RawSample...)
+		}
+
+		n, err := w.Write(buf)
+		written += int64(n)
+		if err != nil {
+			return written, err
+		}
+	}
+}
+
 // Pause stops all notifications from this Reader.
 //
 // While the Reader is paused, any attempts to write to the event buffer from
@@ -389,7 +664,79 @@ func (pr *Reader) readRecordFromRing(rec *Record, ring *perfEventRing) error {
 	defer ring.writeTail()
 
 	rec.CPU = ring.cpu
-	return readRecord(ring, rec, pr.eventHeader)
+	err := readRecord(ring, rec, pr.eventHeader, pr.sampleType, pr.accept)
+	if err == nil && rec.LostSamples > 0 {
+		pr.observeLost(rec.LostSamples)
+	}
+	return err
+}
+
+// OnLostThreshold invokes action when more than count samples are lost
+// within the given duration.
+//
+// Lost samples are accounted in consecutive windows of the given duration,
+// the first of which starts with the first lost sample. action is invoked at
+// most once per window, from a new goroutine so that it can't delay reading
+// from the ring buffer. Lost samples are only accounted when they are
+// returned by Read, ReadInto or WriteTo.
+//
+// Passing a nil action removes a previously configured threshold.
+func (pr *Reader) OnLostThreshold(count uint64, within time.Duration, action func()) error {
+	if action == nil {
+		pr.lostMu.Lock()
+		pr.lost = nil
+		pr.lostMu.Unlock()
+		return nil
+	}
+
+	if within <= 0 {
+		return fmt.Errorf("window must be positive, got %s", within)
+	}
+
+	pr.lostMu.Lock()
+	pr.lost = &lostThreshold{count: count, within: within, action: action}
+	pr.lostMu.Unlock()
+	return nil
+}
+
+func (pr *Reader) observeLost(n uint64) {
+	pr.lostMu.Lock()
+	var action func()
+	if pr.lost != nil && pr.lost.observe(n, internal.Now()) {
+		action = pr.lost.action
+	}
+	pr.lostMu.Unlock()
+
+	if action != nil {
+		go action()
+	}
+}
+
+// lostThreshold keeps track of the lost samples in the current window.
+type lostThreshold struct {
+	count  uint64
+	within time.Duration
+	action func()
+
+	start time.Time
+	lost  uint64
+	fired bool
+}
+
+// observe accounts n lost samples at the given time and returns true if
+// the action should be invoked.
+func (lt *lostThreshold) observe(n uint64, now time.Time) bool {
+	if lt.start.IsZero() || now.Sub(lt.start) >= lt.within {
+		lt.start, lt.lost, lt.fired = now, 0, false
+	}
+
+	lt.lost += n
+	if lt.fired || lt.lost <= lt.count {
+		return false
+	}
+
+	lt.fired = true
+	return true
 }
 
 type unknownEventError struct {
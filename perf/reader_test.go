@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"os"
+	"os/signal"
 	"syscall"
 	"testing"
 	"time"
@@ -60,6 +61,140 @@ func TestPerfReader(t *testing.T) {
 	}
 }
 
+func TestPerfReaderReadInto(t *testing.T) {
+	prog, events := mustOutputSamplesProg(t, 12, 5)
+	defer prog.Close()
+	defer events.Close()
+
+	rd, err := NewReader(events, 4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rd.Close()
+
+	ret, _, err := prog.Test(make([]byte, 14))
+	testutils.SkipIfNotSupported(t, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if errno := syscall.Errno(-int32(ret)); errno != 0 {
+		t.Fatal("Expected 0 as return value, got", errno)
+	}
+
+	var rec Record
+	if err := rd.ReadInto(&rec); err != nil {
+		t.Fatal("Can't read first sample:", err)
+	}
+	first := &rec.RawSample[0]
+
+	if err := rd.ReadInto(&rec); err != nil {
+		t.Fatal("Can't read second sample:", err)
+	}
+
+	qt.Assert(t, rec.RawSample[:5], qt.DeepEquals, []byte{1, 2, 3, 4, 4})
+	if &rec.RawSample[0] != first {
+		t.Error("ReadInto doesn't reuse RawSample")
+	}
+}
+
+func TestPerfReaderAccept(t *testing.T) {
+	prog, events := mustOutputSamplesProg(t, 5, 20, 5)
+	defer prog.Close()
+	defer events.Close()
+
+	var calls int
+	rd, err := NewReaderWithOptions(events, 4096, ReaderOptions{
+		Accept: func(raw []byte) bool {
+			calls++
+			return len(raw) > 12
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rd.Close()
+
+	ret, _, err := prog.Test(make([]byte, 14))
+	testutils.SkipIfNotSupported(t, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if errno := syscall.Errno(-int32(ret)); errno != 0 {
+		t.Fatal("Expected 0 as return value, got", errno)
+	}
+
+	record, err := rd.Read()
+	if err != nil {
+		t.Fatal("Can't read samples:", err)
+	}
+	if len(record.RawSample) != 20 {
+		t.Fatal("Expected the accepted 20 byte sample, got", len(record.RawSample))
+	}
+
+	errs := make(chan error, 1)
+	go func() {
+		_, err := rd.Read()
+		errs <- err
+	}()
+
+	select {
+	case err := <-errs:
+		t.Fatal("Expected the remaining sample to be rejected, got", err)
+	case <-time.After(readTimeout):
+	}
+
+	rd.Close()
+	if err := <-errs; !errors.Is(err, ErrClosed) {
+		t.Fatal("Expected ErrClosed, got", err)
+	}
+
+	if calls != 3 {
+		t.Error("Expected Accept to be called once per sample, got", calls)
+	}
+}
+
+func TestPerfReaderAsyncSignal(t *testing.T) {
+	prog, events := mustOutputSamplesProg(t, 5)
+	defer prog.Close()
+	defer events.Close()
+
+	sigs := make(chan os.Signal, 1)
+	signal.Notify(sigs, syscall.SIGUSR1)
+	defer signal.Stop(sigs)
+
+	rd, err := NewReaderWithOptions(events, 4096, ReaderOptions{AsyncSignal: syscall.SIGUSR1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rd.Close()
+
+	ret, _, err := prog.Test(make([]byte, 14))
+	testutils.SkipIfNotSupported(t, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if errno := syscall.Errno(-int32(ret)); errno != 0 {
+		t.Fatal("Expected 0 as return value, got", errno)
+	}
+
+	select {
+	case <-sigs:
+	case <-time.After(time.Second):
+		t.Fatal("No signal received")
+	}
+
+	if _, err := rd.Read(); err != nil {
+		t.Fatal("Can't read samples:", err)
+	}
+
+	if _, err := NewReaderWithOptions(events, 4096, ReaderOptions{AsyncSignal: -1}); err == nil {
+		t.Error("Negative signal doesn't return an error")
+	}
+}
+
 func outputSamplesProg(sampleSizes ...int) (*ebpf.Program, *ebpf.Map, error) {
 	const bpfFCurrentCPU = 0xffffffff
 
@@ -214,6 +349,11 @@ func TestPerfReaderLostSample(t *testing.T) {
 	}
 	defer rd.Close()
 
+	exceeded := make(chan struct{})
+	if err := rd.OnLostThreshold(0, time.Minute, func() { close(exceeded) }); err != nil {
+		t.Fatal(err)
+	}
+
 	ret, _, err := prog.Test(make([]byte, 14))
 	testutils.SkipIfNotSupported(t, err)
 	if err != nil {
@@ -234,6 +374,63 @@ func TestPerfReaderLostSample(t *testing.T) {
 			t.Fatal("Expected a record with LostSamples 1, got", record.LostSamples)
 		}
 	}
+
+	select {
+	case <-exceeded:
+	case <-time.After(time.Second):
+		t.Fatal("Lost sample threshold action wasn't invoked")
+	}
+}
+
+func TestLostThreshold(t *testing.T) {
+	start := time.Unix(0, 0)
+	lt := lostThreshold{count: 2, within: time.Second}
+
+	if lt.observe(2, start) {
+		t.Error("Threshold exceeded by two lost samples")
+	}
+	if !lt.observe(1, start.Add(time.Millisecond)) {
+		t.Error("Threshold not exceeded by three lost samples")
+	}
+	if lt.observe(10, start.Add(2*time.Millisecond)) {
+		t.Error("Threshold exceeded twice in the same window")
+	}
+	if lt.observe(1, start.Add(time.Second)) {
+		t.Error("Lost samples from the previous window are accounted")
+	}
+	if !lt.observe(2, start.Add(1500*time.Millisecond)) {
+		t.Error("Threshold not exceeded in the new window")
+	}
+}
+
+func TestOnLostThreshold(t *testing.T) {
+	testutils.StubClock(t, testutils.FixedClock(time.Unix(0, 0), time.Millisecond))
+
+	rd := &Reader{}
+	if err := rd.OnLostThreshold(1, 0, func() {}); err == nil {
+		t.Fatal("Expected an error for a zero window")
+	}
+
+	called := make(chan struct{}, 2)
+	if err := rd.OnLostThreshold(1, time.Second, func() { called <- struct{}{} }); err != nil {
+		t.Fatal(err)
+	}
+
+	rd.observeLost(1)
+	rd.observeLost(1)
+	select {
+	case <-called:
+	case <-time.After(time.Second):
+		t.Fatal("Action wasn't invoked")
+	}
+
+	if err := rd.OnLostThreshold(0, time.Second, nil); err != nil {
+		t.Fatal(err)
+	}
+	rd.observeLost(100)
+	if rd.lost != nil {
+		t.Fatal("Threshold wasn't removed")
+	}
 }
 
 func TestPerfReaderClose(t *testing.T) {
@@ -279,7 +476,7 @@ func TestPerfReaderClose(t *testing.T) {
 }
 
 func TestCreatePerfEvent(t *testing.T) {
-	fd, err := createPerfEvent(0, 1)
+	fd, err := createPerfEvent(0, 1, 0)
 	if err != nil {
 		t.Fatal("Can't create perf event:", err)
 	}
@@ -295,12 +492,170 @@ func TestReadRecord(t *testing.T) {
 	}
 
 	var rec Record
-	err = readRecord(&buf, &rec, make([]byte, perfEventHeaderSize))
+	err = readRecord(&buf, &rec, make([]byte, perfEventHeaderSize), 0, nil)
 	if !IsUnknownEvent(err) {
 		t.Error("readRecord should return unknown event error, got", err)
 	}
 }
 
+func TestReadRecordSampleType(t *testing.T) {
+	var body bytes.Buffer
+	write := func(data interface{}) {
+		t.Helper()
+		if err := binary.Write(&body, internal.NativeEndian, data); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	write([2]uint32{42, 43})       // SampleTID
+	write(uint64(1234))            // SampleTime
+	write([2]uint32{3, 0})         // SampleCPU
+	write([]uint64{2, 0xaa, 0xbb}) // SampleCallchain
+	write(uint32(4))               // PERF_SAMPLE_RAW
+	write([]byte{1, 2, 3, 4})
+
+	record := func() *bytes.Buffer {
+		var buf bytes.Buffer
+		header := perfEventHeader{
+			Type: unix.PERF_RECORD_SAMPLE,
+			Size: uint16(perfEventHeaderSize + body.Len()),
+		}
+		if err := binary.Write(&buf, internal.NativeEndian, &header); err != nil {
+			t.Fatal(err)
+		}
+		buf.Write(body.Bytes())
+		return &buf
+	}
+
+	c := qt.New(t)
+
+	var rec Record
+	err := readRecord(record(), &rec, make([]byte, perfEventHeaderSize), SampleTID|SampleTime|SampleCPU|SampleCallchain, nil)
+	c.Assert(err, qt.IsNil)
+	c.Assert(rec.PID, qt.Equals, uint32(42))
+	c.Assert(rec.TID, qt.Equals, uint32(43))
+	c.Assert(rec.Timestamp, qt.Equals, uint64(1234))
+	c.Assert(rec.CPU, qt.Equals, 3)
+	c.Assert(rec.Callchain, qt.DeepEquals, []uint64{0xaa, 0xbb})
+	c.Assert(rec.RawSample, qt.DeepEquals, []byte{1, 2, 3, 4})
+
+	// Parsing with a different sample type than the record was written with
+	// must not silently return a bogus RawSample.
+	buf := record()
+	err = readRecord(buf, &rec, make([]byte, perfEventHeaderSize), SampleTID, nil)
+	c.Assert(err, qt.IsNotNil)
+	c.Assert(buf.Len(), qt.Equals, 0, qt.Commentf("record wasn't consumed"))
+}
+
+func TestPerfReaderSampleType(t *testing.T) {
+	prog, events := mustOutputSamplesProg(t, 5)
+	defer prog.Close()
+	defer events.Close()
+
+	rd, err := NewReaderWithOptions(events, 4096, ReaderOptions{
+		SampleType: SampleTID | SampleTime | SampleCPU,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rd.Close()
+
+	ret, _, err := prog.Test(make([]byte, 14))
+	testutils.SkipIfNotSupported(t, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if errno := syscall.Errno(-int32(ret)); errno != 0 {
+		t.Fatal("Expected 0 as return value, got", errno)
+	}
+
+	record, err := rd.Read()
+	if err != nil {
+		t.Fatal("Can't read samples:", err)
+	}
+
+	want := []byte{1, 2, 3, 4, 4, 0, 0, 0, 0, 0, 0, 0}
+	if !bytes.Equal(record.RawSample, want) {
+		t.Log(record.RawSample)
+		t.Error("Sample doesn't match expected output")
+	}
+
+	if record.PID != uint32(os.Getpid()) {
+		t.Errorf("Expected PID %d, got %d", os.Getpid(), record.PID)
+	}
+
+	if record.Timestamp == 0 {
+		t.Error("Record has no timestamp")
+	}
+
+	if _, err := NewReaderWithOptions(events, 4096, ReaderOptions{SampleType: 1 << 63}); err == nil {
+		t.Error("Unsupported sample type doesn't return an error")
+	}
+}
+
+type chanWriter chan []byte
+
+func (cw chanWriter) Write(p []byte) (int, error) {
+	cw <- append([]byte(nil), p...)
+	return len(p), nil
+}
+
+func TestPerfReaderWriteTo(t *testing.T) {
+	prog, events := mustOutputSamplesProg(t, 5)
+	defer prog.Close()
+	defer events.Close()
+
+	rd, err := NewReader(events, 4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rd.Close()
+
+	frames := make(chanWriter, 1)
+	errs := make(chan error, 1)
+	go func() {
+		_, err := rd.WriteTo(frames)
+		errs <- err
+	}()
+
+	ret, _, err := prog.Test(make([]byte, 14))
+	testutils.SkipIfNotSupported(t, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if errno := syscall.Errno(-int32(ret)); errno != 0 {
+		t.Fatal("Expected 0 as return value, got", errno)
+	}
+
+	var frame []byte
+	select {
+	case frame = <-frames:
+	case <-time.After(time.Second):
+		t.Fatal("WriteTo doesn't write a sample")
+	}
+
+	sample := []byte{1, 2, 3, 4, 4, 0, 0, 0, 0, 0, 0, 0}
+	want := make([]byte, 4, 4+len(sample))
+	internal.NativeEndian.PutUint32(want, uint32(len(sample)))
+	want = append(want, sample...)
+
+	if !bytes.Equal(frame, want) {
+		t.Errorf("Expected frame %v, got %v", want, frame)
+	}
+
+	rd.Close()
+	select {
+	case err := <-errs:
+		if err != nil {
+			t.Error("WriteTo returns an error after Close:", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Close doesn't interrupt WriteTo")
+	}
+}
+
 func TestPause(t *testing.T) {
 	t.Parallel()
 
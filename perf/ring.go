@@ -8,6 +8,7 @@ import (
 	"os"
 	"runtime"
 	"sync/atomic"
+	"syscall"
 	"unsafe"
 
 	"github.com/cilium/ebpf/internal/unix"
@@ -22,12 +23,12 @@ type perfEventRing struct {
 	*ringReader
 }
 
-func newPerfEventRing(cpu, perCPUBuffer, watermark int) (*perfEventRing, error) {
+func newPerfEventRing(cpu, perCPUBuffer, watermark int, sampleType SampleType) (*perfEventRing, error) {
 	if watermark >= perCPUBuffer {
 		return nil, errors.New("watermark must be smaller than perCPUBuffer")
 	}
 
-	fd, err := createPerfEvent(cpu, watermark)
+	fd, err := createPerfEvent(cpu, watermark, sampleType)
 	if err != nil {
 		return nil, err
 	}
@@ -60,6 +61,29 @@ func newPerfEventRing(cpu, perCPUBuffer, watermark int) (*perfEventRing, error)
 	return ring, nil
 }
 
+// enableAsyncSignal makes the kernel send sig to the current process
+// whenever the perf event behind fd has data ready.
+func enableAsyncSignal(fd int, sig syscall.Signal) error {
+	if _, err := unix.FcntlInt(uintptr(fd), unix.F_SETOWN, unix.Getpid()); err != nil {
+		return fmt.Errorf("set owner: %w", err)
+	}
+
+	if _, err := unix.FcntlInt(uintptr(fd), unix.F_SETSIG, int(sig)); err != nil {
+		return fmt.Errorf("set signal: %w", err)
+	}
+
+	flags, err := unix.FcntlInt(uintptr(fd), unix.F_GETFL, 0)
+	if err != nil {
+		return fmt.Errorf("get flags: %w", err)
+	}
+
+	if _, err := unix.FcntlInt(uintptr(fd), unix.F_SETFL, flags|unix.O_ASYNC); err != nil {
+		return fmt.Errorf("set O_ASYNC: %w", err)
+	}
+
+	return nil
+}
+
 // mmapBufferSize returns a valid mmap buffer size for use with perf_event_open (1+2^n pages)
 func perfBufferSize(perCPUBuffer int) int {
 	pageSize := os.Getpagesize()
@@ -86,7 +110,7 @@ func (ring *perfEventRing) Close() {
 	ring.mmap = nil
 }
 
-func createPerfEvent(cpu, watermark int) (int, error) {
+func createPerfEvent(cpu, watermark int, sampleType SampleType) (int, error) {
 	if watermark == 0 {
 		watermark = 1
 	}
@@ -95,7 +119,7 @@ func createPerfEvent(cpu, watermark int) (int, error) {
 		Type:        unix.PERF_TYPE_SOFTWARE,
 		Config:      unix.PERF_COUNT_SW_BPF_OUTPUT,
 		Bits:        unix.PerfBitWatermark,
-		Sample_type: unix.PERF_SAMPLE_RAW,
+		Sample_type: unix.PERF_SAMPLE_RAW | uint64(sampleType),
 		Wakeup:      uint32(watermark),
 	}
 
@@ -135,6 +159,16 @@ func (rr *ringReader) writeTail() {
 	atomic.StoreUint64(&rr.meta.Data_tail, rr.tail)
 }
 
+// peek implements peeker. It fails if the next n bytes wrap around the end of
+// the ring.
+func (rr *ringReader) peek(n int) ([]byte, bool) {
+	start := int(rr.tail & rr.mask)
+	if uint64(n) > rr.head-rr.tail || start+n > cap(rr.ring) {
+		return nil, false
+	}
+	return rr.ring[start : start+n : start+n], true
+}
+
 func (rr *ringReader) Read(p []byte) (int, error) {
 	start := int(rr.tail & rr.mask)
 
@@ -6,6 +6,7 @@ import (
 	"errors"
 	"fmt"
 	"math"
+	"os"
 	"path/filepath"
 	"runtime"
 	"strings"
@@ -21,6 +22,11 @@ import (
 // ErrNotSupported is returned whenever the kernel doesn't support a feature.
 var ErrNotSupported = internal.ErrNotSupported
 
+// VerifierError is returned by NewProgram and NewCollection when the kernel
+// rejects a program. Use errors.As to retrieve it, and WithSource to annotate
+// the verifier log with source line information.
+type VerifierError = internal.VerifierError
+
 // ProgramID represents the unique ID of an eBPF program.
 type ProgramID uint32
 
@@ -50,12 +56,21 @@ type ProgramOptions struct {
 	// (containers) or where it is in a non-standard location. Defaults to
 	// use the kernel BTF from a well-known location if nil.
 	KernelTypes *btf.Spec
+
+	// TokenFD is a BPF token delegated by a privileged process, which
+	// allows loading programs without privileges. The kernel also checks the
+	// token of a program when attaching it, so links don't need a token of
+	// their own. Zero doesn't use a token.
+	//
+	// Needs kernel 6.9+.
+	TokenFD int
 }
 
 // ProgramSpec defines a Program.
 type ProgramSpec struct {
 	// Name is passed to the kernel as a debug aid. Must only contain
-	// alpha numeric and '_' characters.
+	// alpha numeric and '_' characters. The kernel only retains the first
+	// 15 bytes, longer names are truncated.
 	Name string
 
 	// Type determines at which hook in the kernel a program will run.
@@ -64,11 +79,18 @@ type ProgramSpec struct {
 	// AttachType of the program, needed to differentiate allowed context
 	// accesses in some newer program types like CGroupSockAddr.
 	//
+	// It is derived from the ELF section name, but may be changed before
+	// loading a CollectionSpec, for example to load a Tracing program for
+	// AttachTraceFEntry. Loading fails if it isn't compatible with Type.
+	//
 	// Available on kernels 4.17 and later.
 	AttachType AttachType
 
 	// Name of a kernel data structure or function to attach to. Its
 	// interpretation depends on Type and AttachType.
+	//
+	// Kernel functions are searched in vmlinux and then in kernel modules,
+	// unless ProgramOptions.KernelTypes is set.
 	AttachTo string
 
 	// The program to attach to. Must be provided manually.
@@ -84,7 +106,12 @@ type ProgramSpec struct {
 	Flags uint32
 
 	// License of the program. Some helpers are only available if
-	// the license is deemed compatible with the GPL.
+	// the license is deemed compatible with the GPL, for example
+	// "Dual BSD/GPL". Loading a program which calls such a helper without
+	// a compatible license returns an error.
+	//
+	// Defaults to the license section of the ELF, but can be overridden
+	// before loading without recompiling the program.
 	//
 	// See https://www.kernel.org/doc/html/latest/process/license-rules.html#id1
 	License string
@@ -175,6 +202,8 @@ type Program struct {
 	name       string
 	pinnedPath string
 	typ        ProgramType
+	// The attach type the program was loaded with, nil if unknown.
+	attachType *AttachType
 }
 
 // NewProgram creates a new Program.
@@ -189,7 +218,9 @@ func NewProgram(spec *ProgramSpec) (*Program, error) {
 //
 // Loading a program for the first time will perform
 // feature detection by loading small, temporary programs.
-func NewProgramWithOptions(spec *ProgramSpec, opts ProgramOptions) (*Program, error) {
+func NewProgramWithOptions(spec *ProgramSpec, opts ProgramOptions) (_ *Program, err error) {
+	defer internal.AddStackTrace(&err)
+
 	if spec == nil {
 		return nil, errors.New("can't load a program from a nil spec")
 	}
@@ -213,6 +244,10 @@ func newProgramWithOptions(spec *ProgramSpec, opts ProgramOptions, handles *hand
 		return nil, errors.New("can't load program of unspecified type")
 	}
 
+	if err := checkLicense(spec.License, spec.Instructions); err != nil {
+		return nil, err
+	}
+
 	if spec.ByteOrder != nil && spec.ByteOrder != internal.NativeEndian {
 		return nil, fmt.Errorf("can't load %s program on %s", spec.ByteOrder, internal.NativeEndian)
 	}
@@ -238,6 +273,13 @@ func newProgramWithOptions(spec *ProgramSpec, opts ProgramOptions, handles *hand
 		KernVersion:        kv,
 	}
 
+	if opts.TokenFD != 0 {
+		if err := haveBPFToken(); err != nil {
+			return nil, fmt.Errorf("load program: %w", err)
+		}
+		attr.ProgFlags |= sys.BPF_F_TOKEN_FD
+	}
+
 	if haveObjName() == nil {
 		attr.ProgName = sys.NewObjName(spec.Name)
 	}
@@ -253,7 +295,7 @@ func newProgramWithOptions(spec *ProgramSpec, opts ProgramOptions, handles *hand
 			return nil, fmt.Errorf("apply CO-RE relocations: %w", err)
 		}
 
-		handle, err := handles.btfHandle(spec.BTF)
+		handle, err := handles.btfHandle(spec.BTF, opts.TokenFD)
 		btfDisabled = errors.Is(err, btf.ErrNotSupported)
 		if err != nil && !btfDisabled {
 			return nil, fmt.Errorf("load BTF: %w", err)
@@ -301,7 +343,7 @@ func newProgramWithOptions(spec *ProgramSpec, opts ProgramOptions, handles *hand
 		attr.AttachProgFd = uint32(spec.AttachTarget.FD())
 		defer runtime.KeepAlive(spec.AttachTarget)
 	} else if spec.AttachTo != "" {
-		targetID, err := findTargetInKernel(kernelTypes, spec.AttachTo, spec.Type, spec.AttachType)
+		targetID, module, err := findTargetInKernel(kernelTypes, spec.AttachTo, spec.Type, spec.AttachType)
 		if err != nil && !errors.Is(err, errUnrecognizedAttachType) {
 			// We ignore errUnrecognizedAttachType since AttachTo may be non-empty
 			// for programs that don't attach anywhere.
@@ -309,6 +351,12 @@ func newProgramWithOptions(spec *ProgramSpec, opts ProgramOptions, handles *hand
 		}
 
 		attr.AttachBtfId = uint32(targetID)
+		if module != nil {
+			// The kernel takes a reference to the module BTF, so the fd
+			// can be closed once the program is loaded.
+			defer module.Close()
+			attr.AttachProgFd = module.Uint()
+		}
 	}
 
 	logSize := DefaultVerifierLogSize
@@ -324,9 +372,20 @@ func newProgramWithOptions(spec *ProgramSpec, opts ProgramOptions, handles *hand
 		attr.LogBuf = sys.NewSlicePointer(logBuf)
 	}
 
-	fd, err := sys.ProgLoad(attr)
+	load := func() (*sys.FD, error) {
+		if opts.TokenFD == 0 {
+			return sys.ProgLoad(attr)
+		}
+		return sys.ProgLoadToken(&sys.ProgLoadTokenAttr{
+			ProgLoadAttr: *attr,
+			ProgTokenFd:  int32(opts.TokenFD),
+		})
+	}
+
+	fd, err := load()
 	if err == nil {
-		return &Program{unix.ByteSliceToString(logBuf), fd, spec.Name, "", spec.Type}, nil
+		attachType := spec.AttachType
+		return &Program{unix.ByteSliceToString(logBuf), fd, spec.Name, "", spec.Type, &attachType}, nil
 	}
 
 	logErr := err
@@ -337,7 +396,7 @@ func newProgramWithOptions(spec *ProgramSpec, opts ProgramOptions, handles *hand
 		attr.LogSize = uint32(len(logBuf))
 		attr.LogBuf = sys.NewSlicePointer(logBuf)
 
-		fd, logErr = sys.ProgLoad(attr)
+		fd, logErr = load()
 		if logErr == nil {
 			fd.Close()
 		}
@@ -345,7 +404,7 @@ func newProgramWithOptions(spec *ProgramSpec, opts ProgramOptions, handles *hand
 
 	if (errors.Is(err, unix.EINVAL) || errors.Is(err, unix.EPERM)) && hasReferences(spec.Instructions) {
 		if err := haveBPFToBPFCalls(); err != nil {
-			return nil, fmt.Errorf("load program: %w", internal.ErrorWithLog(err, logBuf, logErr))
+			return nil, fmt.Errorf("load program: %w", verifierError(err, logBuf, logErr, insns))
 		}
 	}
 
@@ -355,13 +414,41 @@ func newProgramWithOptions(spec *ProgramSpec, opts ProgramOptions, handles *hand
 		return nil, fmt.Errorf("load program: %w (MEMLOCK may be too low, consider rlimit.RemoveMemlock)", logErr)
 	}
 
-	err = internal.ErrorWithLog(err, logBuf, logErr)
+	if errors.Is(logErr, unix.EINVAL) && spec.AttachType != AttachNone && len(logBuf) > 0 && logBuf[0] == 0 {
+		// The kernel checks the attach type before running the verifier, so
+		// an empty log hints at an attach type which doesn't match the program
+		// type.
+		return nil, fmt.Errorf("load program: %w (attach type %s may be incompatible with program type %s)", logErr, spec.AttachType, spec.Type)
+	}
+
+	err = verifierError(err, logBuf, logErr, insns)
 	if btfDisabled {
 		return nil, fmt.Errorf("load program without BTF: %w", err)
 	}
 	return nil, fmt.Errorf("load program: %w", err)
 }
 
+// verifierError wraps err with the verifier log, and with the source
+// locations of insns if they contain line info.
+func verifierError(err error, logBuf []byte, logErr error, insns asm.Instructions) error {
+	verr := internal.ErrorWithLog(err, logBuf, logErr)
+
+	var lines []internal.SourceLine
+	iter := insns.Iterate()
+	for iter.Next() {
+		line, ok := iter.Ins.Source().(*btf.Line)
+		if !ok {
+			continue
+		}
+
+		loc := fmt.Sprintf("%s:%d", line.FileName(), line.LineNumber())
+		lines = append(lines, internal.SourceLine{Offset: int(iter.Offset), Location: loc})
+	}
+	verr.SetSourceLines(lines)
+
+	return verr
+}
+
 // NewProgramFromFD creates a program from a raw fd.
 //
 // You should not use fd after calling this function.
@@ -397,7 +484,7 @@ func newProgramFromFD(fd *sys.FD) (*Program, error) {
 		return nil, fmt.Errorf("discover program type: %w", err)
 	}
 
-	return &Program{"", fd, "", "", info.Type}, nil
+	return &Program{"", fd, "", "", info.Type, nil}, nil
 }
 
 func (p *Program) String() string {
@@ -416,7 +503,25 @@ func (p *Program) Type() ProgramType {
 //
 // Requires at least 4.10.
 func (p *Program) Info() (*ProgramInfo, error) {
-	return newProgramInfoFromFd(p.fd)
+	info, err := newProgramInfoFromFd(p.fd)
+	if err != nil {
+		return nil, err
+	}
+	info.attachType = p.attachType
+	return info, nil
+}
+
+// Instructions returns the instructions of the program as translated by the
+// kernel, which may have been rewritten by the verifier.
+//
+// It is a shortcut for ProgramInfo.Instructions, see there for details.
+func (p *Program) Instructions() (asm.Instructions, error) {
+	info, err := p.Info()
+	if err != nil {
+		return nil, fmt.Errorf("get program info: %w", err)
+	}
+
+	return info.Instructions()
 }
 
 // FD gets the file descriptor of the Program.
@@ -441,7 +546,7 @@ func (p *Program) Clone() (*Program, error) {
 		return nil, fmt.Errorf("can't clone program: %w", err)
 	}
 
-	return &Program{p.VerifierLog, dup, p.name, "", p.typ}, nil
+	return &Program{p.VerifierLog, dup, p.name, "", p.typ, p.attachType}, nil
 }
 
 // Pin persists the Program on the BPF virtual file system past the lifetime of
@@ -742,7 +847,7 @@ func LoadPinnedProgram(fileName string, opts *LoadPinOptions) (*Program, error)
 		return nil, fmt.Errorf("info for %s: %w", fileName, err)
 	}
 
-	return &Program{"", fd, filepath.Base(fileName), fileName, info.Type}, nil
+	return &Program{"", fd, filepath.Base(fileName), fileName, info.Type, nil}, nil
 }
 
 // SanitizeName replaces all invalid characters in name with replacement.
@@ -782,15 +887,82 @@ func (p *Program) BindMap(m *Map) error {
 	return sys.ProgBindMap(attr)
 }
 
+// gplOnlyHelpers are helpers which the kernel only allows programs with a GPL
+// compatible license to call.
+//
+// The list is best-effort: the verifier rejects calls to GPL-only helpers
+// missing from it, just with a less descriptive error.
+var gplOnlyHelpers = map[asm.BuiltinFunc]bool{
+	asm.FnProbeRead:          true,
+	asm.FnTracePrintk:        true,
+	asm.FnPerfEventRead:      true,
+	asm.FnPerfEventOutput:    true,
+	asm.FnGetStackid:         true,
+	asm.FnGetCurrentTask:     true,
+	asm.FnProbeWriteUser:     true,
+	asm.FnProbeReadStr:       true,
+	asm.FnPerfEventReadValue: true,
+	asm.FnOverrideReturn:     true,
+	asm.FnPerfProgReadValue:  true,
+	asm.FnGetStack:           true,
+	asm.FnSkbOutput:          true,
+	asm.FnProbeReadUser:      true,
+	asm.FnProbeReadKernel:    true,
+	asm.FnProbeReadUserStr:   true,
+	asm.FnProbeReadKernelStr: true,
+	asm.FnReadBranchRecords:  true,
+	asm.FnXdpOutput:          true,
+	asm.FnSeqPrintf:          true,
+	asm.FnSeqWrite:           true,
+	asm.FnSnprintfBtf:        true,
+	asm.FnSeqPrintfBtf:       true,
+	asm.FnGetCurrentTaskBtf:  true,
+	asm.FnSnprintf:           true,
+	asm.FnTimerInit:          true,
+	asm.FnTaskPtRegs:         true,
+}
+
+// isGPLCompatible mirrors license_is_gpl_compatible in the kernel.
+func isGPLCompatible(license string) bool {
+	switch license {
+	case "GPL", "GPL v2", "GPL and additional rights", "Dual BSD/GPL", "Dual MIT/GPL", "Dual MPL/GPL":
+		return true
+	}
+	return false
+}
+
+// checkLicense returns an error if insns call a GPL-only helper but license
+// isn't compatible with the GPL, which the verifier would reject.
+func checkLicense(license string, insns asm.Instructions) error {
+	if isGPLCompatible(license) {
+		return nil
+	}
+
+	for _, ins := range insns {
+		if !ins.IsBuiltinCall() {
+			continue
+		}
+
+		if fn := asm.BuiltinFunc(ins.Constant); gplOnlyHelpers[fn] {
+			return fmt.Errorf("cannot call GPL-restricted function %s from program with license %q", fn, license)
+		}
+	}
+
+	return nil
+}
+
 var errUnrecognizedAttachType = errors.New("unrecognized attach type")
 
 // find an attach target type in the kernel.
 //
-// spec may be nil and defaults to the canonical kernel BTF. name together with
-// progType and attachType determine which type we need to attach to.
+// spec may be nil and defaults to the canonical kernel BTF. In that case
+// the BTF of kernel modules is searched if the target isn't part of vmlinux,
+// and the BTF object of the module containing the target is returned. name
+// together with progType and attachType determine which type we need to attach
+// to.
 //
 // Returns errUnrecognizedAttachType.
-func findTargetInKernel(spec *btf.Spec, name string, progType ProgramType, attachType AttachType) (btf.TypeID, error) {
+func findTargetInKernel(spec *btf.Spec, name string, progType ProgramType, attachType AttachType) (btf.TypeID, *sys.FD, error) {
 	type match struct {
 		p ProgramType
 		a AttachType
@@ -822,15 +994,52 @@ func findTargetInKernel(spec *btf.Spec, name string, progType ProgramType, attac
 		featureName = fmt.Sprintf("raw_tp %s", name)
 		isBTFTypeFunc = false
 	default:
-		return 0, errUnrecognizedAttachType
+		return 0, nil, errUnrecognizedAttachType
 	}
 
+	searchModules := spec == nil
 	spec, err := maybeLoadKernelBTF(spec)
 	if err != nil {
-		return 0, fmt.Errorf("load kernel spec: %w", err)
+		return 0, nil, fmt.Errorf("load kernel spec: %w", err)
+	}
+
+	id, err := findTargetInSpec(spec, typeName, isBTFTypeFunc)
+	if err == nil {
+		return id, nil, nil
+	}
+	if !errors.Is(err, btf.ErrNotFound) {
+		return 0, nil, fmt.Errorf("find target for %s: %w", featureName, err)
+	}
+
+	notFound := &internal.UnsupportedFeatureError{Name: featureName}
+	if !searchModules {
+		return 0, nil, notFound
+	}
+
+	module, id, err := findTargetInKernelModules(typeName, isBTFTypeFunc)
+	if errors.Is(err, btf.ErrNotFound) {
+		return 0, nil, fmt.Errorf("searched vmlinux and module BTF in %s: %w", kernelBTFDir, notFound)
+	}
+	if err != nil {
+		return 0, nil, fmt.Errorf("find target for %s: %w", featureName, err)
 	}
 
-	var target btf.Type
+	fd, err := kernelModuleBTF(module)
+	if err != nil {
+		return 0, nil, fmt.Errorf("find target for %s: module %s: %w", featureName, module, err)
+	}
+
+	return id, fd, nil
+}
+
+// findTargetInSpec returns the ID of the Func or Typedef called typeName.
+//
+// Returns an error wrapping btf.ErrNotFound if there is no such type.
+func findTargetInSpec(spec *btf.Spec, typeName string, isBTFTypeFunc bool) (btf.TypeID, error) {
+	var (
+		target btf.Type
+		err    error
+	)
 	if isBTFTypeFunc {
 		var targetFunc *btf.Func
 		err = spec.TypeByName(typeName, &targetFunc)
@@ -842,15 +1051,106 @@ func findTargetInKernel(spec *btf.Spec, name string, progType ProgramType, attac
 	}
 
 	if err != nil {
+		return 0, err
+	}
+
+	return spec.TypeID(target)
+}
+
+// kernelBTFDir contains the BTF of vmlinux and of kernel modules.
+var kernelBTFDir = "/sys/kernel/btf"
+
+// findTargetInKernelModules searches the BTF of all loaded kernel modules,
+// which is split from vmlinux, for a target.
+//
+// Modules whose BTF can't be parsed are skipped. Only the BTF of the module
+// containing the target is cached. Returns the name of the module and the ID
+// of the target, or an error wrapping btf.ErrNotFound if no module contains
+// the target.
+func findTargetInKernelModules(typeName string, isBTFTypeFunc bool) (string, btf.TypeID, error) {
+	entries, err := os.ReadDir(kernelBTFDir)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", 0, fmt.Errorf("no module BTF: %w", btf.ErrNotFound)
+	}
+	if err != nil {
+		return "", 0, err
+	}
+
+	var invalid []string
+	for _, entry := range entries {
+		module := entry.Name()
+		if module == "vmlinux" {
+			continue
+		}
+
+		mod, err := loadKernelModuleBTF(module)
+		if errors.Is(err, os.ErrNotExist) {
+			// The module was unloaded in the meantime.
+			continue
+		}
+		if err != nil {
+			// Don't let a single module prevent finding the target in others.
+			invalid = append(invalid, module)
+			continue
+		}
+
+		id, err := findTargetInSpec(mod.spec, typeName, isBTFTypeFunc)
 		if errors.Is(err, btf.ErrNotFound) {
-			return 0, &internal.UnsupportedFeatureError{
-				Name: featureName,
-			}
+			continue
+		}
+		if err != nil {
+			return "", 0, fmt.Errorf("module %s: %w", module, err)
 		}
-		return 0, fmt.Errorf("find target for %s: %w", featureName, err)
+
+		cacheKernelModuleBTF(module, mod)
+		return module, id, nil
 	}
 
-	return spec.TypeID(target)
+	if len(invalid) > 0 {
+		return "", 0, fmt.Errorf("type %s: %w (skipped modules with invalid BTF: %s)", typeName, btf.ErrNotFound, strings.Join(invalid, ", "))
+	}
+	return "", 0, fmt.Errorf("type %s: %w", typeName, btf.ErrNotFound)
+}
+
+// kernelModuleBTF returns the BTF object the kernel created for module.
+func kernelModuleBTF(module string) (*sys.FD, error) {
+	attr := &sys.BtfGetNextIdAttr{}
+	for {
+		err := sys.BtfGetNextId(attr)
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("no BTF object for module: %w", btf.ErrNotFound)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("get next BTF id: %w", err)
+		}
+		attr.Id = attr.NextId
+
+		fd, err := sys.BtfGetFdById(&sys.BtfGetFdByIdAttr{Id: attr.Id})
+		if errors.Is(err, os.ErrNotExist) {
+			// The BTF was released in the meantime.
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("get BTF by id: %w", err)
+		}
+
+		// The kernel returns ENOSPC if the name doesn't fit, in which case
+		// it is longer than module.
+		var info sys.BtfInfo
+		name := make([]byte, len(module)+1)
+		info.Name, info.NameLen = sys.NewSlicePointerLen(name)
+		err = sys.ObjInfo(fd, &info)
+		if err != nil && !errors.Is(err, unix.ENOSPC) {
+			_ = fd.Close()
+			return nil, fmt.Errorf("get BTF info: %w", err)
+		}
+
+		if err == nil && info.KernelBtf != 0 && unix.ByteSliceToString(name) == module {
+			return fd, nil
+		}
+
+		_ = fd.Close()
+	}
 }
 
 // find an attach target type in a program.
@@ -9,6 +9,7 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strings"
 	"syscall"
 	"testing"
@@ -508,6 +509,65 @@ func TestProgramMarshaling(t *testing.T) {
 	}
 }
 
+func TestMapUpdateProgram(t *testing.T) {
+	const idx = uint32(0)
+
+	arr := createProgramArray(t)
+	defer arr.Close()
+
+	prog := mustSocketFilter(t)
+
+	if err := arr.UpdateProgram(idx, prog); err != nil {
+		t.Fatal("Can't update program:", err)
+	}
+
+	// Replacing a program with one of the same type must succeed.
+	prog2 := mustSocketFilter(t)
+	if err := arr.UpdateProgram(idx, prog2); err != nil {
+		t.Fatal("Can't replace program:", err)
+	}
+
+	if err := arr.UpdateProgram(idx, nil); err == nil {
+		t.Error("UpdateProgram accepts nil program")
+	}
+
+	xdp, err := NewProgram(&ProgramSpec{
+		Type: XDP,
+		Instructions: asm.Instructions{
+			asm.LoadImm(asm.R0, 0, asm.DWord),
+			asm.Return(),
+		},
+		License: "MIT",
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer xdp.Close()
+
+	if err := arr.UpdateProgram(idx, xdp); err == nil {
+		t.Error("UpdateProgram accepts a program of a different type")
+	}
+
+	if err := arr.DeleteProgram(idx); err != nil {
+		t.Fatal("Can't delete program:", err)
+	}
+
+	if err := arr.DeleteProgram(idx); !errors.Is(err, ErrKeyNotExist) {
+		t.Error("Deleting an empty slot doesn't return ErrKeyNotExist, got", err)
+	}
+
+	m := createArray(t)
+	defer m.Close()
+
+	if err := m.UpdateProgram(idx, prog); err == nil {
+		t.Error("UpdateProgram accepts a map which isn't a ProgramArray")
+	}
+
+	if err := m.DeleteProgram(idx); err == nil {
+		t.Error("DeleteProgram accepts a map which isn't a ProgramArray")
+	}
+}
+
 func TestProgramFromFD(t *testing.T) {
 	prog := mustSocketFilter(t)
 
@@ -599,6 +659,66 @@ func TestProgramRejectIncorrectByteOrder(t *testing.T) {
 	}
 }
 
+func TestProgramLicenseOverride(t *testing.T) {
+	spec := &ProgramSpec{
+		Type:    Kprobe,
+		License: "MIT",
+		Instructions: asm.Instructions{
+			asm.FnGetCurrentPidTgid.Call(),
+			asm.FnKtimeGetNs.Call(),
+			asm.Mov.Imm(asm.R0, 0),
+			asm.Return(),
+		},
+	}
+
+	prog, err := NewProgram(spec)
+	testutils.SkipIfNotSupported(t, err)
+	if err != nil {
+		t.Fatal("Can't load program without GPL-only helpers:", err)
+	}
+	prog.Close()
+
+	spec.Instructions = append(asm.Instructions{asm.FnGetCurrentTask.Call()}, spec.Instructions...)
+	if _, err := NewProgram(spec); err == nil || !strings.Contains(err.Error(), "GPL-restricted") {
+		t.Error("Calling a GPL-only helper with MIT license should be rejected:", err)
+	}
+
+	spec.License = "Dual BSD/GPL"
+	prog, err = NewProgram(spec)
+	if err != nil {
+		t.Fatal("Can't load program with overridden license:", err)
+	}
+	prog.Close()
+}
+
+func TestProgramAttachTypeOverride(t *testing.T) {
+	spec := &ProgramSpec{
+		Type:       CGroupSKB,
+		AttachType: AttachCGroupInetEgress,
+		License:    "MIT",
+		Instructions: asm.Instructions{
+			asm.Mov.Imm(asm.R0, 0),
+			asm.Return(),
+		},
+	}
+
+	prog, err := NewProgram(spec)
+	testutils.SkipIfNotSupported(t, err)
+	if err != nil {
+		t.Fatal("Can't load program with compatible attach type:", err)
+	}
+	prog.Close()
+
+	spec.AttachType = AttachTraceFEntry
+	_, err = NewProgram(spec)
+	if !errors.Is(err, unix.EINVAL) {
+		t.Fatal("Incompatible attach type should be rejected by the kernel, got", err)
+	}
+	if !strings.Contains(err.Error(), "may be incompatible") {
+		t.Error("Error doesn't mention the incompatible attach type:", err)
+	}
+}
+
 func TestProgramSpecTag(t *testing.T) {
 	arr := createArray(t)
 	defer arr.Close()
@@ -713,6 +833,134 @@ func TestProgramKernelTypes(t *testing.T) {
 	prog.Close()
 }
 
+func TestKernelModuleBTF(t *testing.T) {
+	testutils.SkipOnOldKernel(t, "5.11", "kernel BTF objects")
+
+	// The kernel names the BTF object of vmlinux like the ones of modules.
+	fd, err := kernelModuleBTF("vmlinux")
+	testutils.SkipIfNotSupported(t, err)
+	if err != nil {
+		t.Fatal("Can't find vmlinux BTF object:", err)
+	}
+	fd.Close()
+
+	_, err = kernelModuleBTF("does_not_exist")
+	if !errors.Is(err, btf.ErrNotFound) {
+		t.Fatal("Expected ErrNotFound for missing module, got", err)
+	}
+}
+
+func TestFindTargetInKernelModules(t *testing.T) {
+	// BTF of vmlinux containing an int with ID 1.
+	vmlinux, err := btf.LoadSpecFromReader(bytes.NewReader(marshalRawBTF(
+		[]uint32{1, 1 << 24, 4, 32},
+		"\x00int\x00",
+	)))
+	qt.Assert(t, err, qt.IsNil)
+
+	// Split BTF containing a typedef of the int with ID 2. The string table
+	// continues after the one of vmlinux.
+	module := func(typedef string) []byte {
+		return marshalRawBTF([]uint32{5, 8 << 24, 1}, typedef+"\x00")
+	}
+
+	dir := t.TempDir()
+	writeModule := func(name string, contents []byte) {
+		t.Helper()
+		qt.Assert(t, os.WriteFile(filepath.Join(dir, name), contents, 0644), qt.IsNil)
+	}
+	writeModule("vmlinux", []byte("ignored"))
+	writeModule("a_invalid", []byte("not BTF"))
+	writeModule("b_foo", module("foo"))
+	writeModule("c_bar", module("bar"))
+
+	kernelBTF.Lock()
+	oldDir, oldSpec, oldModules := kernelBTFDir, kernelBTF.spec, kernelBTF.modules
+	kernelBTFDir, kernelBTF.spec, kernelBTF.modules = dir, vmlinux, nil
+	kernelBTF.Unlock()
+	t.Cleanup(func() {
+		kernelBTF.Lock()
+		kernelBTFDir, kernelBTF.spec, kernelBTF.modules = oldDir, oldSpec, oldModules
+		kernelBTF.Unlock()
+	})
+
+	cached := func() []string {
+		var modules []string
+		for module := range kernelBTF.modules {
+			modules = append(modules, module)
+		}
+		sort.Strings(modules)
+		return modules
+	}
+
+	name, id, err := findTargetInKernelModules("foo", false)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, name, qt.Equals, "b_foo")
+	qt.Assert(t, id, qt.Equals, btf.TypeID(2))
+	qt.Assert(t, cached(), qt.DeepEquals, []string{"b_foo"})
+
+	_, _, err = findTargetInKernelModules("foo", true)
+	qt.Assert(t, errors.Is(err, btf.ErrNotFound), qt.IsTrue, qt.Commentf("got %v", err))
+
+	_, _, err = findTargetInKernelModules("missing", false)
+	qt.Assert(t, errors.Is(err, btf.ErrNotFound), qt.IsTrue, qt.Commentf("got %v", err))
+	qt.Assert(t, err.Error(), qt.Contains, "a_invalid")
+	qt.Assert(t, cached(), qt.DeepEquals, []string{"b_foo"}, qt.Commentf("modules without a match are cached"))
+
+	name, _, err = findTargetInKernelModules("bar", false)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, name, qt.Equals, "c_bar")
+	qt.Assert(t, cached(), qt.DeepEquals, []string{"b_foo", "c_bar"})
+
+	// Overwriting the file in place keeps its identity, so the cached BTF is
+	// still used.
+	f, err := os.OpenFile(filepath.Join(dir, "b_foo"), os.O_WRONLY|os.O_TRUNC, 0)
+	qt.Assert(t, err, qt.IsNil)
+	_, err = f.Write([]byte("not BTF"))
+	f.Close()
+	qt.Assert(t, err, qt.IsNil)
+
+	name, _, err = findTargetInKernelModules("foo", false)
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, name, qt.Equals, "b_foo")
+
+	// Reloading the module recreates the file, which invalidates the cache.
+	writeModule("b_foo.new", []byte("not BTF"))
+	qt.Assert(t, os.Rename(filepath.Join(dir, "b_foo.new"), filepath.Join(dir, "b_foo")), qt.IsNil)
+
+	_, _, err = findTargetInKernelModules("foo", false)
+	qt.Assert(t, errors.Is(err, btf.ErrNotFound), qt.IsTrue, qt.Commentf("got %v", err))
+	qt.Assert(t, err.Error(), qt.Contains, "b_foo")
+}
+
+// marshalRawBTF encodes raw types and strings as a BTF blob in native
+// endianness.
+func marshalRawBTF(types []uint32, strings string) []byte {
+	header := struct {
+		Magic     uint16
+		Version   uint8
+		Flags     uint8
+		HdrLen    uint32
+		TypeOff   uint32
+		TypeLen   uint32
+		StringOff uint32
+		StringLen uint32
+	}{
+		Magic:     0xeB9F,
+		Version:   1,
+		HdrLen:    24,
+		TypeLen:   uint32(len(types) * 4),
+		StringOff: uint32(len(types) * 4),
+		StringLen: uint32(len(strings)),
+	}
+
+	buf := new(bytes.Buffer)
+	_ = binary.Write(buf, internal.NativeEndian, &header)
+	_ = binary.Write(buf, internal.NativeEndian, types)
+	buf.WriteString(strings)
+	return buf.Bytes()
+}
+
 func TestProgramBindMap(t *testing.T) {
 	testutils.SkipOnOldKernel(t, "5.10", "BPF_PROG_BIND_MAP")
 
@@ -779,6 +1027,19 @@ func TestProgramInstructions(t *testing.T) {
 	if tag != tagXlated {
 		t.Fatalf("tag %s differs from xlated instructions tag %s", tag, tagXlated)
 	}
+
+	progInsns, err := prog.Instructions()
+	if err != nil {
+		t.Fatal(err)
+	}
+	qt.Assert(t, progInsns, qt.HasLen, len(insns))
+
+	jitEnabled, err := os.ReadFile("/proc/sys/net/core/bpf_jit_enable")
+	if err == nil && strings.TrimSpace(string(jitEnabled)) != "0" {
+		if _, ok := pi.JitedInsns(); !ok {
+			t.Error("JitedInsns returned no machine code although the JIT is enabled")
+		}
+	}
 }
 
 func createProgramArray(t *testing.T) *Map {
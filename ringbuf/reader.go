@@ -6,11 +6,14 @@ import (
 	"fmt"
 	"io"
 	"os"
+	"runtime"
 	"sync"
+	"time"
 
 	"github.com/cilium/ebpf"
 	"github.com/cilium/ebpf/internal"
 	"github.com/cilium/ebpf/internal/epoll"
+	"github.com/cilium/ebpf/internal/sys"
 	"github.com/cilium/ebpf/internal/unix"
 )
 
@@ -19,6 +22,14 @@ var (
 	errEOR     = errors.New("end of ring")
 	errDiscard = errors.New("sample discarded")
 	errBusy    = errors.New("sample not committed yet")
+
+	// ErrRecordTooLarge is returned by Read if a record exceeds
+	// ReaderOptions.MaxRecordSize. The record is consumed from the ring.
+	ErrRecordTooLarge = errors.New("record too large")
+
+	// ErrRecordTooShort is returned by Read if a record is shorter than
+	// ReaderOptions.Header. The record is consumed from the ring.
+	ErrRecordTooShort = errors.New("record too short")
 )
 
 var ringbufHeaderSize = binary.Size(ringbufHeader{})
@@ -42,17 +53,154 @@ func (rh *ringbufHeader) dataLen() int {
 }
 
 type Record struct {
+	// The data submitted by the eBPF program. If ReaderOptions.Header is
+	// set, the header is removed and RawSample only contains the payload
+	// following it.
 	RawSample []byte
+
+	// Fields decoded from the header described by ReaderOptions.Header.
+	// They are zero if the header doesn't contain the field.
+	Timestamp uint64
+	Type      uint32
+	CPU       uint32
+}
+
+// HeaderLayout describes a fixed size header which the eBPF program writes
+// at the start of every record, for example:
+//
+//	struct header {
+//		__u64 timestamp;
+//		__u32 type;
+//		__u32 cpu;
+//	};
+//
+// which corresponds to
+//
+//	HeaderLayout{
+//		Size:      16,
+//		Timestamp: HeaderField{Offset: 0, Size: 8},
+//		Type:      HeaderField{Offset: 8, Size: 4},
+//		CPU:       HeaderField{Offset: 12, Size: 4},
+//	}
+type HeaderLayout struct {
+	// Size of the header in bytes, including any padding.
+	Size int
+
+	// Location of the fields decoded into Record.
+	Timestamp, Type, CPU HeaderField
+}
+
+// HeaderField is the location of an unsigned integer in native endianness
+// in a header.
+type HeaderField struct {
+	Offset int
+	// Size of the integer in bytes. Zero means that the header doesn't
+	// contain the field.
+	Size int
+}
+
+func (hf HeaderField) validate(headerSize, maxSize int) error {
+	if hf.Size == 0 {
+		return nil
+	}
+
+	switch hf.Size {
+	case 1, 2, 4, 8:
+	default:
+		return fmt.Errorf("invalid size %d", hf.Size)
+	}
+
+	if hf.Size > maxSize {
+		return fmt.Errorf("size %d exceeds maximum of %d", hf.Size, maxSize)
+	}
+
+	if hf.Offset < 0 || hf.Offset+hf.Size > headerSize {
+		return fmt.Errorf("offset %d is out of bounds", hf.Offset)
+	}
+
+	return nil
+}
+
+func (hf HeaderField) decode(header []byte) uint64 {
+	b := header[hf.Offset:]
+	switch hf.Size {
+	case 1:
+		return uint64(b[0])
+	case 2:
+		return uint64(internal.NativeEndian.Uint16(b))
+	case 4:
+		return uint64(internal.NativeEndian.Uint32(b))
+	case 8:
+		return internal.NativeEndian.Uint64(b)
+	default:
+		return 0
+	}
+}
+
+func (hl *HeaderLayout) validate() error {
+	if hl.Size <= 0 {
+		return fmt.Errorf("header size %d must be positive", hl.Size)
+	}
+
+	for _, field := range []struct {
+		name    string
+		field   HeaderField
+		maxSize int
+	}{
+		{"Timestamp", hl.Timestamp, 8},
+		{"Type", hl.Type, 4},
+		{"CPU", hl.CPU, 4},
+	} {
+		if err := field.field.validate(hl.Size, field.maxSize); err != nil {
+			return fmt.Errorf("header field %s: %w", field.name, err)
+		}
+	}
+
+	return nil
+}
+
+// decode parses the header at the start of rec.RawSample and moves the
+// remaining payload to the start of the buffer.
+func (hl *HeaderLayout) decode(rec *Record) error {
+	if len(rec.RawSample) < hl.Size {
+		return fmt.Errorf("record of %d bytes is shorter than header of %d bytes: %w", len(rec.RawSample), hl.Size, ErrRecordTooShort)
+	}
+
+	header := rec.RawSample[:hl.Size]
+	rec.Timestamp = hl.Timestamp.decode(header)
+	rec.Type = uint32(hl.Type.decode(header))
+	rec.CPU = uint32(hl.CPU.decode(header))
+
+	n := copy(rec.RawSample, rec.RawSample[hl.Size:])
+	rec.RawSample = rec.RawSample[:n]
+	return nil
 }
 
 // Read a record from an event ring.
 //
-// buf must be at least ringbufHeaderSize bytes long.
-func readRecord(rd *ringbufEventRing, rec *Record, buf []byte) error {
+// buf must be at least ringbufHeaderSize bytes long. Records larger than
+// maxSize are skipped if maxSize is not zero.
+func readRecord(rd *ringbufEventRing, rec *Record, buf []byte, maxSize int) error {
 	rd.loadConsumer()
 
+	err := nextRecord(rd, rec, buf, maxSize)
+	if err == nil || err == errDiscard || errors.Is(err, ErrRecordTooLarge) {
+		rd.storeConsumer()
+	}
+	return err
+}
+
+// nextRecord reads the record at the local consumer position of rd without
+// committing the position to the ring.
+//
+// The position is not advanced if errBusy or errEOR is returned. Discarded
+// and oversized records are skipped.
+func nextRecord(rd *ringbufEventRing, rec *Record, buf []byte, maxSize int) error {
+	start := rd.cons
+
 	buf = buf[:ringbufHeaderSize]
 	if _, err := io.ReadFull(rd, buf); err == io.EOF {
+		rd.cons = start
 		return errEOR
 	} else if err != nil {
 		return fmt.Errorf("read event header: %w", err)
@@ -67,6 +215,7 @@ func readRecord(rd *ringbufEventRing, rec *Record, buf []byte) error {
 		// the next sample in the ring is not committed yet so we
 		// exit without storing the reader/consumer position
 		// and start again from the same position.
+		rd.cons = start
 		return errBusy
 	}
 
@@ -80,11 +229,16 @@ func readRecord(rd *ringbufEventRing, rec *Record, buf []byte) error {
 		// and reading/copying from the ring (which normally keeps track of the
 		// consumer position).
 		rd.skipRead(dataLenAligned)
-		rd.storeConsumer()
-
 		return errDiscard
 	}
 
+	if maxSize > 0 && header.dataLen() > maxSize {
+		// Skip oversized records the same way as discarded ones, so that
+		// the next call to Read can make progress.
+		rd.skipRead(dataLenAligned)
+		return fmt.Errorf("record of %d bytes exceeds maximum of %d bytes: %w", header.dataLen(), maxSize, ErrRecordTooLarge)
+	}
+
 	if cap(rec.RawSample) < int(dataLenAligned) {
 		rec.RawSample = make([]byte, dataLenAligned)
 	} else {
@@ -95,7 +249,6 @@ func readRecord(rd *ringbufEventRing, rec *Record, buf []byte) error {
 		return fmt.Errorf("read sample: %w", err)
 	}
 
-	rd.storeConsumer()
 	rec.RawSample = rec.RawSample[:header.dataLen()]
 	return nil
 }
@@ -103,6 +256,7 @@ func readRecord(rd *ringbufEventRing, rec *Record, buf []byte) error {
 // Reader allows reading bpf_ringbuf_output
 // from user space.
 type Reader struct {
+	rbMap  *ebpf.Map
 	poller *epoll.Poller
 
 	// mu protects read/write access to the Reader structure
@@ -111,47 +265,176 @@ type Reader struct {
 	epollEvents []unix.EpollEvent
 	header      []byte
 	haveData    bool
+	maxSize     int
+	busyPoll    time.Duration
+	layout      *HeaderLayout
+	batch       []Record
+	stack       sys.LeakStack
+}
+
+// ReaderOptions control the behaviour of the user
+// space reader.
+type ReaderOptions struct {
+	// The maximum size in bytes of a record returned by Read. Larger
+	// records are consumed from the ring and Read returns an error
+	// wrapping ErrRecordTooLarge instead. Zero disables the check.
+	MaxRecordSize int
+
+	// How long Read spins checking the ring for new records before
+	// blocking in epoll. This reduces latency at the cost of CPU time,
+	// and allows picking up records submitted with BPF_RB_NO_WAKEUP
+	// without waiting for a later wakeup. Zero disables busy polling.
+	//
+	// Close doesn't interrupt a Read which is busy polling, it only
+	// returns once BusyPollDuration has elapsed.
+	BusyPollDuration time.Duration
+
+	// Header describes a common header at the start of every record, which
+	// is decoded into the fields of Record. Records shorter than the header
+	// are consumed from the ring and Read returns an error wrapping
+	// ErrRecordTooShort instead. Nil disables header decoding.
+	Header *HeaderLayout
 }
 
-// NewReader creates a new BPF ringbuf reader.
+// NewReader creates a new BPF ringbuf reader with default options.
 func NewReader(ringbufMap *ebpf.Map) (*Reader, error) {
+	return NewReaderWithOptions(ringbufMap, ReaderOptions{})
+}
+
+// NewReaderFromCollection creates a new BPF ringbuf reader with default
+// options for the map called mapName in coll.
+//
+// Returns an error wrapping os.ErrNotExist if coll doesn't contain the map.
+func NewReaderFromCollection(coll *ebpf.Collection, mapName string) (*Reader, error) {
+	m, ok := coll.Maps[mapName]
+	if !ok {
+		return nil, fmt.Errorf("map %s: %w", mapName, os.ErrNotExist)
+	}
+
+	if m.Type() != ebpf.RingBuf {
+		return nil, fmt.Errorf("map %s: invalid type %s, expected %s", mapName, m.Type(), ebpf.RingBuf)
+	}
+
+	return NewReader(m)
+}
+
+// NewReaderWithOptions creates a new BPF ringbuf reader with the given options.
+func NewReaderWithOptions(ringbufMap *ebpf.Map, opts ReaderOptions) (*Reader, error) {
 	if ringbufMap.Type() != ebpf.RingBuf {
 		return nil, fmt.Errorf("invalid Map type: %s", ringbufMap.Type())
 	}
 
+	if opts.MaxRecordSize < 0 {
+		return nil, errors.New("MaxRecordSize can't be negative")
+	}
+
+	if opts.BusyPollDuration < 0 {
+		return nil, errors.New("BusyPollDuration can't be negative")
+	}
+
+	var layout *HeaderLayout
+	if opts.Header != nil {
+		if err := opts.Header.validate(); err != nil {
+			return nil, err
+		}
+
+		if opts.MaxRecordSize > 0 && opts.MaxRecordSize < opts.Header.Size {
+			return nil, fmt.Errorf("MaxRecordSize %d is smaller than header of %d bytes", opts.MaxRecordSize, opts.Header.Size)
+		}
+
+		// Copy the layout so that it can't be modified concurrently.
+		copied := *opts.Header
+		layout = &copied
+	}
+
 	maxEntries := int(ringbufMap.MaxEntries())
 	if maxEntries == 0 || (maxEntries&(maxEntries-1)) != 0 {
 		return nil, fmt.Errorf("ringbuffer map size %d is zero or not a power of two", maxEntries)
 	}
 
+	r := &Reader{
+		rbMap:       ringbufMap,
+		epollEvents: make([]unix.EpollEvent, 1),
+		header:      make([]byte, ringbufHeaderSize),
+		maxSize:     opts.MaxRecordSize,
+		busyPoll:    opts.BusyPollDuration,
+		layout:      layout,
+		stack:       sys.NewLeakStack(),
+	}
+
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// open sets up the poller and ring for r.rbMap.
+func (r *Reader) open() error {
+	fd := r.rbMap.FD()
+	if fd < 0 {
+		return errors.New("ringbuffer map is closed")
+	}
+
 	poller, err := epoll.New()
 	if err != nil {
-		return nil, err
+		return err
 	}
 
-	if err := poller.Add(ringbufMap.FD(), 0); err != nil {
+	if err := poller.Add(fd, 0); err != nil {
 		poller.Close()
-		return nil, err
+		return err
 	}
 
-	ring, err := newRingBufEventRing(ringbufMap.FD(), maxEntries)
+	ring, err := newRingBufEventRing(fd, int(r.rbMap.MaxEntries()))
 	if err != nil {
 		poller.Close()
-		return nil, fmt.Errorf("failed to create ringbuf ring: %w", err)
+		return fmt.Errorf("failed to create ringbuf ring: %w", err)
 	}
 
-	return &Reader{
-		poller:      poller,
-		ring:        ring,
-		epollEvents: make([]unix.EpollEvent, 1),
-		header:      make([]byte, ringbufHeaderSize),
-	}, nil
+	r.poller = poller
+	r.ring = ring
+	r.haveData = false
+
+	// The poller and ring clean up after themselves, so only track the
+	// Reader if leak warnings are enabled.
+	if r.stack != nil {
+		runtime.SetFinalizer(r, func(r *Reader) {
+			r.stack.Warn("ringbuf.Reader")
+			_ = r.Close()
+		})
+	}
+
+	return nil
+}
+
+// Reset makes a closed Reader usable again, by mapping the ring buffer and
+// setting up polling for the same map once more. An open Reader is closed
+// first. The options passed when creating the Reader still apply.
+//
+// The read position is stored in the ring buffer itself, so records which
+// weren't read before Close are returned after Reset. Records passed to a
+// ReadBatchFunc callback which didn't return nil are returned again.
+//
+// Returns an error if the map has been closed in the meantime. Reset must not
+// be called concurrently with other methods of the Reader.
+func (r *Reader) Reset() error {
+	if err := r.Close(); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return r.open()
 }
 
 // Close frees resources used by the reader.
 //
 // It interrupts calls to Read.
 func (r *Reader) Close() error {
+	runtime.SetFinalizer(r, nil)
+
 	if err := r.poller.Close(); err != nil {
 		if errors.Is(err, os.ErrClosed) {
 			return nil
@@ -190,15 +473,17 @@ func (r *Reader) ReadInto(rec *Record) error {
 
 	for {
 		if !r.haveData {
-			_, err := r.poller.Wait(r.epollEvents[:cap(r.epollEvents)])
-			if err != nil {
-				return err
+			if !r.pollRing() {
+				_, err := r.poller.Wait(r.epollEvents[:cap(r.epollEvents)])
+				if err != nil {
+					return err
+				}
 			}
 			r.haveData = true
 		}
 
 		for {
-			err := readRecord(r.ring, rec, r.header)
+			err := readRecord(r.ring, rec, r.header, r.maxSize)
 			if err == errBusy || err == errDiscard {
 				continue
 			}
@@ -207,7 +492,139 @@ func (r *Reader) ReadInto(rec *Record) error {
 				break
 			}
 
+			if err == nil && r.layout != nil {
+				return r.layout.decode(rec)
+			}
+
+			return err
+		}
+	}
+}
+
+// ReadBatchFunc reads up to max records from the BPF ringbuf and passes them
+// to fn. The records are only consumed from the ring if fn returns nil.
+// Otherwise they are passed to fn again by the next call to ReadBatchFunc,
+// which allows processing records at least once.
+//
+// Blocks until at least one record is available. Calling Close interrupts the
+// function. The error returned by fn is returned as is.
+//
+// The records and their RawSample are reused by subsequent calls, and are
+// only valid until fn returns. Copy them to retain them.
+//
+// A record which exceeds ReaderOptions.MaxRecordSize or is shorter than
+// ReaderOptions.Header ends the batch. It is consumed and reported as an
+// error once it is the first record of a batch, like Read would.
+func (r *Reader) ReadBatchFunc(max int, fn func(records []Record) error) error {
+	if max <= 0 {
+		return fmt.Errorf("batch size %d must be positive", max)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.ring == nil {
+		return fmt.Errorf("ringbuffer: %w", ErrClosed)
+	}
+
+	if cap(r.batch) < max {
+		r.batch = make([]Record, max)
+	}
+
+	for {
+		if !r.haveData {
+			if !r.pollRing() {
+				_, err := r.poller.Wait(r.epollEvents[:cap(r.epollEvents)])
+				if err != nil {
+					return err
+				}
+			}
+			r.haveData = true
+		}
+
+		r.ring.loadConsumer()
+		n, err := r.readBatch(r.batch[:max])
+		if err != nil {
+			return err
+		}
+
+		if n == 0 {
+			// Commit any discarded records.
+			r.ring.storeConsumer()
+			r.haveData = false
+			continue
+		}
+
+		if err := fn(r.batch[:n]); err != nil {
 			return err
 		}
+
+		r.ring.storeConsumer()
+		return nil
+	}
+}
+
+// readBatch reads records into batch without committing the consumer
+// position, and returns how many got read.
+func (r *Reader) readBatch(batch []Record) (int, error) {
+	n := 0
+	for n < len(batch) {
+		start := r.ring.cons
+		rec := &batch[n]
+
+		err := nextRecord(r.ring, rec, r.header, r.maxSize)
+		if err == errDiscard {
+			continue
+		}
+		if err == errBusy && n == 0 {
+			continue
+		}
+		if err == errBusy || err == errEOR {
+			if err == errEOR {
+				r.haveData = false
+			}
+			return n, nil
+		}
+
+		if err == nil && r.layout != nil {
+			err = r.layout.decode(rec)
+		}
+
+		if err != nil {
+			if n == 0 {
+				// Consume the invalid record, like ReadInto.
+				r.ring.storeConsumer()
+				return 0, err
+			}
+
+			// Report the invalid record on the next call.
+			r.ring.cons = start
+			return n, nil
+		}
+
+		n++
+	}
+
+	return n, nil
+}
+
+// pollRing spins until the ring contains data or the busy poll duration
+// has elapsed. Returns true if data is available.
+func (r *Reader) pollRing() bool {
+	if r.busyPoll == 0 {
+		return false
+	}
+
+	deadline := internal.Now().Add(r.busyPoll)
+	for {
+		if !r.ring.isEmpty() {
+			return true
+		}
+
+		if internal.Now().After(deadline) {
+			return false
+		}
+
+		runtime.Gosched()
 	}
 }
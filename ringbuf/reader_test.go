@@ -2,12 +2,15 @@ package ringbuf
 
 import (
 	"errors"
+	"os"
+	"sync/atomic"
 	"syscall"
 	"testing"
 	"time"
 
 	"github.com/cilium/ebpf"
 	"github.com/cilium/ebpf/asm"
+	"github.com/cilium/ebpf/internal"
 	"github.com/cilium/ebpf/internal/testutils"
 	"github.com/google/go-cmp/cmp"
 )
@@ -73,6 +76,356 @@ func TestRingbufReader(t *testing.T) {
 	}
 }
 
+func TestReaderMaxRecordSize(t *testing.T) {
+	testutils.SkipOnOldKernel(t, "5.8", "BPF ring buffer")
+
+	prog, events := mustOutputSamplesProg(t, 0, 5, 10, 15, 20, 7)
+
+	rd, err := NewReaderWithOptions(events, ReaderOptions{MaxRecordSize: 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rd.Close()
+
+	ret, _, err := prog.Test(make([]byte, 14))
+	testutils.SkipIfNotSupported(t, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if errno := syscall.Errno(-int32(ret)); errno != 0 {
+		t.Fatal("Expected 0 as return value, got", errno)
+	}
+
+	record, err := rd.Read()
+	if err != nil {
+		t.Fatal("Can't read first sample:", err)
+	}
+	if len(record.RawSample) != 5 {
+		t.Fatal("Expected a 5 byte sample, got", len(record.RawSample))
+	}
+
+	if _, err := rd.Read(); !errors.Is(err, ErrRecordTooLarge) {
+		t.Fatal("Expected ErrRecordTooLarge, got", err)
+	}
+
+	// The oversized record must have been consumed.
+	record, err = rd.Read()
+	if err != nil {
+		t.Fatal("Can't read sample after oversized record:", err)
+	}
+	if len(record.RawSample) != 7 {
+		t.Fatal("Expected a 7 byte sample, got", len(record.RawSample))
+	}
+
+	if _, err := NewReaderWithOptions(events, ReaderOptions{MaxRecordSize: -1}); err == nil {
+		t.Fatal("Negative MaxRecordSize doesn't return an error")
+	}
+}
+
+func TestReaderReadBatchFunc(t *testing.T) {
+	testutils.SkipOnOldKernel(t, "5.8", "BPF ring buffer")
+
+	// Samples at odd indices are discarded.
+	prog, events := mustOutputSamplesProg(t, 0, 1, 9, 2, 9, 3, 9, 4)
+
+	rd, err := NewReader(events)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rd.Close()
+
+	ret, _, err := prog.Test(make([]byte, 14))
+	testutils.SkipIfNotSupported(t, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if errno := syscall.Errno(-int32(ret)); errno != 0 {
+		t.Fatal("Expected 0 as return value, got", errno)
+	}
+
+	readBatch := func(fnErr error) ([]int, error) {
+		var sizes []int
+		err := rd.ReadBatchFunc(3, func(records []Record) error {
+			for _, rec := range records {
+				sizes = append(sizes, len(rec.RawSample))
+			}
+			return fnErr
+		})
+		return sizes, err
+	}
+
+	errProcess := errors.New("process failed")
+	sizes, err := readBatch(errProcess)
+	if !errors.Is(err, errProcess) {
+		t.Fatal("Expected error from fn, got", err)
+	}
+	if diff := cmp.Diff([]int{1, 2, 3}, sizes); diff != "" {
+		t.Fatalf("First batch mismatch (-want +got):\n%s", diff)
+	}
+
+	// The failed batch must not have been consumed.
+	sizes, err = readBatch(nil)
+	if err != nil {
+		t.Fatal("Can't read batch:", err)
+	}
+	if diff := cmp.Diff([]int{1, 2, 3}, sizes); diff != "" {
+		t.Fatalf("Retried batch mismatch (-want +got):\n%s", diff)
+	}
+
+	sizes, err = readBatch(nil)
+	if err != nil {
+		t.Fatal("Can't read batch:", err)
+	}
+	if diff := cmp.Diff([]int{4}, sizes); diff != "" {
+		t.Fatalf("Last batch mismatch (-want +got):\n%s", diff)
+	}
+
+	if err := rd.ReadBatchFunc(0, func([]Record) error { return nil }); err == nil {
+		t.Fatal("Zero batch size doesn't return an error")
+	}
+
+	rd.Close()
+	if _, err := readBatch(nil); !errors.Is(err, ErrClosed) {
+		t.Fatal("Expected ErrClosed after Close, got", err)
+	}
+}
+
+func TestNewReaderFromCollection(t *testing.T) {
+	testutils.SkipOnOldKernel(t, "5.8", "BPF ring buffer")
+
+	_, events := mustOutputSamplesProg(t, 0, 5)
+
+	array, err := ebpf.NewMap(&ebpf.MapSpec{
+		Type:       ebpf.Array,
+		KeySize:    4,
+		ValueSize:  4,
+		MaxEntries: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer array.Close()
+
+	coll := &ebpf.Collection{
+		Maps: map[string]*ebpf.Map{
+			"events": events,
+			"array":  array,
+		},
+	}
+
+	rd, err := NewReaderFromCollection(coll, "events")
+	if err != nil {
+		t.Fatal(err)
+	}
+	rd.Close()
+
+	if _, err := NewReaderFromCollection(coll, "missing"); !errors.Is(err, os.ErrNotExist) {
+		t.Fatal("Expected os.ErrNotExist for missing map, got", err)
+	}
+
+	if _, err := NewReaderFromCollection(coll, "array"); err == nil {
+		t.Fatal("Creating a reader for an array doesn't return an error")
+	}
+}
+
+func TestReaderHeader(t *testing.T) {
+	testutils.SkipOnOldKernel(t, "5.8", "BPF ring buffer")
+
+	// Every second sample is discarded.
+	prog, events := mustOutputSamplesProg(t, 0, 2, 0, 7)
+
+	rd, err := NewReaderWithOptions(events, ReaderOptions{
+		Header: &HeaderLayout{
+			Size: 4,
+			Type: HeaderField{Offset: 0, Size: 2},
+			CPU:  HeaderField{Offset: 2, Size: 1},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rd.Close()
+
+	ret, _, err := prog.Test(make([]byte, 14))
+	testutils.SkipIfNotSupported(t, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if errno := syscall.Errno(-int32(ret)); errno != 0 {
+		t.Fatal("Expected 0 as return value, got", errno)
+	}
+
+	if _, err := rd.Read(); !errors.Is(err, ErrRecordTooShort) {
+		t.Fatal("Expected ErrRecordTooShort, got", err)
+	}
+
+	record, err := rd.Read()
+	if err != nil {
+		t.Fatal("Can't read sample:", err)
+	}
+
+	want := Record{
+		RawSample: []byte{4, 3, 2},
+		Type:      uint32(internal.NativeEndian.Uint16([]byte{1, 2})),
+		CPU:       3,
+	}
+	if diff := cmp.Diff(want, record); diff != "" {
+		t.Errorf("Record mismatch (-want +got):\n%s", diff)
+	}
+}
+
+func TestHeaderLayout(t *testing.T) {
+	valid := HeaderLayout{
+		Size:      16,
+		Timestamp: HeaderField{Offset: 0, Size: 8},
+		Type:      HeaderField{Offset: 8, Size: 4},
+		CPU:       HeaderField{Offset: 12, Size: 4},
+	}
+	if err := valid.validate(); err != nil {
+		t.Fatal("Valid layout is rejected:", err)
+	}
+
+	for name, layout := range map[string]HeaderLayout{
+		"zero size":          {},
+		"field out of bound": {Size: 8, Timestamp: HeaderField{Offset: 4, Size: 8}},
+		"negative offset":    {Size: 8, Type: HeaderField{Offset: -1, Size: 4}},
+		"odd field size":     {Size: 8, Type: HeaderField{Size: 3}},
+		"field too large":    {Size: 8, CPU: HeaderField{Size: 8}},
+	} {
+		if err := layout.validate(); err == nil {
+			t.Errorf("%s: no error", name)
+		}
+	}
+
+	header := make([]byte, 16)
+	internal.NativeEndian.PutUint64(header[0:], 1234)
+	internal.NativeEndian.PutUint32(header[8:], 2)
+	internal.NativeEndian.PutUint32(header[12:], 3)
+
+	rec := Record{RawSample: append(header, 0xff)}
+	if err := valid.decode(&rec); err != nil {
+		t.Fatal(err)
+	}
+	if diff := cmp.Diff(Record{[]byte{0xff}, 1234, 2, 3}, rec); diff != "" {
+		t.Errorf("Record mismatch (-want +got):\n%s", diff)
+	}
+
+	rec = Record{RawSample: header[:15]}
+	if err := valid.decode(&rec); !errors.Is(err, ErrRecordTooShort) {
+		t.Error("Expected ErrRecordTooShort, got", err)
+	}
+}
+
+func TestReaderBusyPoll(t *testing.T) {
+	testutils.SkipOnOldKernel(t, "5.8", "BPF ring buffer")
+
+	prog, events := mustOutputSamplesProg(t, 0, 5)
+
+	rd, err := NewReaderWithOptions(events, ReaderOptions{BusyPollDuration: 10 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rd.Close()
+
+	errs := make(chan error, 1)
+	go func() {
+		_, err := rd.Read()
+		errs <- err
+	}()
+
+	// Wait for busy polling to time out so that Read falls back to epoll.
+	time.Sleep(50 * time.Millisecond)
+
+	ret, _, err := prog.Test(make([]byte, 14))
+	testutils.SkipIfNotSupported(t, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if errno := syscall.Errno(-int32(ret)); errno != 0 {
+		t.Fatal("Expected 0 as return value, got", errno)
+	}
+
+	select {
+	case err := <-errs:
+		if err != nil {
+			t.Fatal("Can't read sample:", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Read doesn't return after busy polling timed out")
+	}
+
+	if _, err := NewReaderWithOptions(events, ReaderOptions{BusyPollDuration: -1}); err == nil {
+		t.Fatal("Negative BusyPollDuration doesn't return an error")
+	}
+}
+
+func TestReaderBusyPollPicksUpRecord(t *testing.T) {
+	testutils.SkipOnOldKernel(t, "5.8", "BPF ring buffer")
+
+	prog, events := mustOutputSamplesProg(t, 0, 5)
+
+	rd, err := NewReaderWithOptions(events, ReaderOptions{BusyPollDuration: time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rd.Close()
+
+	// The clock doesn't advance until the test is done, so busy polling
+	// doesn't time out and Read can only return a record found by polling
+	// the ring, not via epoll.
+	start := time.Now()
+	var calls, done int32
+	spinning := make(chan struct{})
+	testutils.StubClock(t, func() time.Time {
+		if atomic.LoadInt32(&done) != 0 {
+			return start.Add(time.Hour)
+		}
+		// The first call computes the deadline, the second one happens
+		// after the ring was found to be empty.
+		if atomic.AddInt32(&calls, 1) == 2 {
+			close(spinning)
+		}
+		return start
+	})
+	// Let a Read which is still spinning return before closing the reader.
+	defer atomic.StoreInt32(&done, 1)
+
+	errs := make(chan error, 1)
+	go func() {
+		_, err := rd.Read()
+		errs <- err
+	}()
+
+	select {
+	case <-spinning:
+	case <-time.After(time.Second):
+		t.Fatal("Read doesn't busy poll")
+	}
+
+	ret, _, err := prog.Test(make([]byte, 14))
+	testutils.SkipIfNotSupported(t, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if errno := syscall.Errno(-int32(ret)); errno != 0 {
+		t.Fatal("Expected 0 as return value, got", errno)
+	}
+
+	select {
+	case err := <-errs:
+		if err != nil {
+			t.Fatal("Can't read sample:", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Busy polling doesn't pick up the record")
+	}
+}
+
 func outputSamplesProg(flags int32, sampleSizes ...int) (*ebpf.Program, *ebpf.Map, error) {
 	events, err := ebpf.NewMap(&ebpf.MapSpec{
 		Type:       ebpf.RingBuf,
@@ -229,6 +582,74 @@ func TestReaderBlocking(t *testing.T) {
 	}
 }
 
+func TestReaderReset(t *testing.T) {
+	testutils.SkipOnOldKernel(t, "5.8", "BPF ring buffer")
+
+	prog, events := mustOutputSamplesProg(t, 0, 5)
+
+	rd, err := NewReader(events)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rd.Close()
+
+	if err := rd.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := rd.Read(); !errors.Is(err, ErrClosed) {
+		t.Fatal("Expected ErrClosed after Close, got", err)
+	}
+
+	if err := rd.Reset(); err != nil {
+		t.Fatal("Can't reset reader:", err)
+	}
+
+	ret, _, err := prog.Test(make([]byte, 14))
+	testutils.SkipIfNotSupported(t, err)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if errno := syscall.Errno(-int32(ret)); errno != 0 {
+		t.Fatal("Expected 0 as return value, got", errno)
+	}
+
+	record, err := rd.Read()
+	if err != nil {
+		t.Fatal("Can't read sample after Reset:", err)
+	}
+	if len(record.RawSample) != 5 {
+		t.Fatalf("Expected a sample of 5 bytes, got %d", len(record.RawSample))
+	}
+
+	// Close must still interrupt Read.
+	errs := make(chan error, 1)
+	go func() {
+		_, err := rd.Read()
+		errs <- err
+	}()
+
+	time.Sleep(10 * time.Millisecond)
+	if err := rd.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err := <-errs:
+		if !errors.Is(err, ErrClosed) {
+			t.Fatal("Expected ErrClosed, got", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Close doesn't interrupt Read after Reset")
+	}
+
+	events.Close()
+	if err := rd.Reset(); err == nil {
+		t.Fatal("Reset succeeds with a closed map")
+	}
+}
+
 func BenchmarkReader(b *testing.B) {
 	testutils.SkipOnOldKernel(b, "5.8", "BPF ring buffer")
 
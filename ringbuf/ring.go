@@ -79,6 +79,12 @@ func (rr *ringReader) storeConsumer() {
 	atomic.StoreUint64(rr.cons_pos, rr.cons)
 }
 
+// isEmpty returns true if the producer hasn't committed any data
+// past the consumer position.
+func (rr *ringReader) isEmpty() bool {
+	return atomic.LoadUint64(rr.prod_pos) == atomic.LoadUint64(rr.cons_pos)
+}
+
 // clamp delta to 'end' if 'start+delta' is beyond 'end'
 func clamp(start, end, delta uint64) uint64 {
 	if remainder := end - start; delta > remainder {
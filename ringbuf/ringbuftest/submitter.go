@@ -0,0 +1,138 @@
+// Package ringbuftest submits records to a BPF ring buffer from user space,
+// for testing code which reads from the ring buffer end-to-end.
+package ringbuftest
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/asm"
+	"github.com/cilium/ebpf/internal"
+)
+
+// ErrFull is returned by Submit if the ring buffer doesn't have enough space
+// for a record.
+var ErrFull = errors.New("ring buffer is full")
+
+// The return values of the submit program.
+const (
+	retSubmitted = iota
+	retFull
+	retLoadFailed
+)
+
+// The socket filter test run strips an Ethernet header from its input before
+// passing it to the program.
+const ethHeaderLen = 14
+
+// Submitter submits records of a fixed size to a ring buffer by running a
+// BPF program via BPF_PROG_TEST_RUN.
+//
+// The program reserves a record, copies the input of the test run into it and
+// submits it, exactly like a program calling bpf_ringbuf_reserve and
+// bpf_ringbuf_submit would. It doesn't require attaching to any hook.
+type Submitter struct {
+	prog *ebpf.Program
+	size int
+}
+
+// NewSubmitter creates a Submitter for records of size bytes.
+//
+// events must be a RingBuf. Use the map of a loaded Collection to test the
+// same ring buffer a program under test submits to.
+func NewSubmitter(events *ebpf.Map, size int) (*Submitter, error) {
+	if events.Type() != ebpf.RingBuf {
+		return nil, fmt.Errorf("can't submit records to map type %s", events.Type())
+	}
+	if size <= 0 {
+		return nil, fmt.Errorf("invalid record size %d", size)
+	}
+
+	prog, err := ebpf.NewProgram(&ebpf.ProgramSpec{
+		Name:    "ringbuf_submit",
+		Type:    ebpf.SocketFilter,
+		License: "MIT",
+		Instructions: asm.Instructions{
+			asm.Mov.Reg(asm.R6, asm.R1),
+
+			asm.LoadMapPtr(asm.R1, events.FD()),
+			asm.Mov.Imm(asm.R2, int32(size)),
+			asm.Mov.Imm(asm.R3, 0),
+			asm.FnRingbufReserve.Call(),
+			asm.JEq.Imm(asm.R0, 0, "full"),
+			asm.Mov.Reg(asm.R7, asm.R0),
+
+			// Copy the input into the record.
+			asm.Mov.Reg(asm.R1, asm.R6),
+			asm.Mov.Imm(asm.R2, 0),
+			asm.Mov.Reg(asm.R3, asm.R7),
+			asm.Mov.Imm(asm.R4, int32(size)),
+			asm.FnSkbLoadBytes.Call(),
+			asm.JNE.Imm(asm.R0, 0, "discard"),
+
+			asm.Mov.Reg(asm.R1, asm.R7),
+			asm.Mov.Imm(asm.R2, 0),
+			asm.FnRingbufSubmit.Call(),
+			asm.Mov.Imm(asm.R0, retSubmitted),
+			asm.Return(),
+
+			asm.Mov.Reg(asm.R1, asm.R7).WithSymbol("discard"),
+			asm.Mov.Imm(asm.R2, 0),
+			asm.FnRingbufDiscard.Call(),
+			asm.Mov.Imm(asm.R0, retLoadFailed),
+			asm.Return(),
+
+			asm.Mov.Imm(asm.R0, retFull).WithSymbol("full"),
+			asm.Return(),
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("load submit program: %w", err)
+	}
+
+	return &Submitter{prog, size}, nil
+}
+
+// Submit a record to the ring buffer.
+//
+// record is either a []byte or a value which is encoded in native endianness
+// using binary.Write, typically a struct generated by bpf2go. The encoded
+// record must have the size passed to NewSubmitter.
+//
+// Returns ErrFull if the ring buffer doesn't have space for the record.
+func (s *Submitter) Submit(record interface{}) error {
+	buf := bytes.NewBuffer(make([]byte, ethHeaderLen, ethHeaderLen+s.size))
+	if raw, ok := record.([]byte); ok {
+		buf.Write(raw)
+	} else if err := binary.Write(buf, internal.NativeEndian, record); err != nil {
+		return fmt.Errorf("encode record: %w", err)
+	}
+
+	if n := buf.Len() - ethHeaderLen; n != s.size {
+		return fmt.Errorf("record has %d bytes instead of %d", n, s.size)
+	}
+
+	ret, _, err := s.prog.Test(buf.Bytes())
+	if err != nil {
+		return fmt.Errorf("run submit program: %w", err)
+	}
+
+	switch ret {
+	case retSubmitted:
+		return nil
+	case retFull:
+		return ErrFull
+	default:
+		return fmt.Errorf("submit program failed to copy record")
+	}
+}
+
+// Close frees the resources used by the Submitter.
+//
+// The ring buffer itself isn't closed.
+func (s *Submitter) Close() error {
+	return s.prog.Close()
+}
@@ -0,0 +1,98 @@
+package ringbuftest
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/cilium/ebpf"
+	"github.com/cilium/ebpf/internal/testutils"
+	"github.com/cilium/ebpf/ringbuf"
+)
+
+type event struct {
+	Pid  uint32
+	Comm [4]byte
+}
+
+func TestSubmitter(t *testing.T) {
+	testutils.SkipOnOldKernel(t, "5.8", "BPF ring buffer")
+
+	events, err := ebpf.NewMap(&ebpf.MapSpec{
+		Type:       ebpf.RingBuf,
+		MaxEntries: uint32(os.Getpagesize()),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer events.Close()
+
+	sub, err := NewSubmitter(events, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sub.Close()
+
+	rd, err := ringbuf.NewTypedReader(mustReader(t, events), event{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rd.Close()
+
+	want := event{42, [4]byte{'s', 'i', 'p', 'p'}}
+	if err := sub.Submit(want); err != nil {
+		t.Fatal("Can't submit record:", err)
+	}
+
+	var got event
+	if err := rd.Read(&got); err != nil {
+		t.Fatal("Can't read record:", err)
+	}
+	if got != want {
+		t.Errorf("Expected %v, got %v", want, got)
+	}
+
+	if err := sub.Submit([]byte{1, 2, 3}); err == nil {
+		t.Error("Submitting a record of the wrong size should fail")
+	}
+
+	for i := 0; ; i++ {
+		err := sub.Submit(make([]byte, 8))
+		if errors.Is(err, ErrFull) {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i > os.Getpagesize() {
+			t.Fatal("Ring buffer never filled up")
+		}
+	}
+}
+
+func TestNewSubmitterInvalidMap(t *testing.T) {
+	hash, err := ebpf.NewMap(&ebpf.MapSpec{
+		Type:       ebpf.Hash,
+		KeySize:    4,
+		ValueSize:  4,
+		MaxEntries: 1,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer hash.Close()
+
+	if _, err := NewSubmitter(hash, 8); err == nil {
+		t.Error("NewSubmitter should reject maps other than RingBuf")
+	}
+}
+
+func mustReader(tb testing.TB, events *ebpf.Map) *ringbuf.Reader {
+	tb.Helper()
+
+	rd, err := ringbuf.NewReader(events)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return rd
+}
@@ -0,0 +1,47 @@
+package ringbuf
+
+import (
+	"math"
+	"os"
+	"time"
+
+	"github.com/cilium/ebpf/internal"
+)
+
+// maxRingSize caps the result of SizeFor. The kernel accepts up to 2 GiB, but
+// that doesn't fit into an int on 32-bit platforms.
+const maxRingSize = 1 << 30
+
+// SizeFor returns a ring buffer size in bytes which can hold the records
+// submitted at eventsPerSecond while the consumer takes drainLatency to catch
+// up. Use it as the MaxEntries of a RingBuf MapSpec.
+//
+// Every record takes up recordSize bytes plus an 8 byte header, rounded up to
+// a multiple of 8 bytes. The result is twice the number of bytes submitted
+// during drainLatency, to absorb bursts above the average rate, rounded up to
+// a power of two and to at least the page size as required by the kernel.
+// The result is capped at 1 GiB.
+//
+// Negative arguments are treated as zero.
+func SizeFor(recordSize int, eventsPerSecond int, drainLatency time.Duration) int {
+	if recordSize < 0 {
+		recordSize = 0
+	}
+	if eventsPerSecond < 0 {
+		eventsPerSecond = 0
+	}
+	if drainLatency < 0 {
+		drainLatency = 0
+	}
+
+	perRecord := float64(ringbufHeaderSize + internal.Align(recordSize, 8))
+	events := math.Ceil(float64(eventsPerSecond) * drainLatency.Seconds())
+	needed := 2 * perRecord * events
+
+	size := os.Getpagesize()
+	for float64(size) < needed && size < maxRingSize {
+		size *= 2
+	}
+
+	return size
+}
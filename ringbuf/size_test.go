@@ -0,0 +1,29 @@
+package ringbuf
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestSizeFor(t *testing.T) {
+	pageSize := os.Getpagesize()
+
+	qt.Assert(t, SizeFor(0, 0, 0), qt.Equals, pageSize)
+	qt.Assert(t, SizeFor(-1, -1, -time.Second), qt.Equals, pageSize)
+	qt.Assert(t, SizeFor(1<<20, 1<<20, time.Hour), qt.Equals, maxRingSize)
+
+	// 100k records per second of 52 bytes, 64 with header and padding, for
+	// 100ms, doubled, is 1.28 MB which rounds up to 2 MiB.
+	qt.Assert(t, SizeFor(52, 100_000, 100*time.Millisecond), qt.Equals, 2<<20)
+
+	for _, size := range []int{
+		SizeFor(1, 1, time.Second),
+		SizeFor(1000, 3333, 17*time.Millisecond),
+	} {
+		qt.Assert(t, size&(size-1), qt.Equals, 0, qt.Commentf("%d is not a power of two", size))
+		qt.Assert(t, size%pageSize, qt.Equals, 0, qt.Commentf("%d is not page aligned", size))
+	}
+}
@@ -0,0 +1,137 @@
+package ringbuf
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"reflect"
+	"unsafe"
+
+	"github.com/cilium/ebpf/internal"
+)
+
+// TypedReader decodes records read from a BPF ringbuf into values of a
+// fixed type, typically a struct generated by bpf2go.
+//
+// The type is determined by the value passed to NewTypedReader, and Read
+// only accepts pointers to that type.
+type TypedReader struct {
+	rd  *Reader
+	typ reflect.Type
+	// The size of an encoded value, or -1 if the type implements
+	// encoding.BinaryUnmarshaler.
+	size int
+	// True if the in-memory representation of the type matches its encoding,
+	// in which case records are copied into values directly.
+	direct bool
+	rec    Record
+}
+
+// NewTypedReader creates a reader which decodes records from rd into values of
+// the same type as value. value may be a pointer, in which case the type it
+// points to is used. For example:
+//
+//	tr, err := NewTypedReader(rd, bpfEvent{})
+//
+// The type must either have a fixed size as determined by binary.Size, or
+// implement encoding.BinaryUnmarshaler via a pointer receiver.
+//
+// The TypedReader takes ownership of rd.
+func NewTypedReader(rd *Reader, value interface{}) (*TypedReader, error) {
+	typ := reflect.TypeOf(value)
+	if typ == nil {
+		return nil, errors.New("value can't be nil")
+	}
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+
+	tr := &TypedReader{rd: rd, typ: typ, size: -1}
+
+	ptr := reflect.New(typ).Interface()
+	if _, ok := ptr.(encoding.BinaryUnmarshaler); ok {
+		return tr, nil
+	}
+
+	tr.size = binary.Size(ptr)
+	if tr.size <= 0 {
+		return nil, fmt.Errorf("%s doesn't have a fixed size", typ)
+	}
+
+	tr.direct = tr.size == int(typ.Size()) && hasPlainLayout(typ)
+	return tr, nil
+}
+
+// hasPlainLayout returns true if any sequence of bytes is a valid in-memory
+// representation of typ.
+func hasPlainLayout(typ reflect.Type) bool {
+	switch typ.Kind() {
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+
+	case reflect.Array:
+		return hasPlainLayout(typ.Elem())
+
+	case reflect.Struct:
+		for i := 0; i < typ.NumField(); i++ {
+			if !hasPlainLayout(typ.Field(i).Type) {
+				return false
+			}
+		}
+		return true
+
+	default:
+		return false
+	}
+}
+
+// Read the next record and decode it into out, which must be a pointer to
+// the type given to NewTypedReader.
+//
+// Returns an *ebpf.DecodeError if the record doesn't have the size of an
+// encoded value.
+// Otherwise, errors are the same as for Reader.Read, for example ErrClosed
+// after Close has been called.
+func (tr *TypedReader) Read(out interface{}) error {
+	if reflect.TypeOf(out) != reflect.PtrTo(tr.typ) {
+		return fmt.Errorf("can't decode into %T: require *%s", out, tr.typ)
+	}
+	if reflect.ValueOf(out).IsNil() {
+		return fmt.Errorf("can't decode into nil %T", out)
+	}
+
+	if err := tr.rd.ReadInto(&tr.rec); err != nil {
+		return err
+	}
+
+	sample := tr.rec.RawSample
+	if tr.size == -1 {
+		return out.(encoding.BinaryUnmarshaler).UnmarshalBinary(sample)
+	}
+
+	if len(sample) != tr.size {
+		return internal.NewDecodeError(tr.typ, len(sample))
+	}
+
+	if tr.direct {
+		dst := unsafe.Slice((*byte)(unsafe.Pointer(reflect.ValueOf(out).Pointer())), tr.size)
+		copy(dst, sample)
+		return nil
+	}
+
+	if err := binary.Read(bytes.NewReader(sample), internal.NativeEndian, out); err != nil {
+		return fmt.Errorf("decoding %s: %w", tr.typ, err)
+	}
+	return nil
+}
+
+// Close frees resources used by the underlying Reader.
+//
+// It interrupts calls to Read.
+func (tr *TypedReader) Close() error {
+	return tr.rd.Close()
+}
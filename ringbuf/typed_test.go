@@ -0,0 +1,105 @@
+package ringbuf
+
+import (
+	"errors"
+	"syscall"
+	"testing"
+
+	"github.com/cilium/ebpf/internal"
+	"github.com/cilium/ebpf/internal/testutils"
+	"github.com/google/go-cmp/cmp"
+)
+
+func TestTypedReader(t *testing.T) {
+	testutils.SkipOnOldKernel(t, "5.8", "BPF ring buffer")
+
+	// Samples consist of the repeating pattern 1, 2, 3, 4, 4, 3, 2, 1.
+	type direct struct {
+		A, B uint32
+	}
+
+	// binary.Size is smaller than the in-memory size due to padding.
+	type padded struct {
+		A uint32
+		B uint8
+	}
+
+	tests := []struct {
+		name   string
+		size   int
+		value  interface{}
+		out    func() interface{}
+		want   interface{}
+		direct bool
+	}{
+		{
+			name:   "direct",
+			size:   8,
+			value:  direct{},
+			out:    func() interface{} { return new(direct) },
+			want:   &direct{internal.NativeEndian.Uint32([]byte{1, 2, 3, 4}), internal.NativeEndian.Uint32([]byte{4, 3, 2, 1})},
+			direct: true,
+		},
+		{
+			name:  "padded",
+			size:  5,
+			value: (*padded)(nil),
+			out:   func() interface{} { return new(padded) },
+			want:  &padded{internal.NativeEndian.Uint32([]byte{1, 2, 3, 4}), 4},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prog, events := mustOutputSamplesProg(t, 0, tt.size)
+
+			rd, err := NewReader(events)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			tr, err := NewTypedReader(rd, tt.value)
+			if err != nil {
+				rd.Close()
+				t.Fatal(err)
+			}
+			defer tr.Close()
+
+			if tr.direct != tt.direct {
+				t.Errorf("Expected direct decoding to be %t", tt.direct)
+			}
+
+			ret, _, err := prog.Test(make([]byte, 14))
+			testutils.SkipIfNotSupported(t, err)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if errno := syscall.Errno(-int32(ret)); errno != 0 {
+				t.Fatal("Expected 0 as return value, got", errno)
+			}
+
+			if err := tr.Read(new(uint64)); err == nil {
+				t.Error("Read accepts a pointer to a different type")
+			}
+
+			out := tt.out()
+			if err := tr.Read(out); err != nil {
+				t.Fatal("Can't read value:", err)
+			}
+
+			if diff := cmp.Diff(tt.want, out); diff != "" {
+				t.Errorf("Decoded value mismatch (-want +got):\n%s", diff)
+			}
+
+			tr.Close()
+			if err := tr.Read(tt.out()); !errors.Is(err, ErrClosed) {
+				t.Error("Read on a closed TypedReader doesn't return ErrClosed, got", err)
+			}
+		})
+	}
+
+	if _, err := NewTypedReader(nil, []byte{}); err == nil {
+		t.Error("NewTypedReader accepts a type without fixed size")
+	}
+}
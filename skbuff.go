@@ -0,0 +1,100 @@
+package ebpf
+
+import (
+	"fmt"
+
+	"github.com/cilium/ebpf/internal"
+)
+
+// Return values of CGroupSKB programs.
+//
+// The kernel only looks at the lowest two bits. Packets are dropped unless
+// CGroupSKBAllow is set. On egress, CGroupSKBCongestion may be set in
+// addition to signal congestion to the TCP stack, which then reduces its
+// sending rate.
+const (
+	CGroupSKBDrop       uint32 = 0
+	CGroupSKBAllow      uint32 = 1
+	CGroupSKBCongestion uint32 = 2
+)
+
+// Offsets of fields in struct __sk_buff.
+const (
+	skBuffMarkOffset           = 8
+	skBuffPriorityOffset       = 32
+	skBuffIngressIfindexOffset = 36
+	skBuffIfindexOffset        = 40
+	skBuffCbOffset             = 48
+	skBuffTstampOffset         = 152
+	skBuffWireLenOffset        = 160
+	skBuffGsoSegsOffset        = 164
+	skBuffGsoSizeOffset        = 176
+	// Size of struct __sk_buff as of Linux 5.16.
+	skBuffSize = 192
+)
+
+// ethernetHeaderSize is the minimum length of packets passed to test runs of
+// SKB programs.
+const ethernetHeaderSize = 14
+
+// SkBuffOptions are the fields of struct __sk_buff which the kernel allows
+// to set for test runs. All other fields are derived from the packet.
+type SkBuffOptions struct {
+	Mark           uint32
+	Priority       uint32
+	IngressIfindex uint32
+	// Must be the index of an existing interface if it is larger than 1.
+	Ifindex uint32
+	// Control block, freely usable by programs.
+	Cb     [5]uint32
+	Tstamp uint64
+	// Length of the packet on the wire, which must not be smaller than the
+	// packet. Zero uses the length of the packet.
+	WireLen uint32
+	GsoSegs uint32
+	GsoSize uint32
+}
+
+// MakeSkBuff returns a struct __sk_buff for running an SKB program such as
+// CGroupSKB or SchedCLS with the packet data, for use as RunOptions.Context:
+//
+//	ctx, err := MakeSkBuff(packet, SkBuffOptions{Mark: 42})
+//	ret, err := prog.Run(&RunOptions{Data: packet, Context: ctx})
+//	if ret&CGroupSKBAllow == 0 {
+//		// The packet was dropped.
+//	}
+//
+// data must start with an ethernet header. Returns an error if it is too
+// short or doesn't fit into opts.WireLen.
+//
+// Passing a context to SKB programs requires Linux 5.2. Support for the
+// fields was added over several releases, and kernels reject non-zero values
+// for fields they don't support.
+func MakeSkBuff(data []byte, opts SkBuffOptions) ([]byte, error) {
+	if len(data) < ethernetHeaderSize {
+		return nil, fmt.Errorf("packet of %d bytes is shorter than an ethernet header", len(data))
+	}
+
+	if opts.WireLen != 0 && int(opts.WireLen) < len(data) {
+		return nil, fmt.Errorf("wire length %d is shorter than packet of %d bytes", opts.WireLen, len(data))
+	}
+
+	buf := make([]byte, skBuffSize)
+	put32 := func(offset int, value uint32) {
+		internal.NativeEndian.PutUint32(buf[offset:], value)
+	}
+
+	put32(skBuffMarkOffset, opts.Mark)
+	put32(skBuffPriorityOffset, opts.Priority)
+	put32(skBuffIngressIfindexOffset, opts.IngressIfindex)
+	put32(skBuffIfindexOffset, opts.Ifindex)
+	for i, cb := range opts.Cb {
+		put32(skBuffCbOffset+4*i, cb)
+	}
+	internal.NativeEndian.PutUint64(buf[skBuffTstampOffset:], opts.Tstamp)
+	put32(skBuffWireLenOffset, opts.WireLen)
+	put32(skBuffGsoSegsOffset, opts.GsoSegs)
+	put32(skBuffGsoSizeOffset, opts.GsoSize)
+
+	return buf, nil
+}
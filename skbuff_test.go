@@ -0,0 +1,70 @@
+package ebpf
+
+import (
+	"testing"
+
+	"github.com/cilium/ebpf/asm"
+	"github.com/cilium/ebpf/internal"
+	"github.com/cilium/ebpf/internal/testutils"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestMakeSkBuff(t *testing.T) {
+	_, err := MakeSkBuff(make([]byte, 13), SkBuffOptions{})
+	qt.Assert(t, err, qt.IsNotNil)
+
+	_, err = MakeSkBuff(make([]byte, 20), SkBuffOptions{WireLen: 19})
+	qt.Assert(t, err, qt.IsNotNil)
+
+	ctx, err := MakeSkBuff(make([]byte, 14), SkBuffOptions{Mark: 1, Cb: [5]uint32{0, 0, 0, 0, 2}, WireLen: 100})
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, ctx, qt.HasLen, skBuffSize)
+	qt.Assert(t, internal.NativeEndian.Uint32(ctx[skBuffMarkOffset:]), qt.Equals, uint32(1))
+	qt.Assert(t, internal.NativeEndian.Uint32(ctx[skBuffCbOffset+16:]), qt.Equals, uint32(2))
+	qt.Assert(t, internal.NativeEndian.Uint32(ctx[skBuffWireLenOffset:]), qt.Equals, uint32(100))
+}
+
+func TestMakeSkBuffVerdict(t *testing.T) {
+	testutils.SkipOnOldKernel(t, "5.2", "__sk_buff context for test runs")
+
+	// Allow packets with mark 42.
+	prog, err := NewProgram(&ProgramSpec{
+		Type:       CGroupSKB,
+		AttachType: AttachCGroupInetIngress,
+		License:    "MIT",
+		Instructions: asm.Instructions{
+			asm.LoadMem(asm.R2, asm.R1, skBuffMarkOffset, asm.Word),
+			asm.Mov.Imm(asm.R0, int32(CGroupSKBDrop)),
+			asm.JNE.Imm(asm.R2, 42, "exit"),
+			asm.Mov.Imm(asm.R0, int32(CGroupSKBAllow)),
+			asm.Return().WithSymbol("exit"),
+		},
+	})
+	qt.Assert(t, err, qt.IsNil)
+	defer prog.Close()
+
+	packet := make([]byte, 64)
+	for _, test := range []struct {
+		mark uint32
+		want uint32
+	}{
+		{42, CGroupSKBAllow},
+		{1, CGroupSKBDrop},
+	} {
+		ctx, err := MakeSkBuff(packet, SkBuffOptions{Mark: test.mark, Cb: [5]uint32{1, 2, 3, 4, 5}, Priority: 3, Tstamp: 7, WireLen: 100, GsoSegs: 2, GsoSize: 9})
+		qt.Assert(t, err, qt.IsNil)
+
+		ctxOut := make([]byte, len(ctx))
+		ret, err := prog.Run(&RunOptions{Data: packet, Context: ctx, ContextOut: ctxOut})
+		testutils.SkipIfNotSupported(t, err)
+		qt.Assert(t, err, qt.IsNil)
+		qt.Assert(t, ret, qt.Equals, test.want, qt.Commentf("mark %d", test.mark))
+
+		// The kernel copies the fields back, except for ifindex which it
+		// sets to the loopback interface.
+		for _, offset := range []int{skBuffPriorityOffset, skBuffCbOffset + 16, skBuffTstampOffset, skBuffWireLenOffset, skBuffGsoSegsOffset, skBuffGsoSizeOffset} {
+			qt.Assert(t, ctxOut[offset:offset+4], qt.DeepEquals, ctx[offset:offset+4], qt.Commentf("offset %d", offset))
+		}
+	}
+}
@@ -0,0 +1,225 @@
+package ebpf
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/cilium/ebpf/internal"
+	"github.com/cilium/ebpf/internal/unix"
+)
+
+// ProgramStats is a sample of the run time statistics of a program, taken by
+// a StatsCollector.
+type ProgramStats struct {
+	// Time at which the sample was taken.
+	Time time.Time
+
+	// Total run time and number of runs of the program while statistics
+	// were enabled, as reported by the kernel.
+	Runtime  time.Duration
+	RunCount uint64
+
+	// Time since the previous sample, and the run time and number of runs
+	// of the program during it. Zero for the first sample, and if the totals
+	// are lower than those of the previous sample.
+	//
+	// The kernel doesn't allow resetting the totals, so these are computed
+	// from the difference to the previous sample.
+	Interval         time.Duration
+	IntervalRuntime  time.Duration
+	IntervalRunCount uint64
+}
+
+// AverageRuntime returns the average run time per invocation of the program
+// during the last interval, or zero if it didn't run.
+func (ps ProgramStats) AverageRuntime() time.Duration {
+	if ps.IntervalRunCount == 0 {
+		return 0
+	}
+	return ps.IntervalRuntime / time.Duration(ps.IntervalRunCount)
+}
+
+// RunRate returns the number of invocations per second of the program
+// during the last interval, or zero for the first sample.
+func (ps ProgramStats) RunRate() float64 {
+	if ps.Interval <= 0 {
+		return 0
+	}
+	return float64(ps.IntervalRunCount) / ps.Interval.Seconds()
+}
+
+// StatsCollector periodically samples the run time statistics of a set of
+// programs.
+//
+// It enables the collection of statistics in the kernel for as long as it
+// is open, see EnableStats.
+type StatsCollector struct {
+	progs map[string]*Program
+	stats io.Closer
+
+	// Serialises Sample, so that samples are applied in the order they
+	// are taken.
+	sampleMu sync.Mutex
+
+	mu   sync.Mutex
+	last map[string]ProgramStats
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// NewStatsCollector starts collecting statistics of progs, keyed by an
+// arbitrary name.
+//
+// The programs are sampled once immediately, and then every interval. An
+// interval of zero disables sampling in the background, in which case the
+// caller must invoke Sample.
+//
+// The collector doesn't take ownership of progs, which must stay open until
+// the collector is closed.
+//
+// Requires at least 5.8.
+func NewStatsCollector(progs map[string]*Program, interval time.Duration) (*StatsCollector, error) {
+	if interval < 0 {
+		return nil, fmt.Errorf("invalid interval %s", interval)
+	}
+
+	stats, err := EnableStats(uint32(unix.BPF_STATS_RUN_TIME))
+	if err != nil {
+		return nil, fmt.Errorf("enable stats: %w", err)
+	}
+
+	sc := &StatsCollector{
+		progs: make(map[string]*Program, len(progs)),
+		stats: stats,
+		last:  make(map[string]ProgramStats, len(progs)),
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	for name, prog := range progs {
+		sc.progs[name] = prog
+	}
+
+	if err := sc.Sample(); err != nil {
+		stats.Close()
+		return nil, err
+	}
+
+	if interval == 0 {
+		close(sc.done)
+		return sc, nil
+	}
+
+	go sc.run(interval)
+	return sc, nil
+}
+
+func (sc *StatsCollector) run(interval time.Duration) {
+	defer close(sc.done)
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			// Errors are transient, since the programs are kept open.
+			// The previous sample is retained.
+			_ = sc.Sample()
+		case <-sc.stop:
+			return
+		}
+	}
+}
+
+// Sample the statistics of all programs.
+//
+// Returns an error if the statistics of any program can't be read, in which
+// case the previous sample of that program is retained.
+func (sc *StatsCollector) Sample() error {
+	sc.sampleMu.Lock()
+	defer sc.sampleMu.Unlock()
+
+	var firstErr error
+	for name, prog := range sc.progs {
+		if err := sc.sample(name, prog); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("program %s: %w", name, err)
+		}
+	}
+	return firstErr
+}
+
+func (sc *StatsCollector) sample(name string, prog *Program) error {
+	info, err := prog.Info()
+	if err != nil {
+		return err
+	}
+
+	rt, ok := info.Runtime()
+	if !ok {
+		return fmt.Errorf("run time: %w", ErrNotSupported)
+	}
+
+	count, ok := info.RunCount()
+	if !ok {
+		return fmt.Errorf("run count: %w", ErrNotSupported)
+	}
+
+	now := internal.Now()
+
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	prev, ok := sc.last[name]
+	sc.last[name] = nextProgramStats(prev, ok, now, rt, count)
+	return nil
+}
+
+// nextProgramStats returns the sample following prev, if havePrev is true.
+func nextProgramStats(prev ProgramStats, havePrev bool, now time.Time, rt time.Duration, count uint64) ProgramStats {
+	cur := ProgramStats{
+		Time:     now,
+		Runtime:  rt,
+		RunCount: count,
+	}
+
+	// Don't compute intervals from totals which went backwards, the
+	// subtraction would underflow.
+	if havePrev && count >= prev.RunCount && rt >= prev.Runtime {
+		cur.Interval = now.Sub(prev.Time)
+		cur.IntervalRuntime = rt - prev.Runtime
+		cur.IntervalRunCount = count - prev.RunCount
+	}
+
+	return cur
+}
+
+// Snapshot returns the most recent sample of each program, keyed by the
+// name given to NewStatsCollector.
+func (sc *StatsCollector) Snapshot() map[string]ProgramStats {
+	sc.mu.Lock()
+	defer sc.mu.Unlock()
+
+	snapshot := make(map[string]ProgramStats, len(sc.last))
+	for name, stats := range sc.last {
+		snapshot[name] = stats
+	}
+	return snapshot
+}
+
+// Close stops sampling and disables the collection of statistics, unless
+// statistics are enabled elsewhere.
+func (sc *StatsCollector) Close() error {
+	select {
+	case <-sc.stop:
+		return errors.New("stats collector already closed")
+	default:
+		close(sc.stop)
+	}
+
+	<-sc.done
+	return sc.stats.Close()
+}
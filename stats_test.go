@@ -0,0 +1,78 @@
+package ebpf
+
+import (
+	"testing"
+	"time"
+
+	"github.com/cilium/ebpf/internal/testutils"
+	qt "github.com/frankban/quicktest"
+)
+
+func TestStatsCollector(t *testing.T) {
+	testutils.SkipOnOldKernel(t, "5.8", "BPF_ENABLE_STATS")
+	testutils.StubClock(t, testutils.FixedClock(time.Unix(0, 0), time.Second))
+
+	prog := mustSocketFilter(t)
+
+	sc, err := NewStatsCollector(map[string]*Program{"filter": prog}, 0)
+	qt.Assert(t, err, qt.IsNil)
+	defer sc.Close()
+
+	first := sc.Snapshot()["filter"]
+	qt.Assert(t, first.Time, qt.Equals, time.Unix(0, 0))
+	qt.Assert(t, first.Interval, qt.Equals, time.Duration(0))
+	qt.Assert(t, first.RunRate(), qt.Equals, 0.0)
+
+	// Test may run the program more than once, see testStats.
+	_, _, err = prog.Test(make([]byte, 14))
+	qt.Assert(t, err, qt.IsNil)
+
+	qt.Assert(t, sc.Sample(), qt.IsNil)
+
+	second := sc.Snapshot()["filter"]
+	qt.Assert(t, second.Interval, qt.Equals, time.Second)
+	qt.Assert(t, second.IntervalRunCount >= 1, qt.IsTrue)
+	qt.Assert(t, second.RunCount, qt.Equals, first.RunCount+second.IntervalRunCount)
+	qt.Assert(t, second.IntervalRuntime > 0, qt.IsTrue)
+	qt.Assert(t, second.AverageRuntime(), qt.Equals, second.IntervalRuntime/time.Duration(second.IntervalRunCount))
+	qt.Assert(t, second.RunRate(), qt.Equals, float64(second.IntervalRunCount))
+
+	qt.Assert(t, sc.Close(), qt.IsNil)
+	qt.Assert(t, sc.Close(), qt.IsNotNil)
+}
+
+func TestStatsCollectorInterval(t *testing.T) {
+	testutils.SkipOnOldKernel(t, "5.8", "BPF_ENABLE_STATS")
+
+	prog := mustSocketFilter(t)
+
+	sc, err := NewStatsCollector(map[string]*Program{"filter": prog}, time.Millisecond)
+	qt.Assert(t, err, qt.IsNil)
+
+	first := sc.Snapshot()["filter"].Time
+	deadline := time.Now().Add(time.Second)
+	for sc.Snapshot()["filter"].Time == first {
+		if time.Now().After(deadline) {
+			t.Fatal("No sample taken in the background")
+		}
+		time.Sleep(time.Millisecond)
+	}
+
+	qt.Assert(t, sc.Close(), qt.IsNil)
+}
+
+func TestNextProgramStats(t *testing.T) {
+	start := time.Unix(0, 0)
+
+	first := nextProgramStats(ProgramStats{}, false, start, time.Second, 10)
+	qt.Assert(t, first, qt.Equals, ProgramStats{Time: start, Runtime: time.Second, RunCount: 10})
+
+	second := nextProgramStats(first, true, start.Add(time.Second), 3*time.Second, 12)
+	qt.Assert(t, second.Interval, qt.Equals, time.Second)
+	qt.Assert(t, second.IntervalRuntime, qt.Equals, 2*time.Second)
+	qt.Assert(t, second.IntervalRunCount, qt.Equals, uint64(2))
+
+	// Totals lower than the previous ones don't underflow.
+	third := nextProgramStats(second, true, start.Add(2*time.Second), 2*time.Second, 11)
+	qt.Assert(t, third, qt.Equals, ProgramStats{Time: start.Add(2 * time.Second), Runtime: 2 * time.Second, RunCount: 11})
+}
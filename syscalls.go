@@ -11,6 +11,60 @@ import (
 	"github.com/cilium/ebpf/internal/unix"
 )
 
+// ErrSyscallsDisabled is returned by all operations which need the bpf()
+// syscall after a call to DisableSyscalls.
+var ErrSyscallsDisabled = sys.ErrSyscallsDisabled
+
+// DisableSyscalls prevents the library from invoking the bpf() syscall for the
+// remainder of the process' lifetime. Subsequent operations which need it
+// return an error wrapping ErrSyscallsDisabled.
+//
+// This is intended for processes which set up all of their eBPF objects at
+// startup and then drop privileges, for example by installing a seccomp
+// filter. It doesn't restrict the process by itself.
+//
+// The following keeps working after DisableSyscalls:
+//   - Reading from perf.Reader and ringbuf.Reader instances created before
+//     the call, as long as they aren't paused or resumed.
+//   - Closing maps, programs and links, with the exception of links which
+//     detach via the bpf() syscall, like those created by RawAttachProgram.
+//   - Reading the contents of memory mapped arrays via Map.Memory.
+//
+// Everything else, including map lookups and updates, program and map
+// creation and object info queries, fails.
+func DisableSyscalls() {
+	sys.DisableSyscalls()
+}
+
+// SetFinalizerWarnings enables or disables logging a warning when a Map,
+// Program, Link or reader from the perf and ringbuf packages is garbage
+// collected without being closed. The warning includes the stack at which the
+// object was created, which helps to find a missing call to Close.
+//
+// This is a debugging aid and is disabled by default because recording
+// creation stacks is expensive. Only objects created while warnings are
+// enabled are tracked. Warnings are written using the log package.
+func SetFinalizerWarnings(enabled bool) {
+	sys.SetLeakWarnings(enabled)
+}
+
+// StackTraceError is an error annotated with the stack at which it was
+// returned, see SetErrorStackTraces. Use errors.As to retrieve it, and
+// Frames to inspect the stack. Formatting it with %+v includes the stack.
+type StackTraceError = internal.StackTraceError
+
+// SetErrorStackTraces enables or disables annotating errors with a
+// StackTraceError. This covers errors returned when creating maps, loading
+// programs and collections, and attaching programs using the link package.
+//
+// The stack is that of the innermost of these functions which failed, which
+// helps to find out which step of a multi-step setup failed. This is a
+// debugging aid and is disabled by default. While disabled, the cost is a
+// single atomic load per call.
+func SetErrorStackTraces(enabled bool) {
+	internal.SetErrorStackTraces(enabled)
+}
+
 // invalidBPFObjNameChar returns true if char may not appear in
 // a BPF object name.
 func invalidBPFObjNameChar(char rune) bool {
@@ -262,3 +316,17 @@ var haveBPFToBPFCalls = internal.FeatureTest("bpf2bpf calls", "4.16", func() err
 	_ = fd.Close()
 	return nil
 })
+
+var haveBPFToken = internal.FeatureTest("BPF token", "6.9", func() error {
+	_, err := sys.TokenCreate(&sys.TokenCreateAttr{
+		// Invalid file descriptor.
+		BpffsFd: ^uint32(0),
+	})
+	if errors.Is(err, unix.EINVAL) {
+		return internal.ErrNotSupported
+	}
+	if errors.Is(err, unix.EBADF) {
+		return nil
+	}
+	return err
+})
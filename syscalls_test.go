@@ -1,10 +1,13 @@
 package ebpf
 
 import (
+	"errors"
 	"strings"
 	"testing"
 
 	"github.com/cilium/ebpf/internal/testutils"
+
+	qt "github.com/frankban/quicktest"
 )
 
 func TestObjNameCharacters(t *testing.T) {
@@ -58,3 +61,21 @@ func TestHaveProbeReadKernel(t *testing.T) {
 func TestHaveBPFToBPFCalls(t *testing.T) {
 	testutils.CheckFeatureTest(t, haveBPFToBPFCalls)
 }
+
+func TestHaveBPFToken(t *testing.T) {
+	testutils.CheckFeatureTest(t, haveBPFToken)
+}
+
+func TestSetErrorStackTraces(t *testing.T) {
+	SetErrorStackTraces(true)
+	defer SetErrorStackTraces(false)
+
+	_, err := NewMap(&MapSpec{Type: Hash, KeySize: 4, ValueSize: 4})
+	qt.Assert(t, err, qt.IsNotNil)
+
+	var ste *StackTraceError
+	qt.Assert(t, errors.As(err, &ste), qt.IsTrue)
+
+	frame, _ := ste.Frames().Next()
+	qt.Assert(t, frame.Function, qt.Equals, "github.com/cilium/ebpf.NewMapWithOptions")
+}
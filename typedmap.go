@@ -0,0 +1,210 @@
+package ebpf
+
+import (
+	"encoding"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"reflect"
+)
+
+// TypedMap accesses a Map using fixed key and value types, for example for a
+// map opened from a pin for which no bpf2go types are available.
+//
+// The types are determined by the values passed to NewTypedMap. The methods
+// only accept keys and values of these types, which is checked at runtime
+// since the package supports Go versions without type parameters.
+type TypedMap struct {
+	m         *Map
+	keyType   reflect.Type
+	valueType reflect.Type
+}
+
+// NewTypedMap creates a TypedMap for m, using the types of key and value.
+// Either may be a pointer, in which case the type it points to is used.
+// For example:
+//
+//	tm, err := NewTypedMap(m, uint32(0), bpfFlow{})
+//
+// For maps with per-CPU values, value is the type of the value of a single
+// CPU. Values are then passed as a slice of that type, see Map.Lookup.
+//
+// Returns an error if the encoded size of a type doesn't match the key or
+// value size of the map. The size of types implementing
+// encoding.BinaryMarshaler isn't checked.
+//
+// The TypedMap doesn't take ownership of m.
+func NewTypedMap(m *Map, key, value interface{}) (*TypedMap, error) {
+	keyType, err := typedMapType(key, m.KeySize())
+	if err != nil {
+		return nil, fmt.Errorf("key: %w", err)
+	}
+
+	valueType, err := typedMapType(value, m.ValueSize())
+	if err != nil {
+		return nil, fmt.Errorf("value: %w", err)
+	}
+
+	return &TypedMap{m, keyType, valueType}, nil
+}
+
+// typedMapType returns the type of v after checking that its encoding is size
+// bytes long.
+func typedMapType(v interface{}, size uint32) (reflect.Type, error) {
+	typ := reflect.TypeOf(v)
+	if typ == nil {
+		return nil, errors.New("type can't be nil")
+	}
+	if typ.Kind() == reflect.Ptr {
+		typ = typ.Elem()
+	}
+
+	ptr := reflect.New(typ).Interface()
+	if _, ok := ptr.(encoding.BinaryMarshaler); ok {
+		return typ, nil
+	}
+
+	n := binary.Size(ptr)
+	if n < 0 {
+		return nil, fmt.Errorf("%s doesn't have a fixed size", typ)
+	}
+	if uint32(n) != size {
+		return nil, fmt.Errorf("%s has %d bytes instead of %d", typ, n, size)
+	}
+
+	return typ, nil
+}
+
+// Map returns the underlying Map.
+func (tm *TypedMap) Map() *Map {
+	return tm.m
+}
+
+// Lookup retrieves the value of key into valueOut, see Map.Lookup.
+//
+// key must be of the key type or a pointer to it. valueOut must be a pointer
+// to the value type, or to a slice of it for maps with per-CPU values.
+func (tm *TypedMap) Lookup(key, valueOut interface{}) error {
+	if err := tm.checkKey(key); err != nil {
+		return err
+	}
+	if err := tm.checkValueOut(valueOut); err != nil {
+		return err
+	}
+
+	return tm.m.Lookup(key, valueOut)
+}
+
+// Update sets the value of key, see Map.Update.
+//
+// value must be of the value type or a pointer to it, or a slice of it for
+// maps with per-CPU values.
+func (tm *TypedMap) Update(key, value interface{}, flags MapUpdateFlags) error {
+	if err := tm.checkKey(key); err != nil {
+		return err
+	}
+	if err := tm.checkValue(value); err != nil {
+		return err
+	}
+
+	return tm.m.Update(key, value, flags)
+}
+
+// Delete removes key, see Map.Delete.
+func (tm *TypedMap) Delete(key interface{}) error {
+	if err := tm.checkKey(key); err != nil {
+		return err
+	}
+
+	return tm.m.Delete(key)
+}
+
+// Iterate traverses the map, see Map.Iterate.
+func (tm *TypedMap) Iterate() *TypedMapIterator {
+	return &TypedMapIterator{tm, tm.m.Iterate(), nil}
+}
+
+func (tm *TypedMap) checkKey(key interface{}) error {
+	typ := reflect.TypeOf(key)
+	if typ != tm.keyType && typ != reflect.PtrTo(tm.keyType) {
+		return fmt.Errorf("key %T: require %s", key, tm.keyType)
+	}
+	return nil
+}
+
+func (tm *TypedMap) checkKeyOut(keyOut interface{}) error {
+	if reflect.TypeOf(keyOut) != reflect.PtrTo(tm.keyType) {
+		return fmt.Errorf("can't decode key into %T: require *%s", keyOut, tm.keyType)
+	}
+	return checkNotNil(keyOut)
+}
+
+func (tm *TypedMap) checkValue(value interface{}) error {
+	typ := reflect.TypeOf(value)
+	if tm.m.Type().hasPerCPUValue() {
+		if typ != reflect.SliceOf(tm.valueType) {
+			return fmt.Errorf("value %T: require []%s", value, tm.valueType)
+		}
+		return nil
+	}
+
+	if typ != tm.valueType && typ != reflect.PtrTo(tm.valueType) {
+		return fmt.Errorf("value %T: require %s", value, tm.valueType)
+	}
+	return nil
+}
+
+func (tm *TypedMap) checkValueOut(valueOut interface{}) error {
+	want := reflect.PtrTo(tm.valueType)
+	if tm.m.Type().hasPerCPUValue() {
+		want = reflect.PtrTo(reflect.SliceOf(tm.valueType))
+	}
+
+	if reflect.TypeOf(valueOut) != want {
+		return fmt.Errorf("can't decode value into %T: require %s", valueOut, want)
+	}
+	return checkNotNil(valueOut)
+}
+
+func checkNotNil(ptr interface{}) error {
+	if reflect.ValueOf(ptr).IsNil() {
+		return fmt.Errorf("can't decode into nil %T", ptr)
+	}
+	return nil
+}
+
+// TypedMapIterator iterates a TypedMap.
+//
+// See TypedMap.Iterate.
+type TypedMapIterator struct {
+	tm  *TypedMap
+	it  *MapIterator
+	err error
+}
+
+// Next decodes the next key and value into keyOut and valueOut, which must be
+// pointers to the key and value types. See MapIterator.Next.
+func (ti *TypedMapIterator) Next(keyOut, valueOut interface{}) bool {
+	if ti.err != nil {
+		return false
+	}
+
+	if ti.err = ti.tm.checkKeyOut(keyOut); ti.err != nil {
+		return false
+	}
+	if ti.err = ti.tm.checkValueOut(valueOut); ti.err != nil {
+		return false
+	}
+
+	return ti.it.Next(keyOut, valueOut)
+}
+
+// Err returns any encountered error.
+//
+// The method must be called after Next returns false.
+func (ti *TypedMapIterator) Err() error {
+	if ti.err != nil {
+		return ti.err
+	}
+	return ti.it.Err()
+}
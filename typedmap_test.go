@@ -0,0 +1,99 @@
+package ebpf
+
+import (
+	"testing"
+
+	"github.com/cilium/ebpf/internal"
+
+	qt "github.com/frankban/quicktest"
+)
+
+func TestTypedMap(t *testing.T) {
+	type key struct {
+		Addr uint32
+		Port uint16
+		_    uint16
+	}
+	type value struct {
+		Packets, Bytes uint64
+	}
+
+	m, err := NewMap(&MapSpec{
+		Type:       Hash,
+		KeySize:    8,
+		ValueSize:  16,
+		MaxEntries: 2,
+	})
+	qt.Assert(t, err, qt.IsNil)
+	defer m.Close()
+
+	_, err = NewTypedMap(m, uint32(0), value{})
+	qt.Assert(t, err, qt.ErrorMatches, "key: .* has 4 bytes instead of 8")
+	_, err = NewTypedMap(m, key{}, []byte(nil))
+	qt.Assert(t, err, qt.IsNotNil)
+
+	tm, err := NewTypedMap(m, &key{}, value{})
+	qt.Assert(t, err, qt.IsNil)
+	qt.Assert(t, tm.Map(), qt.Equals, m)
+
+	k := key{Addr: 1, Port: 80}
+	qt.Assert(t, tm.Update(k, value{1, 2}, UpdateAny), qt.IsNil)
+	qt.Assert(t, tm.Update(&k, &value{3, 4}, UpdateExist), qt.IsNil)
+	qt.Assert(t, tm.Update(uint64(0), value{}, UpdateAny), qt.IsNotNil)
+	qt.Assert(t, tm.Update(k, uint64(0), UpdateAny), qt.IsNotNil)
+
+	var v value
+	qt.Assert(t, tm.Lookup(k, &v), qt.IsNil)
+	qt.Assert(t, v, qt.Equals, value{3, 4})
+	qt.Assert(t, tm.Lookup(k, v), qt.IsNotNil)
+	qt.Assert(t, tm.Lookup(k, (*value)(nil)), qt.IsNotNil)
+	qt.Assert(t, tm.Lookup(k, new([]byte)), qt.IsNotNil)
+
+	var (
+		gotKey key
+		n      int
+	)
+	entries := tm.Iterate()
+	for entries.Next(&gotKey, &v) {
+		qt.Assert(t, gotKey, qt.Equals, k)
+		qt.Assert(t, v, qt.Equals, value{3, 4})
+		n++
+	}
+	qt.Assert(t, entries.Err(), qt.IsNil)
+	qt.Assert(t, n, qt.Equals, 1)
+
+	entries = tm.Iterate()
+	qt.Assert(t, entries.Next(new(uint64), &v), qt.IsFalse)
+	qt.Assert(t, entries.Err(), qt.IsNotNil)
+
+	qt.Assert(t, tm.Delete(uint32(0)), qt.IsNotNil)
+	qt.Assert(t, tm.Delete(&k), qt.IsNil)
+	qt.Assert(t, tm.Lookup(k, &v), qt.ErrorIs, ErrKeyNotExist)
+}
+
+func TestTypedMapPerCPU(t *testing.T) {
+	m, err := NewMap(&MapSpec{
+		Type:       PerCPUArray,
+		KeySize:    4,
+		ValueSize:  8,
+		MaxEntries: 1,
+	})
+	qt.Assert(t, err, qt.IsNil)
+	defer m.Close()
+
+	tm, err := NewTypedMap(m, uint32(0), uint64(0))
+	qt.Assert(t, err, qt.IsNil)
+
+	cpus, err := internal.PossibleCPUs()
+	qt.Assert(t, err, qt.IsNil)
+
+	values := make([]uint64, cpus)
+	values[0] = 42
+	qt.Assert(t, tm.Update(uint32(0), values, UpdateAny), qt.IsNil)
+	qt.Assert(t, tm.Update(uint32(0), uint64(42), UpdateAny), qt.IsNotNil)
+
+	var got []uint64
+	qt.Assert(t, tm.Lookup(uint32(0), &got), qt.IsNil)
+	qt.Assert(t, got[0], qt.Equals, uint64(42))
+	qt.Assert(t, tm.Lookup(uint32(0), new(uint64)), qt.IsNotNil)
+}
@@ -99,6 +99,9 @@ const (
 	InodeStorage
 	// TaskStorage - Specialized local storage map for task_struct.
 	TaskStorage
+	// BloomFilter - Probabilistic set of values without keys. Lookups may
+	// return false positives, but never false negatives.
+	BloomFilter
 	// maxMapType - Bound enum of MapTypes, has to be last in enum.
 	maxMapType
 )
@@ -120,6 +123,30 @@ func (mt MapType) canStoreProgram() bool {
 	return mt == ProgramArray
 }
 
+// isArray returns true if the map type is backed by an array, whose size is
+// part of the template when used as an inner map.
+func (mt MapType) isArray() bool {
+	switch mt {
+	case Array, PerCPUArray, ProgramArray, PerfEventArray, CGroupArray, ArrayOfMaps:
+		return true
+	default:
+		return false
+	}
+}
+
+// hasEmptyArraySlots returns true if the map type is an array whose elements
+// can be deleted, leaving an empty slot. Iterating such a map returns every
+// index, whether the slot is empty or not.
+func (mt MapType) hasEmptyArraySlots() bool {
+	switch mt {
+	case ProgramArray, PerfEventArray, CGroupArray, ArrayOfMaps, DevMap, CPUMap,
+		XSKMap, SockMap, ReusePortSockArray:
+		return true
+	default:
+		return false
+	}
+}
+
 // hasBTF returns true if the map type supports BTF key/value metadata.
 func (mt MapType) hasBTF() bool {
 	switch mt {
@@ -229,6 +256,12 @@ const (
 	AttachSkReuseportSelect
 	AttachSkReuseportSelectOrMigrate
 	AttachPerfEvent
+	AttachTraceKprobeMulti
+	AttachLSMCgroup
+	AttachStructOps
+	AttachNetfilter
+	AttachTCXIngress
+	AttachTCXEgress
 )
 
 // AttachFlags of the eBPF program used in BPF_PROG_ATTACH command